@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"strings"
 
 	"github.com/kardianos/service"
 	"google.golang.org/grpc"
@@ -15,6 +16,43 @@ import (
 // Logger writes to the system log.
 var logger service.Logger
 
+// setFlags is the list of -set <Field>=<value> flags, they override the
+// fields of agent config.
+type setFlags []string
+
+func (flags *setFlags) String() string {
+	return strings.Join(*flags, ",")
+}
+
+func (flags *setFlags) Set(value string) error {
+	*flags = append(*flags, value)
+	return nil
+}
+
+// This function writes the info message to the system log if the LogLevel
+// of agent config allows it.
+func logInfof(format string, args ...interface{}) {
+	if agent.LogEnabled("info") {
+		logger.Infof(format, args...)
+	}
+}
+
+// This function writes the warning to the system log if the LogLevel of
+// agent config allows it.
+func logWarning(err error) {
+	if agent.LogEnabled("warning") {
+		logger.Warning(err)
+	}
+}
+
+// This function writes the error to the system log if the LogLevel of agent
+// config allows it.
+func logError(err error) {
+	if agent.LogEnabled("error") {
+		logger.Error(err)
+	}
+}
+
 // Program structures.
 // Define Start and Stop methods.
 type program struct {
@@ -27,9 +65,9 @@ func (p *program) Start(s service.Service) error {
 	// Interactive returns false if running under
 	// the windows OS service manager and true otherwise.
 	if service.Interactive() {
-		logger.Info("bkedr agent runs in terminal.")
+		logInfof("bkedr agent runs in terminal.")
 	} else {
-		logger.Info("bkedr agent runs under service manager.")
+		logInfof("bkedr agent runs under service manager.")
 	}
 	p.exit = make(chan struct{})
 
@@ -41,15 +79,65 @@ func (p *program) Start(s service.Service) error {
 // Execute kind of main function for the program
 func (p *program) run() error {
 
-	logger.Infof("bkedr agent is running %v.", service.Platform())
+	logInfof("bkedr agent is running %v.", service.Platform())
+
+	// Apply the config profile that the EDR server pushed before restart
+	if err := agent.LoadAgentProfile(); err != nil {
+		logWarning(err)
+	}
 
-	// Connect to EDR server
+	// Apply the isolation again if the host was isolated before restart
+	if err := agent.RestoreIsolation(); err != nil {
+		logError(err)
+	}
+
+	// Load the local policy, an invalid policy denies every action
+	if err := agent.LoadLocalPolicy(); err != nil {
+		logError(err)
+	}
+
+	// Load the local rules that are used when EDR server is unreachable
+	if err := agent.LoadLocalRules(); err != nil {
+		logError(err)
+	}
+
+	// Connect to EDR server. With local rules, the agent keeps running when
+	// EDR server is unreachable, the server dials it from its agent config.
 	if err := agent.RunSocketDial(); err != nil {
-		log.Fatal(err)
+		if !agent.LocalRulesEnabled() {
+			log.Fatal(err)
+		}
+		logWarning(err)
+	}
+
+	// Stream the events of agent to EDR server
+	if agent.TelemetryEnabled() {
+		go func() {
+			source, err := agent.NewEventSource()
+			if err != nil {
+				logError(err)
+				return
+			}
+			logInfof("bkedr agent streams events of %s.", source.Name())
+			if err := agent.RunTelemetry(source, logError); err != nil {
+				logError(err)
+			}
+		}()
 	}
 
-	// Create new gRPC server and initialize a gRPC service object
-	grpcServer := grpc.NewServer()
+	// Create new gRPC server and initialize a gRPC service object. Every
+	// request is journaled before the reply, the requests that the policy
+	// does not allow are denied.
+	grpcServer := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(
+			agent.JournalUnaryInterceptor(logError),
+			agent.PolicyUnaryInterceptor(logError),
+		),
+		grpc.ChainStreamInterceptor(
+			agent.JournalStreamInterceptor(logError),
+			agent.PolicyStreamInterceptor(logError),
+		),
+	)
 
 	// Register the service with gRPC Server (of the gRPC plugin)
 	agentGRPCSvc := agent.NewAgentGRPCService()
@@ -72,7 +160,7 @@ func (p *program) run() error {
 // this function defind stop method
 func (p *program) Stop(s service.Service) error {
 	// Any work in Stop should be quick, usually a few seconds at most.
-	logger.Info("bkedr agent is stop")
+	logInfof("bkedr agent is stop")
 	close(p.exit)
 	return nil
 }
@@ -85,8 +173,21 @@ func (p *program) Stop(s service.Service) error {
 //	  Run the service.
 func main() {
 	svcFlag := flag.String("service", "", "Control the system service.")
+	configFlag := flag.String("config", "", "Path of agent config, default is "+
+		agent.CONFIG_PATH_ENV+" or "+agent.CONFIG_PATH+".")
+	var overrides setFlags
+	flag.Var(&overrides, "set", "Override a field of agent config: <Field>=<value>.")
 	flag.Parse()
 
+	// The service runs with the same config flags
+	arguments := make([]string, 0)
+	if *configFlag != "" {
+		arguments = append(arguments, "-config", *configFlag)
+	}
+	for _, override := range overrides {
+		arguments = append(arguments, "-set", override)
+	}
+
 	options := make(service.KeyValue)
 	options["Restart"] = "on-success"
 	options["SuccessExitStatus"] = "1 2 8 SIGKILL"
@@ -95,6 +196,7 @@ func main() {
 		DisplayName:  "Bkedr Agent",
 		Description:  "The EDR agent for Windows.",
 		Dependencies: []string{},
+		Arguments:    arguments,
 		Option:       options,
 	}
 
@@ -128,6 +230,12 @@ func main() {
 		return
 	}
 
+	// Load the config file with the overrides of env vars and flags
+	configPath := agent.ResolveConfigPath(*configFlag)
+	if err := agent.LoadConfig(configPath, overrides); err != nil {
+		log.Fatal("Load bkedr agent config error: ", err)
+	}
+
 	err = s.Run()
 	if err != nil {
 		logger.Error(err)
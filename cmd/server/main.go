@@ -2,8 +2,16 @@ package main
 
 import (
 	"bkedr/pkg/server"
+	"os"
 )
 
 func main() {
+
+	server.LoadServerConfig()
+
+	// bkedr <command> sends the command to the running server
+	if len(os.Args) > 1 {
+		os.Exit(server.RunCommand(os.Args[1:]))
+	}
 	server.StartServer()
 }
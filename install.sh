@@ -10,8 +10,12 @@ cp bkedr /opt/bkedr
 chmod +x /opt/bkedr/bkedr
 
 touch /opt/bkedr/configs/agents.conf
+touch /opt/bkedr/configs/containments.conf
+touch /opt/bkedr/configs/approvals.conf
 
 mkdir /opt/bkedr/downloadfile
+mkdir /opt/bkedr/evidence
+mkdir /opt/bkedr/push
 
 mkdir /opt/bkedr/log
 touch /opt/bkedr/log/applog.txt
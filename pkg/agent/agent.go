@@ -16,28 +16,67 @@ import (
 	"bkedr/pkg/rpc"
 	"context"
 	"encoding/json"
-	"fmt"
-	"io"
-	"io/ioutil"
 	"net"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
-
-	"golang.org/x/sys/windows/registry"
 )
 
-const CONFIG_PATH = "C:\\Windows\\System32\\BSkedrAgent\\windowsagent.conf"
+// Default path of agent config, see ResolveConfigPath
+const CONFIG_PATH = "C:\\Windows\\System32\\BkedrAgent\\windowsagent.conf"
 
-// Variables use for multiple func
+// Variables use for multiple func. They are the fields of agent config that
+// a config profile cannot set, they are set when the config file is loaded
+// and do not change while the agent runs. The fields that a profile can set
+// are read from CurrentConfig.
 
 var (
-	//Network adapter name is connected to internet
-	adapterInternet string
-	serverHost      string
-	serverPort      string
-	AgentHost       string
-	AgentPort       string
+	AgentHost string
+	AgentPort string
+	// Directory stores quarantined files
+	quarantineDir string
+	// Directory stores backup of deleted registry keys and values
+	registryBackupDir string
+	// Registry is used to handle registry events
+	registryAccess Registry = NewRegistry()
+	// File saves the isolation state
+	isolationStatePath string
+	// Source of telemetry events, sysmon or file
+	telemetrySource string
+	// File of events replayed by the file source, one event per line
+	telemetryReplayFile string
+	// Number of events of a telemetry batch
+	telemetryBatchSize int
+	// A telemetry batch is sent after this duration if it is not full
+	telemetryFlushInterval time.Duration
+	// Token of agent, the telemetry service of EDR server authenticates
+	// the agent with it
+	telemetryToken string
+	// Public key of EDR server that verifies the local rules
+	localRulesPublicKeyPath string
+	// File saves the local rules signed by EDR server
+	localRulesPath string
+	// File saves the results of local responses until they are uploaded
+	localResultsPath string
+	// File saves the journal of actions, the old segment is <path>.1
+	actionJournalPath string
+	// Number of records of a segment of journal
+	actionJournalSize int
+	// Group of agent, the EDR server selects the config profiles with it
+	group string
+	// File saves the config profile pushed by the EDR server
+	agentProfilePath string
+	// File of local policy, it cannot be changed by the EDR server
+	policyPath string
+	// File saves the requests that are denied by the policies
+	policyAuditPath string
+	// Effective agent config, a *AgentConfigObj that is never changed. A
+	// config profile publishes a new one, so the handlers read it without
+	// lock.
+	currentConfig atomic.Value
 )
 
 // AgentConfig struct which contains an array of AgentConfigObj
@@ -47,40 +86,125 @@ type AgentConfig struct {
 
 // AgentConfigObj struct is used to decode json of AgentConfig object
 type AgentConfigObj struct {
-	AdapterInternet string `json:"AdapterInternet"`
-	ServerHost      string `json:"ServerHost"`
-	ServerPort      string `json:"ServerPort"`
-	AgentHost       string `json:"AgentHost"`
-	AgentPort       string `json:"AgentPort"`
+	AdapterInternet         string      `json:"AdapterInternet"`
+	ServerHost              string      `json:"ServerHost"`
+	ServerPort              string      `json:"ServerPort"`
+	AgentHost               string      `json:"AgentHost"`
+	AgentPort               string      `json:"AgentPort"`
+	QuarantineDir           string      `json:"QuarantineDir"`
+	RegistryBackupDir       string      `json:"RegistryBackupDir"`
+	IsolationAllowlist      []string    `json:"IsolationAllowlist"`
+	IsolationAllowDns       bool        `json:"IsolationAllowDns"`
+	IsolationAllowDhcp      bool        `json:"IsolationAllowDhcp"`
+	IsolationStatePath      string      `json:"IsolationStatePath"`
+	MaxFileSize             int64       `json:"MaxFileSize"`
+	MaxTransferRate         int64       `json:"MaxTransferRate"`
+	AllowedPutPaths         []string    `json:"AllowedPutPaths"`
+	TelemetryPort           string      `json:"TelemetryPort"`
+	TelemetrySource         string      `json:"TelemetrySource"`
+	TelemetryReplayFile     string      `json:"TelemetryReplayFile"`
+	TelemetryBatchSize      int         `json:"TelemetryBatchSize"`
+	TelemetryFlushInterval  string      `json:"TelemetryFlushInterval"`
+	TelemetryToken          string      `json:"TelemetryToken"`
+	LocalRulesPublicKeyPath string      `json:"LocalRulesPublicKeyPath"`
+	LocalRulesPath          string      `json:"LocalRulesPath"`
+	LocalResultsPath        string      `json:"LocalResultsPath"`
+	ActionJournalPath       string      `json:"ActionJournalPath"`
+	ActionJournalSize       int         `json:"ActionJournalSize"`
+	Group                   string      `json:"Group"`
+	AllowedActions          []string    `json:"AllowedActions"`
+	LogLevel                string      `json:"LogLevel"`
+	AgentProfilePath        string      `json:"AgentProfilePath"`
+	Policy                  AgentPolicy `json:"Policy"`
+	PolicyPath              string      `json:"PolicyPath"`
+	PolicyAuditPath         string      `json:"PolicyAuditPath"`
 }
 
-func init() {
-
-	// Get all values of variables from config file
-	agentConfig := GetAgentConfig()
-	adapterInternet = agentConfig.AgentConfig[0].AdapterInternet
-	serverHost = agentConfig.AgentConfig[0].ServerHost
-	serverPort = agentConfig.AgentConfig[0].ServerPort
-	AgentHost = agentConfig.AgentConfig[0].AgentHost
-	AgentPort = agentConfig.AgentConfig[0].AgentPort
-	fmt.Println(serverHost, serverPort, AgentHost, AgentPort, adapterInternet)
+// This function returns the effective agent config. It must not be
+// changed, a config profile publishes a new config. Before the config file
+// is loaded, it is an empty config.
+func CurrentConfig() *AgentConfigObj {
+	if config, ok := currentConfig.Load().(*AgentConfigObj); ok {
+		return config
+	}
+	return &AgentConfigObj{}
 }
 
-// This function returns the pointer of ServerConfig
-func GetAgentConfig() *AgentConfig {
-
-	// read opened config file as a byte array.
-	byteValue, err := ioutil.ReadFile(CONFIG_PATH)
+// This function sets the defaults of the fields that are not set in
+// config. The default paths are in the directory of config file.
+func SetConfigDefaults(config *AgentConfigObj) {
 
-	// If the config cannot be loaded, exit the program
-	if err != nil {
-		fmt.Println("Load bkedr agent config error: ", err)
-		os.Exit(1)
+	// Default quarantine directory is in the directory of config file
+	if config.QuarantineDir == "" {
+		config.QuarantineDir = filepath.Join(filepath.Dir(configPath), "quarantine")
+	}
+	if config.RegistryBackupDir == "" {
+		config.RegistryBackupDir = filepath.Join(filepath.Dir(configPath), "registrybackup")
+	}
+	if config.IsolationStatePath == "" {
+		config.IsolationStatePath = filepath.Join(filepath.Dir(configPath), "isolation.json")
+	}
+	if config.LocalRulesPath == "" {
+		config.LocalRulesPath = filepath.Join(filepath.Dir(configPath), "localrules.json")
+	}
+	if config.LocalResultsPath == "" {
+		config.LocalResultsPath = filepath.Join(filepath.Dir(configPath), "localresults.spool")
+	}
+	if config.ActionJournalPath == "" {
+		config.ActionJournalPath = filepath.Join(filepath.Dir(configPath), "actions.journal")
+	}
+	if config.AgentProfilePath == "" {
+		config.AgentProfilePath = filepath.Join(filepath.Dir(configPath), "profile.json")
+	}
+	if config.PolicyPath == "" {
+		config.PolicyPath = filepath.Join(filepath.Dir(configPath), "policy.json")
+	}
+	if config.PolicyAuditPath == "" {
+		config.PolicyAuditPath = filepath.Join(filepath.Dir(configPath), "policy-audit.log")
 	}
+	config.LogLevel = strings.ToLower(config.LogLevel)
+	if config.LogLevel == "" {
+		config.LogLevel = "info"
+	}
+	// Default journal keeps between 1000 and 2000 actions
+	if config.ActionJournalSize <= 0 {
+		config.ActionJournalSize = 1000
+	}
+	// Default telemetry batch is 500 events or 1 second
+	if config.TelemetryBatchSize <= 0 {
+		config.TelemetryBatchSize = 500
+	}
+	interval, err := time.ParseDuration(config.TelemetryFlushInterval)
+	if err != nil || interval <= 0 {
+		interval = time.Second
+	}
+	config.TelemetryFlushInterval = interval.String()
+}
 
-	agentConfig := AgentConfig{}
-	json.Unmarshal(byteValue, &agentConfig) // Json decoding
-	return &agentConfig
+// This function sets the variables of the fields that a config profile
+// cannot set. It is called when the config file is loaded, before the
+// agent handles requests.
+func ApplyAgentConfig(config *AgentConfigObj) {
+
+	AgentHost = config.AgentHost
+	AgentPort = config.AgentPort
+	quarantineDir = config.QuarantineDir
+	registryBackupDir = config.RegistryBackupDir
+	isolationStatePath = config.IsolationStatePath
+	telemetrySource = config.TelemetrySource
+	telemetryReplayFile = config.TelemetryReplayFile
+	telemetryBatchSize = config.TelemetryBatchSize
+	telemetryFlushInterval, _ = time.ParseDuration(config.TelemetryFlushInterval)
+	telemetryToken = config.TelemetryToken
+	localRulesPublicKeyPath = config.LocalRulesPublicKeyPath
+	localRulesPath = config.LocalRulesPath
+	localResultsPath = config.LocalResultsPath
+	actionJournalPath = config.ActionJournalPath
+	actionJournalSize = config.ActionJournalSize
+	group = config.Group
+	agentProfilePath = config.AgentProfilePath
+	policyPath = config.PolicyPath
+	policyAuditPath = config.PolicyAuditPath
 }
 
 // AgentGRPCService is a implementation of ManagerServer Grpc Service
@@ -96,6 +220,7 @@ type AgentInfo struct {
 	ComputerName string
 	AgentHost    string
 	AgentPort    string
+	Group        string
 }
 
 // This function is used to send Computername to the EDR server
@@ -103,7 +228,8 @@ type AgentInfo struct {
 func RunSocketDial() error {
 
 	// Create a dial connection using host and port that pass to this function
-	con, err := net.Dial("tcp", serverHost+":"+serverPort)
+	config := CurrentConfig()
+	con, err := net.Dial("tcp", config.ServerHost+":"+config.ServerPort)
 	if err != nil {
 		return err
 	}
@@ -116,6 +242,7 @@ func RunSocketDial() error {
 		ComputerName: computerName,
 		AgentHost:    AgentHost,
 		AgentPort:    AgentPort,
+		Group:        group,
 	}
 
 	data, err := json.Marshal(AgentInfo) // Json Encoding of agentInfo
@@ -137,6 +264,7 @@ func RunSocketDial() error {
 //   - kill: processId
 //   - kill tree: processId
 //   - suspend: processId
+//   - resume: processId
 //   - getfile: Image (Func ManagerGetFile())
 func (*AgentGRPCService) ManagerEventCode1(
 	ctx context.Context, in *rpc.EventCode1) (*rpc.ResponseResult, error) {
@@ -152,7 +280,7 @@ func (*AgentGRPCService) ManagerEventCode1(
 	switch action {
 	// In this case, the agent kills the Process Tree.
 	case "killtree":
-		if err := KillTreeProcess(pid32); err != nil {
+		if err := KillTreeProcess(pid32, ProtectionOverride(ctx)); err != nil {
 			resultInfo = "Error kills tree ProcessId " + pid + ": " + err.Error()
 			result = false
 		} else {
@@ -160,7 +288,7 @@ func (*AgentGRPCService) ManagerEventCode1(
 		}
 	// In this case, the agent kills the Process
 	case "kill":
-		if err := KillProcess(pid32); err != nil {
+		if err := KillProcess(pid32, ProtectionOverride(ctx)); err != nil {
 			resultInfo = "Error kills ProcessId " + pid + ": " + err.Error()
 			result = false
 		} else {
@@ -168,12 +296,20 @@ func (*AgentGRPCService) ManagerEventCode1(
 		}
 	// In this case, the agent suspends the Process
 	case "suspend":
-		if err := SuspendProcess(pid32); err != nil {
+		if err := SuspendProcess(pid32, ProtectionOverride(ctx)); err != nil {
 			resultInfo = "Error suppeds ProcessId " + pid + ": " + err.Error()
 			result = false
 		} else {
 			resultInfo = "Success suspends ProcessId " + pid
 		}
+	// In this case, the agent resumes the suspended Process
+	case "resume":
+		if err := ResumeProcess(pid32); err != nil {
+			resultInfo = "Error resumes ProcessId " + pid + ": " + err.Error()
+			result = false
+		} else {
+			resultInfo = "Success resumes ProcessId " + pid
+		}
 	default:
 		resultInfo = "Error: Action " + action +
 			" is not supported for EventCode 1"
@@ -193,6 +329,12 @@ func (*AgentGRPCService) ManagerEventCode1(
 //   - kill tree: ProcessId
 //   - block inbound ip: SourceIp
 //   - block outbound ip: DestinationIp
+//   - unblock inbound ip: SourceIp
+//   - unblock outbound ip: DestinationIp
+//   - block inbound port: SourcePort
+//   - block outbound port: DestinationPort
+//   - unblock inbound port: SourcePort
+//   - unblock outbound port: DestinationPort
 func (*AgentGRPCService) ManagerEventCode3(
 	ctx context.Context, in *rpc.EventCode3) (*rpc.ResponseResult, error) {
 
@@ -204,12 +346,14 @@ func (*AgentGRPCService) ManagerEventCode3(
 	pid32 := ConvertStringToInt32(pid)
 	sIp := in.GetSourceIp()
 	dIp := in.GetDestinationIp()
+	sPort := in.GetSourcePort()
+	dPort := in.GetDestinationPort()
 
 	// Handle the EventCode 3 based on action variable
 	switch action {
 	// In this case, the agent kills the Process Tree.
 	case "killtree":
-		if err := KillTreeProcess(pid32); err != nil {
+		if err := KillTreeProcess(pid32, ProtectionOverride(ctx)); err != nil {
 			resultInfo = "Error kills tree ProcessId " + pid + ": " + err.Error()
 			result = false
 		} else {
@@ -217,7 +361,7 @@ func (*AgentGRPCService) ManagerEventCode3(
 		}
 	// In this case, the agent kills the Process
 	case "kill":
-		if err := KillProcess(pid32); err != nil {
+		if err := KillProcess(pid32, ProtectionOverride(ctx)); err != nil {
 			resultInfo = "Error kills ProcessId " + pid + ": " + err.Error()
 			result = false
 		} else {
@@ -241,6 +385,58 @@ func (*AgentGRPCService) ManagerEventCode3(
 		} else {
 			resultInfo = "Success blocks outbound ip " + dIp
 		}
+	// In this case, the agent removes the rule that blocks traffic initiated
+	// from external ip to local ip.
+	case "unblock_src_ip":
+		if err := UnblockInboundIp(sIp); err != nil {
+			resultInfo = "Error unblocks inbound ip " + sIp + ": " + err.Error()
+			result = false
+		} else {
+			resultInfo = "Success unblocks inbound ip " + sIp
+		}
+	// In this case, the agent removes the rule that blocks traffic initiated
+	// from the local ip to external ip.
+	case "unblock_dst_ip":
+		if err := UnblockOutboundIp(dIp); err != nil {
+			resultInfo = "Error unblocks outbound ip " + dIp + ": " + err.Error()
+			result = false
+		} else {
+			resultInfo = "Success unblocks outbound ip " + dIp
+		}
+	// In this case, the agent blocks inbound traffic of the source port.
+	case "block_src_port":
+		if err := BlockInboundPort(sPort); err != nil {
+			resultInfo = "Error blocks inbound port " + sPort + ": " + err.Error()
+			result = false
+		} else {
+			resultInfo = "Success blocks inbound port " + sPort
+		}
+	// In this case, the agent blocks outbound traffic of the destination port.
+	case "block_dst_port":
+		if err := BlockOutboundPort(dPort); err != nil {
+			resultInfo = "Error blocks outbound port " + dPort + ": " + err.Error()
+			result = false
+		} else {
+			resultInfo = "Success blocks outbound port " + dPort
+		}
+	// In this case, the agent removes the rule that blocks inbound traffic
+	// of the source port.
+	case "unblock_src_port":
+		if err := UnblockInboundPort(sPort); err != nil {
+			resultInfo = "Error unblocks inbound port " + sPort + ": " + err.Error()
+			result = false
+		} else {
+			resultInfo = "Success unblocks inbound port " + sPort
+		}
+	// In this case, the agent removes the rule that blocks outbound traffic
+	// of the destination port.
+	case "unblock_dst_port":
+		if err := UnblockOutboundPort(dPort); err != nil {
+			resultInfo = "Error unblocks outbound port " + dPort + ": " + err.Error()
+			result = false
+		} else {
+			resultInfo = "Success unblocks outbound port " + dPort
+		}
 	default:
 		resultInfo = "Error: Action " + action +
 			" is not supported for EventCode 3"
@@ -259,12 +455,16 @@ func (*AgentGRPCService) ManagerEventCode3(
 //   - kill: processId
 //   - kill tree: processId
 //   - delete: ImageLoaded
+//   - quarantine: ImageLoaded
+//   - restore: ImageLoaded or quarantine id
+//   - purge: ImageLoaded or quarantine id
 //   - get file: ImageLoaded (Func ManagerGetFile())
 func (*AgentGRPCService) ManagerEventCode7(
 	ctx context.Context, in *rpc.EventCode7) (*rpc.ResponseResult, error) {
 
 	var resultInfo string
 	var result = true
+	var undoId string
 
 	action := in.GetAction()
 	pid := in.GetProcessId()
@@ -275,7 +475,7 @@ func (*AgentGRPCService) ManagerEventCode7(
 	switch action {
 	// In this case, the agent kills the Process Tree.
 	case "killtree":
-		if err := KillTreeProcess(pid32); err != nil {
+		if err := KillTreeProcess(pid32, ProtectionOverride(ctx)); err != nil {
 			resultInfo = "Error kills tree ProcessId " + pid + ": " + err.Error()
 			result = false
 		} else {
@@ -283,7 +483,7 @@ func (*AgentGRPCService) ManagerEventCode7(
 		}
 	// In this case, the agent kills the Process
 	case "kill":
-		if err := KillProcess(pid32); err != nil {
+		if err := KillProcess(pid32, ProtectionOverride(ctx)); err != nil {
 			resultInfo = "Error kills ProcessId " + pid + ": " + err.Error()
 			result = false
 		} else {
@@ -297,6 +497,34 @@ func (*AgentGRPCService) ManagerEventCode7(
 		} else {
 			resultInfo = "Success deletes file " + filePath
 		}
+	// In this case, the agent moves the file into quarantine directory
+	case "quarantine":
+		if item, err := QuarantineFile(filePath); err != nil {
+			resultInfo = "Error quarantines file " + filePath + ": " + err.Error()
+			result = false
+		} else {
+			resultInfo = "Success quarantines file " + filePath +
+				" with id " + item.Id + ", sha256 " + item.Sha256
+			undoId = item.Id
+		}
+	// In this case, the agent restores the quarantined file
+	case "restore":
+		if item, err := RestoreFile(filePath); err != nil {
+			resultInfo = "Error restores file " + filePath + ": " + err.Error()
+			result = false
+		} else {
+			resultInfo = "Success restores file " + item.OriginalPath +
+				" from quarantine id " + item.Id
+		}
+	// In this case, the agent deletes the quarantined file permanently
+	case "purge":
+		if count, err := PurgeFile(filePath); err != nil {
+			resultInfo = "Error purges file " + filePath + ": " + err.Error()
+			result = false
+		} else {
+			resultInfo = "Success purges " + strconv.Itoa(count) +
+				" quarantined file " + filePath
+		}
 	default:
 		resultInfo = "Error: Action " + action +
 			" is not supported for EventCode 7"
@@ -306,6 +534,7 @@ func (*AgentGRPCService) ManagerEventCode7(
 	return &rpc.ResponseResult{
 		ResultInfo: resultInfo,
 		Result:     result,
+		UndoId:     undoId,
 	}, nil
 }
 
@@ -328,7 +557,7 @@ func (*AgentGRPCService) ManagerEventCode8(
 	switch action {
 	// In this case, the agent kills the Source Process Tree.
 	case "killtree":
-		if err := KillTreeProcess(pid32); err != nil {
+		if err := KillTreeProcess(pid32, ProtectionOverride(ctx)); err != nil {
 			resultInfo = "Error kills tree ProcessId " + pid + ": " + err.Error()
 			result = false
 		} else {
@@ -336,7 +565,7 @@ func (*AgentGRPCService) ManagerEventCode8(
 		}
 	// In this case, the agent kills the Source Process
 	case "kill":
-		if err := KillProcess(pid32); err != nil {
+		if err := KillProcess(pid32, ProtectionOverride(ctx)); err != nil {
 			resultInfo = "Error kills ProcessId " + pid + ": " + err.Error()
 			result = false
 		} else {
@@ -373,7 +602,7 @@ func (*AgentGRPCService) ManagerEventCode9(
 	switch action {
 	// In this case, the agent kills the Process Tree.
 	case "killtree":
-		if err := KillTreeProcess(pid32); err != nil {
+		if err := KillTreeProcess(pid32, ProtectionOverride(ctx)); err != nil {
 			resultInfo = "Error kills tree ProcessId " + pid + ": " + err.Error()
 			result = false
 		} else {
@@ -381,7 +610,7 @@ func (*AgentGRPCService) ManagerEventCode9(
 		}
 	// In this case, the agent kills the Process
 	case "kill":
-		if err := KillProcess(pid32); err != nil {
+		if err := KillProcess(pid32, ProtectionOverride(ctx)); err != nil {
 			resultInfo = "Error kills ProcessId " + pid + ": " + err.Error()
 			result = false
 		} else {
@@ -418,7 +647,7 @@ func (*AgentGRPCService) ManagerEventCode10(
 	switch action {
 	// In this case, the agent kills the Process Tree.
 	case "killtree":
-		if err := KillTreeProcess(pid32); err != nil {
+		if err := KillTreeProcess(pid32, ProtectionOverride(ctx)); err != nil {
 			resultInfo = "Error kills tree ProcessId " + pid + ": " + err.Error()
 			result = false
 		} else {
@@ -426,7 +655,7 @@ func (*AgentGRPCService) ManagerEventCode10(
 		}
 	// In this case, the agent kills the Process
 	case "kill":
-		if err := KillProcess(pid32); err != nil {
+		if err := KillProcess(pid32, ProtectionOverride(ctx)); err != nil {
 			resultInfo = "Error kills ProcessId " + pid + ": " + err.Error()
 			result = false
 		} else {
@@ -448,12 +677,16 @@ func (*AgentGRPCService) ManagerEventCode10(
 // This function handles a request with EventCode 11 (FileCreate)
 // sent by the EDR Server and returns a ResponseResult. Action support:
 //   - delete: TargetFilename
+//   - quarantine: TargetFilename
+//   - restore: TargetFilename or quarantine id
+//   - purge: TargetFilename or quarantine id
 //   - get file: TargetFilename
 func (*AgentGRPCService) ManagerEventCode11(
 	ctx context.Context, in *rpc.EventCode11) (*rpc.ResponseResult, error) {
 
 	var resultInfo string
 	var result = true
+	var undoId string
 
 	action := in.GetAction()
 	filePath := in.GetTargetFilename()
@@ -468,6 +701,34 @@ func (*AgentGRPCService) ManagerEventCode11(
 		} else {
 			resultInfo = "Success deletes file " + filePath
 		}
+	// In this case, the agent moves the file into quarantine directory
+	case "quarantine":
+		if item, err := QuarantineFile(filePath); err != nil {
+			resultInfo = "Error quarantines file " + filePath + ": " + err.Error()
+			result = false
+		} else {
+			resultInfo = "Success quarantines file " + filePath +
+				" with id " + item.Id + ", sha256 " + item.Sha256
+			undoId = item.Id
+		}
+	// In this case, the agent restores the quarantined file
+	case "restore":
+		if item, err := RestoreFile(filePath); err != nil {
+			resultInfo = "Error restores file " + filePath + ": " + err.Error()
+			result = false
+		} else {
+			resultInfo = "Success restores file " + item.OriginalPath +
+				" from quarantine id " + item.Id
+		}
+	// In this case, the agent deletes the quarantined file permanently
+	case "purge":
+		if count, err := PurgeFile(filePath); err != nil {
+			resultInfo = "Error purges file " + filePath + ": " + err.Error()
+			result = false
+		} else {
+			resultInfo = "Success purges " + strconv.Itoa(count) +
+				" quarantined file " + filePath
+		}
 	default:
 		resultInfo = "Error: Action " + action +
 			" is not supported for EventCode 11"
@@ -477,6 +738,7 @@ func (*AgentGRPCService) ManagerEventCode11(
 	return &rpc.ResponseResult{
 		ResultInfo: resultInfo,
 		Result:     result,
+		UndoId:     undoId,
 	}, nil
 }
 
@@ -484,28 +746,39 @@ func (*AgentGRPCService) ManagerEventCode11(
 // This function handles a request with EventCode 12 (RegistryEvent Object
 // create and delete) sent by the EDR Server and returns a ResponseResult.
 // Action support:
-//   - delete: TargetObject (key)
+//   - delete: TargetObject (key), the key is backed up before deleting
+//   - restore: TargetObject (key) or backup id
 func (*AgentGRPCService) ManagerEventCode12(
 	ctx context.Context, in *rpc.EventCode12) (*rpc.ResponseResult, error) {
 
 	var resultInfo string
 	var result = true
+	var undoId string
 
-	// Get key, path of Registry Key
+	// Get Registry Key
 	targetObject := in.GetTargetObject()
-	keyStr, path := SplitKeyPath(targetObject)
-	key := ConvertKey(keyStr)
 
 	action := in.GetAction()
 	// Handle the EventCode 12 based on action variable
 	switch action {
-	// In this case, the agent delete the Registry Key
+	// In this case, the agent backs up and deletes the Registry Key
 	case "delete":
-		if err := registry.DeleteKey(key, path); err != nil {
+		if backup, err := BackupAndDeleteKey(registryAccess, targetObject); err != nil {
 			resultInfo = "Error deletes Registry Key " + targetObject + ": " + err.Error()
 			result = false
 		} else {
-			resultInfo = "Success deletes Registry Key " + targetObject
+			resultInfo = "Success deletes Registry Key " + targetObject +
+				" with backup id " + backup.Id
+			undoId = backup.Id
+		}
+	// In this case, the agent restores the Registry Key from backup
+	case "restore":
+		if backup, err := RestoreRegistry(registryAccess, targetObject); err != nil {
+			resultInfo = "Error restores Registry Key " + targetObject + ": " + err.Error()
+			result = false
+		} else {
+			resultInfo = "Success restores Registry Key " + backup.TargetObject +
+				" from backup id " + backup.Id
 		}
 	default:
 		resultInfo = "Error: Action " + action +
@@ -516,34 +789,46 @@ func (*AgentGRPCService) ManagerEventCode12(
 	return &rpc.ResponseResult{
 		ResultInfo: resultInfo,
 		Result:     result,
+		UndoId:     undoId,
 	}, nil
 }
 
 // ManagerEventCode13 function implementation of gRPC Service.
 // This function handles a request with EventCode 13 (RegistryEvent Value Set)
 // sent by the EDR Server and returns a ResponseResult. Action support:
-//   - delete: TargetObject (value)
+//   - delete: TargetObject (value), the value is backed up before deleting
+//   - restore: TargetObject (value) or backup id
 func (*AgentGRPCService) ManagerEventCode13(
 	ctx context.Context, in *rpc.EventCode13) (*rpc.ResponseResult, error) {
 
 	var resultInfo string
 	var result = true
+	var undoId string
 
-	// Get key, path of Registry Key
+	// Get Registry Value
 	targetObject := in.GetTargetObject()
-	keyStr, path, name := SplitKeyPathName(targetObject)
-	key := ConvertKey(keyStr)
 
 	action := in.GetAction()
 	// Handle the EventCode 13 based on action variable
 	switch action {
-	// In this case, the agent delete the Registry Value
+	// In this case, the agent backs up and deletes the Registry Value
 	case "delete":
-		if err := DeleteValue(key, path, name); err != nil {
+		if backup, err := BackupAndDeleteValue(registryAccess, targetObject); err != nil {
 			resultInfo = "Error deletes Registry Value " + targetObject + ": " + err.Error()
 			result = false
 		} else {
-			resultInfo = "Success deletes Registry Value " + targetObject
+			resultInfo = "Success deletes Registry Value " + targetObject +
+				" with backup id " + backup.Id
+			undoId = backup.Id
+		}
+	// In this case, the agent restores the Registry Value from backup
+	case "restore":
+		if backup, err := RestoreRegistry(registryAccess, targetObject); err != nil {
+			resultInfo = "Error restores Registry Value " + targetObject + ": " + err.Error()
+			result = false
+		} else {
+			resultInfo = "Success restores Registry Value " + backup.TargetObject +
+				" from backup id " + backup.Id
 		}
 	default:
 		resultInfo = "Error: Action " + action +
@@ -554,6 +839,7 @@ func (*AgentGRPCService) ManagerEventCode13(
 	return &rpc.ResponseResult{
 		ResultInfo: resultInfo,
 		Result:     result,
+		UndoId:     undoId,
 	}, nil
 }
 
@@ -561,28 +847,39 @@ func (*AgentGRPCService) ManagerEventCode13(
 // This function handles a request with EventCode 14 (RegistryEvent Registry
 // object renamed) sent by the EDR Server and returns a ResponseResult.
 // Action support:
-//   - delete: TargetObject (key)
+//   - delete: NewName (key), the key is backed up before deleting
+//   - restore: NewName (key) or backup id
 func (*AgentGRPCService) ManagerEventCode14(
 	ctx context.Context, in *rpc.EventCode14) (*rpc.ResponseResult, error) {
 
 	var resultInfo string
 	var result = true
+	var undoId string
 
-	// Get key, path of Registry Key
+	// Get Registry Key
 	newName := in.GetNewName()
-	keyStr, path := SplitKeyPath(newName)
-	key := ConvertKey(keyStr)
 
 	action := in.GetAction()
 	// Handle the EventCode 14 based on action variable
 	switch action {
-	// In this case, the agent delete the Registry Key
+	// In this case, the agent backs up and deletes the Registry Key
 	case "delete":
-		if err := registry.DeleteKey(key, path); err != nil {
+		if backup, err := BackupAndDeleteKey(registryAccess, newName); err != nil {
 			resultInfo = "Error deletes Registry Key " + newName + ": " + err.Error()
 			result = false
 		} else {
-			resultInfo = "Success deletes Registry Key " + newName
+			resultInfo = "Success deletes Registry Key " + newName +
+				" with backup id " + backup.Id
+			undoId = backup.Id
+		}
+	// In this case, the agent restores the Registry Key from backup
+	case "restore":
+		if backup, err := RestoreRegistry(registryAccess, newName); err != nil {
+			resultInfo = "Error restores Registry Key " + newName + ": " + err.Error()
+			result = false
+		} else {
+			resultInfo = "Success restores Registry Key " + backup.TargetObject +
+				" from backup id " + backup.Id
 		}
 	default:
 		resultInfo = "Error: Action " + action +
@@ -593,6 +890,7 @@ func (*AgentGRPCService) ManagerEventCode14(
 	return &rpc.ResponseResult{
 		ResultInfo: resultInfo,
 		Result:     result,
+		UndoId:     undoId,
 	}, nil
 }
 
@@ -601,12 +899,16 @@ func (*AgentGRPCService) ManagerEventCode14(
 // by the EDR Server and returns a ResponseResult.
 // Action support:
 //   - Disable: adapterInternet
+//   - Enable: adapterInternet
+//   - Isolate: block all traffic except bkedr server, allowlist, DNS, DHCP
+//   - Unisolate: remove the isolation
 func (*AgentGRPCService) ManagerNetworkAdapter(
 	ctx context.Context, in *rpc.NetworkAdapter) (*rpc.ResponseResult, error) {
 
 	var resultInfo string
 	var result = true
 
+	adapterInternet := CurrentConfig().AdapterInternet
 	action := in.GetAction()
 	switch action {
 	// Disable adapter network that connect to internet
@@ -627,6 +929,22 @@ func (*AgentGRPCService) ManagerNetworkAdapter(
 		} else {
 			resultInfo = "Success enable Network Adapter " + adapterInternet
 		}
+	// Isolate the host, only the bkedr server and allowlist are reachable
+	case "isolate":
+		if err := IsolateHost(); err != nil {
+			resultInfo = "Error isolates host: " + err.Error()
+			result = false
+		} else {
+			resultInfo = "Success isolates host, allows bkedr server " + CurrentConfig().ServerHost
+		}
+	// Remove the isolation of the host
+	case "unisolate":
+		if err := UnisolateHost(); err != nil {
+			resultInfo = "Error unisolates host: " + err.Error()
+			result = false
+		} else {
+			resultInfo = "Success unisolates host"
+		}
 	default:
 		resultInfo = "Error: Action " + action +
 			" is not supported for Network Adapter"
@@ -640,53 +958,100 @@ func (*AgentGRPCService) ManagerNetworkAdapter(
 }
 
 // ManagerGetFile function implementation of gRPC Service.
-// This function handles a Download File request sent by the EDR Server
+// This function handles a Download File request sent by the EDR Server.
+// The first message contains the metadata of file (size, hashes and
+// timestamps), so the EDR Server can verify the file after transfer.
+// The file is sent from the offset of request, compressed and limited by
+// the max size and max rate of request and config file.
+// If ProcessId of request is set, the memory of process is dumped and sent
+// instead of the file.
 func (*AgentGRPCService) ManagerGetFile(FileInfoObj *rpc.FileInfo,
 	ResultFileStream rpc.Manager_ManagerGetFileServer) error {
 
-	// 64KiB, buffer length
-	bufferSize := 64 * 1024
+	if FileInfoObj.GetProcessId() != 0 {
+		return SendMemoryDump(FileInfoObj, ResultFileStream)
+	}
+	return SendFile(FileInfoObj, ResultFileStream)
+}
 
-	file, err := os.Open(FileInfoObj.GetFilePath())
-	if err != nil {
-		return err
+// ManagerCollect function implementation of gRPC Service.
+// This function handles a Collect request sent by the EDR Server. The files
+// of paths and globs are written into an archive with a manifest, then the
+// archive is sent like a downloaded file.
+func (*AgentGRPCService) ManagerCollect(CollectInfoObj *rpc.CollectInfo,
+	ResultFileStream rpc.Manager_ManagerCollectServer) error {
+
+	return SendCollect(CollectInfoObj, ResultFileStream)
+}
+
+// ManagerPutFile function implementation of gRPC Service.
+// This function handles a Push File request sent by the EDR Server. The
+// first message contains the destination, size and SHA-256 of file. The
+// file is written only if the destination is in AllowedPutPaths and the
+// received content matches the size and SHA-256.
+func (*AgentGRPCService) ManagerPutFile(FileDataStream rpc.Manager_ManagerPutFileServer) error {
+
+	var resultInfo string
+	var result = true
+
+	var denyReason string
+	fileMeta, err := ReceivePutFile(FileDataStream)
+	if policyError, ok := err.(*PolicyError); ok {
+		resultInfo = policyError.Error()
+		result = false
+		denyReason = policyError.Reason
+	} else if err != nil {
+		resultInfo = "Error puts file " + fileMeta.GetFilePath() + ": " + err.Error()
+		result = false
+	} else {
+		resultInfo = "Success puts file " + fileMeta.GetFilePath() + " sha256 " +
+			fileMeta.GetSha256()
 	}
-	defer file.Close()
 
-	// Create a slice buff that stores bytes read in buffer
-	buff := make([]byte, bufferSize)
+	return FileDataStream.SendAndClose(&rpc.ResponseResult{
+		ResultInfo: resultInfo,
+		Result:     result,
+		DenyReason: denyReason,
+	})
+}
 
-	// Read the file multiple times, each time read up to buffer Size bytes,
-	// Save them in slice buff and send the changed slice buff to the
-	// EDR Server. Keep doing this until the file is finished reading.
-	for {
+// ManagerTriage function implementation of gRPC Service.
+// This function handles a Triage request sent by the EDR Server and returns
+// a JSON snapshot of processes, network connections, logged-on users,
+// services, scheduled tasks and autoruns of the host.
+func (*AgentGRPCService) ManagerTriage(
+	ctx context.Context, in *rpc.TriageQuery) (*rpc.TriageSnapshot, error) {
 
-		// Read up to bufferSize bytes, and stores them to slice buff
-		bytesRead, err := file.Read(buff)
+	snapshot, err := json.Marshal(Triage(in.GetSkipHashes()))
+	if err != nil {
+		return nil, err
+	}
+	return &rpc.TriageSnapshot{Snapshot: string(snapshot)}, nil
+}
 
-		// If the error is equal to io.EOF, read file is done,
-		// exits the loop and ends the file sending.
-		// If an error occurs when the file is not finished reading,
-		// stop the reading process and return an error.
-		if err != nil {
-			if err != io.EOF {
-				return err
-			}
-			break
-		}
+// ManagerListQuarantine function implementation of gRPC Service.
+// This function handles a request that lists quarantined files sent by the
+// EDR Server and returns a QuarantineList. If FilePath of request is not
+// empty, only the quarantined files of this path are returned.
+func (*AgentGRPCService) ManagerListQuarantine(
+	ctx context.Context, in *rpc.QuarantineQuery) (*rpc.QuarantineList, error) {
 
-		// Initializing FileData with FileChunk equals as changed
-		// slice buff, length is the number of bytes read
-		resp := &rpc.FileData{
-			FileChunk: buff[:bytesRead],
-		}
+	items, err := ListQuarantineItems(in.GetFilePath())
+	if err != nil {
+		return nil, err
+	}
 
-		// Send resp to EDR server
-		if err = ResultFileStream.Send(resp); err != nil {
-			return err
-		}
+	quarantineList := &rpc.QuarantineList{}
+	for _, item := range items {
+		quarantineList.Items = append(quarantineList.Items, &rpc.QuarantineItem{
+			Id:             item.Id,
+			OriginalPath:   item.OriginalPath,
+			Sha256:         item.Sha256,
+			Size:           item.Size,
+			QuarantineTime: item.QuarantineTime,
+		})
 	}
-	return nil
+	return quarantineList, nil
 }
 
 // This function converts string number to int32 number
@@ -694,3 +1059,12 @@ func ConvertStringToInt32(numberString string) int32 {
 	number, _ := strconv.Atoi(numberString)
 	return int32(number)
 }
+
+// This function returns a copy of map string
+func CopyMapString(mapString map[string]string) map[string]string {
+	copied := make(map[string]string, len(mapString))
+	for key, value := range mapString {
+		copied[key] = value
+	}
+	return copied
+}
@@ -0,0 +1,308 @@
+/**
+ * File:    collect.go
+ *
+ * Summary of File:
+ *
+ * 	This file contains the code related to the collection of files of the
+ * 	agent.
+ * 	Functions:
+ * 	Expanding environment variables (%TEMP%) and globs of collected paths.
+ * 	Walking directories up to a recursion depth.
+ * 	Writing the files into a zip or tar.gz archive with a manifest of
+ *	collected and skipped files, limited by file size and total size.
+ * 	Sending the archive to the EDR server.
+ */
+
+package agent
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bkedr/pkg/rpc"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Name of manifest file in archive
+const COLLECT_MANIFEST_NAME = "manifest.json"
+
+// Status of collected file
+const (
+	COLLECT_COLLECTED = "collected"
+	COLLECT_SKIPPED   = "skipped"
+	COLLECT_ERROR     = "error"
+)
+
+// CollectedFile struct is used to encode json of a file in collect manifest
+type CollectedFile struct {
+	Path        string `json:"Path"`
+	ArchiveName string `json:"ArchiveName,omitempty"`
+	Size        int64  `json:"Size"`
+	Sha256      string `json:"Sha256,omitempty"`
+	ModTime     string `json:"ModTime"`
+	Status      string `json:"Status"`
+	Error       string `json:"Error,omitempty"`
+}
+
+// archiveWriter writes files into a zip or tar.gz archive
+type archiveWriter interface {
+	Create(name string, size int64, modTime time.Time) (io.Writer, error)
+	Close() error
+}
+
+// zipArchive writes files into a zip archive
+type zipArchive struct {
+	writer *zip.Writer
+}
+
+// Create adds a compressed file to zip archive
+func (z *zipArchive) Create(name string, size int64, modTime time.Time) (io.Writer, error) {
+	return z.writer.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: modTime,
+	})
+}
+
+// Close writes the central directory of zip archive
+func (z *zipArchive) Close() error {
+	return z.writer.Close()
+}
+
+// tarArchive writes files into a tar.gz archive
+type tarArchive struct {
+	gzipWriter *gzip.Writer
+	writer     *tar.Writer
+}
+
+// Create adds the header of file to tar archive. The size must be equal
+// to the number of bytes written.
+func (t *tarArchive) Create(name string, size int64, modTime time.Time) (io.Writer, error) {
+	err := t.writer.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    size,
+		ModTime: modTime,
+	})
+	return t.writer, err
+}
+
+// Close flushes tar archive and gzip stream
+func (t *tarArchive) Close() error {
+	if err := t.writer.Close(); err != nil {
+		return err
+	}
+	return t.gzipWriter.Close()
+}
+
+// This function replaces %NAME% by the value of environment variable NAME
+func ExpandEnvPath(path string) string {
+	re := regexp.MustCompile(`%([^%]+)%`)
+	return re.ReplaceAllStringFunc(path, func(match string) string {
+		if value, ok := os.LookupEnv(match[1 : len(match)-1]); ok {
+			return value
+		}
+		return match
+	})
+}
+
+// This function returns the name of file in archive. The volume separator
+// is removed, so C:\Users\a.ps1 is C/Users/a.ps1.
+func ArchiveName(filePath string) string {
+	name := filepath.ToSlash(filePath)
+	name = strings.Replace(name, ":", "", 1)
+	return strings.TrimLeft(name, "/")
+}
+
+// This function expands the paths of collectInfo and returns all files.
+// Directories are walked up to MaxDepth levels, 1 is only the files in the
+// directory, 0 is unlimited.
+func CollectPaths(collectInfo *rpc.CollectInfo) ([]string, []*CollectedFile) {
+
+	filePaths := make([]string, 0)
+	failed := make([]*CollectedFile, 0)
+	seen := make(map[string]bool)
+
+	for _, pattern := range collectInfo.GetPaths() {
+		pattern = ExpandEnvPath(strings.TrimSpace(pattern))
+		if pattern == "" {
+			continue
+		}
+		matches, err := filepath.Glob(pattern)
+		if err == nil && len(matches) == 0 {
+			err = errors.New("no file matches")
+		}
+		if err != nil {
+			failed = append(failed, &CollectedFile{Path: pattern, Status: COLLECT_ERROR,
+				Error: err.Error()})
+			continue
+		}
+
+		for _, match := range matches {
+			rootDepth := strings.Count(filepath.Clean(match), string(os.PathSeparator))
+			filepath.Walk(match, func(filePath string, info os.FileInfo, err error) error {
+				if err != nil {
+					failed = append(failed, &CollectedFile{Path: filePath,
+						Status: COLLECT_ERROR, Error: err.Error()})
+					return nil
+				}
+				if info.IsDir() {
+					depth := strings.Count(filePath, string(os.PathSeparator)) - rootDepth
+					if collectInfo.GetMaxDepth() > 0 && depth >= int(collectInfo.GetMaxDepth()) {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+				if info.Mode().IsRegular() && !seen[filePath] {
+					seen[filePath] = true
+					filePaths = append(filePaths, filePath)
+				}
+				return nil
+			})
+		}
+	}
+	return filePaths, failed
+}
+
+// This function writes the files of collectInfo into archive file and
+// returns the manifest of collected and skipped files. The manifest is also
+// written into the archive.
+func CollectArchive(collectInfo *rpc.CollectInfo, archiveFile io.Writer) ([]*CollectedFile, error) {
+
+	var archive archiveWriter
+	switch collectInfo.GetFormat() {
+	case "", "zip":
+		archive = &zipArchive{writer: zip.NewWriter(archiveFile)}
+	case "tar":
+		gzipWriter := gzip.NewWriter(archiveFile)
+		archive = &tarArchive{gzipWriter: gzipWriter, writer: tar.NewWriter(gzipWriter)}
+	default:
+		return nil, errors.New("format " + collectInfo.GetFormat() + " is not supported")
+	}
+
+	maxFileSize := CurrentConfig().MaxFileSize
+	fileLimit := MinLimit(collectInfo.GetMaxFileSize(), maxFileSize)
+	totalLimit := MinLimit(collectInfo.GetMaxTotalSize(), maxFileSize)
+	var totalSize int64
+
+	filePaths, manifest := CollectPaths(collectInfo)
+	for _, filePath := range filePaths {
+		item := &CollectedFile{Path: filePath, Status: COLLECT_COLLECTED}
+		manifest = append(manifest, item)
+
+		info, err := os.Stat(filePath)
+		if err != nil {
+			item.Status, item.Error = COLLECT_ERROR, err.Error()
+			continue
+		}
+		item.Size = info.Size()
+		item.ModTime = info.ModTime().Format(time.RFC3339Nano)
+
+		// Skip the files that exceed the limits, the manifest keeps them
+		if fileLimit > 0 && item.Size > fileLimit {
+			item.Status, item.Error = COLLECT_SKIPPED, "file exceeds max file size"
+			continue
+		}
+		if totalLimit > 0 && totalSize+item.Size > totalLimit {
+			item.Status, item.Error = COLLECT_SKIPPED, "archive exceeds max total size"
+			continue
+		}
+
+		item.ArchiveName = ArchiveName(filePath)
+		item.Sha256, err = AddArchiveFile(archive, filePath, item.ArchiveName, info)
+		if err != nil {
+			// a broken entry of tar can not be recovered
+			if _, ok := archive.(*tarArchive); ok {
+				return nil, err
+			}
+			item.Status, item.Error = COLLECT_ERROR, err.Error()
+			continue
+		}
+		totalSize += item.Size
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	writer, err := archive.Create(COLLECT_MANIFEST_NAME, int64(len(data)), time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+	return manifest, archive.Close()
+}
+
+// This function writes the file into archive and returns its SHA-256
+func AddArchiveFile(archive archiveWriter, filePath string, name string,
+	info os.FileInfo) (string, error) {
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	writer, err := archive.Create(name, info.Size(), info.ModTime())
+	if err != nil {
+		return "", err
+	}
+
+	// tar needs exactly the size of header, the file may grow while copying
+	hash := sha256.New()
+	if _, err := io.CopyN(io.MultiWriter(writer, hash), file, info.Size()); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// This function writes the archive of collectInfo to a temporary file,
+// then sends the metadata with the manifest and the content of archive.
+func SendCollect(collectInfo *rpc.CollectInfo, stream FileDataSender) error {
+
+	archiveFile, err := ioutil.TempFile("", "bkedr_collect_*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(archiveFile.Name())
+	defer archiveFile.Close()
+
+	manifest, err := CollectArchive(collectInfo, archiveFile)
+	if err != nil {
+		return err
+	}
+	if err := archiveFile.Close(); err != nil {
+		return err
+	}
+
+	fileMeta, err := GetFileMeta(archiveFile.Name())
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	fileMeta.FilePath = strings.Join(collectInfo.GetPaths(), ";")
+	fileMeta.Manifest = string(data)
+
+	file, err := os.Open(archiveFile.Name())
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return SendContent(stream, fileMeta, file,
+		MinLimit(collectInfo.GetMaxRate(), CurrentConfig().MaxTransferRate))
+}
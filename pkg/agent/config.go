@@ -0,0 +1,446 @@
+/**
+ * File:    config.go
+ *
+ * Summary of File:
+ *
+ * 	This file contains the code related to the config of the agent. The
+ * 	effective config is the config file, then the config profile pushed by
+ *	the EDR server, then the env vars, then the flags: a later source
+ *	overrides the fields of the earlier sources.
+ * 	Functions:
+ * 	Finding the config file from the -config flag, the BKEDR_AGENT_CONFIG
+ *	env var or the default path.
+ * 	Overriding fields with the env vars BKEDR_AGENT_<Field> and the flags
+ *	-set <Field>=<value>.
+ * 	Verifying the signature of the config profile pushed by the EDR server,
+ *	applying and saving it without restart, and returning the effective
+ *	config.
+ * 	Checking the level of agent log and the AllowedActions of agent config.
+ */
+
+package agent
+
+import (
+	"bkedr/pkg/rpc"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Path of agent config of old versions, used if CONFIG_PATH does not
+	// exist
+	LEGACY_CONFIG_PATH = "C:\\Windows\\System32\\BSkedrAgent\\windowsagent.conf"
+	// Env var of the path of agent config
+	CONFIG_PATH_ENV = "BKEDR_AGENT_CONFIG"
+	// Prefix of the env vars that override a field of agent config
+	CONFIG_ENV_PREFIX = "BKEDR_AGENT_"
+)
+
+// Fields of agent config that a profile of EDR server can set, they are
+// applied without restart
+var profileFields = []string{"ServerHost", "ServerPort", "TelemetryPort",
+	"AdapterInternet", "AllowedActions", "LogLevel", "IsolationAllowlist",
+	"IsolationAllowDns", "IsolationAllowDhcp", "MaxFileSize", "MaxTransferRate",
+	"Policy"}
+
+// ProfileClaims struct is the JSON of pushed profile signed by the EDR
+// server. ExpireTime is Unix time.
+type ProfileClaims struct {
+	RequestId    string `json:"RequestId"`
+	ComputerName string `json:"ComputerName"`
+	Name         string `json:"Name"`
+	Config       string `json:"Config"`
+	ExpireTime   int64  `json:"ExpireTime"`
+}
+
+// Levels of agent log, a level logs the messages of the levels before it
+var logLevels = []string{"error", "warning", "info", "debug"}
+
+// AgentProfileFile struct is the config profile pushed by the EDR server,
+// it is saved in agentProfilePath
+type AgentProfileFile struct {
+	Name   string                 `json:"Name"`
+	Config map[string]interface{} `json:"Config"`
+}
+
+var (
+	// Path of config file that is loaded
+	configPath string
+	// Fields of config file
+	fileConfig map[string]interface{}
+	// Overrides of -set flags, <Field>=<value>
+	flagOverrides []string
+	// Config profile pushed by the EDR server
+	agentProfile AgentProfileFile
+	// Source of the fields of effective config that are not from the file
+	configSources map[string]string
+	// Mutex protects the config and its sources
+	configMutex sync.Mutex
+)
+
+// This function returns the path of agent config: the -config flag, else
+// BKEDR_AGENT_CONFIG, else CONFIG_PATH. LEGACY_CONFIG_PATH is used if
+// CONFIG_PATH does not exist and the agent was installed there.
+func ResolveConfigPath(flagPath string) string {
+	if flagPath != "" {
+		return flagPath
+	}
+	if envPath := os.Getenv(CONFIG_PATH_ENV); envPath != "" {
+		return envPath
+	}
+	if _, err := os.Stat(CONFIG_PATH); os.IsNotExist(err) {
+		if _, err := os.Stat(LEGACY_CONFIG_PATH); err == nil {
+			return LEGACY_CONFIG_PATH
+		}
+	}
+	return CONFIG_PATH
+}
+
+// This function loads the config file of filePath and applies it with the
+// overrides of env vars and of flags (<Field>=<value>).
+func LoadConfig(filePath string, overrides []string) error {
+
+	byteValue, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	agentConfig := struct {
+		AgentConfig []map[string]interface{} `json:"AgentConfig"`
+	}{}
+	if err := json.Unmarshal(byteValue, &agentConfig); err != nil {
+		return errors.New("config " + filePath + " is invalid: " + err.Error())
+	}
+	if len(agentConfig.AgentConfig) == 0 {
+		return errors.New("config " + filePath + " has no AgentConfig")
+	}
+
+	configMutex.Lock()
+	defer configMutex.Unlock()
+	configPath = filePath
+	fileConfig = agentConfig.AgentConfig[0]
+	flagOverrides = overrides
+	if err := ApplyConfig(); err != nil {
+		return err
+	}
+	ApplyAgentConfig(CurrentConfig())
+	return nil
+}
+
+// This function loads the config profile saved in agentProfilePath and
+// applies it. The agent keeps the config without profile if it is invalid.
+func LoadAgentProfile() error {
+
+	data, err := ioutil.ReadFile(agentProfilePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	profile := AgentProfileFile{}
+	if err := json.Unmarshal(data, &profile); err != nil {
+		return errors.New("config profile " + agentProfilePath + " is invalid: " + err.Error())
+	}
+	return SwitchAgentProfile(profile)
+}
+
+// This function applies profile over the config file. The previous profile
+// is applied again if the config with profile is invalid.
+func SwitchAgentProfile(profile AgentProfileFile) error {
+
+	for field := range profile.Config {
+		if !CheckProfileField(field) {
+			return errors.New("field " + field + " cannot be set by a config profile")
+		}
+	}
+
+	configMutex.Lock()
+	defer configMutex.Unlock()
+	previous := agentProfile
+	agentProfile = profile
+	if err := ApplyConfig(); err != nil {
+		agentProfile = previous
+		ApplyConfig()
+		return err
+	}
+	return nil
+}
+
+// This function applies the config profile pushed by the EDR server and
+// saves it, so it is applied again after restart. An empty Config removes
+// the profile.
+func UpdateAgentProfile(name string, config string) error {
+
+	profile := AgentProfileFile{Name: name, Config: make(map[string]interface{})}
+	if config != "" {
+		if err := json.Unmarshal([]byte(config), &profile.Config); err != nil {
+			return err
+		}
+	}
+	if err := SwitchAgentProfile(profile); err != nil {
+		return err
+	}
+	data, err := json.Marshal(profile)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(agentProfilePath, data, 0600)
+}
+
+// This function merges the config file, the config profile, the env vars
+// and the flags, and publishes the effective config. It is called with
+// configMutex locked.
+func ApplyConfig() error {
+
+	config := make(map[string]interface{}, len(fileConfig))
+	for field, value := range fileConfig {
+		config[field] = value
+	}
+	sources := make(map[string]string)
+	for field, value := range agentProfile.Config {
+		config[field] = value
+		sources[field] = "profile " + agentProfile.Name
+	}
+	for _, env := range os.Environ() {
+		key := strings.SplitN(env, "=", 2)
+		if len(key) != 2 || !strings.HasPrefix(strings.ToUpper(key[0]), CONFIG_ENV_PREFIX) ||
+			strings.EqualFold(key[0], CONFIG_PATH_ENV) {
+			continue
+		}
+		field, err := SetConfigValue(config, key[0][len(CONFIG_ENV_PREFIX):], key[1])
+		if err != nil {
+			return errors.New("env " + key[0] + ": " + err.Error())
+		}
+		sources[field] = "env"
+	}
+	for _, override := range flagOverrides {
+		key := strings.SplitN(override, "=", 2)
+		if len(key) != 2 {
+			return errors.New("flag -set " + override + " is not <Field>=<value>")
+		}
+		field, err := SetConfigValue(config, key[0], key[1])
+		if err != nil {
+			return errors.New("flag -set " + override + ": " + err.Error())
+		}
+		sources[field] = "flag"
+	}
+
+	data, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	agentConfig := AgentConfigObj{}
+	if err := json.Unmarshal(data, &agentConfig); err != nil {
+		return err
+	}
+	if err := ValidateAgentConfig(agentConfig); err != nil {
+		return err
+	}
+
+	// the effective config shows the defaults that the agent uses
+	SetConfigDefaults(&agentConfig)
+	currentConfig.Store(&agentConfig)
+	configSources = sources
+	return nil
+}
+
+// This function sets the field of config named key (case insensitive) to
+// value and returns the name of field. A value of a field that is not a
+// string is JSON, a list of strings can also be separated by ",".
+func SetConfigValue(config map[string]interface{}, key string, value string) (string, error) {
+
+	configType := reflect.TypeOf(AgentConfigObj{})
+	for index := 0; index < configType.NumField(); index++ {
+		field := configType.Field(index)
+		name := field.Tag.Get("json")
+		if !strings.EqualFold(name, key) {
+			continue
+		}
+
+		switch {
+		case field.Type.Kind() == reflect.String:
+			config[name] = value
+		case field.Type.Kind() == reflect.Slice && !strings.HasPrefix(strings.TrimSpace(value), "["):
+			values := make([]string, 0)
+			for _, item := range strings.Split(value, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					values = append(values, item)
+				}
+			}
+			config[name] = values
+		default:
+			var decoded interface{}
+			if err := json.Unmarshal([]byte(value), &decoded); err != nil {
+				return "", err
+			}
+			config[name] = decoded
+		}
+		return name, nil
+	}
+	return "", errors.New("field " + key + " is not in agent config")
+}
+
+// This function checks the fields of config that are not checked by the
+// JSON decoding
+func ValidateAgentConfig(config AgentConfigObj) error {
+
+	if config.LogLevel != "" && !CheckLogLevel(config.LogLevel) {
+		return errors.New("LogLevel " + config.LogLevel + " is not error, warning, info or debug")
+	}
+	for _, action := range config.AllowedActions {
+		if NormalizeAction(action) == "" {
+			return errors.New("AllowedActions contains an empty action")
+		}
+	}
+	return nil
+}
+
+// This function checks that a config profile can set field
+func CheckProfileField(field string) bool {
+	for _, profileField := range profileFields {
+		if profileField == field {
+			return true
+		}
+	}
+	return false
+}
+
+// This function checks that level is a level of agent log
+func CheckLogLevel(level string) bool {
+	for _, logLevel := range logLevels {
+		if strings.EqualFold(logLevel, level) {
+			return true
+		}
+	}
+	return false
+}
+
+// This function checks that the messages of level are logged with the
+// LogLevel of agent config
+func LogEnabled(level string) bool {
+	logLevel := CurrentConfig().LogLevel
+	for _, current := range logLevels {
+		if current == level {
+			return true
+		}
+		if current == logLevel {
+			return false
+		}
+	}
+	return false
+}
+
+// This function checks that the profile is signed by the EDR server for
+// this agent and the request of ctx, and is not expired. It returns why the
+// profile is rejected, or nil.
+func VerifyProfile(ctx context.Context, in *rpc.AgentProfile) error {
+
+	claims := ProfileClaims{}
+	if err := VerifyClaims(in.GetSignature(), &claims); err != nil {
+		return err
+	}
+	computerName, _ := os.Hostname()
+	requestId := RequestIdFromContext(ctx)
+	switch {
+	case claims.RequestId == "" || claims.RequestId != requestId:
+		return errors.New("profile is signed for request " + claims.RequestId + ", not " + requestId)
+	case claims.ComputerName != computerName:
+		return errors.New("profile is signed for agent " + claims.ComputerName + ", not " + computerName)
+	case claims.Name != in.GetName() || claims.Config != in.GetConfig():
+		return errors.New("profile is not the signed profile")
+	case time.Now().Unix() > claims.ExpireTime:
+		return errors.New("signature of profile expired at " +
+			time.Unix(claims.ExpireTime, 0).Format("2006-01-02 15:04:05"))
+	}
+	return nil
+}
+
+// SetConfig function implementation of gRPC Service.
+// This function applies the config profile sent by the EDR Server and
+// returns a ResponseResult. The profile must be signed by the EDR server,
+// see VerifyProfile. If the address of EDR server changes, the agent
+// registers with the new server.
+func (*AgentGRPCService) SetConfig(
+	ctx context.Context, in *rpc.AgentProfile) (*rpc.ResponseResult, error) {
+
+	if err := VerifyProfile(ctx, in); err != nil {
+		return &rpc.ResponseResult{
+			ResultInfo: "Error rejects config profile " + in.GetName() + ": " + err.Error(),
+			Result:     false,
+		}, nil
+	}
+
+	previous := CurrentConfig()
+	if err := UpdateAgentProfile(in.GetName(), in.GetConfig()); err != nil {
+		return &rpc.ResponseResult{
+			ResultInfo: "Error applies config profile " + in.GetName() + ": " + err.Error(),
+			Result:     false,
+		}, nil
+	}
+
+	resultInfo := "Success applies config profile " + in.GetName()
+	config := CurrentConfig()
+	if server := config.ServerHost + ":" + config.ServerPort; server !=
+		previous.ServerHost+":"+previous.ServerPort {
+		if err := RunSocketDial(); err != nil {
+			resultInfo += ", error registers with server " + server + ": " + err.Error()
+		} else {
+			resultInfo += ", registered with server " + server
+		}
+	}
+	return &rpc.ResponseResult{
+		ResultInfo: resultInfo,
+		Result:     true,
+	}, nil
+}
+
+// GetConfig function implementation of gRPC Service.
+// This function returns the effective config of agent and the source of
+// the fields that are not from the config file.
+func (*AgentGRPCService) GetConfig(
+	ctx context.Context, in *rpc.ConfigQuery) (*rpc.AgentConfigView, error) {
+
+	configMutex.Lock()
+	defer configMutex.Unlock()
+	config, err := json.Marshal(CurrentConfig())
+	if err != nil {
+		return nil, err
+	}
+	sources, err := json.Marshal(configSources)
+	if err != nil {
+		return nil, err
+	}
+	return &rpc.AgentConfigView{
+		ConfigPath: configPath,
+		Profile:    agentProfile.Name,
+		Config:     string(config),
+		Sources:    string(sources),
+	}, nil
+}
+
+// This function returns the action in lower case without spaces
+func NormalizeAction(action string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(action), " ", ""))
+}
+
+// This function checks that action is in AllowedActions of agent config.
+// Every action is allowed if AllowedActions is empty.
+func CheckActionAllowed(action string) error {
+	allowedActions := CurrentConfig().AllowedActions
+	if len(allowedActions) == 0 || action == "" {
+		return nil
+	}
+	for _, allowed := range allowedActions {
+		if NormalizeAction(allowed) == NormalizeAction(action) {
+			return nil
+		}
+	}
+	return errors.New("action " + action + " is not allowed by agent config")
+}
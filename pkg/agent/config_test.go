@@ -0,0 +1,200 @@
+/**
+ * File:    config_test.go
+ *
+ * Summary of File:
+ *
+ * 	This file contains the tests of the config of the agent.
+ * 	Functions:
+ * 	Setting the effective config of a test.
+ * 	Testing that the handlers read a consistent config while the config
+ *	profiles of EDR server are applied.
+ * 	Testing that the agent only applies the profiles signed by the EDR
+ *	server for the agent and the request.
+ */
+
+package agent
+
+import (
+	"bkedr/pkg/rpc"
+	"context"
+	"crypto/ed25519"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// This function publishes a copy of the effective config changed by set,
+// the previous config is published again when the test ends
+func setTestConfig(t *testing.T, set func(config *AgentConfigObj)) {
+
+	previous := CurrentConfig()
+	config := *previous
+	set(&config)
+	currentConfig.Store(&config)
+	t.Cleanup(func() { currentConfig.Store(previous) })
+}
+
+// This function loads a config file in a temporary directory, the config
+// and the profile are loaded again when the test ends
+func loadTestConfig(t *testing.T, content string) {
+
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "windowsagent.conf")
+	if err := ioutil.WriteFile(filePath, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	previous := CurrentConfig()
+	configMutex.Lock()
+	previousPath, previousFile, previousFlags := configPath, fileConfig, flagOverrides
+	previousProfile, previousSources := agentProfile, configSources
+	configMutex.Unlock()
+	t.Cleanup(func() {
+		configMutex.Lock()
+		defer configMutex.Unlock()
+		configPath, fileConfig, flagOverrides = previousPath, previousFile, previousFlags
+		agentProfile, configSources = previousProfile, previousSources
+		currentConfig.Store(previous)
+		ApplyAgentConfig(previous)
+	})
+
+	if err := LoadConfig(filePath, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// This function tests that a handler that reads the config while profiles
+// are applied sees the fields of one profile, never a mix of two
+func TestConfigProfileSnapshot(t *testing.T) {
+
+	loadTestConfig(t, `{"AgentConfig": [{"ServerHost": "127.0.0.1", "ServerPort": "9000"}]}`)
+	profiles := []string{
+		`{"AllowedActions": ["kill"], "MaxFileSize": 1, "LogLevel": "error"}`,
+		`{"AllowedActions": ["suspend"], "MaxFileSize": 2, "LogLevel": "debug"}`,
+	}
+	want := map[int64]string{1: "kill", 2: "suspend"}
+
+	var wait sync.WaitGroup
+	wait.Add(1)
+	go func() {
+		defer wait.Done()
+		for index := 0; index < 200; index++ {
+			if err := UpdateAgentProfile("test", profiles[index%2]); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	for index := 0; index < 2000; index++ {
+		config := CurrentConfig()
+		if config.MaxFileSize == 0 {
+			continue
+		}
+		if len(config.AllowedActions) != 1 || config.AllowedActions[0] != want[config.MaxFileSize] {
+			t.Fatalf("config mixes profiles: %v %d", config.AllowedActions, config.MaxFileSize)
+		}
+		// the handlers read the same config
+		CheckActionAllowed("kill")
+		CheckPolicy("ManagerNetworkAdapter", &rpc.NetworkAdapter{Action: "enable"}, false)
+		IsAllowedPutPath("/tmp/file")
+		LogEnabled("info")
+	}
+	wait.Wait()
+
+	if config := CurrentConfig(); config.ServerHost != "127.0.0.1" || config.MaxFileSize != 2 {
+		t.Errorf("config is %s:%s MaxFileSize %d", config.ServerHost, config.ServerPort,
+			config.MaxFileSize)
+	}
+}
+
+// This function tests that SetConfig rejects a profile that is not signed
+// by the EDR server for the agent and the request, and applies a signed one
+func TestSetConfigSignature(t *testing.T) {
+
+	loadTestConfig(t, `{"AgentConfig": [{"ServerHost": "127.0.0.1", "ServerPort": "9000"}]}`)
+	key := setTestOverrideKey(t)
+	_, otherKey, _ := ed25519.GenerateKey(nil)
+	computerName, _ := os.Hostname()
+	// the unsigned profiles would register the agent with another server
+	config := `{"ServerHost": "203.0.113.7", "AllowedActions": ["isolate"]}`
+	profileClaims := func(set func(claims *ProfileClaims)) ProfileClaims {
+		claims := ProfileClaims{
+			RequestId:    "request-1",
+			ComputerName: computerName,
+			Name:         "servers",
+			Config:       config,
+			ExpireTime:   time.Now().Add(time.Minute).Unix(),
+		}
+		if set != nil {
+			set(&claims)
+		}
+		return claims
+	}
+
+	tests := []struct {
+		name      string
+		signature string
+	}{
+		{name: "unsigned"},
+		{name: "other key", signature: signTestClaims(t, otherKey, profileClaims(nil))},
+		{name: "other agent", signature: signTestClaims(t, key, profileClaims(func(claims *ProfileClaims) {
+			claims.ComputerName = "other-agent"
+		}))},
+		{name: "other request", signature: signTestClaims(t, key, profileClaims(func(claims *ProfileClaims) {
+			claims.RequestId = "request-2"
+		}))},
+		{name: "other config", signature: signTestClaims(t, key, profileClaims(func(claims *ProfileClaims) {
+			claims.Config = `{"AllowedActions": ["isolate"]}`
+		}))},
+		{name: "expired", signature: signTestClaims(t, key, profileClaims(func(claims *ProfileClaims) {
+			claims.ExpireTime = time.Now().Add(-time.Minute).Unix()
+		}))},
+	}
+
+	ctx := metadata.NewIncomingContext(context.Background(),
+		metadata.Pairs(REQUEST_ID_METADATA, "request-1"))
+	service := NewAgentGRPCService()
+	for _, test := range tests {
+		responseResult, err := service.SetConfig(ctx, &rpc.AgentProfile{
+			Name:      "servers",
+			Config:    config,
+			Signature: test.signature,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if responseResult.GetResult() {
+			t.Errorf("%s: profile is applied: %s", test.name, responseResult.GetResultInfo())
+		}
+		if current := CurrentConfig(); current.ServerHost != "127.0.0.1" ||
+			len(current.AllowedActions) != 0 {
+			t.Fatalf("%s: config is changed: %s %v", test.name, current.ServerHost,
+				current.AllowedActions)
+		}
+	}
+
+	// a signed profile without ServerHost is applied without registering
+	// with another server
+	config = `{"AllowedActions": ["isolate"]}`
+	responseResult, err := service.SetConfig(ctx, &rpc.AgentProfile{
+		Name:      "servers",
+		Config:    config,
+		Signature: signTestClaims(t, key, profileClaims(nil)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !responseResult.GetResult() {
+		t.Fatalf("signed profile is rejected: %s", responseResult.GetResultInfo())
+	}
+	if actions := CurrentConfig().AllowedActions; !reflect.DeepEqual(actions, []string{"isolate"}) {
+		t.Errorf("AllowedActions is %v", actions)
+	}
+}
@@ -0,0 +1,192 @@
+/**
+ * File:    file.go
+ *
+ * Summary of File:
+ *
+ * 	This file contains the code related to the file handling of the agent.
+ * 	Functions:
+ * 	Computing metadata of file: size, hashes and timestamps, that is sent
+ *	to the EDR server before the content of file.
+ * 	Sending file from an offset to resume the download, compressing the
+ *	content and limiting the size and the rate of transfer.
+ */
+
+package agent
+
+import (
+	"bkedr/pkg/rpc"
+	"bufio"
+	"compress/gzip"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// 64KiB, max length of chunk
+const FILE_CHUNK_SIZE = 64 * 1024
+
+// FileDataSender is the server stream of ManagerGetFile and ManagerCollect
+type FileDataSender interface {
+	Send(*rpc.FileData) error
+}
+
+// chunkWriter sends all bytes to the EDR server as file chunks. If rate is
+// not 0, it sleeps to keep the transfer under rate bytes per second.
+type chunkWriter struct {
+	stream FileDataSender
+	rate   int64
+	sent   int64
+	start  time.Time
+}
+
+// Write sends p in chunks of up to FILE_CHUNK_SIZE bytes
+func (c *chunkWriter) Write(p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		end := written + FILE_CHUNK_SIZE
+		if end > len(p) {
+			end = len(p)
+		}
+		if err := c.stream.Send(&rpc.FileData{FileChunk: p[written:end]}); err != nil {
+			return written, err
+		}
+		c.sent += int64(end - written)
+		written = end
+
+		// sleep until the time that sent bytes are allowed by rate
+		if c.rate > 0 {
+			allowed := time.Duration(c.sent * int64(time.Second) / c.rate)
+			if wait := allowed - time.Since(c.start); wait > 0 {
+				time.Sleep(wait)
+			}
+		}
+	}
+	return written, nil
+}
+
+// This function sends the file to the EDR server. The first message is the
+// metadata of file. The content is sent from the offset of request if the
+// file is not changed since the partial download (same SHA-256), otherwise
+// from the beginning.
+func SendFile(fileInfo *rpc.FileInfo, stream FileDataSender) error {
+
+	filePath := fileInfo.GetFilePath()
+
+	// check size before hashing, so a big file is rejected quickly
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return err
+	}
+	config := CurrentConfig()
+	maxSize := MinLimit(fileInfo.GetMaxSize(), config.MaxFileSize)
+	if maxSize > 0 && info.Size() > maxSize {
+		return fmt.Errorf("size of file %d exceeds max size %d", info.Size(), maxSize)
+	}
+
+	compression := fileInfo.GetCompression()
+	if compression != "" && compression != "gzip" {
+		return errors.New("compression " + compression + " is not supported")
+	}
+
+	fileMeta, err := GetFileMeta(filePath)
+	if err != nil {
+		return err
+	}
+	offset := fileInfo.GetOffset()
+	if offset < 0 || offset > fileMeta.Size || fileInfo.GetSha256() != fileMeta.Sha256 {
+		offset = 0
+	}
+	fileMeta.Offset = offset
+	fileMeta.Compression = compression
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	return SendContent(stream, fileMeta, file,
+		MinLimit(fileInfo.GetMaxRate(), config.MaxTransferRate))
+}
+
+// This function sends the metadata, then the content of reader, compressed
+// with the compression of metadata, in chunks of FILE_CHUNK_SIZE bytes.
+func SendContent(stream FileDataSender, fileMeta *rpc.FileMeta, reader io.Reader,
+	rate int64) error {
+
+	// Send metadata of file before the content of file
+	if err := stream.Send(&rpc.FileData{Meta: fileMeta}); err != nil {
+		return err
+	}
+
+	// Content is buffered, so each message carries a full chunk
+	chunks := &chunkWriter{
+		stream: stream,
+		rate:   rate,
+		start:  time.Now(),
+	}
+	buffered := bufio.NewWriterSize(chunks, FILE_CHUNK_SIZE)
+	if fileMeta.GetCompression() == "gzip" {
+		gzipWriter := gzip.NewWriter(buffered)
+		if _, err := io.Copy(gzipWriter, reader); err != nil {
+			return err
+		}
+		if err := gzipWriter.Close(); err != nil {
+			return err
+		}
+	} else if _, err := io.Copy(buffered, reader); err != nil {
+		return err
+	}
+	return buffered.Flush()
+}
+
+// This function returns the smaller limit, 0 is unlimited
+func MinLimit(a int64, b int64) int64 {
+	if a <= 0 || (b > 0 && b < a) {
+		return b
+	}
+	return a
+}
+
+// This function reads the file and returns its metadata with size,
+// SHA-256, MD5 and timestamps.
+func GetFileMeta(filePath string) (*rpc.FileMeta, error) {
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	// compute both hashes in one read
+	sha256Hash := sha256.New()
+	md5Hash := md5.New()
+	size, err := io.Copy(io.MultiWriter(sha256Hash, md5Hash), file)
+	if err != nil {
+		return nil, err
+	}
+
+	createTime, accessTime := GetFileTimes(info)
+	return &rpc.FileMeta{
+		FilePath:   filePath,
+		Size:       size,
+		Sha256:     hex.EncodeToString(sha256Hash.Sum(nil)),
+		Md5:        hex.EncodeToString(md5Hash.Sum(nil)),
+		ModTime:    info.ModTime().Format(time.RFC3339Nano),
+		AccessTime: accessTime,
+		CreateTime: createTime,
+	}, nil
+}
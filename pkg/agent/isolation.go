@@ -0,0 +1,174 @@
+/**
+ * File:    isolation.go
+ *
+ * Summary of File:
+ *
+ * 	This file contains the code related to the network isolation of the agent.
+ * 	Functions:
+ * 	Isolating the host: all traffic is blocked except the traffic to the
+ *	bkedr server, DNS, DHCP and the allowlist in config file.
+ * 	Saving the isolation state, so the isolation is applied again after
+ *	the agent restarts.
+ * 	Removing the isolation.
+ */
+
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// IsolationState struct is used to encode json of isolation state file.
+// FirewallPolicies is the firewall policy of each profile before the
+// isolation (Windows), it is restored when the isolation is removed.
+type IsolationState struct {
+	Isolated         bool              `json:"Isolated"`
+	AllowedIps       []string          `json:"AllowedIps"`
+	AllowDns         bool              `json:"AllowDns"`
+	AllowDhcp        bool              `json:"AllowDhcp"`
+	IsolateTime      string            `json:"IsolateTime"`
+	FirewallPolicies map[string]string `json:"FirewallPolicies,omitempty"`
+}
+
+// This function isolates the host from the network. The traffic to the
+// bkedr server and the allowlist is allowed, so the server can still send
+// request to agent. The isolation state is saved to state file.
+func IsolateHost() error {
+
+	config := CurrentConfig()
+	allowedIps, err := ResolveAllowedIps(append([]string{config.ServerHost},
+		config.IsolationAllowlist...))
+	if err != nil {
+		return err
+	}
+
+	state := &IsolationState{
+		Isolated:    true,
+		AllowedIps:  allowedIps,
+		AllowDns:    config.IsolationAllowDns,
+		AllowDhcp:   config.IsolationAllowDhcp,
+		IsolateTime: time.Now().Format("2006-01-02 15:04:05.000"),
+	}
+
+	// a host that is already isolated keeps the firewall policies of
+	// before the first isolation
+	previous, err := ReadIsolationState()
+	if err != nil {
+		return err
+	}
+	if previous.Isolated {
+		state.FirewallPolicies = previous.FirewallPolicies
+	}
+	if err := ApplyIsolation(state); err != nil {
+		return err
+	}
+	return WriteIsolationState(state)
+}
+
+// This function removes the isolation, restores the firewall policies of
+// before the isolation and saves the isolation state
+func UnisolateHost() error {
+	state, err := ReadIsolationState()
+	if err != nil {
+		return err
+	}
+	if err := RemoveIsolation(state); err != nil {
+		return err
+	}
+	return WriteIsolationState(&IsolationState{Isolated: false})
+}
+
+// This function reads the isolation state file. If the host was isolated
+// before the agent restarts, the isolation is applied again.
+func RestoreIsolation() error {
+	state, err := ReadIsolationState()
+	if err != nil || !state.Isolated {
+		return err
+	}
+	return ApplyIsolation(state)
+}
+
+// This function reads the isolation state file. The state is not isolated
+// if the file does not exist.
+func ReadIsolationState() (*IsolationState, error) {
+
+	state := &IsolationState{}
+	byteValue, err := ioutil.ReadFile(isolationStatePath)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(byteValue, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// This function writes the isolation state to state file
+func WriteIsolationState(state *IsolationState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(isolationStatePath, data, 0600)
+}
+
+// This function returns the ip addresses and networks of the hosts. Host is
+// an ip address, a network in CIDR notation or a host name.
+func ResolveAllowedIps(hosts []string) ([]string, error) {
+
+	allowedIps := make([]string, 0)
+	for _, host := range hosts {
+		host = strings.TrimSpace(host)
+		if host == "" {
+			continue
+		}
+		if net.ParseIP(host) != nil {
+			allowedIps = append(allowedIps, host)
+			continue
+		}
+		if _, _, err := net.ParseCIDR(host); err == nil {
+			allowedIps = append(allowedIps, host)
+			continue
+		}
+
+		// host name is resolved before isolation, DNS may be blocked later
+		ips, err := net.LookupHost(host)
+		if err != nil {
+			return nil, err
+		}
+		allowedIps = append(allowedIps, ips...)
+	}
+
+	if len(allowedIps) == 0 {
+		return nil, errors.New("no allowed ip for isolation")
+	}
+	return allowedIps, nil
+}
+
+// This function runs the command and returns error with the output of
+// command if the command fails.
+func RunCommand(name string, args ...string) error {
+	return RunCmd(exec.Command(name, args...))
+}
+
+// This function runs the Cmd struct and returns error with the output of
+// command if the command fails.
+func RunCmd(cmd *exec.Cmd) error {
+	if output, err := cmd.CombinedOutput(); err != nil {
+		if message := strings.TrimSpace(string(output)); message != "" {
+			return errors.New(message)
+		}
+		return err
+	}
+	return nil
+}
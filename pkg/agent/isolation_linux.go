@@ -0,0 +1,83 @@
+/**
+ * File:    isolation_linux.go
+ *
+ * Summary of File:
+ *
+ * 	This file contains the Linux functions used by the network isolation.
+ *	It executes nft command to create a nftables table that drops all
+ *	traffic that is not allowed.
+ */
+
+package agent
+
+import (
+	"os/exec"
+	"strings"
+)
+
+// Name of nftables table that is created by the isolation
+const ISOLATION_TABLE = "inet bkedr_isolation"
+
+// This function creates the nftables table that allows the traffic of the
+// state and drops other traffic. The old table is deleted in the same
+// transaction, so the function can be called many times.
+// Example: nft -f - with the ruleset:
+// table inet bkedr_isolation { chain input { ...; policy drop; ... } }
+func ApplyIsolation(state *IsolationState) error {
+
+	// split the allowed ip to IPv4 and IPv6
+	ipv4 := make([]string, 0)
+	ipv6 := make([]string, 0)
+	for _, ip := range state.AllowedIps {
+		if strings.Contains(ip, ":") {
+			ipv6 = append(ipv6, ip)
+		} else {
+			ipv4 = append(ipv4, ip)
+		}
+	}
+
+	input := []string{"iif \"lo\" accept"}
+	output := []string{"oif \"lo\" accept"}
+	if len(ipv4) != 0 {
+		input = append(input, "ip saddr { "+strings.Join(ipv4, ", ")+" } accept")
+		output = append(output, "ip daddr { "+strings.Join(ipv4, ", ")+" } accept")
+	}
+	if len(ipv6) != 0 {
+		// IPv6 needs neighbor discovery to reach the allowed ip
+		input = append(input, "ip6 saddr { "+strings.Join(ipv6, ", ")+" } accept",
+			"icmpv6 type { nd-neighbor-solicit, nd-neighbor-advert } accept")
+		output = append(output, "ip6 daddr { "+strings.Join(ipv6, ", ")+" } accept",
+			"icmpv6 type { nd-neighbor-solicit, nd-neighbor-advert } accept")
+	}
+	if state.AllowDns {
+		// only the replies of DNS queries, not any packet from port 53
+		input = append(input, "udp sport 53 ct state established,related accept",
+			"tcp sport 53 ct state established,related accept")
+		output = append(output, "udp dport 53 accept", "tcp dport 53 accept")
+	}
+	if state.AllowDhcp {
+		input = append(input, "udp sport 67 udp dport 68 accept")
+		output = append(output, "udp sport 68 udp dport 67 accept")
+	}
+
+	ruleset := "table " + ISOLATION_TABLE + "\n" +
+		"delete table " + ISOLATION_TABLE + "\n" +
+		"table " + ISOLATION_TABLE + " {\n" +
+		"\tchain input {\n\t\ttype filter hook input priority -10; policy drop;\n\t\t" +
+		strings.Join(input, "\n\t\t") + "\n\t}\n" +
+		"\tchain output {\n\t\ttype filter hook output priority -10; policy drop;\n\t\t" +
+		strings.Join(output, "\n\t\t") + "\n\t}\n" +
+		"}\n"
+
+	// Cmd struct to execute the nft program, the ruleset is read from stdin
+	cmd := exec.Command("nft", "-f", "-")
+	cmd.Stdin = strings.NewReader(ruleset)
+	return RunCmd(cmd)
+}
+
+// This function deletes the nftables table that is created by the isolation,
+// the rules of host are not changed by the isolation.
+// Example: nft delete table inet bkedr_isolation
+func RemoveIsolation(state *IsolationState) error {
+	return RunCommand("nft", "delete", "table", "inet", "bkedr_isolation")
+}
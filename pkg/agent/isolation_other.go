@@ -0,0 +1,30 @@
+//go:build !windows && !linux
+// +build !windows,!linux
+
+/**
+ * File:    isolation_other.go
+ *
+ * Summary of File:
+ *
+ * 	This file contains the functions used by the network isolation on the
+ *	operating systems that are not supported. All functions return error.
+ */
+
+package agent
+
+import (
+	"errors"
+)
+
+// Error is returned when the operating system does not support isolation
+var ErrIsolationNotSupported = errors.New("isolation is not supported on this operating system")
+
+// This function returns ErrIsolationNotSupported
+func ApplyIsolation(state *IsolationState) error {
+	return ErrIsolationNotSupported
+}
+
+// This function returns ErrIsolationNotSupported
+func RemoveIsolation(state *IsolationState) error {
+	return ErrIsolationNotSupported
+}
@@ -0,0 +1,138 @@
+/**
+ * File:    isolation_windows.go
+ *
+ * Summary of File:
+ *
+ * 	This file contains the Windows functions used by the network isolation.
+ *	It executes netsh command of Windows OS to add allow rules and to
+ *	block all traffic that is not allowed.
+ */
+
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"os/exec"
+	"strings"
+)
+
+const (
+	// Name of all firewall rules that are added by the isolation
+	ISOLATION_RULE_NAME = "name=BKEDR ISOLATION"
+	// Firewall policy of Windows, it is restored if the policy of a profile
+	// is not saved
+	DEFAULT_FIREWALL_POLICY = "blockinbound,allowoutbound"
+)
+
+// Profiles of Windows Firewall
+var firewallProfiles = []string{"domainprofile", "privateprofile", "publicprofile"}
+
+// This function adds firewall rules that allow the traffic of the state,
+// then blocks inbound and outbound traffic of all profiles.
+// Example: netsh advfirewall firewall add rule name="BKEDR ISOLATION"
+// dir=out action=allow remoteip=192.xxx.xxx.x
+// netsh advfirewall set allprofiles firewallpolicy blockinbound,blockoutbound
+func ApplyIsolation(state *IsolationState) error {
+
+	// the policies of host are saved before the first isolation, a profile
+	// whose policy can not be read is restored to the default policy
+	if state.FirewallPolicies == nil {
+		state.FirewallPolicies = make(map[string]string)
+		for _, profile := range firewallProfiles {
+			if policy, err := GetFirewallPolicy(profile); err == nil {
+				state.FirewallPolicies[profile] = policy
+			}
+		}
+	}
+
+	// delete the rules of the previous isolation, error is ignored
+	// when there is no rule
+	RunCommand("netsh", "advfirewall", "firewall", "delete", "rule",
+		ISOLATION_RULE_NAME)
+
+	// allow traffic from and to the bkedr server and the allowlist
+	for _, ip := range state.AllowedIps {
+		for _, dir := range []string{"dir=in", "dir=out"} {
+			if err := RunCommand("netsh", "advfirewall", "firewall", "add", "rule",
+				ISOLATION_RULE_NAME, dir, "action=allow", "remoteip="+ip); err != nil {
+				return err
+			}
+		}
+	}
+
+	// allow DNS queries
+	if state.AllowDns {
+		for _, protocol := range []string{"protocol=UDP", "protocol=TCP"} {
+			if err := RunCommand("netsh", "advfirewall", "firewall", "add", "rule",
+				ISOLATION_RULE_NAME, "dir=out", "action=allow", protocol,
+				"remoteport=53"); err != nil {
+				return err
+			}
+		}
+	}
+
+	// allow DHCP requests and replies
+	if state.AllowDhcp {
+		for _, dir := range []string{"dir=in", "dir=out"} {
+			if err := RunCommand("netsh", "advfirewall", "firewall", "add", "rule",
+				ISOLATION_RULE_NAME, dir, "action=allow", "protocol=UDP",
+				"localport=68", "remoteport=67"); err != nil {
+				return err
+			}
+		}
+	}
+
+	// block all traffic that is not allowed by firewall rules
+	return RunCommand("netsh", "advfirewall", "set", "allprofiles",
+		"firewallpolicy", "blockinbound,blockoutbound")
+}
+
+// This function restores the firewall policy of each profile before the
+// isolation and deletes the rules that are added by the isolation.
+// Example: netsh advfirewall set domainprofile firewallpolicy blockinbound,allowoutbound
+// netsh advfirewall firewall delete rule name="BKEDR ISOLATION"
+func RemoveIsolation(state *IsolationState) error {
+	for _, profile := range firewallProfiles {
+		policy := state.FirewallPolicies[profile]
+		if policy == "" {
+			policy = DEFAULT_FIREWALL_POLICY
+		}
+		if err := RunCommand("netsh", "advfirewall", "set", profile,
+			"firewallpolicy", policy); err != nil {
+			return err
+		}
+	}
+	return RunCommand("netsh", "advfirewall", "firewall", "delete", "rule",
+		ISOLATION_RULE_NAME)
+}
+
+// This function returns the firewall policy of profile
+// (ex: blockinbound,allowoutbound).
+// Example: netsh advfirewall show domainprofile firewallpolicy
+// Output: Firewall Policy                       BlockInbound,AllowOutbound
+func GetFirewallPolicy(profile string) (string, error) {
+
+	output, err := exec.Command("netsh", "advfirewall", "show", profile,
+		"firewallpolicy").CombinedOutput()
+	if err != nil {
+		return "", errors.New(strings.TrimSpace(string(output)))
+	}
+
+	// the policy is the last field of the line of policy, it is the only
+	// field that contains a comma
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		policy := strings.ToLower(fields[len(fields)-1])
+		if strings.Contains(policy, ",") && strings.Contains(policy, "inbound") &&
+			strings.Contains(policy, "outbound") {
+			return policy, nil
+		}
+	}
+	return "", errors.New("firewall policy of " + profile + " is not found")
+}
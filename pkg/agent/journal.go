@@ -0,0 +1,307 @@
+/**
+ * File:    journal.go
+ *
+ * Summary of File:
+ *
+ * 	This file contains the code related to the action journal of the agent.
+ * 	The result of an action is returned only in the reply of request, it is
+ *	lost if the connection to the EDR server breaks during the request.
+ * 	Functions:
+ * 	Journaling every action that the agent executes (request, time and
+ *	outcome) to the disk before the reply, from the requests of the EDR
+ *	server and from the local rules.
+ * 	Bounding the journal: two segments of ActionJournalSize records, the
+ *	oldest segment is replaced when the current segment is full.
+ * 	Returning the history of actions, so the EDR server can reconcile the
+ *	requests whose reply was lost.
+ */
+
+package agent
+
+import (
+	"bkedr/pkg/rpc"
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// Metadata of request that contains the id of request of EDR server
+	REQUEST_ID_METADATA = "bkedr-request-id"
+	// Max size of the JSON of request in a record
+	MAX_JOURNAL_REQUEST_SIZE = 4096
+)
+
+var (
+	// Seq of last record and number of records of current segment
+	actionJournalSeq   int64
+	actionJournalCount int
+	// Journal is loaded on the first record
+	actionJournalLoaded bool
+	// Mutex protects the journal files and their state
+	actionJournalMutex sync.Mutex
+)
+
+// This function returns the records of a segment of journal. A segment
+// that does not exist has no records.
+func ReadJournalSegment(segmentPath string) ([]*rpc.ActionRecord, error) {
+
+	records := make([]*rpc.ActionRecord, 0)
+	file, err := os.Open(segmentPath)
+	if os.IsNotExist(err) {
+		return records, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		record := &rpc.ActionRecord{}
+		// a record that is cut by a crash is ignored
+		if json.Unmarshal(scanner.Bytes(), record) == nil {
+			records = append(records, record)
+		}
+	}
+	return records, scanner.Err()
+}
+
+// This function reads the seq of last record and the number of records of
+// current segment. It is called with actionJournalMutex locked.
+func LoadActionJournal() error {
+
+	for _, segmentPath := range []string{actionJournalPath + ".1", actionJournalPath} {
+		records, err := ReadJournalSegment(segmentPath)
+		if err != nil {
+			return err
+		}
+		if len(records) > 0 {
+			actionJournalSeq = records[len(records)-1].Seq
+		}
+		actionJournalCount = len(records)
+	}
+	actionJournalLoaded = true
+	return nil
+}
+
+// This function appends the record to the journal with the next seq, and
+// writes it to the disk before it returns. The current segment becomes the
+// old segment when it has ActionJournalSize records.
+func JournalAction(record *rpc.ActionRecord) error {
+
+	actionJournalMutex.Lock()
+	defer actionJournalMutex.Unlock()
+
+	if !actionJournalLoaded {
+		if err := LoadActionJournal(); err != nil {
+			return err
+		}
+	}
+	if actionJournalCount >= actionJournalSize {
+		if err := os.Rename(actionJournalPath, actionJournalPath+".1"); err != nil {
+			return err
+		}
+		actionJournalCount = 0
+	}
+
+	record.Seq = actionJournalSeq + 1
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(actionJournalPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		return err
+	}
+	actionJournalSeq = record.Seq
+	actionJournalCount++
+	return nil
+}
+
+// This function returns the records of journal that match the query, in
+// order of seq.
+func ActionHistory(query *rpc.ActionHistoryQuery) ([]*rpc.ActionRecord, error) {
+
+	actionJournalMutex.Lock()
+	defer actionJournalMutex.Unlock()
+
+	requestIds := make(map[string]bool)
+	for _, requestId := range query.GetRequestIds() {
+		requestIds[requestId] = true
+	}
+
+	history := make([]*rpc.ActionRecord, 0)
+	for _, segmentPath := range []string{actionJournalPath + ".1", actionJournalPath} {
+		records, err := ReadJournalSegment(segmentPath)
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range records {
+			if record.Seq <= query.GetAfterSeq() {
+				continue
+			}
+			if len(requestIds) > 0 && !requestIds[record.RequestId] {
+				continue
+			}
+			history = append(history, record)
+			if query.GetLimit() > 0 && len(history) >= int(query.GetLimit()) {
+				return history, nil
+			}
+		}
+	}
+	return history, nil
+}
+
+// GetActionHistory function implementation of gRPC Service.
+// This function returns the records of the action journal of agent that
+// match the query of the EDR Server.
+func (*AgentGRPCService) GetActionHistory(
+	ctx context.Context, in *rpc.ActionHistoryQuery) (*rpc.ActionHistory, error) {
+
+	records, err := ActionHistory(in)
+	if err != nil {
+		return nil, err
+	}
+	return &rpc.ActionHistory{Records: records}, nil
+}
+
+// This function returns the JSON of request for a record. A long request
+// (ex: a pushed file) is cut.
+func JournalRequest(request interface{}) string {
+	data, _ := json.Marshal(request)
+	if len(data) > MAX_JOURNAL_REQUEST_SIZE {
+		data = data[:MAX_JOURNAL_REQUEST_SIZE]
+	}
+	return string(data)
+}
+
+// This function returns the id of request of EDR server in the metadata of
+// ctx, or an empty string.
+func RequestIdFromContext(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(REQUEST_ID_METADATA); len(values) > 0 {
+			return values[0]
+		}
+	}
+	return ""
+}
+
+// This function writes the record of an action and logs the error of
+// journal, the result of action is returned even if the journal fails.
+func WriteActionRecord(record *rpc.ActionRecord, logError func(error)) {
+	if err := JournalAction(record); err != nil && logError != nil {
+		logError(err)
+	}
+}
+
+// This function returns the unary interceptor of gRPC server that journals
+// every request of the EDR server before the reply. The result of
+// ResponseResult is the outcome, other replies succeed if there is no error.
+func JournalUnaryInterceptor(logError func(error)) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+
+		// reading the journal or the config is not an action
+		if method := path.Base(info.FullMethod); method == "GetActionHistory" || method == "GetConfig" {
+			return handler(ctx, req)
+		}
+
+		record := &rpc.ActionRecord{
+			RequestId: RequestIdFromContext(ctx),
+			Source:    "server",
+			Method:    path.Base(info.FullMethod),
+			Request:   JournalRequest(req),
+			StartTime: time.Now().Format("2006-01-02 15:04:05.000"),
+		}
+		resp, err := handler(ctx, req)
+		record.EndTime = time.Now().Format("2006-01-02 15:04:05.000")
+		if responseResult, ok := resp.(*rpc.ResponseResult); ok && err == nil {
+			record.Result = responseResult.GetResult()
+			record.ResultInfo = responseResult.GetResultInfo()
+			record.UndoId = responseResult.GetUndoId()
+		} else if err != nil {
+			record.ResultInfo = "Error: " + err.Error()
+		} else {
+			record.Result = true
+			record.ResultInfo = "Success"
+		}
+		WriteActionRecord(record, logError)
+		return resp, err
+	}
+}
+
+// JournalServerStream struct keeps the first received message (the
+// request) and the ResponseResult sent on a stream.
+type JournalServerStream struct {
+	grpc.ServerStream
+	request        interface{}
+	responseResult *rpc.ResponseResult
+}
+
+// This function receives a message and keeps the first message
+func (stream *JournalServerStream) RecvMsg(m interface{}) error {
+	err := stream.ServerStream.RecvMsg(m)
+	if err == nil && stream.request == nil {
+		stream.request = m
+		// the chunk of a pushed file is not journaled
+		if fileData, ok := m.(*rpc.FileData); ok {
+			stream.request = fileData.GetMeta()
+		}
+	}
+	return err
+}
+
+// This function sends a message and keeps the ResponseResult
+func (stream *JournalServerStream) SendMsg(m interface{}) error {
+	if responseResult, ok := m.(*rpc.ResponseResult); ok {
+		stream.responseResult = responseResult
+	}
+	return stream.ServerStream.SendMsg(m)
+}
+
+// This function returns the stream interceptor of gRPC server that
+// journals every stream request of the EDR server (download, collect and
+// push of files) when the stream ends.
+func JournalStreamInterceptor(logError func(error)) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler) error {
+
+		stream := &JournalServerStream{ServerStream: ss}
+		record := &rpc.ActionRecord{
+			RequestId: RequestIdFromContext(ss.Context()),
+			Source:    "server",
+			Method:    path.Base(info.FullMethod),
+			StartTime: time.Now().Format("2006-01-02 15:04:05.000"),
+		}
+		err := handler(srv, stream)
+		record.EndTime = time.Now().Format("2006-01-02 15:04:05.000")
+		record.Request = JournalRequest(stream.request)
+		if err != nil {
+			record.ResultInfo = "Error: " + err.Error()
+		} else if stream.responseResult != nil {
+			record.Result = stream.responseResult.GetResult()
+			record.ResultInfo = stream.responseResult.GetResultInfo()
+		} else {
+			record.Result = true
+			record.ResultInfo = "Success"
+		}
+		WriteActionRecord(record, logError)
+		return err
+	}
+}
@@ -0,0 +1,566 @@
+/**
+ * File:    localrules.go
+ *
+ * Summary of File:
+ *
+ * 	This file contains the code related to the local detection of the
+ * 	agent. When the EDR server is unreachable, the agent compares its events
+ *	with the local rules and executes the responses itself.
+ * 	Functions:
+ * 	Verifying the Ed25519 signature of the local rules that the EDR server
+ *	pushes, and saving them so they are used after restart.
+ * 	Verifying the claims that the EDR server signs with the same key (ex:
+ *	override of protected processes, config profiles).
+ * 	Comparing the events with the local rules, with the rule engine of the
+ *	EDR server, and executing the matched responses.
+ * 	Spooling the results of local responses, and uploading them when the
+ *	EDR server is reachable again.
+ */
+
+package agent
+
+import (
+	"bkedr/pkg/detection"
+	"bkedr/pkg/rpc"
+	"bufio"
+	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// LocalRuleSet struct is the JSON of rule set signed by the EDR server
+type LocalRuleSet struct {
+	Version int64                    `json:"Version"`
+	Rules   []map[string]interface{} `json:"Rules"`
+}
+
+// SignedRuleSet struct is saved in LocalRulesPath, the signature is
+// verified again when the rule set is loaded.
+type SignedRuleSet struct {
+	RuleSet   []byte `json:"RuleSet"`
+	Signature []byte `json:"Signature"`
+}
+
+var (
+	// Public key of EDR server, nil is local detection disabled
+	localRulesPublicKey ed25519.PublicKey
+	// Local rules that are verified
+	localRuleSet LocalRuleSet
+	// Mutex protects localRuleSet and local results file
+	localRulesMutex sync.Mutex
+)
+
+// This function loads the public key of EDR server and the local rules
+// saved in LocalRulesPath. Local detection is disabled if
+// LocalRulesPublicKeyPath is not set.
+func LoadLocalRules() error {
+
+	if localRulesPublicKeyPath == "" {
+		return nil
+	}
+	publicKey, err := LoadPublicKey(localRulesPublicKeyPath)
+	if err != nil {
+		return err
+	}
+	localRulesPublicKey = publicKey
+
+	data, err := ioutil.ReadFile(localRulesPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	signed := SignedRuleSet{}
+	if err := json.Unmarshal(data, &signed); err != nil {
+		return err
+	}
+	ruleSet, err := VerifyRuleSet(signed.RuleSet, signed.Signature)
+	if err != nil {
+		return err
+	}
+
+	localRulesMutex.Lock()
+	localRuleSet = *ruleSet
+	localRulesMutex.Unlock()
+	return nil
+}
+
+// This function checks that local detection is enabled
+func LocalRulesEnabled() bool {
+	return localRulesPublicKey != nil
+}
+
+// This function loads the Ed25519 public key of PEM file (PKIX), ex:
+// openssl pkey -in localrules.key -pubout -out localrules.pub
+func LoadPublicKey(keyPath string) (ed25519.PublicKey, error) {
+
+	data, err := ioutil.ReadFile(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("key " + keyPath + " is not PEM")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, errors.New("key " + keyPath + " is not Ed25519")
+	}
+	return publicKey, nil
+}
+
+// This function verifies the signature of rule set with the public key of
+// EDR server and returns the rule set.
+func VerifyRuleSet(data []byte, signature []byte) (*LocalRuleSet, error) {
+
+	if !ed25519.Verify(localRulesPublicKey, data, signature) {
+		return nil, errors.New("signature of local rules is invalid")
+	}
+	ruleSet := LocalRuleSet{}
+	if err := json.Unmarshal(data, &ruleSet); err != nil {
+		return nil, err
+	}
+	for _, rule := range ruleSet.Rules {
+		if _, ok := rule["Data"].(map[string]interface{}); !ok {
+			return nil, errors.New("local rule " + fmt.Sprintf("%v", rule["Message"]) +
+				" has no Data")
+		}
+	}
+	return &ruleSet, nil
+}
+
+// This function verifies the claims signed by the EDR server: the JSON of
+// claims and its signature, in base64 and separated by ".". The claims are
+// decoded into claims.
+func VerifyClaims(token string, claims interface{}) error {
+
+	if localRulesPublicKey == nil {
+		return errors.New("signature cannot be verified, LocalRulesPublicKeyPath is not set")
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return errors.New("claims are not signed")
+	}
+	data, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return errors.New("claims are not signed")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !ed25519.Verify(localRulesPublicKey, data, signature) {
+		return errors.New("signature is invalid")
+	}
+	return json.Unmarshal(data, claims)
+}
+
+// This function replaces the local rules with the rule set if it is signed
+// by the EDR server and is not older than the current rule set.
+func UpdateLocalRules(in *rpc.LocalRuleSet) (*LocalRuleSet, error) {
+
+	if !LocalRulesEnabled() {
+		return nil, errors.New("local rules are disabled, LocalRulesPublicKeyPath is not set")
+	}
+	ruleSet, err := VerifyRuleSet(in.GetRuleSet(), in.GetSignature())
+	if err != nil {
+		return nil, err
+	}
+
+	localRulesMutex.Lock()
+	defer localRulesMutex.Unlock()
+
+	// an old rule set that is sent again cannot remove newer rules
+	if ruleSet.Version < localRuleSet.Version {
+		return nil, errors.New("version " + strconv.FormatInt(ruleSet.Version, 10) +
+			" is older than version " + strconv.FormatInt(localRuleSet.Version, 10))
+	}
+	data, err := json.Marshal(SignedRuleSet{
+		RuleSet:   in.GetRuleSet(),
+		Signature: in.GetSignature(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(localRulesPath, data, 0600); err != nil {
+		return nil, err
+	}
+	localRuleSet = *ruleSet
+	return ruleSet, nil
+}
+
+// ManagerLocalRules function implementation of gRPC Service.
+// This function handles the local rules pushed by the EDR Server. The rule
+// set replaces the local rules only if its signature is valid.
+func (*AgentGRPCService) ManagerLocalRules(
+	ctx context.Context, in *rpc.LocalRuleSet) (*rpc.ResponseResult, error) {
+
+	var resultInfo string
+	var result = true
+
+	if ruleSet, err := UpdateLocalRules(in); err != nil {
+		resultInfo = "Error updates local rules: " + err.Error()
+		result = false
+	} else {
+		resultInfo = "Success updates " + strconv.Itoa(len(ruleSet.Rules)) +
+			" local rules, version " + strconv.FormatInt(ruleSet.Version, 10)
+	}
+
+	return &rpc.ResponseResult{
+		ResultInfo: resultInfo,
+		Result:     result,
+	}, nil
+}
+
+// This function compares the event with the local rules and executes the
+// matched responses. The results are written to LocalResultsPath.
+func DetectLocal(event string) error {
+
+	localRulesMutex.Lock()
+	rules := localRuleSet.Rules
+	localRulesMutex.Unlock()
+	if len(rules) == 0 {
+		return nil
+	}
+
+	fields, err := DecodeLocalEvent(event)
+	if err != nil {
+		return err
+	}
+
+	// an error of journal or spool does not stop the next actions, the
+	// first error is returned
+	var firstErr error
+	for _, objRequest := range detection.FilterRules(rules, fields) {
+
+		// a chain of actions is executed in order, each action has its own
+		// result like on the EDR server. The chain stops at the first failed
+		// action, the next actions are skipped.
+		actions := strings.Split(objRequest["Action"], ",")
+		failedStep := 0
+		for index, action := range actions {
+			step := CopyMapString(objRequest)
+			if len(actions) > 1 {
+				step["Action"] = strings.TrimSpace(action)
+				step["ActionChain"] = objRequest["Action"]
+				step["ActionStep"] = strconv.Itoa(index + 1)
+			}
+			if failedStep != 0 {
+				step["Result"] = "Skipped"
+				step["ResultInfo"] = "Error: step " + strconv.Itoa(failedStep) +
+					" of action chain failed"
+				step["ResultTime"] = time.Now().Format("2006-01-02 15:04:05.000")
+				if err := SpoolLocalResult(step); err != nil && firstErr == nil {
+					firstErr = err
+				}
+				continue
+			}
+			startTime := time.Now().Format("2006-01-02 15:04:05.000")
+			responseResult := ExecuteLocalRequest(step)
+			step["ResultInfo"] = responseResult.GetResultInfo()
+			if responseResult.GetUndoId() != "" {
+				step["UndoId"] = responseResult.GetUndoId()
+			}
+			if responseResult.GetResult() {
+				step["Result"] = "Success"
+			} else {
+				step["Result"] = "Failure"
+			}
+			step["ResultTime"] = time.Now().Format("2006-01-02 15:04:05.000")
+
+			// a denial of policy is also written to the policy audit log
+			if responseResult.GetDenyReason() != "" {
+				step["DenyReason"] = responseResult.GetDenyReason()
+				if err := AuditDenial(&PolicyAuditRecord{
+					Source:     "local",
+					Method:     LocalRequestMethod(step),
+					Action:     step["Action"],
+					DenyReason: step["DenyReason"],
+					ResultInfo: step["ResultInfo"],
+					Request:    JournalRequest(step),
+				}); err != nil && firstErr == nil {
+					firstErr = err
+				}
+			}
+
+			if err := JournalAction(&rpc.ActionRecord{
+				Source:     "local",
+				Method:     LocalRequestMethod(step),
+				Request:    JournalRequest(step),
+				Result:     responseResult.GetResult(),
+				ResultInfo: responseResult.GetResultInfo(),
+				StartTime:  startTime,
+				EndTime:    step["ResultTime"],
+			}); err != nil && firstErr == nil {
+				firstErr = err
+			}
+			if err := SpoolLocalResult(step); err != nil && firstErr == nil {
+				firstErr = err
+			}
+			if !responseResult.GetResult() {
+				failedStep = index + 1
+			}
+		}
+	}
+	return firstErr
+}
+
+// This function returns the method of gRPC service that executes the
+// request, it is the method of the record of local response.
+func LocalRequestMethod(objRequest map[string]string) string {
+	if objRequest["Action"] == "isolate" {
+		return "ManagerNetworkAdapter"
+	}
+	return "ManagerEventCode" + objRequest["EventCode"]
+}
+
+// This function returns the request of gRPC service of the local response,
+// or nil if the EventCode is not supported.
+func LocalRequest(objRequest map[string]string) interface{} {
+
+	if objRequest["Action"] == "isolate" {
+		return &rpc.NetworkAdapter{
+			Action: objRequest["Action"],
+		}
+	}
+
+	switch objRequest["EventCode"] {
+	case "1":
+		return &rpc.EventCode1{
+			ProcessId: objRequest["ProcessId"],
+			Action:    objRequest["Action"],
+		}
+	case "3":
+		return &rpc.EventCode3{
+			ProcessId:       objRequest["ProcessId"],
+			SourceIp:        objRequest["SourceIp"],
+			SourcePort:      objRequest["SourcePort"],
+			DestinationIp:   objRequest["DestinationIp"],
+			DestinationPort: objRequest["DestinationPort"],
+			Action:          objRequest["Action"],
+		}
+	case "7":
+		return &rpc.EventCode7{
+			ProcessId:   objRequest["ProcessId"],
+			ImageLoaded: objRequest["ImageLoaded"],
+			Action:      objRequest["Action"],
+		}
+	case "8":
+		return &rpc.EventCode8{
+			SourceProcessId: objRequest["SourceProcessId"],
+			Action:          objRequest["Action"],
+		}
+	case "9":
+		return &rpc.EventCode9{
+			ProcessId: objRequest["ProcessId"],
+			Action:    objRequest["Action"],
+		}
+	case "10":
+		return &rpc.EventCode10{
+			ProcessId: objRequest["ProcessId"],
+			Action:    objRequest["Action"],
+		}
+	case "11":
+		return &rpc.EventCode11{
+			TargetFilename: objRequest["TargetFilename"],
+			Action:         objRequest["Action"],
+		}
+	case "12":
+		return &rpc.EventCode12{
+			TargetObject: objRequest["TargetObject"],
+			Action:       objRequest["Action"],
+		}
+	case "13":
+		return &rpc.EventCode13{
+			TargetObject: objRequest["TargetObject"],
+			Action:       objRequest["Action"],
+		}
+	case "14":
+		return &rpc.EventCode14{
+			EventType:    objRequest["EventType"],
+			TargetObject: objRequest["TargetObject"],
+			NewName:      objRequest["NewName"],
+			Action:       objRequest["Action"],
+		}
+	}
+	return nil
+}
+
+// This function executes the request with the handlers of gRPC service,
+// like a request of the EDR server. A request that the policy does not
+// allow returns the denial.
+func ExecuteLocalRequest(objRequest map[string]string) *rpc.ResponseResult {
+
+	request := LocalRequest(objRequest)
+	if request == nil {
+		return &rpc.ResponseResult{
+			ResultInfo: "Error: Not support for EventCode" + objRequest["EventCode"],
+			Result:     false,
+		}
+	}
+	if policyError := CheckPolicy(LocalRequestMethod(objRequest), request, false); policyError != nil {
+		return policyError.ResponseResult()
+	}
+
+	service := NewAgentGRPCService()
+	ctx := context.Background()
+	var responseResult *rpc.ResponseResult
+
+	switch request := request.(type) {
+	case *rpc.NetworkAdapter:
+		responseResult, _ = service.ManagerNetworkAdapter(ctx, request)
+	case *rpc.EventCode1:
+		responseResult, _ = service.ManagerEventCode1(ctx, request)
+	case *rpc.EventCode3:
+		responseResult, _ = service.ManagerEventCode3(ctx, request)
+	case *rpc.EventCode7:
+		responseResult, _ = service.ManagerEventCode7(ctx, request)
+	case *rpc.EventCode8:
+		responseResult, _ = service.ManagerEventCode8(ctx, request)
+	case *rpc.EventCode9:
+		responseResult, _ = service.ManagerEventCode9(ctx, request)
+	case *rpc.EventCode10:
+		responseResult, _ = service.ManagerEventCode10(ctx, request)
+	case *rpc.EventCode11:
+		responseResult, _ = service.ManagerEventCode11(ctx, request)
+	case *rpc.EventCode12:
+		responseResult, _ = service.ManagerEventCode12(ctx, request)
+	case *rpc.EventCode13:
+		responseResult, _ = service.ManagerEventCode13(ctx, request)
+	case *rpc.EventCode14:
+		responseResult, _ = service.ManagerEventCode14(ctx, request)
+	}
+	return responseResult
+}
+
+// LocalXmlEvent struct is used to decode the XML of a Sysmon event
+type LocalXmlEvent struct {
+	System struct {
+		EventID string `xml:"EventID"`
+	} `xml:"System"`
+	EventData struct {
+		Data []struct {
+			Name  string `xml:"Name,attr"`
+			Value string `xml:",chardata"`
+		} `xml:"Data"`
+	} `xml:"EventData"`
+}
+
+// This function returns the fields of rules of the event, Sysmon XML or a
+// flat JSON object. ComputerName is the hostname of agent, like the events
+// that the agent streams to the EDR server.
+func DecodeLocalEvent(event string) (map[string]string, error) {
+
+	fields := make(map[string]string)
+	event = strings.TrimSpace(event)
+	if strings.HasPrefix(event, "<") {
+		xmlEvent := LocalXmlEvent{}
+		if err := xml.Unmarshal([]byte(event), &xmlEvent); err != nil {
+			return nil, err
+		}
+		for _, item := range xmlEvent.EventData.Data {
+			if item.Name != "" {
+				fields[item.Name] = item.Value
+			}
+		}
+		fields["EventCode"] = strings.TrimSpace(xmlEvent.System.EventID)
+	} else {
+		object := make(map[string]interface{})
+		if err := json.Unmarshal([]byte(event), &object); err != nil {
+			return nil, err
+		}
+		for key, value := range object {
+			if value != nil {
+				fields[key] = fmt.Sprintf("%v", value)
+			}
+		}
+	}
+	fields["ComputerName"], _ = os.Hostname()
+	return fields, nil
+}
+
+// This function appends the result of a local response to LocalResultsPath
+func SpoolLocalResult(objRequest map[string]string) error {
+
+	data, err := json.Marshal(objRequest)
+	if err != nil {
+		return err
+	}
+
+	localRulesMutex.Lock()
+	defer localRulesMutex.Unlock()
+	file, err := os.OpenFile(localResultsPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(append(data, '\n'))
+	return err
+}
+
+// This function uploads the results of local responses to the telemetry
+// service of EDR server. The results file is renamed before it is read, so
+// new results are not lost; the renamed file is removed after the server
+// receives it and is uploaded again after an error.
+func UploadLocalResults(conn *grpc.ClientConn) error {
+
+	uploadPath := localResultsPath + ".upload"
+	if _, err := os.Stat(uploadPath); os.IsNotExist(err) {
+		localRulesMutex.Lock()
+		err := os.Rename(localResultsPath, uploadPath)
+		localRulesMutex.Unlock()
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	file, err := os.Open(uploadPath)
+	if err != nil {
+		return err
+	}
+	results := make([]string, 0)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			results = append(results, line)
+		}
+	}
+	file.Close()
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	if len(results) > 0 {
+		computerName, _ := os.Hostname()
+		ctx, cancel := context.WithTimeout(TelemetryContext(context.Background()), 30*time.Second)
+		defer cancel()
+		_, err := rpc.NewTelemetryClient(conn).UploadResults(ctx, &rpc.ResultBatch{
+			ComputerName: computerName,
+			Results:      results,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return os.Remove(uploadPath)
+}
@@ -0,0 +1,103 @@
+/**
+ * File:    memdump.go
+ *
+ * Summary of File:
+ *
+ * 	This file contains the code related to the memory dump of a process.
+ * 	Functions:
+ * 	Dumping the memory of process to a temporary file before the process
+ *	is killed, the payload of a process often exists only in its memory.
+ * 	Sending the dump to the EDR server like a downloaded file. The list of
+ *	dumped memory regions is sent as the manifest of file.
+ */
+
+package agent
+
+import (
+	"bkedr/pkg/rpc"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+
+	"github.com/shirou/gopsutil/process"
+)
+
+// DumpRegion struct is used to encode json of a dumped memory region.
+// Offset is the position of region in the dump file, Size is the number of
+// bytes that are dumped. Error is set if the region is not dumped.
+type DumpRegion struct {
+	Start       string `json:"Start"`
+	End         string `json:"End"`
+	Permissions string `json:"Permissions"`
+	Path        string `json:"Path,omitempty"`
+	Offset      int64  `json:"Offset"`
+	Size        int64  `json:"Size"`
+	Error       string `json:"Error,omitempty"`
+}
+
+// This function dumps the memory of process fileInfo.ProcessId to a
+// temporary file, then sends the metadata with the list of regions and the
+// content of dump.
+func SendMemoryDump(fileInfo *rpc.FileInfo, stream FileDataSender) error {
+
+	pid := fileInfo.GetProcessId()
+	if pid <= 0 || int(pid) == os.Getpid() {
+		return errors.New("process id " + strconv.Itoa(int(pid)) + " can not be dumped")
+	}
+	p, err := process.NewProcess(pid)
+	if err != nil {
+		return err
+	}
+
+	compression := fileInfo.GetCompression()
+	if compression != "" && compression != "gzip" {
+		return errors.New("compression " + compression + " is not supported")
+	}
+
+	dumpFile, err := ioutil.TempFile("", "bkedr_dump_*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(dumpFile.Name())
+	defer dumpFile.Close()
+
+	config := CurrentConfig()
+	maxSize := MinLimit(fileInfo.GetMaxSize(), config.MaxFileSize)
+	regions, err := DumpProcessMemory(pid, dumpFile, maxSize)
+	if err != nil {
+		return err
+	}
+	if err := dumpFile.Close(); err != nil {
+		return err
+	}
+
+	fileMeta, err := GetFileMeta(dumpFile.Name())
+	if err != nil {
+		return err
+	}
+	if maxSize > 0 && fileMeta.Size > maxSize {
+		return fmt.Errorf("size of dump %d exceeds max size %d", fileMeta.Size, maxSize)
+	}
+	if regions != nil {
+		data, err := json.Marshal(regions)
+		if err != nil {
+			return err
+		}
+		fileMeta.Manifest = string(data)
+	}
+
+	// FilePath is the image of process, so the dump can be related to it
+	fileMeta.FilePath, _ = p.Exe()
+	fileMeta.Compression = compression
+
+	file, err := os.Open(dumpFile.Name())
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return SendContent(stream, fileMeta, file,
+		MinLimit(fileInfo.GetMaxRate(), config.MaxTransferRate))
+}
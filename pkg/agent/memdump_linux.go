@@ -0,0 +1,89 @@
+/**
+ * File:    memdump_linux.go
+ *
+ * Summary of File:
+ *
+ * 	This file contains the Linux functions used by the memory dump. The
+ *	readable regions of /proc/<pid>/maps are read from /proc/<pid>/mem and
+ *	written one after the other to the dump file.
+ */
+
+package agent
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// This function writes the readable memory regions of process pid to
+// dumpFile and returns the list of regions. A region that can not be read
+// or that exceeds maxSize is listed with its error.
+func DumpProcessMemory(pid int32, dumpFile *os.File, maxSize int64) ([]*DumpRegion, error) {
+
+	procPath := "/proc/" + strconv.Itoa(int(pid))
+	maps, err := os.Open(procPath + "/maps")
+	if err != nil {
+		return nil, err
+	}
+	defer maps.Close()
+
+	mem, err := os.Open(procPath + "/mem")
+	if err != nil {
+		return nil, err
+	}
+	defer mem.Close()
+
+	regions := make([]*DumpRegion, 0)
+	var offset int64
+	scanner := bufio.NewScanner(maps)
+	for scanner.Scan() {
+		// Each line is: start-end perms offset dev inode path
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 {
+			continue
+		}
+		bounds := strings.SplitN(fields[0], "-", 2)
+		if len(bounds) != 2 {
+			continue
+		}
+		region := &DumpRegion{
+			Start:       bounds[0],
+			End:         bounds[1],
+			Permissions: fields[1],
+			Offset:      offset,
+		}
+		if len(fields) > 5 {
+			region.Path = strings.Join(fields[5:], " ")
+		}
+		regions = append(regions, region)
+
+		start, err1 := strconv.ParseUint(bounds[0], 16, 64)
+		end, err2 := strconv.ParseUint(bounds[1], 16, 64)
+		switch {
+		case err1 != nil || err2 != nil || end < start:
+			region.Error = "invalid address range"
+			continue
+		case !strings.HasPrefix(region.Permissions, "r"):
+			region.Error = "region is not readable"
+			continue
+		case strings.HasPrefix(region.Path, "[vvar") || region.Path == "[vsyscall]":
+			region.Error = "region is not dumped"
+			continue
+		case maxSize > 0 && offset+int64(end-start) > maxSize:
+			region.Error = "region exceeds max size of dump"
+			continue
+		}
+
+		// a region is read until the first error, the read bytes are kept
+		size, err := io.Copy(dumpFile, io.NewSectionReader(mem, int64(start), int64(end-start)))
+		region.Size = size
+		offset += size
+		if err != nil {
+			region.Error = err.Error()
+		}
+	}
+	return regions, scanner.Err()
+}
@@ -0,0 +1,26 @@
+//go:build !windows && !linux
+// +build !windows,!linux
+
+/**
+ * File:    memdump_other.go
+ *
+ * Summary of File:
+ *
+ * 	This file contains the functions used by the memory dump on the
+ *	operating systems that are not supported. All functions return error.
+ */
+
+package agent
+
+import (
+	"errors"
+	"os"
+)
+
+// Error is returned when the operating system does not support memory dump
+var ErrMemoryDumpNotSupported = errors.New("memory dump is not supported on this operating system")
+
+// This function returns ErrMemoryDumpNotSupported
+func DumpProcessMemory(pid int32, dumpFile *os.File, maxSize int64) ([]*DumpRegion, error) {
+	return nil, ErrMemoryDumpNotSupported
+}
@@ -0,0 +1,171 @@
+//go:build linux || windows
+// +build linux windows
+
+/**
+ * File:    memdump_test.go
+ *
+ * Summary of File:
+ *
+ * 	This file contains the tests of the memory dump of a process. The test
+ *	binary starts itself as a child process that keeps a marker in its
+ *	memory, then dumps the child.
+ * 	Functions:
+ * 	Testing the dump of the child process and sending it like a file.
+ */
+
+package agent
+
+import (
+	"bkedr/pkg/rpc"
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// Env var that makes the test binary run as the child process
+const MEMDUMP_CHILD_ENV = "BKEDR_MEMDUMP_CHILD"
+
+// memoryMarker is kept in the memory of the child process
+var memoryMarker []byte
+
+// This function is the child process. It copies the marker of env var to
+// its heap, writes a line when it is ready and waits until stdin is closed.
+func TestMemoryDumpChild(t *testing.T) {
+	marker := os.Getenv(MEMDUMP_CHILD_ENV)
+	if marker == "" {
+		t.Skip("only run as child process of TestDumpProcessMemory")
+	}
+	memoryMarker = []byte(marker)
+	os.Stdout.WriteString("ready\n")
+	ioutil.ReadAll(os.Stdin)
+	runtime.KeepAlive(memoryMarker)
+	os.Exit(0)
+}
+
+// This function starts the child process with a random marker and returns
+// the marker. The child exits when the test ends.
+func startDumpChild(t *testing.T) (*exec.Cmd, string) {
+
+	random := make([]byte, 16)
+	rand.Read(random)
+	marker := "BKEDR_MARKER_" + hex.EncodeToString(random)
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestMemoryDumpChild$")
+	cmd.Env = append(os.Environ(), MEMDUMP_CHILD_ENV+"="+marker)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		stdin.Close()
+		cmd.Wait()
+	})
+	if line, err := bufio.NewReader(stdout).ReadString('\n'); err != nil || line != "ready\n" {
+		t.Fatalf("child process is not ready: %q %v", line, err)
+	}
+	return cmd, marker
+}
+
+func TestDumpProcessMemory(t *testing.T) {
+
+	cmd, marker := startDumpChild(t)
+	dumpFile, err := ioutil.TempFile(t.TempDir(), "dump_*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dumpFile.Close()
+
+	regions, err := DumpProcessMemory(int32(cmd.Process.Pid), dumpFile, 0)
+	if err != nil {
+		if os.IsPermission(err) {
+			t.Skip("memory of child process can not be read: ", err)
+		}
+		t.Fatal(err)
+	}
+	dump, err := ioutil.ReadFile(dumpFile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if runtime.GOOS == "windows" {
+		// the minidump lists its memory regions
+		if !bytes.HasPrefix(dump, []byte("MDMP")) {
+			t.Fatal("dump is not a minidump")
+		}
+		return
+	}
+
+	dumped := 0
+	for _, region := range regions {
+		if region.Size > 0 {
+			dumped++
+		}
+	}
+	if dumped == 0 {
+		t.Fatalf("no region is dumped: %d regions", len(regions))
+	}
+	if !bytes.Contains(dump, []byte(marker)) {
+		t.Fatal("dump does not contain the marker of child process")
+	}
+}
+
+// fileDataRecorder keeps the messages sent as a file
+type fileDataRecorder struct {
+	meta    *rpc.FileMeta
+	content bytes.Buffer
+}
+
+// Send keeps the metadata and the chunks of file
+func (recorder *fileDataRecorder) Send(fileData *rpc.FileData) error {
+	if fileData.GetMeta() != nil {
+		recorder.meta = fileData.GetMeta()
+	}
+	recorder.content.Write(fileData.GetFileChunk())
+	return nil
+}
+
+func TestSendMemoryDump(t *testing.T) {
+
+	cmd, marker := startDumpChild(t)
+	recorder := &fileDataRecorder{}
+	err := SendMemoryDump(&rpc.FileInfo{ProcessId: int32(cmd.Process.Pid)}, recorder)
+	if err != nil {
+		if os.IsPermission(err) || strings.Contains(err.Error(), "denied") {
+			t.Skip("memory of child process can not be read: ", err)
+		}
+		t.Fatal(err)
+	}
+	if recorder.meta == nil || recorder.meta.GetSize() != int64(recorder.content.Len()) {
+		t.Fatalf("metadata %+v does not match %d bytes of content", recorder.meta, recorder.content.Len())
+	}
+	if runtime.GOOS == "windows" {
+		return
+	}
+	regions := make([]*DumpRegion, 0)
+	if err := json.Unmarshal([]byte(recorder.meta.GetManifest()), &regions); err != nil || len(regions) == 0 {
+		t.Fatalf("manifest of dump is invalid: %v", err)
+	}
+	if !bytes.Contains(recorder.content.Bytes(), []byte(marker)) {
+		t.Fatal("sent dump does not contain the marker of child process")
+	}
+
+	// the agent never dumps itself
+	if err := SendMemoryDump(&rpc.FileInfo{ProcessId: int32(os.Getpid())}, recorder); err == nil {
+		t.Fatal("agent dumps its own memory")
+	}
+}
@@ -0,0 +1,48 @@
+/**
+ * File:    memdump_windows.go
+ *
+ * Summary of File:
+ *
+ * 	This file contains the Windows functions used by the memory dump. The
+ *	process is dumped with MiniDumpWriteDump of dbghelp.dll, the full
+ *	memory of process is written to a minidump file.
+ */
+
+package agent
+
+import (
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/windows"
+)
+
+// MINIDUMP_TYPE that includes all accessible memory of process
+const MINIDUMP_WITH_FULL_MEMORY = 0x00000002
+
+var (
+	dbghelp               = windows.NewLazySystemDLL("dbghelp.dll")
+	procMiniDumpWriteDump = dbghelp.NewProc("MiniDumpWriteDump")
+)
+
+// This function writes a full memory minidump of process pid to dumpFile.
+// The minidump lists its memory regions, so no region is returned.
+func DumpProcessMemory(pid int32, dumpFile *os.File, maxSize int64) ([]*DumpRegion, error) {
+
+	handle, err := windows.OpenProcess(windows.PROCESS_QUERY_INFORMATION|
+		windows.PROCESS_VM_READ, false, uint32(pid))
+	if err != nil {
+		return nil, err
+	}
+	defer windows.CloseHandle(handle)
+
+	ret, _, err := procMiniDumpWriteDump.Call(uintptr(handle), uintptr(pid),
+		dumpFile.Fd(), MINIDUMP_WITH_FULL_MEMORY, 0, 0, 0)
+	if ret == 0 {
+		if err == nil || err == syscall.Errno(0) {
+			err = syscall.EINVAL
+		}
+		return nil, err
+	}
+	return nil, nil
+}
@@ -0,0 +1,537 @@
+/**
+ * File:    policy.go
+ *
+ * Summary of File:
+ *
+ * 	This file contains the code related to the policy of the agent. The
+ * 	policy limits the actions that any caller of the agent can execute,
+ *	whatever the EDR server or the local rules request (ex: no killtree or
+ *	adapter disable on a domain controller).
+ * 	Functions:
+ * 	Loading the local policy file, which the EDR server cannot change. The
+ *	EDR server can push a policy in the config profile, both policies and
+ *	AllowedActions of agent config are applied.
+ * 	Denying the requests whose action is not allowed, or whose target is a
+ *	protected process (name or PID, and the built-in protected processes
+ *	unless the EDR server overrides them), a protected path or a protected
+ *	registry key.
+ * 	Returning the reason of denial in ResponseResult and writing every
+ *	denied request to the policy audit log.
+ */
+
+package agent
+
+import (
+	"bkedr/pkg/rpc"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/process"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Reasons of denial of the policy
+const (
+	DENY_ACTION_NOT_ALLOWED = "action_not_allowed"
+	DENY_PROTECTED_PROCESS  = "protected_process"
+	DENY_PROTECTED_PATH     = "protected_path"
+	DENY_PROTECTED_REGISTRY = "protected_registry"
+	DENY_INVALID_POLICY     = "invalid_policy"
+)
+
+// Actions whose target is the process of ProcessId of request
+var processActions = []string{"kill", "killtree", "suspend", "resume"}
+
+// Long names of the roots of registry paths
+var registryRoots = map[string]string{
+	"hkey_local_machine":  "hklm",
+	"hkey_current_user":   "hkcu",
+	"hkey_classes_root":   "hkcr",
+	"hkey_users":          "hku",
+	"\\registry\\machine": "hklm",
+	"\\registry\\user":    "hku",
+}
+
+// AgentPolicy struct is used to decode json of a policy. AllowedActions
+// empty allows every action. ProtectedProcesses are process names (ex:
+// lsass.exe) or PIDs. ProtectedPaths are files or directories and
+// ProtectedRegistry are registry keys, with their content.
+type AgentPolicy struct {
+	AllowedActions     []string `json:"AllowedActions"`
+	ProtectedProcesses []string `json:"ProtectedProcesses"`
+	ProtectedPaths     []string `json:"ProtectedPaths"`
+	ProtectedRegistry  []string `json:"ProtectedRegistry"`
+}
+
+// PolicyError struct is the denial of a request, Reason is one of DENY_*.
+// It is returned as PermissionDenied to gRPC.
+type PolicyError struct {
+	Reason string
+	Detail string
+}
+
+// This function returns the message of denial
+func (policyError *PolicyError) Error() string {
+	return "Denied by agent policy (" + policyError.Reason + "): " + policyError.Detail
+}
+
+// This function returns the gRPC status of denial
+func (policyError *PolicyError) GRPCStatus() *status.Status {
+	return status.New(codes.PermissionDenied, policyError.Error())
+}
+
+// This function returns the ResponseResult of denial
+func (policyError *PolicyError) ResponseResult() *rpc.ResponseResult {
+	return &rpc.ResponseResult{
+		ResultInfo: policyError.Error(),
+		Result:     false,
+		DenyReason: policyError.Reason,
+	}
+}
+
+// PolicyAuditRecord struct is a denied request in the policy audit log, or
+// a request that overrides the built-in protected processes
+type PolicyAuditRecord struct {
+	Time       string `json:"Time"`
+	Source     string `json:"Source"`
+	RequestId  string `json:"RequestId"`
+	Method     string `json:"Method"`
+	Action     string `json:"Action"`
+	DenyReason string `json:"DenyReason"`
+	ResultInfo string `json:"ResultInfo"`
+	Request    string `json:"Request"`
+	Override   bool   `json:"Override"`
+}
+
+var (
+	// Local policy, and the error of policy file that denies every request
+	localPolicy    AgentPolicy
+	localPolicyErr error
+	// Mutex protects the policy audit log
+	policyAuditMutex sync.Mutex
+)
+
+// This function loads the local policy of PolicyPath. A policy file that
+// does not exist is an empty policy. If the file is invalid, every request
+// is denied until the agent loads a valid file.
+func LoadLocalPolicy() error {
+
+	localPolicy = AgentPolicy{}
+	localPolicyErr = nil
+	data, err := ioutil.ReadFile(policyPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err == nil {
+		err = json.Unmarshal(data, &localPolicy)
+	}
+	if err != nil {
+		localPolicyErr = err
+		return err
+	}
+	return nil
+}
+
+// This function checks the request of gRPC method with AllowedActions of
+// agent config, the local policy, the pushed policy and the built-in
+// protected processes if override is false. It returns the denial, or nil
+// if the request is allowed.
+func CheckPolicy(method string, request interface{}, override bool) *PolicyError {
+
+	action := RequestAction(method, request)
+	if action == "" {
+		return nil
+	}
+	if localPolicyErr != nil {
+		return &PolicyError{Reason: DENY_INVALID_POLICY,
+			Detail: "local policy " + policyPath + " is invalid: " + localPolicyErr.Error()}
+	}
+
+	// the action must be allowed by every policy
+	if err := CheckActionAllowed(action); err != nil {
+		return &PolicyError{Reason: DENY_ACTION_NOT_ALLOWED, Detail: err.Error()}
+	}
+	policies := []AgentPolicy{localPolicy, CurrentConfig().Policy}
+	for _, policy := range policies {
+		if !CheckPolicyAction(policy, action) {
+			return &PolicyError{Reason: DENY_ACTION_NOT_ALLOWED,
+				Detail: "action " + action + " is not allowed by policy"}
+		}
+	}
+
+	// the targets must not be protected by any policy
+	protectedProcesses := make([]string, 0)
+	protectedPaths := make([]string, 0)
+	protectedRegistry := make([]string, 0)
+	for _, policy := range policies {
+		protectedProcesses = append(protectedProcesses, policy.ProtectedProcesses...)
+		protectedPaths = append(protectedPaths, policy.ProtectedPaths...)
+		protectedRegistry = append(protectedRegistry, policy.ProtectedRegistry...)
+	}
+	pids, paths, keys := RequestTargets(action, request)
+	if !override && CheckProtectedAction(action) {
+		for _, pid := range pids {
+			if policyError := CheckCriticalProcess(ConvertStringToInt32(pid),
+				NormalizeAction(action) == "killtree"); policyError != nil {
+				return policyError
+			}
+		}
+	}
+	for _, pid := range pids {
+		if detail := ProtectedProcess(pid, NormalizeAction(action) == "killtree",
+			protectedProcesses); detail != "" {
+			return &PolicyError{Reason: DENY_PROTECTED_PROCESS, Detail: detail}
+		}
+	}
+	for _, filePath := range paths {
+		for _, protectedPath := range protectedPaths {
+			if OverlapPath(filePath, protectedPath) {
+				return &PolicyError{Reason: DENY_PROTECTED_PATH,
+					Detail: filePath + " is protected by " + protectedPath}
+			}
+		}
+	}
+	for _, key := range keys {
+		for _, protectedKey := range protectedRegistry {
+			if OverlapRegistry(key, protectedKey) {
+				return &PolicyError{Reason: DENY_PROTECTED_REGISTRY,
+					Detail: key + " is protected by " + protectedKey}
+			}
+		}
+	}
+	return nil
+}
+
+// This function checks that the built-in protected processes apply to
+// action
+func CheckProtectedAction(action string) bool {
+	for _, protectedAction := range protectedActions {
+		if NormalizeAction(action) == protectedAction {
+			return true
+		}
+	}
+	return false
+}
+
+// This function checks that action is in AllowedActions of policy, every
+// action is allowed if it is empty
+func CheckPolicyAction(policy AgentPolicy, action string) bool {
+	if len(policy.AllowedActions) == 0 {
+		return true
+	}
+	for _, allowed := range policy.AllowedActions {
+		if NormalizeAction(allowed) == NormalizeAction(action) {
+			return true
+		}
+	}
+	return false
+}
+
+// This function returns the action of the request of gRPC method. The
+// methods that are not actions (config, journal, local rules) have no
+// action.
+func RequestAction(method string, request interface{}) string {
+	if actionRequest, ok := request.(interface{ GetAction() string }); ok {
+		return actionRequest.GetAction()
+	}
+	switch method {
+	case "ManagerGetFile":
+		if fileInfo, ok := request.(*rpc.FileInfo); ok && fileInfo.GetProcessId() != 0 {
+			return "dumpmem"
+		}
+		return "getfile"
+	case "ManagerListQuarantine":
+		return "listquarantine"
+	case "ManagerCollect":
+		return "collect"
+	case "ManagerPutFile":
+		return "putfile"
+	case "ManagerTriage":
+		return "triage"
+	}
+	return ""
+}
+
+// This function returns the targets of request: the PIDs of processes that
+// action acts on, the file paths and the registry keys.
+func RequestTargets(action string, request interface{}) ([]string, []string, []string) {
+
+	pids := make([]string, 0)
+	paths := make([]string, 0)
+	keys := make([]string, 0)
+	processAction := false
+	for _, name := range processActions {
+		if NormalizeAction(action) == name {
+			processAction = true
+		}
+	}
+
+	switch request := request.(type) {
+	case *rpc.EventCode1:
+		if processAction {
+			pids = append(pids, request.GetProcessId())
+		}
+	case *rpc.EventCode3:
+		if processAction {
+			pids = append(pids, request.GetProcessId())
+		}
+	case *rpc.EventCode7:
+		if processAction {
+			pids = append(pids, request.GetProcessId())
+		} else {
+			paths = append(paths, request.GetImageLoaded())
+		}
+	case *rpc.EventCode8:
+		if processAction {
+			pids = append(pids, request.GetSourceProcessId())
+		}
+	case *rpc.EventCode9:
+		if processAction {
+			pids = append(pids, request.GetProcessId())
+		}
+	case *rpc.EventCode10:
+		if processAction {
+			pids = append(pids, request.GetProcessId())
+		}
+	case *rpc.EventCode11:
+		paths = append(paths, request.GetTargetFilename())
+	case *rpc.EventCode12:
+		keys = append(keys, request.GetTargetObject())
+	case *rpc.EventCode13:
+		keys = append(keys, request.GetTargetObject())
+	case *rpc.EventCode14:
+		keys = append(keys, request.GetTargetObject(), request.GetNewName())
+	case *rpc.FileInfo:
+		if request.GetProcessId() != 0 {
+			pids = append(pids, strconv.Itoa(int(request.GetProcessId())))
+		} else {
+			paths = append(paths, request.GetFilePath())
+		}
+	case *rpc.CollectInfo:
+		paths = append(paths, request.GetPaths()...)
+	case *rpc.FileData:
+		paths = append(paths, request.GetMeta().GetFilePath())
+	}
+	return pids, paths, keys
+}
+
+// This function returns why the process of pid is protected, or an empty
+// string. With tree, the children of process are also checked.
+func ProtectedProcess(pid string, tree bool, protectedProcesses []string) string {
+
+	pid32 := ConvertStringToInt32(pid)
+	for _, protected := range protectedProcesses {
+		if strings.TrimSpace(protected) == pid {
+			return "ProcessId " + pid + " is protected"
+		}
+	}
+
+	p, err := process.NewProcess(pid32)
+	if err != nil {
+		return ""
+	}
+	if name, err := p.Name(); err == nil {
+		for _, protected := range protectedProcesses {
+			protected = strings.ToLower(strings.TrimSpace(protected))
+			if protected == strings.ToLower(name) ||
+				protected+".exe" == strings.ToLower(name) {
+				return "ProcessId " + pid + " " + name + " is protected"
+			}
+		}
+	}
+	if tree {
+		if children, err := p.Children(); err == nil {
+			for _, child := range children {
+				if detail := ProtectedProcess(strconv.Itoa(int(child.Pid)), true,
+					protectedProcesses); detail != "" {
+					return detail + " in the tree of ProcessId " + pid
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// This function checks that filePath is protectedPath, is in it, or
+// contains it (ex: a collected directory). Paths are case-insensitive and
+// "/" is "\" like on Windows.
+func OverlapPath(filePath string, protectedPath string) bool {
+	filePath = NormalizePolicyPath(filePath)
+	protectedPath = NormalizePolicyPath(protectedPath)
+	if filePath == "" || protectedPath == "" {
+		return false
+	}
+	return filePath == protectedPath ||
+		strings.HasPrefix(filePath, protectedPath+"\\") ||
+		strings.HasPrefix(protectedPath, filePath+"\\")
+}
+
+// This function returns the path in lower case with "\" separators and
+// without "\" at the end
+func NormalizePolicyPath(filePath string) string {
+	filePath = strings.ToLower(strings.TrimSpace(filePath))
+	filePath = strings.ReplaceAll(filePath, "/", "\\")
+	return strings.TrimRight(filePath, "\\")
+}
+
+// This function checks that key is protectedKey, is in it, or contains it.
+// The long names of roots (ex: HKEY_LOCAL_MACHINE) are the short names.
+func OverlapRegistry(key string, protectedKey string) bool {
+	return OverlapPath(NormalizeRegistryKey(key), NormalizeRegistryKey(protectedKey))
+}
+
+// This function returns the registry key with the short name of root
+func NormalizeRegistryKey(key string) string {
+	key = NormalizePolicyPath(key)
+	for long, short := range registryRoots {
+		if key == long || strings.HasPrefix(key, long+"\\") {
+			return short + key[len(long):]
+		}
+	}
+	return key
+}
+
+// This function appends the record to the policy audit log
+func AuditDenial(record *PolicyAuditRecord) error {
+
+	record.Time = time.Now().Format("2006-01-02 15:04:05.000")
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	policyAuditMutex.Lock()
+	defer policyAuditMutex.Unlock()
+	if err := os.MkdirAll(filepath.Dir(policyAuditPath), 0700); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(policyAuditPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(append(data, '\n'))
+	return err
+}
+
+// This function checks the request of EDR server with the policy, and
+// writes a denial, an override of the built-in protected processes or a
+// rejected override to the policy audit log. The override is only used if
+// its signature is valid for the request, the action and its target.
+// Audit errors are passed to logError.
+func CheckServerRequest(ctx context.Context, method string, request interface{},
+	logError func(error)) *PolicyError {
+
+	action := RequestAction(method, request)
+	override := false
+	var overrideErr error
+	if signedOverride := ProtectionOverride(ctx); signedOverride != nil {
+		overrideErr = errors.New("action " + action + " has no protected process")
+		if CheckProtectedAction(action) {
+			pids, _, _ := RequestTargets(action, request)
+			for _, pid := range pids {
+				overrideErr = signedOverride.Verify(action, ConvertStringToInt32(pid))
+				if overrideErr != nil {
+					break
+				}
+			}
+		}
+		override = overrideErr == nil
+	}
+	policyError := CheckPolicy(method, request, override)
+	if policyError == nil && !override && overrideErr == nil {
+		return nil
+	}
+
+	record := &PolicyAuditRecord{
+		Source:    "server",
+		RequestId: RequestIdFromContext(ctx),
+		Method:    method,
+		Action:    action,
+		Request:   JournalRequest(request),
+		Override:  override,
+	}
+	if policyError != nil {
+		record.DenyReason = policyError.Reason
+		record.ResultInfo = policyError.Error()
+	} else if override {
+		record.ResultInfo = "Built-in protected processes are overridden"
+	}
+	if overrideErr != nil {
+		record.ResultInfo = strings.TrimSpace(record.ResultInfo + " Override is rejected: " +
+			overrideErr.Error())
+	}
+	if err := AuditDenial(record); err != nil && logError != nil {
+		logError(err)
+	}
+	return policyError
+}
+
+// This function returns the unary interceptor of gRPC server that denies
+// the requests that the policy does not allow. The methods that reply a
+// ResponseResult reply the denial with its DenyReason, the others return
+// PermissionDenied.
+func PolicyUnaryInterceptor(logError func(error)) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+
+		method := path.Base(info.FullMethod)
+		if policyError := CheckServerRequest(ctx, method, req, logError); policyError != nil {
+			if strings.HasPrefix(method, "ManagerEventCode") || method == "ManagerNetworkAdapter" {
+				return policyError.ResponseResult(), nil
+			}
+			return nil, policyError
+		}
+		return handler(ctx, req)
+	}
+}
+
+// PolicyServerStream struct checks the first received message (the
+// request) of a stream with the policy
+type PolicyServerStream struct {
+	grpc.ServerStream
+	method   string
+	logError func(error)
+	checked  bool
+}
+
+// This function receives a message and returns the denial if the policy
+// does not allow the first message
+func (stream *PolicyServerStream) RecvMsg(m interface{}) error {
+	if err := stream.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	if !stream.checked {
+		stream.checked = true
+		if policyError := CheckServerRequest(stream.Context(), stream.method, m,
+			stream.logError); policyError != nil {
+			return policyError
+		}
+	}
+	return nil
+}
+
+// This function returns the stream interceptor of gRPC server that denies
+// the streams that the policy does not allow
+func PolicyStreamInterceptor(logError func(error)) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler) error {
+
+		return handler(srv, &PolicyServerStream{
+			ServerStream: ss,
+			method:       path.Base(info.FullMethod),
+			logError:     logError,
+		})
+	}
+}
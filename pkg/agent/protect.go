@@ -0,0 +1,171 @@
+/**
+ * File:    protect.go
+ *
+ * Summary of File:
+ *
+ * 	This file contains the code related to the built-in protected processes
+ *	of the agent. Killing or suspending a critical process (ex: lsass,
+ *	services), the agent itself or a parent of the agent would crash or
+ *	blind the host.
+ * 	Functions:
+ * 	Checking that kill, killtree and suspend do not act on a protected
+ *	process, killtree checks every process of the tree.
+ * 	Verifying the override of protection that the EDR server signs for the
+ *	requests of its administrator and sends in their metadata.
+ */
+
+package agent
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/process"
+	"google.golang.org/grpc/metadata"
+)
+
+// Metadata of request that overrides the built-in protected processes, the
+// EDR server only sets it for the requests of its administrator
+const PROTECTION_OVERRIDE_METADATA = "bkedr-override-protection"
+
+// Actions that the built-in protected processes apply to
+var protectedActions = []string{"kill", "killtree", "suspend"}
+
+// SignedOverride struct is the override of a request: Token is the claims
+// and their signature by the EDR server, in base64 and separated by ".".
+// RequestId is the RequestId of the request that carries the override.
+type SignedOverride struct {
+	RequestId string
+	Token     string
+}
+
+// OverrideClaims struct is the JSON of override signed by the EDR server.
+// ExpireTime is Unix time.
+type OverrideClaims struct {
+	RequestId  string `json:"RequestId"`
+	Action     string `json:"Action"`
+	ProcessId  string `json:"ProcessId"`
+	ExpireTime int64  `json:"ExpireTime"`
+}
+
+// This function returns the override in the metadata of ctx, or nil. The
+// override is not verified yet, see Verify.
+func ProtectionOverride(ctx context.Context) *SignedOverride {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(PROTECTION_OVERRIDE_METADATA); len(values) > 0 {
+			return &SignedOverride{RequestId: RequestIdFromContext(ctx), Token: values[0]}
+		}
+	}
+	return nil
+}
+
+// This function checks that the override is signed by the EDR server for
+// its request, the action on the process of pid32, and is not expired. It
+// returns why the override is rejected, or nil. A nil override is rejected.
+func (override *SignedOverride) Verify(action string, pid32 int32) error {
+
+	if override == nil {
+		return errors.New("request has no override")
+	}
+	claims := OverrideClaims{}
+	if err := VerifyClaims(override.Token, &claims); err != nil {
+		return errors.New("override: " + err.Error())
+	}
+	if claims.RequestId == "" || claims.RequestId != override.RequestId {
+		return errors.New("override is signed for request " + claims.RequestId +
+			", not " + override.RequestId)
+	}
+	if NormalizeAction(claims.Action) != NormalizeAction(action) {
+		return errors.New("override is signed for action " + claims.Action + ", not " + action)
+	}
+	if ConvertStringToInt32(claims.ProcessId) != pid32 {
+		return errors.New("override is signed for ProcessId " + claims.ProcessId +
+			", not " + strconv.Itoa(int(pid32)))
+	}
+	if time.Now().Unix() > claims.ExpireTime {
+		return errors.New("override expired at " +
+			time.Unix(claims.ExpireTime, 0).Format("2006-01-02 15:04:05"))
+	}
+	return nil
+}
+
+// This function returns the PIDs of the parents of agent, up to the first
+// process (ex: services.exe on Windows, systemd or init on Linux)
+func AgentParents() []int32 {
+
+	parents := make([]int32, 0)
+	p, err := process.NewProcess(int32(os.Getpid()))
+	for err == nil {
+		ppid, errPpid := p.Ppid()
+		if errPpid != nil || ppid <= 0 || ppid == p.Pid {
+			break
+		}
+		// a loop of parents is not possible, but the list is bounded
+		if len(parents) >= 64 {
+			break
+		}
+		parents = append(parents, ppid)
+		p, err = process.NewProcess(ppid)
+	}
+	return parents
+}
+
+// This function returns why the process of pid32 is a built-in protected
+// process, or an empty string
+func CriticalProcess(pid32 int32) string {
+
+	pid := strconv.Itoa(int(pid32))
+	if int(pid32) == os.Getpid() {
+		return "ProcessId " + pid + " is the agent"
+	}
+	for _, parent := range AgentParents() {
+		if parent == pid32 {
+			return "ProcessId " + pid + " is a parent of the agent"
+		}
+	}
+
+	p, err := process.NewProcess(pid32)
+	if err != nil {
+		return ""
+	}
+	name, err := p.Name()
+	if err != nil {
+		return ""
+	}
+	for _, critical := range criticalProcesses {
+		if strings.EqualFold(critical, name) {
+			return "ProcessId " + pid + " " + name + " is a critical process"
+		}
+	}
+	return ""
+}
+
+// This function returns the denial if the process of pid32 is a built-in
+// protected process, or nil. With tree, the children of process are also
+// checked.
+func CheckCriticalProcess(pid32 int32, tree bool) *PolicyError {
+
+	if detail := CriticalProcess(pid32); detail != "" {
+		return &PolicyError{Reason: DENY_PROTECTED_PROCESS, Detail: detail}
+	}
+	if !tree {
+		return nil
+	}
+	p, err := process.NewProcess(pid32)
+	if err != nil {
+		return nil
+	}
+	if children, err := p.Children(); err == nil {
+		for _, child := range children {
+			if policyError := CheckCriticalProcess(child.Pid, true); policyError != nil {
+				policyError.Detail += " in the tree of ProcessId " + strconv.Itoa(int(pid32))
+				return policyError
+			}
+		}
+	}
+	return nil
+}
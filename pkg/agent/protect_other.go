@@ -0,0 +1,16 @@
+//go:build !windows
+// +build !windows
+
+/**
+ * File:    protect_other.go
+ *
+ * Summary of File:
+ *
+ * 	This file contains the critical processes of the operating systems
+ *	that are not Windows, killing or suspending them crashes the host.
+ */
+
+package agent
+
+// Names of the critical processes of this OS
+var criticalProcesses = []string{"systemd", "init"}
@@ -0,0 +1,169 @@
+/**
+ * File:    protect_test.go
+ *
+ * Summary of File:
+ *
+ * 	This file contains the tests of the override of the built-in protected
+ *	processes. The agent itself is a protected process, so the tests target
+ *	it and never kill it.
+ * 	Functions:
+ * 	Testing that the override is only used when the EDR server signed it for
+ *	the request, the action and the process, and that a bare header is
+ *	rejected by the policy and by kill, killtree and suspend.
+ */
+
+package agent
+
+import (
+	"bkedr/pkg/rpc"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// This function sets a new public key of EDR server and a policy audit log
+// in a temporary directory, and returns the private key
+func setTestOverrideKey(t *testing.T) ed25519.PrivateKey {
+
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldKey, oldAuditPath := localRulesPublicKey, policyAuditPath
+	localRulesPublicKey = publicKey
+	policyAuditPath = filepath.Join(t.TempDir(), "policy-audit.log")
+	t.Cleanup(func() { localRulesPublicKey, policyAuditPath = oldKey, oldAuditPath })
+	return privateKey
+}
+
+// This function returns the claims signed by key, like the EDR server signs
+// them
+func signTestClaims(t *testing.T, key ed25519.PrivateKey, claims interface{}) string {
+
+	data, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data) + "." +
+		base64.RawURLEncoding.EncodeToString(ed25519.Sign(key, data))
+}
+
+// This function returns the context of a request of EDR server with the
+// override
+func overrideContext(requestId string, override string) context.Context {
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+		REQUEST_ID_METADATA, requestId, PROTECTION_OVERRIDE_METADATA, override))
+}
+
+// This function tests that CheckServerRequest only overrides the protection
+// of the agent process with an override signed for the request
+func TestCheckServerRequestOverride(t *testing.T) {
+
+	key := setTestOverrideKey(t)
+	_, otherKey, _ := ed25519.GenerateKey(nil)
+	pid := strconv.Itoa(os.Getpid())
+	valid := OverrideClaims{
+		RequestId:  "request-1",
+		Action:     "kill",
+		ProcessId:  pid,
+		ExpireTime: time.Now().Add(time.Minute).Unix(),
+	}
+
+	tests := []struct {
+		name     string
+		override string
+		allowed  bool
+	}{
+		{name: "bare header", override: "true"},
+		{name: "other key", override: signTestClaims(t, otherKey, valid)},
+		{name: "other request", override: signTestClaims(t, key, OverrideClaims{
+			RequestId: "request-2", Action: "kill", ProcessId: pid, ExpireTime: valid.ExpireTime})},
+		{name: "other action", override: signTestClaims(t, key, OverrideClaims{
+			RequestId: "request-1", Action: "suspend", ProcessId: pid, ExpireTime: valid.ExpireTime})},
+		{name: "other process", override: signTestClaims(t, key, OverrideClaims{
+			RequestId: "request-1", Action: "kill", ProcessId: "1", ExpireTime: valid.ExpireTime})},
+		{name: "expired", override: signTestClaims(t, key, OverrideClaims{
+			RequestId: "request-1", Action: "kill", ProcessId: pid,
+			ExpireTime: time.Now().Add(-time.Minute).Unix()})},
+		{name: "signed", override: signTestClaims(t, key, valid), allowed: true},
+	}
+
+	request := &rpc.EventCode1{Action: "kill", ProcessId: pid}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := overrideContext("request-1", test.override)
+			policyError := CheckServerRequest(ctx, "ManagerEventCode1", request, func(err error) {
+				t.Error(err)
+			})
+			if test.allowed {
+				if policyError != nil {
+					t.Fatalf("signed override is denied: %v", policyError)
+				}
+				return
+			}
+			if policyError == nil || policyError.Reason != DENY_PROTECTED_PROCESS {
+				t.Fatalf("override is not rejected: %v", policyError)
+			}
+		})
+	}
+
+	// every override is audited, the rejected ones with the reason
+	data, err := ioutil.ReadFile(policyAuditPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != len(tests) {
+		t.Fatalf("audit log has %d records, want %d", len(lines), len(tests))
+	}
+	for index, line := range lines {
+		record := PolicyAuditRecord{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatal(err)
+		}
+		if record.Override != tests[index].allowed {
+			t.Errorf("%s: Override is %v", tests[index].name, record.Override)
+		}
+		if !tests[index].allowed && !strings.Contains(record.ResultInfo, "Override is rejected") {
+			t.Errorf("%s: ResultInfo is %q", tests[index].name, record.ResultInfo)
+		}
+	}
+}
+
+// This function tests that kill, killtree and suspend reject a bare header
+// and still refuse to act on the agent process
+func TestProcessActionsRejectBareOverride(t *testing.T) {
+
+	setTestOverrideKey(t)
+	pid32 := int32(os.Getpid())
+	override := ProtectionOverride(overrideContext("request-1", "true"))
+	if override == nil {
+		t.Fatal("override is not read from metadata")
+	}
+	if err := override.Verify("kill", pid32); err == nil {
+		t.Fatal("bare header is verified")
+	}
+
+	actions := map[string]func(int32, *SignedOverride) error{
+		"kill":     KillProcess,
+		"killtree": KillTreeProcess,
+		"suspend":  SuspendProcess,
+	}
+	for action, function := range actions {
+		err := function(pid32, override)
+		policyError, ok := err.(*PolicyError)
+		if !ok || policyError.Reason != DENY_PROTECTED_PROCESS {
+			t.Errorf("%s of the agent is not denied: %v", action, err)
+		}
+	}
+}
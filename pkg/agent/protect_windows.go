@@ -0,0 +1,13 @@
+/**
+ * File:    protect_windows.go
+ *
+ * Summary of File:
+ *
+ * 	This file contains the critical processes of Windows, killing or
+ *	suspending them crashes the host.
+ */
+
+package agent
+
+// Names of the critical processes of Windows
+var criticalProcesses = []string{"csrss.exe", "wininit.exe", "lsass.exe", "services.exe", "smss.exe"}
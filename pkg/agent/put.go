@@ -0,0 +1,170 @@
+/**
+ * File:    put.go
+ *
+ * Summary of File:
+ *
+ * 	This file contains the code related to the files pushed by the EDR
+ * 	server to the agent.
+ * 	Functions:
+ * 	Checking the destination with the allowed directories in config file.
+ *	Nothing is allowed if the config file does not set any directory.
+ * 	Receiving the file stream into a temporary file and verifying its
+ *	size and SHA-256 before it replaces the destination.
+ */
+
+package agent
+
+import (
+	"bkedr/pkg/rpc"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// This function checks that filePath is in one of the allowed directories
+// of config file. Symbolic links are resolved, so a link can not point out
+// of an allowed directory.
+func IsAllowedPutPath(filePath string) bool {
+
+	if !filepath.IsAbs(filePath) {
+		return false
+	}
+	filePath = ResolvePath(filePath)
+
+	for _, allowedPath := range CurrentConfig().AllowedPutPaths {
+		allowedPath = ResolvePath(ExpandEnvPath(allowedPath))
+		if IsSubPath(filePath, allowedPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// This function resolves the symbolic links of the longest existing parent
+// of filePath. The directories that do not exist yet are kept.
+func ResolvePath(filePath string) string {
+	filePath = filepath.Clean(filePath)
+	for dirPath := filePath; ; dirPath = filepath.Dir(dirPath) {
+		if resolved, err := filepath.EvalSymlinks(dirPath); err == nil {
+			rest, _ := filepath.Rel(dirPath, filePath)
+			return filepath.Join(resolved, rest)
+		}
+		if dirPath == filepath.Dir(dirPath) {
+			return filePath
+		}
+	}
+}
+
+// This function checks that filePath is in directory dirPath. Paths are
+// case-insensitive on Windows.
+func IsSubPath(filePath string, dirPath string) bool {
+	if runtime.GOOS == "windows" {
+		filePath = strings.ToLower(filePath)
+		dirPath = strings.ToLower(dirPath)
+	}
+	return strings.HasPrefix(filePath, strings.TrimSuffix(dirPath,
+		string(os.PathSeparator))+string(os.PathSeparator))
+}
+
+// This function receives the file stream sent by the EDR server and writes
+// the file to the destination of the first message. It returns the
+// metadata of the written file.
+func ReceivePutFile(stream rpc.Manager_ManagerPutFileServer) (*rpc.FileMeta, error) {
+
+	chunkData, err := stream.Recv()
+	if err != nil {
+		return nil, err
+	}
+	fileMeta := chunkData.GetMeta()
+	if fileMeta == nil {
+		return nil, errors.New("first message does not contain metadata of file")
+	}
+
+	filePath := fileMeta.GetFilePath()
+	if !IsAllowedPutPath(filePath) {
+		return fileMeta, errors.New("destination " + filePath + " is not allowed")
+	}
+	if len(fileMeta.GetSha256()) != sha256.Size*2 {
+		return fileMeta, errors.New("sha256 of " + filePath + " is invalid")
+	}
+	if maxFileSize := CurrentConfig().MaxFileSize; maxFileSize > 0 &&
+		fileMeta.GetSize() > maxFileSize {
+		return fileMeta, fmt.Errorf("size of file %d exceeds max size %d",
+			fileMeta.GetSize(), maxFileSize)
+	}
+	if info, err := os.Stat(filePath); err == nil {
+		if info.IsDir() || !fileMeta.GetOverwrite() {
+			return fileMeta, errors.New(filePath + " already exists")
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return fileMeta, err
+	}
+	tmpPath := filePath + ".bkedr.partial"
+	file, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return fileMeta, err
+	}
+
+	err = WritePutFile(stream, file, fileMeta, chunkData.GetFileChunk())
+	if errClose := file.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return fileMeta, err
+	}
+
+	// the destination is replaced only when the file is complete
+	if err := os.Rename(tmpPath, filePath); err != nil {
+		os.Remove(tmpPath)
+		return fileMeta, err
+	}
+	return fileMeta, nil
+}
+
+// This function writes the first chunk and the chunks of stream to file,
+// then checks the size and SHA-256 of written content with fileMeta.
+func WritePutFile(stream rpc.Manager_ManagerPutFileServer, file *os.File,
+	fileMeta *rpc.FileMeta, firstChunk []byte) error {
+
+	hash := sha256.New()
+	writer := io.MultiWriter(file, hash)
+	var size int64
+
+	chunk := firstChunk
+	for {
+		// stop receiving if the sender sends more than the size of file
+		size += int64(len(chunk))
+		if size > fileMeta.GetSize() {
+			return fmt.Errorf("received size exceeds size of file %d", fileMeta.GetSize())
+		}
+		if _, err := writer.Write(chunk); err != nil {
+			return err
+		}
+
+		chunkData, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		chunk = chunkData.GetFileChunk()
+	}
+
+	if size != fileMeta.GetSize() {
+		return fmt.Errorf("received size %d is different from %d", size, fileMeta.GetSize())
+	}
+	if sha := hex.EncodeToString(hash.Sum(nil)); sha != fileMeta.GetSha256() {
+		return errors.New("hash " + sha + " is different from " + fileMeta.GetSha256())
+	}
+	return file.Sync()
+}
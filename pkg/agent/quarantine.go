@@ -0,0 +1,313 @@
+/**
+ * File:    quarantine.go
+ *
+ * Summary of File:
+ *
+ * 	This file contains the code related to the quarantine store of the agent.
+ * 	Functions:
+ * 	Moving a file into the quarantine directory. The content is XOR-obfuscated
+ *	so it can not be executed.
+ * 	Recording original path, hash, ACL and timestamps of quarantined file.
+ * 	Restoring, purging and listing quarantined files.
+ */
+
+package agent
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// QuarantineItem struct is used to encode json of quarantine metadata file
+type QuarantineItem struct {
+	Id             string `json:"Id"`
+	OriginalPath   string `json:"OriginalPath"`
+	Sha256         string `json:"Sha256"`
+	Size           int64  `json:"Size"`
+	Mode           uint32 `json:"Mode"`
+	Acl            string `json:"Acl"`
+	ModTime        string `json:"ModTime"`
+	AccessTime     string `json:"AccessTime"`
+	CreateTime     string `json:"CreateTime"`
+	QuarantineTime string `json:"QuarantineTime"`
+	Key            string `json:"Key"`
+}
+
+// xorWriter XORs all bytes with key before writing them to writer
+type xorWriter struct {
+	writer io.Writer
+	key    []byte
+	offset int
+}
+
+// Write XORs p with key and writes the result to the underlying writer
+func (x *xorWriter) Write(p []byte) (int, error) {
+	buff := make([]byte, len(p))
+	for i := range p {
+		buff[i] = p[i] ^ x.key[(x.offset+i)%len(x.key)]
+	}
+	x.offset += len(p)
+	return x.writer.Write(buff)
+}
+
+// This function returns a random id of 8 bytes in hex. The ids of
+// quarantine items and registry backups are random, so they never collide
+// and cannot be guessed.
+func NewRandomId() (string, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// This function returns path of the obfuscated file and metadata file
+func QuarantinePaths(id string) (string, string) {
+	return filepath.Join(quarantineDir, id+".bin"),
+		filepath.Join(quarantineDir, id+".json")
+}
+
+// This function moves the file into quarantine directory and returns
+// the quarantine item. The original file is removed after the obfuscated
+// copy and metadata are written.
+func QuarantineFile(filePath string) (*QuarantineItem, error) {
+
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, errors.New(filePath + " is not a regular file")
+	}
+
+	if err := os.MkdirAll(quarantineDir, 0700); err != nil {
+		return nil, err
+	}
+
+	// ACL is saved before the file is removed
+	acl, err := SaveAcl(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Each file is obfuscated with a random key. The id is random too, it
+	// is sent to the EDR server and must not reveal the key.
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	id, err := NewRandomId()
+	if err != nil {
+		return nil, err
+	}
+	createTime, accessTime := GetFileTimes(info)
+	item := &QuarantineItem{
+		Id:             id,
+		OriginalPath:   filePath,
+		Size:           info.Size(),
+		Mode:           uint32(info.Mode().Perm()),
+		Acl:            acl,
+		ModTime:        info.ModTime().Format(time.RFC3339Nano),
+		AccessTime:     accessTime,
+		CreateTime:     createTime,
+		QuarantineTime: time.Now().Format("2006-01-02 15:04:05.000"),
+		Key:            hex.EncodeToString(key),
+	}
+	binPath, metaPath := QuarantinePaths(item.Id)
+
+	// Copy the obfuscated content and compute hash of the original content
+	if item.Sha256, _, err = CopyXorFile(filePath, binPath, key); err != nil {
+		os.Remove(binPath)
+		return nil, err
+	}
+	if err := WriteQuarantineItem(metaPath, item); err != nil {
+		os.Remove(binPath)
+		return nil, err
+	}
+
+	// If the original file can not be removed, undo the quarantine
+	if err := os.Remove(filePath); err != nil {
+		os.Remove(binPath)
+		os.Remove(metaPath)
+		return nil, err
+	}
+	return item, nil
+}
+
+// This function restores the quarantined file to its original path.
+// Target is the id of quarantine item or the original path of file, in this
+// case the latest quarantine item of this path is restored.
+func RestoreFile(target string) (*QuarantineItem, error) {
+
+	item, err := FindQuarantineItem(target)
+	if err != nil {
+		return nil, err
+	}
+	binPath, metaPath := QuarantinePaths(item.Id)
+
+	// Never overwrite a file that is created after quarantine
+	if _, err := os.Stat(item.OriginalPath); err == nil {
+		return nil, errors.New(item.OriginalPath + " already exists")
+	}
+
+	key, err := hex.DecodeString(item.Key)
+	if err != nil {
+		return nil, err
+	}
+	_, sha, err := CopyXorFile(binPath, item.OriginalPath, key)
+	if err != nil {
+		os.Remove(item.OriginalPath)
+		return nil, err
+	}
+
+	// The restored content must be the same as the original content
+	if sha != item.Sha256 {
+		os.Remove(item.OriginalPath)
+		return nil, errors.New("hash of restored file " + sha +
+			" is different from " + item.Sha256)
+	}
+
+	// Restore mode, ACL and timestamps of original file
+	os.Chmod(item.OriginalPath, os.FileMode(item.Mode))
+	if err := RestoreAcl(item.OriginalPath, item.Acl); err != nil {
+		return nil, err
+	}
+	if modTime, err := time.Parse(time.RFC3339Nano, item.ModTime); err == nil {
+		os.Chtimes(item.OriginalPath, modTime, modTime)
+	}
+
+	os.Remove(binPath)
+	os.Remove(metaPath)
+	return item, nil
+}
+
+// This function deletes the quarantined file permanently.
+// Target is the id of quarantine item or the original path of file, in this
+// case all quarantine items of this path are purged.
+func PurgeFile(target string) (int, error) {
+
+	items, err := ListQuarantineItems("")
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, item := range items {
+		if item.Id != target && item.OriginalPath != target {
+			continue
+		}
+		binPath, metaPath := QuarantinePaths(item.Id)
+		if err := os.Remove(binPath); err != nil && !os.IsNotExist(err) {
+			return count, err
+		}
+		if err := os.Remove(metaPath); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	if count == 0 {
+		return 0, errors.New(target + " is not quarantined")
+	}
+	return count, nil
+}
+
+// This function returns the quarantine item that has id equal target.
+// Otherwise, returns the latest quarantine item of original path target.
+func FindQuarantineItem(target string) (*QuarantineItem, error) {
+
+	items, err := ListQuarantineItems("")
+	if err != nil {
+		return nil, err
+	}
+
+	// items are sorted by quarantine time, search from the latest
+	for i := len(items) - 1; i >= 0; i-- {
+		if items[i].Id == target || items[i].OriginalPath == target {
+			return items[i], nil
+		}
+	}
+	return nil, errors.New(target + " is not quarantined")
+}
+
+// This function reads all metadata files in quarantine directory and
+// returns quarantine items sorted by quarantine time. If filePath is not
+// empty, only the items of this path are returned.
+func ListQuarantineItems(filePath string) ([]*QuarantineItem, error) {
+
+	items := make([]*QuarantineItem, 0)
+	metaPaths, err := filepath.Glob(filepath.Join(quarantineDir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, metaPath := range metaPaths {
+		byteValue, err := ioutil.ReadFile(metaPath)
+		if err != nil {
+			return nil, err
+		}
+		item := &QuarantineItem{}
+		if err := json.Unmarshal(byteValue, item); err != nil {
+			return nil, err
+		}
+		if filePath == "" || item.OriginalPath == filePath {
+			items = append(items, item)
+		}
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].QuarantineTime < items[j].QuarantineTime
+	})
+	return items, nil
+}
+
+// This function writes the quarantine item to metadata file
+func WriteQuarantineItem(metaPath string, item *QuarantineItem) error {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(metaPath, data, 0600)
+}
+
+// This function copies srcPath to dstPath, XORs content with key and
+// returns the sha256 of the source content and the destination content.
+// XOR is symmetric, so it is used to obfuscate and restore file.
+func CopyXorFile(srcPath string, dstPath string, key []byte) (string, string, error) {
+
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return "", "", err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(dstPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return "", "", err
+	}
+	defer dst.Close()
+
+	// hash of source is computed before XOR, hash of destination after XOR
+	srcHash := sha256.New()
+	dstHash := sha256.New()
+	writer := bufio.NewWriter(dst)
+	xor := &xorWriter{writer: io.MultiWriter(writer, dstHash), key: key}
+	if _, err = io.Copy(io.MultiWriter(xor, srcHash), src); err != nil {
+		return "", "", err
+	}
+	if err := writer.Flush(); err != nil {
+		return "", "", err
+	}
+	return hex.EncodeToString(srcHash.Sum(nil)),
+		hex.EncodeToString(dstHash.Sum(nil)), dst.Sync()
+}
@@ -0,0 +1,34 @@
+//go:build !windows
+// +build !windows
+
+/**
+ * File:    quarantine_other.go
+ *
+ * Summary of File:
+ *
+ * 	This file contains the functions used by the quarantine store on
+ *	the operating systems that are not Windows. File mode is saved in
+ *	quarantine item, so there is no ACL to save.
+ */
+
+package agent
+
+import (
+	"os"
+)
+
+// This function returns empty ACL, file mode is enough on this OS
+func SaveAcl(filePath string) (string, error) {
+	return "", nil
+}
+
+// This function does nothing, file mode is restored by quarantine store
+func RestoreAcl(filePath string, acl string) error {
+	return nil
+}
+
+// This function returns empty create time and access time, they are not
+// portable on this OS
+func GetFileTimes(info os.FileInfo) (string, string) {
+	return "", ""
+}
@@ -0,0 +1,82 @@
+/**
+ * File:    quarantine_windows.go
+ *
+ * Summary of File:
+ *
+ * 	This file contains the Windows functions used by the quarantine store:
+ *	Save and restore ACL of file, get create and access time of file.
+ */
+
+package agent
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// This function saves ACL of the file and returns it.
+// It executes icacls command of Windows OS.
+// Example: icacls C:\xxx\file.exe /save aclfile
+func SaveAcl(filePath string) (string, error) {
+
+	aclFile, err := ioutil.TempFile("", "bkedracl")
+	if err != nil {
+		return "", err
+	}
+	aclFile.Close()
+	defer os.Remove(aclFile.Name())
+
+	// Cmd struct to execute the icacls program with the given arguments
+	cmd := exec.Command("icacls", filePath, "/save", aclFile.Name())
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return "", errors.New(string(output))
+	}
+
+	acl, err := ioutil.ReadFile(aclFile.Name())
+	return string(acl), err
+}
+
+// This function restores ACL of the file that is saved by SaveAcl.
+// It executes icacls command of Windows OS. The ACL file contains name
+// of file, so ACL is restored on the directory of the file.
+// Example: icacls C:\xxx /restore aclfile
+func RestoreAcl(filePath string, acl string) error {
+
+	if acl == "" {
+		return nil
+	}
+
+	aclFile, err := ioutil.TempFile("", "bkedracl")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(aclFile.Name())
+	_, err = aclFile.WriteString(acl)
+	aclFile.Close()
+	if err != nil {
+		return err
+	}
+
+	// Cmd struct to execute the icacls program with the given arguments
+	cmd := exec.Command("icacls", filepath.Dir(filePath), "/restore", aclFile.Name())
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return errors.New(string(output))
+	}
+	return nil
+}
+
+// This function returns create time and access time of file
+func GetFileTimes(info os.FileInfo) (string, string) {
+	data, ok := info.Sys().(*syscall.Win32FileAttributeData)
+	if !ok {
+		return "", ""
+	}
+	createTime := time.Unix(0, data.CreationTime.Nanoseconds())
+	accessTime := time.Unix(0, data.LastAccessTime.Nanoseconds())
+	return createTime.Format(time.RFC3339Nano), accessTime.Format(time.RFC3339Nano)
+}
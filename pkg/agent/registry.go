@@ -0,0 +1,290 @@
+/**
+ * File:    registry.go
+ *
+ * Summary of File:
+ *
+ * 	This file contains the code related to the registry handling of the agent.
+ * 	Functions:
+ * 	Accessing the registry through the Registry interface, so the logic can
+ *	be used with the Windows registry or the in-memory registry of tests.
+ * 	Exporting a key with its subtree or a value to a backup file before
+ *	deleting it, deleting a key recursively.
+ * 	Restoring a key or a value from the backup file.
+ */
+
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Types of registry value, the same as the values of Windows registry
+const (
+	REG_NONE      = 0
+	REG_SZ        = 1
+	REG_EXPAND_SZ = 2
+	REG_BINARY    = 3
+	REG_DWORD     = 4
+	REG_MULTI_SZ  = 7
+	REG_QWORD     = 11
+)
+
+// Registry interface is used to access the registry. Root is the key
+// string of registry path (HKLM, HKCU, HKCR, HKU), path is the path of key.
+type Registry interface {
+	// SubKeyNames returns the names of subkeys of the key
+	SubKeyNames(root string, path string) ([]string, error)
+	// Values returns all values of the key
+	Values(root string, path string) ([]RegistryValue, error)
+	// Value returns the value that has name of the key
+	Value(root string, path string, name string) (RegistryValue, error)
+	// CreateKey creates the key and its parents if they do not exist
+	CreateKey(root string, path string) error
+	// SetValue sets the value of the key
+	SetValue(root string, path string, value RegistryValue) error
+	// DeleteKey deletes the key, the key must not have subkeys
+	DeleteKey(root string, path string) error
+	// DeleteValue deletes the value that has name of the key
+	DeleteValue(root string, path string, name string) error
+}
+
+// RegistryValue struct contains name, type and data of registry value.
+// Data is stored in the field based on the type of value.
+type RegistryValue struct {
+	Name    string   `json:"Name"`
+	Type    uint32   `json:"Type"`
+	String  string   `json:"String,omitempty"`
+	Strings []string `json:"Strings,omitempty"`
+	Integer uint64   `json:"Integer,omitempty"`
+	Binary  []byte   `json:"Binary,omitempty"`
+}
+
+// RegistryKeyBackup struct contains all values and subkeys of a key
+type RegistryKeyBackup struct {
+	Name    string               `json:"Name"`
+	Values  []RegistryValue      `json:"Values"`
+	SubKeys []*RegistryKeyBackup `json:"SubKeys"`
+}
+
+// RegistryBackup struct is used to encode json of registry backup file.
+// Key is set when backup is a key, Value is set when backup is a value.
+type RegistryBackup struct {
+	Id           string             `json:"Id"`
+	TargetObject string             `json:"TargetObject"`
+	Root         string             `json:"Root"`
+	Path         string             `json:"Path"`
+	BackupTime   string             `json:"BackupTime"`
+	Key          *RegistryKeyBackup `json:"Key,omitempty"`
+	Value        *RegistryValue     `json:"Value,omitempty"`
+}
+
+// This function exports the key with all values and subkeys
+func ExportKey(reg Registry, root string, path string) (*RegistryKeyBackup, error) {
+
+	values, err := reg.Values(root, path)
+	if err != nil {
+		return nil, err
+	}
+	subKeyNames, err := reg.SubKeyNames(root, path)
+	if err != nil {
+		return nil, err
+	}
+
+	keyBackup := &RegistryKeyBackup{
+		Name:   path[strings.LastIndex(path, "\\")+1:],
+		Values: values,
+	}
+
+	// This is recursive function, call itself for each subkey
+	for _, subKeyName := range subKeyNames {
+		subKey, err := ExportKey(reg, root, path+"\\"+subKeyName)
+		if err != nil {
+			return nil, err
+		}
+		keyBackup.SubKeys = append(keyBackup.SubKeys, subKey)
+	}
+	return keyBackup, nil
+}
+
+// This function creates the key with all values and subkeys of backup
+func ImportKey(reg Registry, root string, path string, keyBackup *RegistryKeyBackup) error {
+
+	if err := reg.CreateKey(root, path); err != nil {
+		return err
+	}
+	for _, value := range keyBackup.Values {
+		if err := reg.SetValue(root, path, value); err != nil {
+			return err
+		}
+	}
+
+	// This is recursive function, call itself for each subkey
+	for _, subKey := range keyBackup.SubKeys {
+		if err := ImportKey(reg, root, path+"\\"+subKey.Name, subKey); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// This function deletes the key and all its subkeys.
+// This is recursive function, call itself util it reaches the key that has
+// no subkeys, then delete backward keys
+func DeleteKeyTree(reg Registry, root string, path string) error {
+
+	subKeyNames, err := reg.SubKeyNames(root, path)
+	if err != nil {
+		return err
+	}
+	for _, subKeyName := range subKeyNames {
+		if err := DeleteKeyTree(reg, root, path+"\\"+subKeyName); err != nil {
+			return err
+		}
+	}
+	return reg.DeleteKey(root, path)
+}
+
+// This function exports the key to backup file, then deletes the key
+// and all its subkeys. Function returns the backup.
+func BackupAndDeleteKey(reg Registry, targetObject string) (*RegistryBackup, error) {
+
+	root, path := SplitKeyPath(targetObject)
+	keyBackup, err := ExportKey(reg, root, path)
+	if err != nil {
+		return nil, err
+	}
+	id, err := NewBackupId()
+	if err != nil {
+		return nil, err
+	}
+
+	backup := &RegistryBackup{
+		Id:           id,
+		TargetObject: targetObject,
+		Root:         root,
+		Path:         path,
+		BackupTime:   time.Now().Format("2006-01-02 15:04:05.000"),
+		Key:          keyBackup,
+	}
+	if err := WriteRegistryBackup(backup); err != nil {
+		return nil, err
+	}
+	return backup, DeleteKeyTree(reg, root, path)
+}
+
+// This function exports the value to backup file, then deletes the value.
+// Function returns the backup.
+func BackupAndDeleteValue(reg Registry, targetObject string) (*RegistryBackup, error) {
+
+	root, path, name := SplitKeyPathName(targetObject)
+	value, err := reg.Value(root, path, name)
+	if err != nil {
+		return nil, err
+	}
+	id, err := NewBackupId()
+	if err != nil {
+		return nil, err
+	}
+
+	backup := &RegistryBackup{
+		Id:           id,
+		TargetObject: targetObject,
+		Root:         root,
+		Path:         path,
+		BackupTime:   time.Now().Format("2006-01-02 15:04:05.000"),
+		Value:        &value,
+	}
+	if err := WriteRegistryBackup(backup); err != nil {
+		return nil, err
+	}
+	return backup, reg.DeleteValue(root, path, name)
+}
+
+// This function restores the key or the value from backup file.
+// Target is the id of backup or the target object, in this case the latest
+// backup of this target object is restored. The backup file is removed
+// after restoring.
+func RestoreRegistry(reg Registry, target string) (*RegistryBackup, error) {
+
+	backup, err := FindRegistryBackup(target)
+	if err != nil {
+		return nil, err
+	}
+
+	if backup.Key != nil {
+		err = ImportKey(reg, backup.Root, backup.Path, backup.Key)
+	} else if backup.Value != nil {
+		if err = reg.CreateKey(backup.Root, backup.Path); err == nil {
+			err = reg.SetValue(backup.Root, backup.Path, *backup.Value)
+		}
+	} else {
+		err = errors.New("backup " + backup.Id + " is empty")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return backup, os.Remove(RegistryBackupPath(backup.Id))
+}
+
+// This function returns the backup that has id equal target. Otherwise,
+// returns the latest backup of target object target.
+func FindRegistryBackup(target string) (*RegistryBackup, error) {
+
+	backupPaths, err := filepath.Glob(filepath.Join(registryBackupDir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	backups := make([]*RegistryBackup, 0)
+	for _, backupPath := range backupPaths {
+		byteValue, err := ioutil.ReadFile(backupPath)
+		if err != nil {
+			return nil, err
+		}
+		backup := &RegistryBackup{}
+		if err := json.Unmarshal(byteValue, backup); err != nil {
+			return nil, err
+		}
+		if backup.Id == target || strings.EqualFold(backup.TargetObject, target) {
+			backups = append(backups, backup)
+		}
+	}
+
+	if len(backups) == 0 {
+		return nil, errors.New(target + " has no backup")
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].BackupTime < backups[j].BackupTime
+	})
+	return backups[len(backups)-1], nil
+}
+
+// This function returns the path of backup file
+func RegistryBackupPath(id string) string {
+	return filepath.Join(registryBackupDir, id+".json")
+}
+
+// This function writes the backup to backup file
+func WriteRegistryBackup(backup *RegistryBackup) error {
+
+	if err := os.MkdirAll(registryBackupDir, 0700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(backup)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(RegistryBackupPath(backup.Id), data, 0600)
+}
+
+// This function returns a random id of backup
+func NewBackupId() (string, error) {
+	return NewRandomId()
+}
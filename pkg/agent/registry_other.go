@@ -0,0 +1,64 @@
+//go:build !windows
+// +build !windows
+
+/**
+ * File:    registry_other.go
+ *
+ * Summary of File:
+ *
+ * 	This file contains the implementation of Registry interface on the
+ *	operating systems that have no registry. All functions return error.
+ */
+
+package agent
+
+import (
+	"errors"
+)
+
+// Error is returned when the operating system has no registry
+var ErrRegistryNotSupported = errors.New("registry is not supported on this operating system")
+
+// UnsupportedRegistry is the implementation of Registry interface that
+// returns ErrRegistryNotSupported
+type UnsupportedRegistry struct{}
+
+// This function returns the Registry of the operating system
+func NewRegistry() Registry {
+	return &UnsupportedRegistry{}
+}
+
+// SubKeyNames returns ErrRegistryNotSupported
+func (*UnsupportedRegistry) SubKeyNames(root string, path string) ([]string, error) {
+	return nil, ErrRegistryNotSupported
+}
+
+// Values returns ErrRegistryNotSupported
+func (*UnsupportedRegistry) Values(root string, path string) ([]RegistryValue, error) {
+	return nil, ErrRegistryNotSupported
+}
+
+// Value returns ErrRegistryNotSupported
+func (*UnsupportedRegistry) Value(root string, path string, name string) (RegistryValue, error) {
+	return RegistryValue{}, ErrRegistryNotSupported
+}
+
+// CreateKey returns ErrRegistryNotSupported
+func (*UnsupportedRegistry) CreateKey(root string, path string) error {
+	return ErrRegistryNotSupported
+}
+
+// SetValue returns ErrRegistryNotSupported
+func (*UnsupportedRegistry) SetValue(root string, path string, value RegistryValue) error {
+	return ErrRegistryNotSupported
+}
+
+// DeleteKey returns ErrRegistryNotSupported
+func (*UnsupportedRegistry) DeleteKey(root string, path string) error {
+	return ErrRegistryNotSupported
+}
+
+// DeleteValue returns ErrRegistryNotSupported
+func (*UnsupportedRegistry) DeleteValue(root string, path string, name string) error {
+	return ErrRegistryNotSupported
+}
@@ -0,0 +1,281 @@
+/**
+ * File:    registry_test.go
+ *
+ * Summary of File:
+ *
+ * 	This file contains the tests of the registry handling of the agent with
+ *	MemoryRegistry, an in-memory implementation of Registry interface.
+ * 	Functions:
+ * 	Testing the backup and the deletion of a key with its subtree and of a
+ *	value, and restoring them from the backup file.
+ */
+
+package agent
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Errors are returned by MemoryRegistry
+var (
+	ErrRegistryNotExist   = errors.New("registry key or value does not exist")
+	ErrRegistryHasSubKeys = errors.New("registry key has subkeys")
+)
+
+// MemoryRegistry is an in-memory implementation of Registry interface.
+// Key names are case insensitive like the Windows registry.
+type MemoryRegistry struct {
+	mutex sync.Mutex
+	keys  map[string]*memoryKey
+}
+
+// memoryKey contains name and values of a key of MemoryRegistry
+type memoryKey struct {
+	path   string
+	values map[string]RegistryValue
+}
+
+// NewMemoryRegistry returns an empty MemoryRegistry
+func NewMemoryRegistry() *MemoryRegistry {
+	return &MemoryRegistry{keys: make(map[string]*memoryKey)}
+}
+
+// This function returns the key of map keys
+func memoryKeyName(root string, path string) string {
+	return strings.ToLower(root + "\\" + path)
+}
+
+// SubKeyNames returns the names of subkeys of the key
+func (m *MemoryRegistry) SubKeyNames(root string, path string) ([]string, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	parent := memoryKeyName(root, path)
+	if _, ok := m.keys[parent]; !ok {
+		return nil, ErrRegistryNotExist
+	}
+	names := make([]string, 0)
+	for name, key := range m.keys {
+		if strings.HasPrefix(name, parent+"\\") && !strings.Contains(name[len(parent)+1:], "\\") {
+			names = append(names, key.path[strings.LastIndex(key.path, "\\")+1:])
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Values returns all values of the key
+func (m *MemoryRegistry) Values(root string, path string) ([]RegistryValue, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	key, ok := m.keys[memoryKeyName(root, path)]
+	if !ok {
+		return nil, ErrRegistryNotExist
+	}
+	values := make([]RegistryValue, 0)
+	for _, value := range key.values {
+		values = append(values, value)
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i].Name < values[j].Name })
+	return values, nil
+}
+
+// Value returns the value that has name of the key
+func (m *MemoryRegistry) Value(root string, path string, name string) (RegistryValue, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if key, ok := m.keys[memoryKeyName(root, path)]; ok {
+		if value, ok := key.values[strings.ToLower(name)]; ok {
+			return value, nil
+		}
+	}
+	return RegistryValue{}, ErrRegistryNotExist
+}
+
+// CreateKey creates the key and its parents if they do not exist
+func (m *MemoryRegistry) CreateKey(root string, path string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	split := strings.Split(path, "\\")
+	for i := range split {
+		keyPath := root + "\\" + strings.Join(split[:i+1], "\\")
+		if _, ok := m.keys[strings.ToLower(keyPath)]; !ok {
+			m.keys[strings.ToLower(keyPath)] = &memoryKey{
+				path:   keyPath,
+				values: make(map[string]RegistryValue),
+			}
+		}
+	}
+	return nil
+}
+
+// SetValue sets the value of the key
+func (m *MemoryRegistry) SetValue(root string, path string, value RegistryValue) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	key, ok := m.keys[memoryKeyName(root, path)]
+	if !ok {
+		return ErrRegistryNotExist
+	}
+	key.values[strings.ToLower(value.Name)] = value
+	return nil
+}
+
+// DeleteKey deletes the key, the key must not have subkeys
+func (m *MemoryRegistry) DeleteKey(root string, path string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	name := memoryKeyName(root, path)
+	if _, ok := m.keys[name]; !ok {
+		return ErrRegistryNotExist
+	}
+	for other := range m.keys {
+		if strings.HasPrefix(other, name+"\\") {
+			return ErrRegistryHasSubKeys
+		}
+	}
+	delete(m.keys, name)
+	return nil
+}
+
+// DeleteValue deletes the value that has name of the key
+func (m *MemoryRegistry) DeleteValue(root string, path string, name string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if key, ok := m.keys[memoryKeyName(root, path)]; ok {
+		if _, ok := key.values[strings.ToLower(name)]; ok {
+			delete(key.values, strings.ToLower(name))
+			return nil
+		}
+	}
+	return ErrRegistryNotExist
+}
+
+// This function creates a key with a subtree and values in reg
+func newTestRegistry(t *testing.T) *MemoryRegistry {
+	reg := NewMemoryRegistry()
+	for _, path := range []string{"Software\\Bad", "Software\\Bad\\Run", "Software\\Bad\\Run\\Sub", "Software\\Good"} {
+		if err := reg.CreateKey("HKLM", path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	values := map[string]RegistryValue{
+		"Software\\Bad":           {Name: "Path", Type: REG_SZ, String: "C:\\bad.exe"},
+		"Software\\Bad\\Run":      {Name: "Args", Type: REG_MULTI_SZ, Strings: []string{"-a", "-b"}},
+		"Software\\Bad\\Run\\Sub": {Name: "Flags", Type: REG_DWORD, Integer: 7},
+		"Software\\Good":          {Name: "Data", Type: REG_BINARY, Binary: []byte{1, 2, 3}},
+	}
+	for path, value := range values {
+		if err := reg.SetValue("HKLM", path, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return reg
+}
+
+// This function sets the backup directory of registry to a directory of test
+func setTestBackupDir(t *testing.T) {
+	previous := registryBackupDir
+	registryBackupDir = t.TempDir()
+	t.Cleanup(func() { registryBackupDir = previous })
+}
+
+func TestBackupAndDeleteKeySubtree(t *testing.T) {
+	setTestBackupDir(t)
+	reg := newTestRegistry(t)
+	before, err := ExportKey(reg, "HKLM", "Software\\Bad")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backup, err := BackupAndDeleteKey(reg, "HKLM\\Software\\Bad")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if backup.Key == nil || len(backup.Key.SubKeys) != 1 || len(backup.Key.SubKeys[0].SubKeys) != 1 {
+		t.Fatalf("backup does not contain the subtree: %+v", backup.Key)
+	}
+	for _, path := range []string{"Software\\Bad", "Software\\Bad\\Run", "Software\\Bad\\Run\\Sub"} {
+		if _, err := reg.Values("HKLM", path); err != ErrRegistryNotExist {
+			t.Fatalf("key %s is not deleted: %v", path, err)
+		}
+	}
+	if _, err := reg.Value("HKLM", "Software\\Good", "Data"); err != nil {
+		t.Fatalf("other key is deleted: %v", err)
+	}
+	if _, err := os.Stat(RegistryBackupPath(backup.Id)); err != nil {
+		t.Fatalf("backup file is not written: %v", err)
+	}
+
+	restored, err := RestoreRegistry(reg, backup.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.Id != backup.Id {
+		t.Fatalf("restored backup %s, want %s", restored.Id, backup.Id)
+	}
+	after, err := ExportKey(reg, "HKLM", "Software\\Bad")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(before, after) {
+		t.Fatalf("restored key %+v, want %+v", after, before)
+	}
+	if _, err := os.Stat(RegistryBackupPath(backup.Id)); !os.IsNotExist(err) {
+		t.Fatalf("backup file is not removed: %v", err)
+	}
+}
+
+func TestBackupAndDeleteValue(t *testing.T) {
+	setTestBackupDir(t)
+	reg := newTestRegistry(t)
+
+	backup, err := BackupAndDeleteValue(reg, "HKLM\\Software\\Bad\\Run\\Args")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if backup.Value == nil || backup.Value.Name != "Args" {
+		t.Fatalf("backup does not contain the value: %+v", backup)
+	}
+	if _, err := reg.Value("HKLM", "Software\\Bad\\Run", "Args"); err != ErrRegistryNotExist {
+		t.Fatalf("value is not deleted: %v", err)
+	}
+	if _, err := reg.Values("HKLM", "Software\\Bad\\Run"); err != nil {
+		t.Fatalf("key of value is deleted: %v", err)
+	}
+
+	// the latest backup of the target object is restored
+	if _, err := RestoreRegistry(reg, "hklm\\software\\bad\\run\\args"); err != nil {
+		t.Fatal(err)
+	}
+	value, err := reg.Value("HKLM", "Software\\Bad\\Run", "Args")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(value, RegistryValue{Name: "Args", Type: REG_MULTI_SZ, Strings: []string{"-a", "-b"}}) {
+		t.Fatalf("restored value %+v", value)
+	}
+}
+
+func TestRestoreRegistryWithoutBackup(t *testing.T) {
+	setTestBackupDir(t)
+	reg := newTestRegistry(t)
+	if _, err := RestoreRegistry(reg, "HKLM\\Software\\Missing"); err == nil {
+		t.Fatal("restore without backup succeeds")
+	}
+	if _, err := BackupAndDeleteKey(reg, "HKLM\\Software\\Missing"); err == nil {
+		t.Fatal("backup of a missing key succeeds")
+	}
+}
@@ -0,0 +1,154 @@
+/**
+ * File:    registry_windows.go
+ *
+ * Summary of File:
+ *
+ * 	This file contains the implementation of Registry interface that
+ *	accesses the Windows registry.
+ */
+
+package agent
+
+import (
+	"golang.org/x/sys/windows/registry"
+)
+
+// WindowsRegistry is the implementation of Registry interface for Windows
+type WindowsRegistry struct{}
+
+// This function returns the Registry of the operating system
+func NewRegistry() Registry {
+	return &WindowsRegistry{}
+}
+
+// Convert key string to Windows Registry Key
+func ConvertKey(keyStr string) registry.Key {
+	switch keyStr {
+	case "HKCR":
+		return registry.CLASSES_ROOT
+	case "HKCU":
+		return registry.CURRENT_USER
+	case "HKLM":
+		return registry.LOCAL_MACHINE
+	case "HKU":
+		return registry.USERS
+	default:
+		return registry.CURRENT_CONFIG
+	}
+}
+
+// SubKeyNames returns the names of subkeys of the key
+func (*WindowsRegistry) SubKeyNames(root string, path string) ([]string, error) {
+	k, err := registry.OpenKey(ConvertKey(root), path, registry.ENUMERATE_SUB_KEYS)
+	if err != nil {
+		return nil, err
+	}
+	defer k.Close()
+	return k.ReadSubKeyNames(-1)
+}
+
+// Values returns all values of the key
+func (w *WindowsRegistry) Values(root string, path string) ([]RegistryValue, error) {
+	k, err := registry.OpenKey(ConvertKey(root), path, registry.QUERY_VALUE)
+	if err != nil {
+		return nil, err
+	}
+	defer k.Close()
+
+	names, err := k.ReadValueNames(-1)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]RegistryValue, 0, len(names))
+	for _, name := range names {
+		value, err := readValue(k, name)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// Value returns the value that has name of the key
+func (*WindowsRegistry) Value(root string, path string, name string) (RegistryValue, error) {
+	k, err := registry.OpenKey(ConvertKey(root), path, registry.QUERY_VALUE)
+	if err != nil {
+		return RegistryValue{}, err
+	}
+	defer k.Close()
+	return readValue(k, name)
+}
+
+// CreateKey creates the key and its parents if they do not exist
+func (*WindowsRegistry) CreateKey(root string, path string) error {
+	k, _, err := registry.CreateKey(ConvertKey(root), path, registry.ALL_ACCESS)
+	if err != nil {
+		return err
+	}
+	return k.Close()
+}
+
+// SetValue sets the value of the key. Value that is not string, strings or
+// integer is set as binary.
+func (*WindowsRegistry) SetValue(root string, path string, value RegistryValue) error {
+	k, err := registry.OpenKey(ConvertKey(root), path, registry.SET_VALUE)
+	if err != nil {
+		return err
+	}
+	defer k.Close()
+
+	switch value.Type {
+	case REG_SZ:
+		return k.SetStringValue(value.Name, value.String)
+	case REG_EXPAND_SZ:
+		return k.SetExpandStringValue(value.Name, value.String)
+	case REG_MULTI_SZ:
+		return k.SetStringsValue(value.Name, value.Strings)
+	case REG_DWORD:
+		return k.SetDWordValue(value.Name, uint32(value.Integer))
+	case REG_QWORD:
+		return k.SetQWordValue(value.Name, value.Integer)
+	default:
+		return k.SetBinaryValue(value.Name, value.Binary)
+	}
+}
+
+// DeleteKey deletes the key, the key must not have subkeys
+func (*WindowsRegistry) DeleteKey(root string, path string) error {
+	return registry.DeleteKey(ConvertKey(root), path)
+}
+
+// DeleteValue deletes the value that has name of the key
+func (*WindowsRegistry) DeleteValue(root string, path string, name string) error {
+	k, err := registry.OpenKey(ConvertKey(root), path, registry.SET_VALUE)
+	if err != nil {
+		return err
+	}
+	defer k.Close()
+	return k.DeleteValue(name)
+}
+
+// This function reads the value that has name of the opened key.
+// Data is read based on the type of value.
+func readValue(k registry.Key, name string) (RegistryValue, error) {
+
+	size, valType, err := k.GetValue(name, nil)
+	if err != nil {
+		return RegistryValue{}, err
+	}
+
+	value := RegistryValue{Name: name, Type: valType}
+	switch valType {
+	case registry.SZ, registry.EXPAND_SZ:
+		value.String, _, err = k.GetStringValue(name)
+	case registry.MULTI_SZ:
+		value.Strings, _, err = k.GetStringsValue(name)
+	case registry.DWORD, registry.QWORD:
+		value.Integer, _, err = k.GetIntegerValue(name)
+	default:
+		value.Binary = make([]byte, size)
+		_, _, err = k.GetValue(name, value.Binary)
+	}
+	return value, err
+}
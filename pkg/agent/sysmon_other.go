@@ -0,0 +1,24 @@
+//go:build !windows
+// +build !windows
+
+/**
+ * File:    sysmon_other.go
+ *
+ * Summary of File:
+ *
+ * 	This file contains the event source of the telemetry on the operating
+ *	systems without the Windows event log. Sysmon events can only be
+ *	replayed from a file.
+ */
+
+package agent
+
+import "errors"
+
+// Error is returned when the operating system has no Sysmon event log
+var ErrSysmonNotSupported = errors.New("Sysmon event log is only supported on Windows, use TelemetrySource file")
+
+// This function returns ErrSysmonNotSupported
+func NewSysmonEventSource() (EventSource, error) {
+	return nil, ErrSysmonNotSupported
+}
@@ -0,0 +1,151 @@
+/**
+ * File:    sysmon_windows.go
+ *
+ * Summary of File:
+ *
+ * 	This file contains the Windows event source of the telemetry. The agent
+ *	subscribes to the Sysmon Operational event log with the Windows Event
+ *	Log API (wevtapi.dll) and renders each new event as XML.
+ */
+
+package agent
+
+import (
+	"context"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// Event log of Sysmon events
+const SYSMON_CHANNEL = "Microsoft-Windows-Sysmon/Operational"
+
+const (
+	// Flag of EvtSubscribe, only the events after the subscription
+	EVT_SUBSCRIBE_TO_FUTURE_EVENTS = 1
+	// Flag of EvtRender, the event is rendered as XML
+	EVT_RENDER_EVENT_XML = 1
+)
+
+var (
+	wevtapi          = windows.NewLazySystemDLL("wevtapi.dll")
+	procEvtSubscribe = wevtapi.NewProc("EvtSubscribe")
+	procEvtNext      = wevtapi.NewProc("EvtNext")
+	procEvtRender    = wevtapi.NewProc("EvtRender")
+	procEvtClose     = wevtapi.NewProc("EvtClose")
+)
+
+// SysmonEventSource struct sends the new events of an event log channel
+type SysmonEventSource struct {
+	Channel string
+}
+
+// This function returns the event source of Sysmon Operational event log
+func NewSysmonEventSource() (EventSource, error) {
+	if err := procEvtSubscribe.Find(); err != nil {
+		return nil, err
+	}
+	return &SysmonEventSource{Channel: SYSMON_CHANNEL}, nil
+}
+
+// This function returns the name of source
+func (source *SysmonEventSource) Name() string {
+	return "event log " + source.Channel
+}
+
+// This function subscribes to the new events of channel and sends them as
+// XML. The subscription signals an event object when new events exist,
+// they are then read with EvtNext until there are no more items.
+func (source *SysmonEventSource) Run(ctx context.Context, events chan<- string) error {
+
+	signal, err := windows.CreateEvent(nil, 1, 1, nil)
+	if err != nil {
+		return err
+	}
+	defer windows.CloseHandle(signal)
+
+	channel, err := windows.UTF16PtrFromString(source.Channel)
+	if err != nil {
+		return err
+	}
+	query, err := windows.UTF16PtrFromString("*")
+	if err != nil {
+		return err
+	}
+	subscription, _, err := procEvtSubscribe.Call(0, uintptr(signal),
+		uintptr(unsafe.Pointer(channel)), uintptr(unsafe.Pointer(query)), 0, 0, 0,
+		EVT_SUBSCRIBE_TO_FUTURE_EVENTS)
+	if subscription == 0 {
+		return err
+	}
+	defer procEvtClose.Call(subscription)
+
+	handles := make([]uintptr, 64)
+	buffer := make([]uint16, 16*1024)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		default:
+		}
+
+		// wait at most 1 second, so ctx is checked
+		status, err := windows.WaitForSingleObject(signal, 1000)
+		if err != nil {
+			return err
+		}
+		if status == uint32(windows.WAIT_TIMEOUT) {
+			continue
+		}
+
+		for {
+			var returned uint32
+			ret, _, err := procEvtNext.Call(subscription, uintptr(len(handles)),
+				uintptr(unsafe.Pointer(&handles[0])), 0, 0, uintptr(unsafe.Pointer(&returned)))
+			if ret == 0 {
+				if err == windows.ERROR_NO_MORE_ITEMS {
+					windows.ResetEvent(signal)
+					break
+				}
+				return err
+			}
+
+			// every handle is closed, even if ctx is done
+			done := false
+			for _, handle := range handles[:returned] {
+				xml, err := RenderEventXml(handle, &buffer)
+				procEvtClose.Call(handle)
+				if err != nil || done {
+					continue
+				}
+				select {
+				case events <- xml:
+				case <-ctx.Done():
+					done = true
+				}
+			}
+			if done {
+				return nil
+			}
+		}
+	}
+}
+
+// This function renders the event of handle as XML. The buffer is grown if
+// the event is larger.
+func RenderEventXml(handle uintptr, buffer *[]uint16) (string, error) {
+
+	for {
+		var used, propertyCount uint32
+		ret, _, err := procEvtRender.Call(0, handle, EVT_RENDER_EVENT_XML,
+			uintptr(len(*buffer)*2), uintptr(unsafe.Pointer(&(*buffer)[0])),
+			uintptr(unsafe.Pointer(&used)), uintptr(unsafe.Pointer(&propertyCount)))
+		if ret != 0 {
+			return windows.UTF16ToString((*buffer)[:used/2]), nil
+		}
+		if err != windows.ERROR_INSUFFICIENT_BUFFER {
+			return "", err
+		}
+		*buffer = make([]uint16, used/2+1)
+	}
+}
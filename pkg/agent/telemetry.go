@@ -0,0 +1,340 @@
+/**
+ * File:    telemetry.go
+ *
+ * Summary of File:
+ *
+ * 	This file contains the code related to the telemetry of the agent. The
+ * 	agent collects events itself and streams them to the EDR server, so
+ *	the detection does not wait for Splunk.
+ * 	Functions:
+ * 	Event sources: the Sysmon Operational event log on Windows, and the
+ *	replay of an event file (one event per line) for tests on Linux.
+ * 	Batching the events, compressing each batch with gzip and sending the
+ *	batches on a telemetry stream to the EDR server.
+ * 	Opening the stream again when the server is unreachable, the batches
+ *	wait in memory and the event source waits when too many batches wait.
+ * 	Comparing the events with the local rules while the server is
+ *	unreachable, and uploading the local results first when it is back.
+ */
+
+package agent
+
+import (
+	"bkedr/pkg/rpc"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// Max number of batches that wait for the EDR server
+	MAX_PENDING_BATCHES = 100
+	// Metadata of telemetry that contains the token of agent
+	AGENT_TOKEN_METADATA = "bkedr-agent-token"
+)
+
+// EventSource is a source of raw events of agent, Sysmon XML or JSON. Run
+// sends the events to events until ctx is done, or until the source has no
+// more events.
+type EventSource interface {
+	Name() string
+	Run(ctx context.Context, events chan<- string) error
+}
+
+// FileReplaySource struct replays the events of a file, one event per line.
+// It is used to test the telemetry without Sysmon.
+type FileReplaySource struct {
+	Path string
+}
+
+// This function returns the name of source
+func (source *FileReplaySource) Name() string {
+	return "file " + source.Path
+}
+
+// This function sends each line of file that is not empty as an event
+func (source *FileReplaySource) Run(ctx context.Context, events chan<- string) error {
+
+	file, err := os.Open(source.Path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		select {
+		case events <- line:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+// This function checks that the telemetry is enabled in agent config
+func TelemetryEnabled() bool {
+	return CurrentConfig().TelemetryPort != ""
+}
+
+// This function returns ctx with the token of agent, the telemetry service
+// of EDR server authenticates the agent with it.
+func TelemetryContext(ctx context.Context) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, AGENT_TOKEN_METADATA, telemetryToken)
+}
+
+// This function returns the event source of agent config: sysmon (default)
+// or file, which replays TelemetryReplayFile.
+func NewEventSource() (EventSource, error) {
+	if telemetrySource == "file" {
+		return &FileReplaySource{Path: telemetryReplayFile}, nil
+	}
+	return NewSysmonEventSource()
+}
+
+// TelemetryBatch struct is a batch of events that waits for the EDR
+// server. LocalHandled[i] is true when event i is compared with the local
+// rules, the server does not execute the responses of local rules again.
+type TelemetryBatch struct {
+	Events       []string
+	LocalHandled []bool
+}
+
+// This function adds the event to batch
+func (batch *TelemetryBatch) Add(event string, localHandled bool) {
+	batch.Events = append(batch.Events, event)
+	batch.LocalHandled = append(batch.LocalHandled, localHandled)
+}
+
+// TelemetryStreamer struct sends the batches of events to the telemetry
+// service of EDR server. Offline is true after the server is unreachable,
+// until a batch is sent again. Address is the address of the open stream.
+type TelemetryStreamer struct {
+	computerName string
+	conn         *grpc.ClientConn
+	address      string
+	stream       rpc.Telemetry_TelemetryStreamClient
+	pending      []*TelemetryBatch
+	offline      bool
+}
+
+// This function runs the telemetry of agent: it reads the events of source
+// and sends them in batches of telemetryBatchSize events, or every
+// telemetryFlushInterval. Errors are passed to logError. It returns when
+// the source has no more events and the last batches are sent.
+// While the server is unreachable, the events are also compared with the
+// local rules: the new events, and the events of the batches that wait
+// when a flush fails. They are marked in their batch.
+func RunTelemetry(source EventSource, logError func(error)) error {
+
+	computerName, _ := os.Hostname()
+	streamer := &TelemetryStreamer{computerName: computerName}
+	defer streamer.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := make(chan string, telemetryBatchSize)
+	sourceDone := make(chan error, 1)
+	go func() {
+		sourceDone <- source.Run(ctx, events)
+		close(events)
+	}()
+
+	ticker := time.NewTicker(telemetryFlushInterval)
+	defer ticker.Stop()
+	batch := &TelemetryBatch{}
+	for {
+		// the source waits while too many batches wait for the server,
+		// except with local rules: the events are still compared with them
+		// and the oldest batch is dropped
+		input := events
+		if len(streamer.pending) >= MAX_PENDING_BATCHES {
+			if LocalRulesEnabled() {
+				streamer.pending = streamer.pending[1:]
+				logError(errors.New("telemetry drops a batch, " +
+					strconv.Itoa(MAX_PENDING_BATCHES) + " batches wait for the server"))
+			} else {
+				input = nil
+			}
+		}
+
+		select {
+		case event, ok := <-input:
+			if !ok {
+				if len(batch.Events) > 0 {
+					streamer.pending = append(streamer.pending, batch)
+				}
+				// the last batches are sent again until the server
+				// receives them
+				for {
+					err := streamer.Flush()
+					if err == nil {
+						break
+					}
+					logError(err)
+					streamer.DetectPending(logError)
+					<-ticker.C
+				}
+				return <-sourceDone
+			}
+			localHandled := false
+			if streamer.offline && LocalRulesEnabled() {
+				if err := DetectLocal(event); err != nil {
+					logError(err)
+				}
+				localHandled = true
+			}
+			batch.Add(event, localHandled)
+			if len(batch.Events) < telemetryBatchSize {
+				continue
+			}
+		case <-ticker.C:
+		}
+
+		if len(batch.Events) > 0 {
+			streamer.pending = append(streamer.pending, batch)
+			batch = &TelemetryBatch{}
+		}
+		if err := streamer.Flush(); err != nil {
+			logError(err)
+			streamer.DetectPending(logError)
+		}
+	}
+}
+
+// This function compares the events of the pending batches that are not
+// handled yet with the local rules, when the server is unreachable. The
+// events that waited for the server when it became unreachable are handled
+// like the new events.
+func (streamer *TelemetryStreamer) DetectPending(logError func(error)) {
+
+	if !streamer.offline || !LocalRulesEnabled() {
+		return
+	}
+	for _, batch := range streamer.pending {
+		for index, event := range batch.Events {
+			if batch.LocalHandled[index] {
+				continue
+			}
+			if err := DetectLocal(event); err != nil {
+				logError(err)
+			}
+			batch.LocalHandled[index] = true
+		}
+	}
+}
+
+// This function sends the pending batches in order. A batch is removed
+// when it is sent, the stream is opened again at the next flush after an
+// error, or when the config profile changes the address of server.
+func (streamer *TelemetryStreamer) Flush() error {
+
+	config := CurrentConfig()
+	if streamer.stream != nil && streamer.address != config.ServerHost+":"+config.TelemetryPort {
+		streamer.Close()
+	}
+	for len(streamer.pending) > 0 {
+		if streamer.stream == nil {
+			if err := streamer.Open(); err != nil {
+				streamer.offline = true
+				return err
+			}
+		}
+		batch, err := EncodeEventBatch(streamer.computerName, streamer.pending[0])
+		if err != nil {
+			// a batch that cannot be encoded is dropped
+			streamer.pending = streamer.pending[1:]
+			return err
+		}
+		if err := streamer.stream.Send(batch); err != nil {
+			streamer.Close()
+			streamer.offline = true
+			return err
+		}
+		streamer.pending = streamer.pending[1:]
+		streamer.offline = false
+	}
+	return nil
+}
+
+// This function opens the telemetry stream to the EDR server. The results
+// of local responses are uploaded first, so the server knows the responses
+// before it receives the events that the agent already handled.
+func (streamer *TelemetryStreamer) Open() error {
+
+	config := CurrentConfig()
+	address := config.ServerHost + ":" + config.TelemetryPort
+	conn, err := grpc.Dial(address, grpc.WithInsecure())
+	if err != nil {
+		return err
+	}
+	if LocalRulesEnabled() {
+		if err := UploadLocalResults(conn); err != nil {
+			conn.Close()
+			return err
+		}
+	}
+	stream, err := rpc.NewTelemetryClient(conn).TelemetryStream(
+		TelemetryContext(context.Background()))
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	streamer.conn = conn
+	streamer.address = address
+	streamer.stream = stream
+	return nil
+}
+
+// This function closes the stream and waits for the acknowledgement of
+// server.
+func (streamer *TelemetryStreamer) Close() {
+	if streamer.stream != nil {
+		streamer.stream.CloseAndRecv()
+		streamer.stream = nil
+	}
+	if streamer.conn != nil {
+		streamer.conn.Close()
+		streamer.conn = nil
+	}
+}
+
+// This function returns the batch of events, the JSON array of events is
+// compressed with gzip.
+func EncodeEventBatch(computerName string, batch *TelemetryBatch) (*rpc.EventBatch, error) {
+
+	data, err := json.Marshal(batch.Events)
+	if err != nil {
+		return nil, err
+	}
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return &rpc.EventBatch{
+		ComputerName: computerName,
+		Compression:  "gzip",
+		Events:       buffer.Bytes(),
+		Count:        int32(len(batch.Events)),
+		LocalHandled: batch.LocalHandled,
+	}, nil
+}
@@ -0,0 +1,266 @@
+/**
+ * File:    telemetry_test.go
+ *
+ * Summary of File:
+ *
+ * 	This file contains the tests of the telemetry of the agent with the
+ *	file replay source and a local gRPC server that stands in for the
+ *	telemetry service of the EDR server.
+ * 	Functions:
+ * 	Testing that the events of a replayed file are sent in batches and that
+ *	the server receives each event, normalized like the EDR server does.
+ * 	Testing that the events that wait when the server becomes unreachable
+ *	are compared with the local rules and sent marked as handled.
+ */
+
+package agent
+
+import (
+	"bkedr/pkg/rpc"
+	"bkedr/pkg/server"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// telemetryStandIn struct is a local telemetry service. The events of each
+// batch are decoded and normalized with the code of the EDR server.
+type telemetryStandIn struct {
+	rpc.UnimplementedTelemetryServer
+	mutex        sync.Mutex
+	batches      []int
+	events       []map[string]string
+	localHandled []bool
+	results      []string
+}
+
+// TelemetryStream receives the batches of agent until the stream is
+// closed, the agent must send its token
+func (standIn *telemetryStandIn) TelemetryStream(stream rpc.Telemetry_TelemetryStreamServer) error {
+
+	md, _ := metadata.FromIncomingContext(stream.Context())
+	if tokens := md.Get(AGENT_TOKEN_METADATA); len(tokens) == 0 || tokens[0] != telemetryToken {
+		return status.Error(codes.Unauthenticated, "agent token is not valid")
+	}
+
+	var received int64
+	for {
+		batch, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(&rpc.TelemetryAck{Received: received})
+		}
+		if err != nil {
+			return err
+		}
+		events, err := server.DecodeEventBatch(batch)
+		if err != nil {
+			return err
+		}
+
+		standIn.mutex.Lock()
+		standIn.batches = append(standIn.batches, len(events))
+		standIn.localHandled = append(standIn.localHandled, batch.GetLocalHandled()...)
+		for _, event := range events {
+			jsonString, ok := server.NormalizeSourceEvent(event, "telemetry",
+				map[string]string{"ComputerName": batch.GetComputerName()}, false)
+			if !ok {
+				standIn.mutex.Unlock()
+				return io.ErrUnexpectedEOF
+			}
+			fields := make(map[string]string)
+			json.Unmarshal([]byte(jsonString), &fields)
+			standIn.events = append(standIn.events, fields)
+		}
+		standIn.mutex.Unlock()
+		received += int64(len(events))
+	}
+}
+
+// UploadResults receives the local results of agent
+func (standIn *telemetryStandIn) UploadResults(ctx context.Context,
+	batch *rpc.ResultBatch) (*rpc.TelemetryAck, error) {
+
+	standIn.mutex.Lock()
+	defer standIn.mutex.Unlock()
+	standIn.results = append(standIn.results, batch.GetResults()...)
+	return &rpc.TelemetryAck{Received: int64(len(batch.GetResults()))}, nil
+}
+
+// This function starts the local telemetry service and sets the agent
+// config to send the telemetry to it
+func newTelemetryStandIn(t *testing.T) *telemetryStandIn {
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	standIn := &telemetryStandIn{}
+	grpcServer := grpc.NewServer()
+	rpc.RegisterTelemetryServer(grpcServer, standIn)
+	go grpcServer.Serve(listener)
+	t.Cleanup(grpcServer.Stop)
+
+	oldToken := telemetryToken
+	telemetryToken = "telemetry-token"
+	t.Cleanup(func() { telemetryToken = oldToken })
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	setTestConfig(t, func(config *AgentConfigObj) {
+		config.ServerHost = host
+		config.TelemetryPort = port
+	})
+	return standIn
+}
+
+// This function tests that the replay of an event file sends every event,
+// in order and in batches of telemetryBatchSize, and that the server gets
+// the normalized fields and the ComputerName of agent
+func TestTelemetryFileReplay(t *testing.T) {
+
+	standIn := newTelemetryStandIn(t)
+	oldSource, oldFile := telemetrySource, telemetryReplayFile
+	oldSize, oldInterval := telemetryBatchSize, telemetryFlushInterval
+	t.Cleanup(func() {
+		telemetrySource, telemetryReplayFile = oldSource, oldFile
+		telemetryBatchSize, telemetryFlushInterval = oldSize, oldInterval
+	})
+	telemetrySource = "file"
+	telemetryReplayFile = filepath.Join("testdata", "telemetry", "events.log")
+	telemetryBatchSize = 2
+	// the batches are only sent when they are full or at the end of file
+	telemetryFlushInterval = time.Hour
+
+	source, err := NewEventSource()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := source.(*FileReplaySource); !ok {
+		t.Fatalf("source is %s, want the file replay", source.Name())
+	}
+	errs := make([]error, 0)
+	if err := RunTelemetry(source, func(err error) { errs = append(errs, err) }); err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) > 0 {
+		t.Fatalf("telemetry errors: %v", errs)
+	}
+
+	standIn.mutex.Lock()
+	defer standIn.mutex.Unlock()
+	if want := []int{2, 2, 1}; !reflect.DeepEqual(standIn.batches, want) {
+		t.Errorf("batches are %v, want %v", standIn.batches, want)
+	}
+
+	computerName, _ := os.Hostname()
+	want := []map[string]string{
+		{"EventCode": "1", "LogFormat": "sysmon-xml", "CommandLine": "cmd.exe /c whoami"},
+		{"EventCode": "3", "LogFormat": "sysmon-xml", "DestinationIp": "10.1.2.3"},
+		{"EventCode": "11", "LogFormat": "sysmon-xml", "TargetFilename": `C:\Users\Public\payload.exe`},
+		{"EventCode": "22", "QueryName": "example.org"},
+		{"EventCode": "5", "Image": `C:\Windows\System32\cmd.exe`},
+	}
+	if len(standIn.events) != len(want) {
+		t.Fatalf("server received %d events, want %d", len(standIn.events), len(want))
+	}
+	for index, fields := range want {
+		event := standIn.events[index]
+		fields["ComputerName"] = computerName
+		fields["IngestSource"] = "telemetry"
+		fields["ProcessId"] = "4312"
+		for key, value := range fields {
+			if event[key] != value {
+				t.Errorf("event %d: %s is %q, want %q", index, key, event[key], value)
+			}
+		}
+	}
+}
+
+// This function tests that the events that wait for the server when it
+// becomes unreachable are compared with the local rules, and that the
+// server gets them marked as handled after the local results
+func TestTelemetryOfflineLocalHandled(t *testing.T) {
+
+	setTestOverrideKey(t)
+	oldRules, oldResultsPath := localRuleSet, localResultsPath
+	oldJournalPath, oldJournalSize := actionJournalPath, actionJournalSize
+	t.Cleanup(func() {
+		localRuleSet, localResultsPath = oldRules, oldResultsPath
+		actionJournalPath, actionJournalSize = oldJournalPath, oldJournalSize
+	})
+	dir := t.TempDir()
+	localResultsPath = filepath.Join(dir, "localresults.spool")
+	actionJournalPath = filepath.Join(dir, "actions.journal")
+	actionJournalSize = 1000
+	// the file does not exist, the delete fails without changing the host
+	localRuleSet = LocalRuleSet{Version: 1, Rules: []map[string]interface{}{{
+		"Type":    "file",
+		"Message": "payload is created",
+		"Action":  "delete",
+		"Data":    map[string]interface{}{"EventCode": "11", "TargetFilename": ".*payload.exe"},
+	}}}
+
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "telemetry", "events.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	batch := &TelemetryBatch{}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			batch.Add(line, false)
+		}
+	}
+
+	// the server is unreachable: the port of a closed listener
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	listener.Close()
+	setTestConfig(t, func(config *AgentConfigObj) {
+		config.ServerHost = host
+		config.TelemetryPort = port
+	})
+
+	computerName, _ := os.Hostname()
+	streamer := &TelemetryStreamer{computerName: computerName, pending: []*TelemetryBatch{batch}}
+	defer streamer.Close()
+	if err := streamer.Flush(); err == nil {
+		t.Fatal("flush to an unreachable server succeeds")
+	}
+	streamer.DetectPending(func(err error) { t.Error(err) })
+	for index, localHandled := range batch.LocalHandled {
+		if !localHandled {
+			t.Errorf("event %d is not compared with the local rules", index)
+		}
+	}
+
+	standIn := newTelemetryStandIn(t)
+	if err := streamer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	streamer.Close()
+
+	standIn.mutex.Lock()
+	defer standIn.mutex.Unlock()
+	if len(standIn.results) != 1 || !strings.Contains(standIn.results[0], "payload.exe") {
+		t.Errorf("server received local results %v, want the delete of payload.exe", standIn.results)
+	}
+	if want := []bool{true, true, true, true, true}; !reflect.DeepEqual(standIn.localHandled, want) {
+		t.Errorf("server received LocalHandled %v, want %v", standIn.localHandled, want)
+	}
+}
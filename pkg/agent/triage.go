@@ -0,0 +1,336 @@
+/**
+ * File:    triage.go
+ *
+ * Summary of File:
+ *
+ * 	This file contains the code related to the live triage of the agent.
+ * 	Functions:
+ * 	Taking a snapshot of the host: processes with command lines, parents
+ *	and hashes, network connections with owning processes, logged-on
+ *	users, services, scheduled tasks and autoruns.
+ * 	Reading autoruns from the Run keys of registry.
+ * 	A section that fails is recorded in Errors of the snapshot, the other
+ *	sections are still returned.
+ */
+
+package agent
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/host"
+	"github.com/shirou/gopsutil/net"
+	"github.com/shirou/gopsutil/process"
+)
+
+// Run keys of registry that start programs, relative to HKLM or HKU\<sid>
+var REGISTRY_RUN_KEYS = []string{
+	"SOFTWARE\\Microsoft\\Windows\\CurrentVersion\\Run",
+	"SOFTWARE\\Microsoft\\Windows\\CurrentVersion\\RunOnce",
+	"SOFTWARE\\WOW6432Node\\Microsoft\\Windows\\CurrentVersion\\Run",
+	"SOFTWARE\\WOW6432Node\\Microsoft\\Windows\\CurrentVersion\\RunOnce",
+}
+
+// Winlogon key, its values Shell and Userinit start programs at logon
+const REGISTRY_WINLOGON_KEY = "SOFTWARE\\Microsoft\\Windows NT\\CurrentVersion\\Winlogon"
+
+// TriageSnapshot struct is used to encode json of triage snapshot
+type TriageSnapshot struct {
+	ComputerName   string             `json:"ComputerName"`
+	Platform       string             `json:"Platform"`
+	BootTime       string             `json:"BootTime"`
+	CollectedTime  string             `json:"CollectedTime"`
+	Processes      []TriageProcess    `json:"Processes"`
+	Connections    []TriageConnection `json:"Connections"`
+	Users          []TriageUser       `json:"Users"`
+	Services       []TriageService    `json:"Services"`
+	ScheduledTasks []TriageTask       `json:"ScheduledTasks"`
+	Autoruns       []TriageAutorun    `json:"Autoruns"`
+	Errors         map[string]string  `json:"Errors,omitempty"`
+}
+
+// TriageProcess struct is used to encode json of a process
+type TriageProcess struct {
+	Pid         int32  `json:"Pid"`
+	Ppid        int32  `json:"Ppid"`
+	Name        string `json:"Name"`
+	Exe         string `json:"Exe"`
+	CommandLine string `json:"CommandLine"`
+	Username    string `json:"Username"`
+	CreateTime  string `json:"CreateTime"`
+	Sha256      string `json:"Sha256,omitempty"`
+}
+
+// TriageConnection struct is used to encode json of a network connection
+type TriageConnection struct {
+	Protocol      string `json:"Protocol"`
+	LocalIp       string `json:"LocalIp"`
+	LocalPort     uint32 `json:"LocalPort"`
+	RemoteIp      string `json:"RemoteIp"`
+	RemotePort    uint32 `json:"RemotePort"`
+	Status        string `json:"Status"`
+	Pid           int32  `json:"Pid"`
+	ProcessName   string `json:"ProcessName"`
+	ProcessImage  string `json:"ProcessImage"`
+	ProcessSha256 string `json:"ProcessSha256,omitempty"`
+}
+
+// TriageUser struct is used to encode json of a logged-on user
+type TriageUser struct {
+	User      string `json:"User"`
+	Terminal  string `json:"Terminal"`
+	Host      string `json:"Host"`
+	LogonTime string `json:"LogonTime"`
+}
+
+// TriageService struct is used to encode json of a service
+type TriageService struct {
+	Name        string `json:"Name"`
+	DisplayName string `json:"DisplayName"`
+	State       string `json:"State"`
+	StartType   string `json:"StartType"`
+	Command     string `json:"Command"`
+	RunAs       string `json:"RunAs"`
+}
+
+// TriageTask struct is used to encode json of a scheduled task
+type TriageTask struct {
+	Name        string `json:"Name"`
+	Status      string `json:"Status"`
+	Command     string `json:"Command"`
+	RunAs       string `json:"RunAs"`
+	NextRunTime string `json:"NextRunTime"`
+	LastRunTime string `json:"LastRunTime"`
+	Source      string `json:"Source"`
+}
+
+// TriageAutorun struct is used to encode json of an autorun location
+type TriageAutorun struct {
+	Location string `json:"Location"`
+	Name     string `json:"Name"`
+	Command  string `json:"Command"`
+}
+
+// This function takes a snapshot of the host. SHA-256 of process images are
+// computed if skipHashes is false.
+func Triage(skipHashes bool) *TriageSnapshot {
+
+	computerName, _ := os.Hostname()
+	snapshot := &TriageSnapshot{
+		ComputerName:  computerName,
+		Platform:      runtime.GOOS,
+		CollectedTime: time.Now().Format("2006-01-02 15:04:05.000"),
+		Errors:        make(map[string]string),
+	}
+	if bootTime, err := host.BootTime(); err == nil {
+		snapshot.BootTime = time.Unix(int64(bootTime), 0).Format("2006-01-02 15:04:05")
+	}
+
+	var err error
+	hashes := make(map[string]string)
+	if snapshot.Processes, err = TriageProcesses(skipHashes, hashes); err != nil {
+		snapshot.Errors["Processes"] = err.Error()
+	}
+	if snapshot.Connections, err = TriageConnections(snapshot.Processes); err != nil {
+		snapshot.Errors["Connections"] = err.Error()
+	}
+	if snapshot.Users, err = ListUsers(); err != nil {
+		snapshot.Errors["Users"] = err.Error()
+	}
+	if snapshot.Services, err = ListServices(); err != nil {
+		snapshot.Errors["Services"] = err.Error()
+	}
+	if snapshot.ScheduledTasks, err = ListScheduledTasks(); err != nil {
+		snapshot.Errors["ScheduledTasks"] = err.Error()
+	}
+	if snapshot.Autoruns, err = ListAutoruns(); err != nil {
+		snapshot.Errors["Autoruns"] = err.Error()
+	}
+	return snapshot
+}
+
+// This function returns all processes. A field that can not be read (access
+// denied) is left empty. Hashes caches the SHA-256 of images by path.
+func TriageProcesses(skipHashes bool, hashes map[string]string) ([]TriageProcess, error) {
+
+	processes, err := process.Processes()
+	if err != nil {
+		return nil, err
+	}
+
+	triageProcesses := make([]TriageProcess, 0, len(processes))
+	for _, p := range processes {
+		triageProcess := TriageProcess{Pid: p.Pid}
+		triageProcess.Ppid, _ = p.Ppid()
+		triageProcess.Name, _ = p.Name()
+		triageProcess.Exe, _ = p.Exe()
+		triageProcess.CommandLine, _ = p.Cmdline()
+		triageProcess.Username, _ = p.Username()
+		if createTime, err := p.CreateTime(); err == nil {
+			triageProcess.CreateTime = time.Unix(0, createTime*int64(time.Millisecond)).
+				Format("2006-01-02 15:04:05.000")
+		}
+		if !skipHashes && triageProcess.Exe != "" {
+			triageProcess.Sha256 = HashFileCached(triageProcess.Exe, hashes)
+		}
+		triageProcesses = append(triageProcesses, triageProcess)
+	}
+	return triageProcesses, nil
+}
+
+// This function returns all network connections with the name, image and
+// hash of the owning process.
+func TriageConnections(processes []TriageProcess) ([]TriageConnection, error) {
+
+	connections, err := net.Connections("inet")
+	if err != nil {
+		return nil, err
+	}
+
+	processByPid := make(map[int32]TriageProcess)
+	for _, p := range processes {
+		processByPid[p.Pid] = p
+	}
+
+	triageConnections := make([]TriageConnection, 0, len(connections))
+	for _, connection := range connections {
+		protocol := "tcp"
+		if connection.Type == 2 { // SOCK_DGRAM
+			protocol = "udp"
+		}
+		if strings.Contains(connection.Laddr.IP, ":") {
+			protocol += "6"
+		}
+		owner := processByPid[connection.Pid]
+		triageConnections = append(triageConnections, TriageConnection{
+			Protocol:      protocol,
+			LocalIp:       connection.Laddr.IP,
+			LocalPort:     connection.Laddr.Port,
+			RemoteIp:      connection.Raddr.IP,
+			RemotePort:    connection.Raddr.Port,
+			Status:        connection.Status,
+			Pid:           connection.Pid,
+			ProcessName:   owner.Name,
+			ProcessImage:  owner.Exe,
+			ProcessSha256: owner.Sha256,
+		})
+	}
+	return triageConnections, nil
+}
+
+// This function returns the SHA-256 of file, the hash is computed once for
+// each path. It returns an empty string if the file can not be read.
+func HashFileCached(filePath string, hashes map[string]string) string {
+
+	if sha, ok := hashes[filePath]; ok {
+		return sha
+	}
+	hashes[filePath] = ""
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return ""
+	}
+	hashes[filePath] = hex.EncodeToString(hash.Sum(nil))
+	return hashes[filePath]
+}
+
+// This function returns the programs that are started by the Run keys of
+// HKLM and of each user in HKU, and by the Winlogon values Shell and
+// Userinit.
+func RegistryAutoruns(reg Registry) ([]TriageAutorun, error) {
+
+	// Run keys of each loaded user hive, classes hives are skipped
+	roots := [][2]string{{"HKLM", ""}}
+	sids, err := reg.SubKeyNames("HKU", "")
+	if err != nil {
+		return nil, err
+	}
+	for _, sid := range sids {
+		if !strings.HasSuffix(sid, "_Classes") {
+			roots = append(roots, [2]string{"HKU", sid + "\\"})
+		}
+	}
+
+	autoruns := make([]TriageAutorun, 0)
+	for _, root := range roots {
+		for _, runKey := range REGISTRY_RUN_KEYS {
+			values, err := reg.Values(root[0], root[1]+runKey)
+			if err != nil {
+				continue
+			}
+			for _, value := range values {
+				autoruns = append(autoruns, TriageAutorun{
+					Location: root[0] + "\\" + root[1] + runKey,
+					Name:     value.Name,
+					Command:  RegistryValueString(value),
+				})
+			}
+		}
+	}
+
+	for _, name := range []string{"Shell", "Userinit"} {
+		if value, err := reg.Value("HKLM", REGISTRY_WINLOGON_KEY, name); err == nil {
+			autoruns = append(autoruns, TriageAutorun{
+				Location: "HKLM\\" + REGISTRY_WINLOGON_KEY,
+				Name:     value.Name,
+				Command:  RegistryValueString(value),
+			})
+		}
+	}
+	return autoruns, nil
+}
+
+// This function returns the data of registry value as a string
+func RegistryValueString(value RegistryValue) string {
+	switch value.Type {
+	case REG_SZ, REG_EXPAND_SZ:
+		return value.String
+	case REG_MULTI_SZ:
+		return strings.Join(value.Strings, " ")
+	default:
+		return ""
+	}
+}
+
+// This function returns the files in the startup directories, each file is
+// an autorun.
+func DirectoryAutoruns(patterns []string) []TriageAutorun {
+
+	autoruns := make([]TriageAutorun, 0)
+	for _, pattern := range patterns {
+		filePaths, err := filepath.Glob(ExpandEnvPath(pattern))
+		if err != nil {
+			continue
+		}
+		for _, filePath := range filePaths {
+			info, err := os.Lstat(filePath)
+			if err != nil || info.IsDir() {
+				continue
+			}
+			command := filePath
+			if target, err := os.Readlink(filePath); err == nil {
+				command = target
+			}
+			autoruns = append(autoruns, TriageAutorun{
+				Location: filepath.Dir(filePath),
+				Name:     info.Name(),
+				Command:  command,
+			})
+		}
+	}
+	return autoruns
+}
@@ -0,0 +1,133 @@
+//go:build !windows
+// +build !windows
+
+/**
+ * File:    triage_other.go
+ *
+ * Summary of File:
+ *
+ * 	This file contains the functions used by the live triage on Linux and
+ *	the other operating systems. Users are read from utmp, services from
+ *	systemctl command, scheduled tasks from the crontab files, autoruns
+ *	from the autostart and init directories.
+ */
+
+package agent
+
+import (
+	"bufio"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/host"
+)
+
+// Crontab files of system and of each user
+var CRONTAB_FILES = []string{
+	"/etc/crontab",
+	"/etc/cron.d/*",
+	"/var/spool/cron/*",
+	"/var/spool/cron/crontabs/*",
+}
+
+// Directories that start programs at boot or logon
+var AUTORUN_DIRECTORIES = []string{
+	"/etc/rc.local",
+	"/etc/init.d/*",
+	"/etc/xdg/autostart/*",
+	"/etc/profile.d/*",
+	"/etc/systemd/system/*.wants/*",
+	"/home/*/.config/autostart/*",
+}
+
+// This function returns the users that are logged on
+func ListUsers() ([]TriageUser, error) {
+
+	userStats, err := host.Users()
+	if err != nil {
+		return nil, err
+	}
+
+	users := make([]TriageUser, 0, len(userStats))
+	for _, userStat := range userStats {
+		users = append(users, TriageUser{
+			User:      userStat.User,
+			Terminal:  userStat.Terminal,
+			Host:      userStat.Host,
+			LogonTime: time.Unix(int64(userStat.Started), 0).Format("2006-01-02 15:04:05"),
+		})
+	}
+	return users, nil
+}
+
+// This function returns all services of systemd.
+// Example: systemctl list-units --type=service --all --no-legend --plain
+func ListServices() ([]TriageService, error) {
+
+	output, err := exec.Command("systemctl", "list-units", "--type=service", "--all",
+		"--no-legend", "--plain", "--no-pager").Output()
+	if err != nil {
+		return nil, err
+	}
+
+	// Each line is: UNIT LOAD ACTIVE SUB DESCRIPTION
+	services := make([]TriageService, 0)
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 {
+			continue
+		}
+		services = append(services, TriageService{
+			Name:        fields[0],
+			DisplayName: strings.Join(fields[4:], " "),
+			State:       fields[2] + "/" + fields[3],
+			StartType:   fields[1],
+		})
+	}
+	return services, nil
+}
+
+// This function returns the jobs of crontab files, each line that is not
+// a comment or a variable is a job.
+func ListScheduledTasks() ([]TriageTask, error) {
+
+	tasks := make([]TriageTask, 0)
+	for _, pattern := range CRONTAB_FILES {
+		filePaths, _ := filepath.Glob(pattern)
+		for _, filePath := range filePaths {
+			file, err := os.Open(filePath)
+			if err != nil {
+				continue
+			}
+			scanner := bufio.NewScanner(file)
+			for scanner.Scan() {
+				line := strings.TrimSpace(scanner.Text())
+				if line == "" || strings.HasPrefix(line, "#") || IsCrontabVariable(line) {
+					continue
+				}
+				tasks = append(tasks, TriageTask{
+					Name:    filepath.Base(filePath),
+					Command: line,
+					Source:  filePath,
+				})
+			}
+			file.Close()
+		}
+	}
+	return tasks, nil
+}
+
+// This function checks that the line of crontab sets a variable
+// (ex: SHELL=/bin/sh)
+func IsCrontabVariable(line string) bool {
+	index := strings.Index(line, "=")
+	return index > 0 && !strings.ContainsAny(line[:index], " \t*")
+}
+
+// This function returns the files in the autostart and init directories
+func ListAutoruns() ([]TriageAutorun, error) {
+	return DirectoryAutoruns(AUTORUN_DIRECTORIES), nil
+}
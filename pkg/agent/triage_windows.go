@@ -0,0 +1,205 @@
+/**
+ * File:    triage_windows.go
+ *
+ * Summary of File:
+ *
+ * 	This file contains the Windows functions used by the live triage.
+ *	Services are read from the service control manager, scheduled tasks
+ *	from schtasks command, autoruns from the Run keys of registry and the
+ *	Startup directories.
+ */
+
+package agent
+
+import (
+	"bytes"
+	"encoding/csv"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/process"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// Startup directories of all users and of each user
+var STARTUP_DIRECTORIES = []string{
+	"%ProgramData%\\Microsoft\\Windows\\Start Menu\\Programs\\Startup\\*",
+	"%SystemDrive%\\Users\\*\\AppData\\Roaming\\Microsoft\\Windows\\Start Menu\\Programs\\Startup\\*",
+}
+
+// This function returns the users that are logged on. A user is logged on
+// when explorer.exe runs with its account, the logon time is the creation
+// time of explorer.exe.
+func ListUsers() ([]TriageUser, error) {
+
+	processes, err := process.Processes()
+	if err != nil {
+		return nil, err
+	}
+
+	users := make([]TriageUser, 0)
+	seen := make(map[string]bool)
+	for _, p := range processes {
+		name, _ := p.Name()
+		if !strings.EqualFold(name, "explorer.exe") {
+			continue
+		}
+		username, err := p.Username()
+		if err != nil || seen[username] {
+			continue
+		}
+		seen[username] = true
+		user := TriageUser{User: username, Terminal: "console"}
+		if createTime, err := p.CreateTime(); err == nil {
+			user.LogonTime = time.Unix(0, createTime*int64(time.Millisecond)).
+				Format("2006-01-02 15:04:05.000")
+		}
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+// This function returns all services of the service control manager
+func ListServices() ([]TriageService, error) {
+
+	m, err := mgr.Connect()
+	if err != nil {
+		return nil, err
+	}
+	defer m.Disconnect()
+
+	names, err := m.ListServices()
+	if err != nil {
+		return nil, err
+	}
+
+	services := make([]TriageService, 0, len(names))
+	for _, name := range names {
+		s, err := m.OpenService(name)
+		if err != nil {
+			services = append(services, TriageService{Name: name})
+			continue
+		}
+		service := TriageService{Name: name}
+		if config, err := s.Config(); err == nil {
+			service.DisplayName = config.DisplayName
+			service.StartType = ServiceStartType(config.StartType)
+			service.Command = config.BinaryPathName
+			service.RunAs = config.ServiceStartName
+		}
+		if status, err := s.Query(); err == nil {
+			service.State = ServiceState(status.State)
+		}
+		s.Close()
+		services = append(services, service)
+	}
+	return services, nil
+}
+
+// This function returns the name of start type of service
+func ServiceStartType(startType uint32) string {
+	switch startType {
+	case mgr.StartAutomatic:
+		return "automatic"
+	case mgr.StartManual:
+		return "manual"
+	case mgr.StartDisabled:
+		return "disabled"
+	case 0:
+		return "boot"
+	case 1:
+		return "system"
+	default:
+		return ""
+	}
+}
+
+// This function returns the name of state of service
+func ServiceState(state svc.State) string {
+	switch state {
+	case svc.Stopped:
+		return "stopped"
+	case svc.StartPending:
+		return "start pending"
+	case svc.StopPending:
+		return "stop pending"
+	case svc.Running:
+		return "running"
+	case svc.ContinuePending:
+		return "continue pending"
+	case svc.PausePending:
+		return "pause pending"
+	case svc.Paused:
+		return "paused"
+	default:
+		return ""
+	}
+}
+
+// This function returns all scheduled tasks. It parses the verbose CSV
+// output of schtasks, a task that has many triggers has many rows.
+// Example: schtasks /query /fo csv /v
+func ListScheduledTasks() ([]TriageTask, error) {
+
+	output, err := exec.Command("schtasks", "/query", "/fo", "csv", "/v").Output()
+	if err != nil {
+		return nil, err
+	}
+
+	reader := csv.NewReader(bytes.NewReader(output))
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	tasks := make([]TriageTask, 0)
+	seen := make(map[string]bool)
+	var header map[string]int
+	for _, record := range records {
+		// the header is repeated for each folder of tasks
+		if len(record) > 1 && record[0] == "HostName" {
+			header = make(map[string]int)
+			for index, column := range record {
+				header[column] = index
+			}
+			continue
+		}
+		if header == nil {
+			continue
+		}
+		field := func(column string) string {
+			if index, ok := header[column]; ok && index < len(record) {
+				return record[index]
+			}
+			return ""
+		}
+		name := field("TaskName")
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		tasks = append(tasks, TriageTask{
+			Name:        name,
+			Status:      field("Status"),
+			Command:     field("Task To Run"),
+			RunAs:       field("Run As User"),
+			NextRunTime: field("Next Run Time"),
+			LastRunTime: field("Last Run Time"),
+			Source:      "schtasks",
+		})
+	}
+	return tasks, nil
+}
+
+// This function returns the autoruns of the Run keys of registry and the
+// files in the Startup directories
+func ListAutoruns() ([]TriageAutorun, error) {
+	autoruns, err := RegistryAutoruns(registryAccess)
+	if err != nil {
+		return nil, err
+	}
+	return append(autoruns, DirectoryAutoruns(STARTUP_DIRECTORIES)...), nil
+}
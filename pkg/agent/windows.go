@@ -9,7 +9,7 @@
  *	Delete file, download file.
  *	Block, Unblock firewall windows.
  *	Disable, Enable network adapter windows.
- *	Delete registry key, value.
+ *	Split registry path.
  */
 
 package agent
@@ -21,13 +21,24 @@ import (
 	"strings"
 
 	"github.com/shirou/gopsutil/process"
-	"golang.org/x/sys/windows/registry"
 )
 
-// This function kills the Process Tree
+// This function kills the Process Tree. Nothing is killed if a process of
+// the tree is protected, unless override is signed for the request.
+func KillTreeProcess(pid32 int32, override *SignedOverride) error {
+
+	if override.Verify("killtree", pid32) != nil {
+		if policyError := CheckCriticalProcess(pid32, true); policyError != nil {
+			return policyError
+		}
+	}
+	return KillTree(pid32)
+}
+
+// This function kills the Process Tree without checking it
 // This is recursive function, call itselt util it reaches the case of
 // no children, them kill backward process
-func KillTreeProcess(pid32 int32) error {
+func KillTree(pid32 int32) error {
 
 	// create a new Process instance
 	p, err := process.NewProcess(pid32)
@@ -41,7 +52,7 @@ func KillTreeProcess(pid32 int32) error {
 		// If the slice has a length of 0, skip the for loop.
 		// Otherwise, call itself for each element in the slice.
 		for _, v := range children {
-			KillTreeProcess(v.Pid)
+			KillTree(v.Pid)
 		}
 	}
 
@@ -50,8 +61,15 @@ func KillTreeProcess(pid32 int32) error {
 	return p.Kill()
 }
 
-// This function kills the Process
-func KillProcess(pid32 int32) error {
+// This function kills the Process, unless it is protected and override is
+// not signed for the request
+func KillProcess(pid32 int32, override *SignedOverride) error {
+
+	if override.Verify("kill", pid32) != nil {
+		if policyError := CheckCriticalProcess(pid32, false); policyError != nil {
+			return policyError
+		}
+	}
 
 	// create a new Process instance
 	p, err := process.NewProcess(pid32)
@@ -64,8 +82,15 @@ func KillProcess(pid32 int32) error {
 	return p.Kill()
 }
 
-// This function suppends the Process
-func SuspendProcess(pid32 int32) error {
+// This function suppends the Process, unless it is protected and override
+// is not signed for the request
+func SuspendProcess(pid32 int32, override *SignedOverride) error {
+
+	if override.Verify("suspend", pid32) != nil {
+		if policyError := CheckCriticalProcess(pid32, false); policyError != nil {
+			return policyError
+		}
+	}
 
 	// create a new Process instance
 	if p, err := process.NewProcess(pid32); err != nil {
@@ -199,11 +224,12 @@ func UnblockOutboundIp(ip string) error {
 func BlockInboundPort(port string) error {
 
 	name := "name=BLOCK PORT " + port + " INBOUND" // name of firewall rule
-	remotePort := "remoteip=" + port               // blocked port
+	remotePort := "remoteport=" + port             // blocked port
 
 	// Cmd struct to execute the netsh program with the given arguments
 	cmd := exec.Command("netsh", "advfirewall", "firewall", "add", "rule",
-		name, "interface=any", "dir=in", "action=block", remotePort)
+		name, "interface=any", "dir=in", "action=block", "protocol=TCP",
+		remotePort)
 
 	// runs the cmd struct and returns its combined output and error
 	if output, err := cmd.CombinedOutput(); err != nil {
@@ -222,12 +248,13 @@ func BlockInboundPort(port string) error {
 // Example: netsh advfirewall firewall add rule name="BLOCKED PORT"
 // interface=any dir=out action=block remoteport=xxxxx
 func BlockOutboundPort(port string) error {
-	name := "name=BLOCK PORT " + port + " INBOUND" // name of firewall rule
-	remotePort := "remoteip=" + port               // blocked port
+	name := "name=BLOCK PORT " + port + " OUTBOUND" // name of firewall rule
+	remotePort := "remoteport=" + port              // blocked port
 
 	// Cmd struct to execute the netsh program with the given arguments
 	cmd := exec.Command("netsh", "advfirewall", "firewall", "add", "rule",
-		name, "interface=any", "dir=in", "action=block", remotePort)
+		name, "interface=any", "dir=out", "action=block", "protocol=TCP",
+		remotePort)
 
 	// runs the cmd struct and returns its combined output and error
 	if output, err := cmd.CombinedOutput(); err != nil {
@@ -247,11 +274,11 @@ func BlockOutboundPort(port string) error {
 // remoteport=xxxxx
 func UnblockInboundPort(port string) error {
 	name := "name=BLOCK PORT " + port + " INBOUND" // name of firewall rule
-	remotePort := "remoteip=" + port               // unblocked port
+	remotePort := "remoteport=" + port             // unblocked port
 
 	// Cmd struct to execute the netsh program with the given arguments
 	cmd := exec.Command("netsh", "advfirewall", "firewall", "delete", "rule",
-		name, remotePort)
+		name, "protocol=TCP", remotePort)
 
 	// runs the cmd struct and returns its combined output and error
 	if output, err := cmd.CombinedOutput(); err != nil {
@@ -271,11 +298,11 @@ func UnblockInboundPort(port string) error {
 // remoteport=xxxxx
 func UnblockOutboundPort(port string) error {
 	name := "name=BLOCK PORT " + port + " OUTBOUND" // name of firewall rule
-	remotePort := "remoteip=" + port                // unblocked port
+	remotePort := "remoteport=" + port              // unblocked port
 
 	// Cmd struct to execute the netsh program with the given arguments
 	cmd := exec.Command("netsh", "advfirewall", "firewall", "delete", "rule",
-		name, remotePort)
+		name, "protocol=TCP", remotePort)
 
 	// runs the cmd struct and returns its combined output and error
 	if output, err := cmd.CombinedOutput(); err != nil {
@@ -331,33 +358,6 @@ func EnableNetworkAdapter(adapterName string) error {
 	}
 }
 
-// Convert key string to Windows Registry Key
-func ConvertKey(keyStr string) registry.Key {
-	switch keyStr {
-	case "HKCR":
-		return registry.CLASSES_ROOT
-	case "HKCU":
-		return registry.CURRENT_USER
-	case "HKLM":
-		return registry.LOCAL_MACHINE
-	case "HKU":
-		return registry.USERS
-	default:
-		return registry.CURRENT_CONFIG
-	}
-}
-
-// DeleteValue removes a named value from the key k
-func DeleteValue(key registry.Key, path string, name string) error {
-
-	// OpenKey opens a new key with path, name
-	if k, err := registry.OpenKey(key, path, registry.ALL_ACCESS); err != nil {
-		return err
-	} else {
-		return k.DeleteValue(name) // remove value
-	}
-}
-
 // This function splits target object (Registry Path) to key string, path, name
 func SplitKeyPathName(targetObject string) (string, string, string) {
 
@@ -0,0 +1,147 @@
+/**
+ * File:    detection.go
+ *
+ * Summary of File:
+ *
+ * 	This file contains the rule engine of bkedr. The server compares the
+ *	logs of Splunk with the rules, the agent compares its events with the
+ *	local rules when the server is unreachable. Both use this engine, so a
+ *	rule matches the same events on the server and on the agent.
+ * 	Functions:
+ * 	Filtering a log with the rules and returning the matched requests.
+ * 	Checking the regex of each field of rule with the field of log.
+ */
+
+package detection
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// This function is used to filter the log with the slice of rules.
+// Function returns a slice of objectRequest that matched rules.
+func FilterRules(rules []map[string]interface{}, log map[string]string) []map[string]string {
+
+	// The pointer of slice is used to add objectRequest when rule capture log
+	objRequests := make([]map[string]string, 0)
+
+	// The for loop is used to retrieve all the rules, then adds an Object
+	// to the slice if the rule matches a log.
+	for _, rule := range rules {
+
+		// slice of fields used to match fields in log.
+		ruleRegex := ConvertRuleData(rule["Data"].(map[string]interface{}))
+
+		// If the event code is not equal, it means that the log is not
+		// related to this rule, continue.
+		if log["EventCode"] != ruleRegex["EventCode"] {
+			continue
+		}
+
+		// check all fields of the rule with fields of log. If the result is true,
+		// we add 1 Object to the Slice. Each matched rule has its own copy of
+		// log, so the keys of a rule are not in the request of another rule.
+		if CheckRule(log, ruleRegex) {
+			objRequest := make(map[string]string, len(log))
+			for key, value := range log {
+				objRequest[key] = value
+			}
+			objRequest["Type"] = fmt.Sprintf("%v", rule["Type"])
+			objRequest["Message"] = fmt.Sprintf("%v", rule["Message"])
+			objRequest["Action"] = fmt.Sprintf("%v", rule["Action"])
+
+			// TTL is optional, the containment is undone when it expires.
+			// Collect options are optional, they are used by action collect.
+			// Playbook is the name of playbook run by action playbook.
+			// RequiresApproval "true" waits for an approver before action.
+			// Severity is used by the filters of result sinks.
+			for _, key := range []string{"TTL", "Timeout", "CollectPaths", "MaxDepth",
+				"MaxFileSize", "MaxTotalSize", "Format", "Playbook", "RequiresApproval",
+				"Severity"} {
+				if value, ok := rule[key]; ok {
+					objRequest[key] = fmt.Sprintf("%v", value)
+				}
+			}
+			objRequests = append(objRequests, objRequest)
+		}
+	}
+	return objRequests
+}
+
+// This function is used to check all fields of the rule with fields of log.
+// Each value of fields of rule is regex. We use regex to catch the fields of log.
+func CheckRule(log map[string]string, ruleRegex map[string]string) bool {
+
+	// regex match the string begin and end by $ character. This is how we
+	// mark the content between the two $ as the key of a log.
+	// We use this method when we want to check in the log if the value whose
+	// key is the key of the regex with the value whose key is the content
+	// between two $ characters are equal.
+	reSimilar := regexp.MustCompile(`(?m)^\$[a-zA-Z]+\$$`)
+
+	// regex matches strings that start with two $ characters and end with
+	// one $ character. This is how we highlight the content between the $
+	// characters as the key of a log.
+	// We use this method when we want to check in the log if the value whose
+	// key is the key of the regex with the value whose key is the content
+	// between the $ characters are different.
+	reDifferent := regexp.MustCompile(`(?m)^\$\$[a-zA-Z]+\$$`)
+
+	// loop for all key of map ruleRegex
+	for key := range ruleRegex {
+
+		// check if reSimilar is matched in value of ruleRegex
+		if reSimilar.FindString(ruleRegex[key]) != "" {
+
+			// content between the two $ characters as the key of a log
+			keyLogSimilar := strings.Replace(ruleRegex[key], "$", "", -1)
+
+			// check if two values of log[key] and log[keyLogSimilar] are equal.
+			// If not equal, log is not catched by ruleRegex, return false.
+			// Otherwise, continue checking to another ruleRegex.
+			if log[key] != log[keyLogSimilar] {
+				return false
+			} else {
+				continue
+			}
+		}
+
+		// check if reDifferent is matched in value of ruleRegex
+		if reDifferent.FindString((ruleRegex[key])) != "" {
+
+			// content between the $ characters as the key of a log
+			keyLogDifferent := strings.Replace(ruleRegex[key], "$", "", -1)
+
+			// check if two values of log[key] and log[keyLogDifferent]
+			// are different. If equal, log is not captured by ruleRegex, return
+			// false. Otherwise, continue checking to another ruleRegex.
+			if log[key] == log[keyLogDifferent] {
+				return false
+			} else {
+				continue
+			}
+		}
+
+		// if reSimilar and reDifferent is not matched value of ruleRegex,
+		// We check if ruleRegex[key] captures log[key]. If not matched,
+		// log is not captured by ruleRegex, return false.
+		re := regexp.MustCompile(ruleRegex[key])
+		if re.FindString(log[key]) == "" {
+			return false
+		}
+	}
+
+	// return true if all ruleRegex match log.
+	return true
+}
+
+// This function converts the fields of data of rule to string
+func ConvertRuleData(data map[string]interface{}) map[string]string {
+	fields := make(map[string]string)
+	for key, value := range data {
+		fields[key] = fmt.Sprintf("%v", value)
+	}
+	return fields
+}
@@ -687,7 +687,10 @@ func (x *NetworkAdapter) GetAction() string {
 	return ""
 }
 
-// Message returns after done request
+// Message returns after done request. DenyReason is set when the policy of
+// agent denies the request (action_not_allowed, protected_process,
+// protected_path, protected_registry or invalid_policy). UndoId is the id
+// that the inverse action takes (quarantine id or registry backup id).
 type ResponseResult struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -695,6 +698,8 @@ type ResponseResult struct {
 
 	ResultInfo string `protobuf:"bytes,1,opt,name=ResultInfo,proto3" json:"ResultInfo,omitempty"`
 	Result     bool   `protobuf:"varint,2,opt,name=Result,proto3" json:"Result,omitempty"`
+	DenyReason string `protobuf:"bytes,3,opt,name=DenyReason,proto3" json:"DenyReason,omitempty"`
+	UndoId     string `protobuf:"bytes,4,opt,name=UndoId,proto3" json:"UndoId,omitempty"`
 }
 
 func (x *ResponseResult) Reset() {
@@ -743,32 +748,1105 @@ func (x *ResponseResult) GetResult() bool {
 	return false
 }
 
-// File info contain file path to download
+func (x *ResponseResult) GetDenyReason() string {
+	if x != nil {
+		return x.DenyReason
+	}
+	return ""
+}
+
+func (x *ResponseResult) GetUndoId() string {
+	if x != nil {
+		return x.UndoId
+	}
+	return ""
+}
+
+// File info contain file path to download.
+// Offset is the position to resume the download, Sha256 is the hash of file
+// that the partial download belongs to. MaxSize (bytes) and MaxRate
+// (bytes per second) limit the transfer, 0 is unlimited. Compression is
+// empty or gzip. If ProcessId is not 0, the memory of this process is dumped
+// and sent instead of FilePath.
 type FileInfo struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	FilePath string `protobuf:"bytes,3,opt,name=FilePath,proto3" json:"FilePath,omitempty"`
+	FilePath    string `protobuf:"bytes,3,opt,name=FilePath,proto3" json:"FilePath,omitempty"`
+	Offset      int64  `protobuf:"varint,4,opt,name=Offset,proto3" json:"Offset,omitempty"`
+	Sha256      string `protobuf:"bytes,5,opt,name=Sha256,proto3" json:"Sha256,omitempty"`
+	MaxSize     int64  `protobuf:"varint,6,opt,name=MaxSize,proto3" json:"MaxSize,omitempty"`
+	MaxRate     int64  `protobuf:"varint,7,opt,name=MaxRate,proto3" json:"MaxRate,omitempty"`
+	Compression string `protobuf:"bytes,8,opt,name=Compression,proto3" json:"Compression,omitempty"`
+	ProcessId   int32  `protobuf:"varint,9,opt,name=ProcessId,proto3" json:"ProcessId,omitempty"`
+}
+
+func (x *FileInfo) Reset() {
+	*x = FileInfo{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_protobuf_agent_message_proto_msgTypes[12]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *FileInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FileInfo) ProtoMessage() {}
+
+func (x *FileInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_protobuf_agent_message_proto_msgTypes[12]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FileInfo.ProtoReflect.Descriptor instead.
+func (*FileInfo) Descriptor() ([]byte, []int) {
+	return file_protobuf_agent_message_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *FileInfo) GetFilePath() string {
+	if x != nil {
+		return x.FilePath
+	}
+	return ""
+}
+
+func (x *FileInfo) GetOffset() int64 {
+	if x != nil {
+		return x.Offset
+	}
+	return 0
+}
+
+func (x *FileInfo) GetSha256() string {
+	if x != nil {
+		return x.Sha256
+	}
+	return ""
+}
+
+func (x *FileInfo) GetMaxSize() int64 {
+	if x != nil {
+		return x.MaxSize
+	}
+	return 0
+}
+
+func (x *FileInfo) GetMaxRate() int64 {
+	if x != nil {
+		return x.MaxRate
+	}
+	return 0
+}
+
+func (x *FileInfo) GetCompression() string {
+	if x != nil {
+		return x.Compression
+	}
+	return ""
+}
+
+func (x *FileInfo) GetProcessId() int32 {
+	if x != nil {
+		return x.ProcessId
+	}
+	return 0
+}
+
+// File metadata is sent in the first message of the stream. Offset is the
+// position of the first chunk, Compression is the compression of chunks.
+// Manifest is the JSON list of collected files when the file is an archive.
+// Overwrite allows a pushed file to replace an existing file on agent.
+type FileMeta struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	FilePath    string `protobuf:"bytes,1,opt,name=FilePath,proto3" json:"FilePath,omitempty"`
+	Size        int64  `protobuf:"varint,2,opt,name=Size,proto3" json:"Size,omitempty"`
+	Sha256      string `protobuf:"bytes,3,opt,name=Sha256,proto3" json:"Sha256,omitempty"`
+	Md5         string `protobuf:"bytes,4,opt,name=Md5,proto3" json:"Md5,omitempty"`
+	ModTime     string `protobuf:"bytes,5,opt,name=ModTime,proto3" json:"ModTime,omitempty"`
+	AccessTime  string `protobuf:"bytes,6,opt,name=AccessTime,proto3" json:"AccessTime,omitempty"`
+	CreateTime  string `protobuf:"bytes,7,opt,name=CreateTime,proto3" json:"CreateTime,omitempty"`
+	Offset      int64  `protobuf:"varint,8,opt,name=Offset,proto3" json:"Offset,omitempty"`
+	Compression string `protobuf:"bytes,9,opt,name=Compression,proto3" json:"Compression,omitempty"`
+	Manifest    string `protobuf:"bytes,10,opt,name=Manifest,proto3" json:"Manifest,omitempty"`
+	Overwrite   bool   `protobuf:"varint,11,opt,name=Overwrite,proto3" json:"Overwrite,omitempty"`
+}
+
+func (x *FileMeta) Reset() {
+	*x = FileMeta{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_protobuf_agent_message_proto_msgTypes[13]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *FileMeta) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FileMeta) ProtoMessage() {}
+
+func (x *FileMeta) ProtoReflect() protoreflect.Message {
+	mi := &file_protobuf_agent_message_proto_msgTypes[13]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FileMeta.ProtoReflect.Descriptor instead.
+func (*FileMeta) Descriptor() ([]byte, []int) {
+	return file_protobuf_agent_message_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *FileMeta) GetFilePath() string {
+	if x != nil {
+		return x.FilePath
+	}
+	return ""
+}
+
+func (x *FileMeta) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *FileMeta) GetSha256() string {
+	if x != nil {
+		return x.Sha256
+	}
+	return ""
+}
+
+func (x *FileMeta) GetMd5() string {
+	if x != nil {
+		return x.Md5
+	}
+	return ""
+}
+
+func (x *FileMeta) GetModTime() string {
+	if x != nil {
+		return x.ModTime
+	}
+	return ""
+}
+
+func (x *FileMeta) GetAccessTime() string {
+	if x != nil {
+		return x.AccessTime
+	}
+	return ""
+}
+
+func (x *FileMeta) GetCreateTime() string {
+	if x != nil {
+		return x.CreateTime
+	}
+	return ""
+}
+
+func (x *FileMeta) GetOffset() int64 {
+	if x != nil {
+		return x.Offset
+	}
+	return 0
+}
+
+func (x *FileMeta) GetCompression() string {
+	if x != nil {
+		return x.Compression
+	}
+	return ""
+}
+
+func (x *FileMeta) GetManifest() string {
+	if x != nil {
+		return x.Manifest
+	}
+	return ""
+}
+
+func (x *FileMeta) GetOverwrite() bool {
+	if x != nil {
+		return x.Overwrite
+	}
+	return false
+}
+
+// Collect info contains paths and globs to collect into an archive.
+// MaxDepth limits the recursion into directories, MaxFileSize and
+// MaxTotalSize (bytes) limit each file and the archive, MaxRate (bytes per
+// second) limits the transfer, 0 is unlimited. Format is zip or tar.
+type CollectInfo struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Paths        []string `protobuf:"bytes,1,rep,name=Paths,proto3" json:"Paths,omitempty"`
+	MaxDepth     int32    `protobuf:"varint,2,opt,name=MaxDepth,proto3" json:"MaxDepth,omitempty"`
+	MaxFileSize  int64    `protobuf:"varint,3,opt,name=MaxFileSize,proto3" json:"MaxFileSize,omitempty"`
+	MaxTotalSize int64    `protobuf:"varint,4,opt,name=MaxTotalSize,proto3" json:"MaxTotalSize,omitempty"`
+	MaxRate      int64    `protobuf:"varint,5,opt,name=MaxRate,proto3" json:"MaxRate,omitempty"`
+	Format       string   `protobuf:"bytes,6,opt,name=Format,proto3" json:"Format,omitempty"`
+}
+
+func (x *CollectInfo) Reset() {
+	*x = CollectInfo{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_protobuf_agent_message_proto_msgTypes[14]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *CollectInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CollectInfo) ProtoMessage() {}
+
+func (x *CollectInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_protobuf_agent_message_proto_msgTypes[14]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CollectInfo.ProtoReflect.Descriptor instead.
+func (*CollectInfo) Descriptor() ([]byte, []int) {
+	return file_protobuf_agent_message_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *CollectInfo) GetPaths() []string {
+	if x != nil {
+		return x.Paths
+	}
+	return nil
+}
+
+func (x *CollectInfo) GetMaxDepth() int32 {
+	if x != nil {
+		return x.MaxDepth
+	}
+	return 0
+}
+
+func (x *CollectInfo) GetMaxFileSize() int64 {
+	if x != nil {
+		return x.MaxFileSize
+	}
+	return 0
+}
+
+func (x *CollectInfo) GetMaxTotalSize() int64 {
+	if x != nil {
+		return x.MaxTotalSize
+	}
+	return 0
+}
+
+func (x *CollectInfo) GetMaxRate() int64 {
+	if x != nil {
+		return x.MaxRate
+	}
+	return 0
+}
+
+func (x *CollectInfo) GetFormat() string {
+	if x != nil {
+		return x.Format
+	}
+	return ""
+}
+
+// A stream to read a sequence of messages back
+type FileData struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	FileChunk []byte    `protobuf:"bytes,1,opt,name=FileChunk,proto3" json:"FileChunk,omitempty"`
+	Meta      *FileMeta `protobuf:"bytes,2,opt,name=Meta,proto3" json:"Meta,omitempty"`
+}
+
+func (x *FileData) Reset() {
+	*x = FileData{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_protobuf_agent_message_proto_msgTypes[15]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *FileData) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FileData) ProtoMessage() {}
+
+func (x *FileData) ProtoReflect() protoreflect.Message {
+	mi := &file_protobuf_agent_message_proto_msgTypes[15]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FileData.ProtoReflect.Descriptor instead.
+func (*FileData) Descriptor() ([]byte, []int) {
+	return file_protobuf_agent_message_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *FileData) GetFileChunk() []byte {
+	if x != nil {
+		return x.FileChunk
+	}
+	return nil
+}
+
+func (x *FileData) GetMeta() *FileMeta {
+	if x != nil {
+		return x.Meta
+	}
+	return nil
+}
+
+// Quarantine query contains file path to filter quarantined files
+type QuarantineQuery struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	FilePath string `protobuf:"bytes,1,opt,name=FilePath,proto3" json:"FilePath,omitempty"`
+}
+
+func (x *QuarantineQuery) Reset() {
+	*x = QuarantineQuery{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_protobuf_agent_message_proto_msgTypes[16]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *QuarantineQuery) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*QuarantineQuery) ProtoMessage() {}
+
+func (x *QuarantineQuery) ProtoReflect() protoreflect.Message {
+	mi := &file_protobuf_agent_message_proto_msgTypes[16]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use QuarantineQuery.ProtoReflect.Descriptor instead.
+func (*QuarantineQuery) Descriptor() ([]byte, []int) {
+	return file_protobuf_agent_message_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *QuarantineQuery) GetFilePath() string {
+	if x != nil {
+		return x.FilePath
+	}
+	return ""
+}
+
+// Quarantined file is stored in quarantine directory of agent
+type QuarantineItem struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Id             string `protobuf:"bytes,1,opt,name=Id,proto3" json:"Id,omitempty"`
+	OriginalPath   string `protobuf:"bytes,2,opt,name=OriginalPath,proto3" json:"OriginalPath,omitempty"`
+	Sha256         string `protobuf:"bytes,3,opt,name=Sha256,proto3" json:"Sha256,omitempty"`
+	Size           int64  `protobuf:"varint,4,opt,name=Size,proto3" json:"Size,omitempty"`
+	QuarantineTime string `protobuf:"bytes,5,opt,name=QuarantineTime,proto3" json:"QuarantineTime,omitempty"`
+}
+
+func (x *QuarantineItem) Reset() {
+	*x = QuarantineItem{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_protobuf_agent_message_proto_msgTypes[17]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *QuarantineItem) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*QuarantineItem) ProtoMessage() {}
+
+func (x *QuarantineItem) ProtoReflect() protoreflect.Message {
+	mi := &file_protobuf_agent_message_proto_msgTypes[17]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use QuarantineItem.ProtoReflect.Descriptor instead.
+func (*QuarantineItem) Descriptor() ([]byte, []int) {
+	return file_protobuf_agent_message_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *QuarantineItem) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *QuarantineItem) GetOriginalPath() string {
+	if x != nil {
+		return x.OriginalPath
+	}
+	return ""
+}
+
+func (x *QuarantineItem) GetSha256() string {
+	if x != nil {
+		return x.Sha256
+	}
+	return ""
+}
+
+func (x *QuarantineItem) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *QuarantineItem) GetQuarantineTime() string {
+	if x != nil {
+		return x.QuarantineTime
+	}
+	return ""
+}
+
+// List of quarantined files
+type QuarantineList struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Items []*QuarantineItem `protobuf:"bytes,1,rep,name=Items,proto3" json:"Items,omitempty"`
+}
+
+func (x *QuarantineList) Reset() {
+	*x = QuarantineList{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_protobuf_agent_message_proto_msgTypes[18]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *QuarantineList) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*QuarantineList) ProtoMessage() {}
+
+func (x *QuarantineList) ProtoReflect() protoreflect.Message {
+	mi := &file_protobuf_agent_message_proto_msgTypes[18]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use QuarantineList.ProtoReflect.Descriptor instead.
+func (*QuarantineList) Descriptor() ([]byte, []int) {
+	return file_protobuf_agent_message_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *QuarantineList) GetItems() []*QuarantineItem {
+	if x != nil {
+		return x.Items
+	}
+	return nil
+}
+
+// Triage query, SkipHashes does not compute SHA-256 of process images
+type TriageQuery struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	SkipHashes bool `protobuf:"varint,1,opt,name=SkipHashes,proto3" json:"SkipHashes,omitempty"`
+}
+
+func (x *TriageQuery) Reset() {
+	*x = TriageQuery{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_protobuf_agent_message_proto_msgTypes[19]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *TriageQuery) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TriageQuery) ProtoMessage() {}
+
+func (x *TriageQuery) ProtoReflect() protoreflect.Message {
+	mi := &file_protobuf_agent_message_proto_msgTypes[19]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TriageQuery.ProtoReflect.Descriptor instead.
+func (*TriageQuery) Descriptor() ([]byte, []int) {
+	return file_protobuf_agent_message_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *TriageQuery) GetSkipHashes() bool {
+	if x != nil {
+		return x.SkipHashes
+	}
+	return false
+}
+
+// Triage snapshot is the JSON of processes, connections, users, services,
+// scheduled tasks and autoruns of agent
+type TriageSnapshot struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Snapshot string `protobuf:"bytes,1,opt,name=Snapshot,proto3" json:"Snapshot,omitempty"`
+}
+
+func (x *TriageSnapshot) Reset() {
+	*x = TriageSnapshot{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_protobuf_agent_message_proto_msgTypes[20]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *TriageSnapshot) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TriageSnapshot) ProtoMessage() {}
+
+func (x *TriageSnapshot) ProtoReflect() protoreflect.Message {
+	mi := &file_protobuf_agent_message_proto_msgTypes[20]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TriageSnapshot.ProtoReflect.Descriptor instead.
+func (*TriageSnapshot) Descriptor() ([]byte, []int) {
+	return file_protobuf_agent_message_proto_rawDescGZIP(), []int{20}
+}
+
+func (x *TriageSnapshot) GetSnapshot() string {
+	if x != nil {
+		return x.Snapshot
+	}
+	return ""
+}
+
+// Rule set that the agent evaluates when the server is unreachable.
+// RuleSet is the JSON of Version and Rules, Signature is the Ed25519
+// signature of RuleSet by the server.
+type LocalRuleSet struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	RuleSet   []byte `protobuf:"bytes,1,opt,name=RuleSet,proto3" json:"RuleSet,omitempty"`
+	Signature []byte `protobuf:"bytes,2,opt,name=Signature,proto3" json:"Signature,omitempty"`
+}
+
+func (x *LocalRuleSet) Reset() {
+	*x = LocalRuleSet{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_protobuf_agent_message_proto_msgTypes[21]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *LocalRuleSet) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LocalRuleSet) ProtoMessage() {}
+
+func (x *LocalRuleSet) ProtoReflect() protoreflect.Message {
+	mi := &file_protobuf_agent_message_proto_msgTypes[21]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LocalRuleSet.ProtoReflect.Descriptor instead.
+func (*LocalRuleSet) Descriptor() ([]byte, []int) {
+	return file_protobuf_agent_message_proto_rawDescGZIP(), []int{21}
+}
+
+func (x *LocalRuleSet) GetRuleSet() []byte {
+	if x != nil {
+		return x.RuleSet
+	}
+	return nil
+}
+
+func (x *LocalRuleSet) GetSignature() []byte {
+	if x != nil {
+		return x.Signature
+	}
+	return nil
+}
+
+// Query of the action journal of agent. Records after AfterSeq are
+// returned, at most Limit records if Limit is not 0. If RequestIds is not
+// empty, only the records of these requests are returned.
+type ActionHistoryQuery struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	AfterSeq   int64    `protobuf:"varint,1,opt,name=AfterSeq,proto3" json:"AfterSeq,omitempty"`
+	Limit      int32    `protobuf:"varint,2,opt,name=Limit,proto3" json:"Limit,omitempty"`
+	RequestIds []string `protobuf:"bytes,3,rep,name=RequestIds,proto3" json:"RequestIds,omitempty"`
+}
+
+func (x *ActionHistoryQuery) Reset() {
+	*x = ActionHistoryQuery{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_protobuf_agent_message_proto_msgTypes[22]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ActionHistoryQuery) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ActionHistoryQuery) ProtoMessage() {}
+
+func (x *ActionHistoryQuery) ProtoReflect() protoreflect.Message {
+	mi := &file_protobuf_agent_message_proto_msgTypes[22]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ActionHistoryQuery.ProtoReflect.Descriptor instead.
+func (*ActionHistoryQuery) Descriptor() ([]byte, []int) {
+	return file_protobuf_agent_message_proto_rawDescGZIP(), []int{22}
+}
+
+func (x *ActionHistoryQuery) GetAfterSeq() int64 {
+	if x != nil {
+		return x.AfterSeq
+	}
+	return 0
+}
+
+func (x *ActionHistoryQuery) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+func (x *ActionHistoryQuery) GetRequestIds() []string {
+	if x != nil {
+		return x.RequestIds
+	}
+	return nil
+}
+
+// Record of an action that the agent executed. RequestId is the id of the
+// request of server, Source is server or local. Request is the JSON of
+// request, Result, ResultInfo and UndoId are the outcome of action.
+type ActionRecord struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Seq        int64  `protobuf:"varint,1,opt,name=Seq,proto3" json:"Seq,omitempty"`
+	RequestId  string `protobuf:"bytes,2,opt,name=RequestId,proto3" json:"RequestId,omitempty"`
+	Source     string `protobuf:"bytes,3,opt,name=Source,proto3" json:"Source,omitempty"`
+	Method     string `protobuf:"bytes,4,opt,name=Method,proto3" json:"Method,omitempty"`
+	Request    string `protobuf:"bytes,5,opt,name=Request,proto3" json:"Request,omitempty"`
+	Result     bool   `protobuf:"varint,6,opt,name=Result,proto3" json:"Result,omitempty"`
+	ResultInfo string `protobuf:"bytes,7,opt,name=ResultInfo,proto3" json:"ResultInfo,omitempty"`
+	StartTime  string `protobuf:"bytes,8,opt,name=StartTime,proto3" json:"StartTime,omitempty"`
+	EndTime    string `protobuf:"bytes,9,opt,name=EndTime,proto3" json:"EndTime,omitempty"`
+	UndoId     string `protobuf:"bytes,10,opt,name=UndoId,proto3" json:"UndoId,omitempty"`
+}
+
+func (x *ActionRecord) Reset() {
+	*x = ActionRecord{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_protobuf_agent_message_proto_msgTypes[23]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ActionRecord) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ActionRecord) ProtoMessage() {}
+
+func (x *ActionRecord) ProtoReflect() protoreflect.Message {
+	mi := &file_protobuf_agent_message_proto_msgTypes[23]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ActionRecord.ProtoReflect.Descriptor instead.
+func (*ActionRecord) Descriptor() ([]byte, []int) {
+	return file_protobuf_agent_message_proto_rawDescGZIP(), []int{23}
+}
+
+func (x *ActionRecord) GetSeq() int64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *ActionRecord) GetRequestId() string {
+	if x != nil {
+		return x.RequestId
+	}
+	return ""
+}
+
+func (x *ActionRecord) GetSource() string {
+	if x != nil {
+		return x.Source
+	}
+	return ""
+}
+
+func (x *ActionRecord) GetMethod() string {
+	if x != nil {
+		return x.Method
+	}
+	return ""
+}
+
+func (x *ActionRecord) GetRequest() string {
+	if x != nil {
+		return x.Request
+	}
+	return ""
+}
+
+func (x *ActionRecord) GetResult() bool {
+	if x != nil {
+		return x.Result
+	}
+	return false
+}
+
+func (x *ActionRecord) GetResultInfo() string {
+	if x != nil {
+		return x.ResultInfo
+	}
+	return ""
+}
+
+func (x *ActionRecord) GetStartTime() string {
+	if x != nil {
+		return x.StartTime
+	}
+	return ""
+}
+
+func (x *ActionRecord) GetEndTime() string {
+	if x != nil {
+		return x.EndTime
+	}
+	return ""
+}
+
+func (x *ActionRecord) GetUndoId() string {
+	if x != nil {
+		return x.UndoId
+	}
+	return ""
+}
+
+// Records of the action journal of agent, in order of Seq
+type ActionHistory struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Records []*ActionRecord `protobuf:"bytes,1,rep,name=Records,proto3" json:"Records,omitempty"`
+}
+
+func (x *ActionHistory) Reset() {
+	*x = ActionHistory{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_protobuf_agent_message_proto_msgTypes[24]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ActionHistory) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ActionHistory) ProtoMessage() {}
+
+func (x *ActionHistory) ProtoReflect() protoreflect.Message {
+	mi := &file_protobuf_agent_message_proto_msgTypes[24]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ActionHistory.ProtoReflect.Descriptor instead.
+func (*ActionHistory) Descriptor() ([]byte, []int) {
+	return file_protobuf_agent_message_proto_rawDescGZIP(), []int{24}
+}
+
+func (x *ActionHistory) GetRecords() []*ActionRecord {
+	if x != nil {
+		return x.Records
+	}
+	return nil
+}
+
+// Config profile of agent pushed by the server. Config is the JSON object of
+// the fields of agent config that the profile sets, Name is the names of the
+// merged profiles. Signature is the claims of profile (RequestId,
+// ComputerName, Name, Config and ExpireTime) signed by the Ed25519 key of
+// server, in base64 and separated by ".".
+type AgentProfile struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Name      string `protobuf:"bytes,1,opt,name=Name,proto3" json:"Name,omitempty"`
+	Config    string `protobuf:"bytes,2,opt,name=Config,proto3" json:"Config,omitempty"`
+	Signature string `protobuf:"bytes,3,opt,name=Signature,proto3" json:"Signature,omitempty"`
+}
+
+func (x *AgentProfile) Reset() {
+	*x = AgentProfile{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_protobuf_agent_message_proto_msgTypes[25]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *AgentProfile) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AgentProfile) ProtoMessage() {}
+
+func (x *AgentProfile) ProtoReflect() protoreflect.Message {
+	mi := &file_protobuf_agent_message_proto_msgTypes[25]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AgentProfile.ProtoReflect.Descriptor instead.
+func (*AgentProfile) Descriptor() ([]byte, []int) {
+	return file_protobuf_agent_message_proto_rawDescGZIP(), []int{25}
+}
+
+func (x *AgentProfile) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *AgentProfile) GetConfig() string {
+	if x != nil {
+		return x.Config
+	}
+	return ""
+}
+
+func (x *AgentProfile) GetSignature() string {
+	if x != nil {
+		return x.Signature
+	}
+	return ""
+}
+
+// Query of the effective config of agent
+type ConfigQuery struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *ConfigQuery) Reset() {
+	*x = ConfigQuery{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_protobuf_agent_message_proto_msgTypes[26]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ConfigQuery) String() string {
+	return protoimpl.X.MessageStringOf(x)
 }
 
-func (x *FileInfo) Reset() {
-	*x = FileInfo{}
+func (*ConfigQuery) ProtoMessage() {}
+
+func (x *ConfigQuery) ProtoReflect() protoreflect.Message {
+	mi := &file_protobuf_agent_message_proto_msgTypes[26]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ConfigQuery.ProtoReflect.Descriptor instead.
+func (*ConfigQuery) Descriptor() ([]byte, []int) {
+	return file_protobuf_agent_message_proto_rawDescGZIP(), []int{26}
+}
+
+// Effective config of agent. Config is the JSON of the config that the
+// agent uses, Sources is the JSON object of the source (profile, env or
+// flag) of the fields that are not from ConfigPath. Profile is the name of
+// the applied profile.
+type AgentConfigView struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	ConfigPath string `protobuf:"bytes,1,opt,name=ConfigPath,proto3" json:"ConfigPath,omitempty"`
+	Profile    string `protobuf:"bytes,2,opt,name=Profile,proto3" json:"Profile,omitempty"`
+	Config     string `protobuf:"bytes,3,opt,name=Config,proto3" json:"Config,omitempty"`
+	Sources    string `protobuf:"bytes,4,opt,name=Sources,proto3" json:"Sources,omitempty"`
+}
+
+func (x *AgentConfigView) Reset() {
+	*x = AgentConfigView{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_protobuf_agent_message_proto_msgTypes[12]
+		mi := &file_protobuf_agent_message_proto_msgTypes[27]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
 }
 
-func (x *FileInfo) String() string {
+func (x *AgentConfigView) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*FileInfo) ProtoMessage() {}
+func (*AgentConfigView) ProtoMessage() {}
 
-func (x *FileInfo) ProtoReflect() protoreflect.Message {
-	mi := &file_protobuf_agent_message_proto_msgTypes[12]
+func (x *AgentConfigView) ProtoReflect() protoreflect.Message {
+	mi := &file_protobuf_agent_message_proto_msgTypes[27]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -779,44 +1857,72 @@ func (x *FileInfo) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use FileInfo.ProtoReflect.Descriptor instead.
-func (*FileInfo) Descriptor() ([]byte, []int) {
-	return file_protobuf_agent_message_proto_rawDescGZIP(), []int{12}
+// Deprecated: Use AgentConfigView.ProtoReflect.Descriptor instead.
+func (*AgentConfigView) Descriptor() ([]byte, []int) {
+	return file_protobuf_agent_message_proto_rawDescGZIP(), []int{27}
 }
 
-func (x *FileInfo) GetFilePath() string {
+func (x *AgentConfigView) GetConfigPath() string {
 	if x != nil {
-		return x.FilePath
+		return x.ConfigPath
 	}
 	return ""
 }
 
-// A stream to read a sequence of messages back
-type FileData struct {
+func (x *AgentConfigView) GetProfile() string {
+	if x != nil {
+		return x.Profile
+	}
+	return ""
+}
+
+func (x *AgentConfigView) GetConfig() string {
+	if x != nil {
+		return x.Config
+	}
+	return ""
+}
+
+func (x *AgentConfigView) GetSources() string {
+	if x != nil {
+		return x.Sources
+	}
+	return ""
+}
+
+// Batch of events collected by agent. Events is the JSON array of the raw
+// events (Sysmon XML or JSON), compressed if Compression is gzip.
+// LocalHandled[i] is true if the agent compared event i with its local rules
+// while the server was unreachable
+type EventBatch struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	FileChunk []byte `protobuf:"bytes,1,opt,name=FileChunk,proto3" json:"FileChunk,omitempty"`
+	ComputerName string `protobuf:"bytes,1,opt,name=ComputerName,proto3" json:"ComputerName,omitempty"`
+	Compression  string `protobuf:"bytes,2,opt,name=Compression,proto3" json:"Compression,omitempty"`
+	Events       []byte `protobuf:"bytes,3,opt,name=Events,proto3" json:"Events,omitempty"`
+	Count        int32  `protobuf:"varint,4,opt,name=Count,proto3" json:"Count,omitempty"`
+	LocalHandled []bool `protobuf:"varint,5,rep,packed,name=LocalHandled,proto3" json:"LocalHandled,omitempty"`
 }
 
-func (x *FileData) Reset() {
-	*x = FileData{}
+func (x *EventBatch) Reset() {
+	*x = EventBatch{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_protobuf_agent_message_proto_msgTypes[13]
+		mi := &file_protobuf_agent_message_proto_msgTypes[28]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
 }
 
-func (x *FileData) String() string {
+func (x *EventBatch) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*FileData) ProtoMessage() {}
+func (*EventBatch) ProtoMessage() {}
 
-func (x *FileData) ProtoReflect() protoreflect.Message {
-	mi := &file_protobuf_agent_message_proto_msgTypes[13]
+func (x *EventBatch) ProtoReflect() protoreflect.Message {
+	mi := &file_protobuf_agent_message_proto_msgTypes[28]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -827,14 +1933,155 @@ func (x *FileData) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use FileData.ProtoReflect.Descriptor instead.
-func (*FileData) Descriptor() ([]byte, []int) {
-	return file_protobuf_agent_message_proto_rawDescGZIP(), []int{13}
+// Deprecated: Use EventBatch.ProtoReflect.Descriptor instead.
+func (*EventBatch) Descriptor() ([]byte, []int) {
+	return file_protobuf_agent_message_proto_rawDescGZIP(), []int{28}
 }
 
-func (x *FileData) GetFileChunk() []byte {
+func (x *EventBatch) GetComputerName() string {
 	if x != nil {
-		return x.FileChunk
+		return x.ComputerName
+	}
+	return ""
+}
+
+func (x *EventBatch) GetCompression() string {
+	if x != nil {
+		return x.Compression
+	}
+	return ""
+}
+
+func (x *EventBatch) GetEvents() []byte {
+	if x != nil {
+		return x.Events
+	}
+	return nil
+}
+
+func (x *EventBatch) GetCount() int32 {
+	if x != nil {
+		return x.Count
+	}
+	return 0
+}
+
+func (x *EventBatch) GetLocalHandled() []bool {
+	if x != nil {
+		return x.LocalHandled
+	}
+	return nil
+}
+
+// Acknowledgement of the telemetry stream, Received is the number of events
+type TelemetryAck struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Received   int64  `protobuf:"varint,1,opt,name=Received,proto3" json:"Received,omitempty"`
+	ResultInfo string `protobuf:"bytes,2,opt,name=ResultInfo,proto3" json:"ResultInfo,omitempty"`
+}
+
+func (x *TelemetryAck) Reset() {
+	*x = TelemetryAck{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_protobuf_agent_message_proto_msgTypes[29]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *TelemetryAck) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TelemetryAck) ProtoMessage() {}
+
+func (x *TelemetryAck) ProtoReflect() protoreflect.Message {
+	mi := &file_protobuf_agent_message_proto_msgTypes[29]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TelemetryAck.ProtoReflect.Descriptor instead.
+func (*TelemetryAck) Descriptor() ([]byte, []int) {
+	return file_protobuf_agent_message_proto_rawDescGZIP(), []int{29}
+}
+
+func (x *TelemetryAck) GetReceived() int64 {
+	if x != nil {
+		return x.Received
+	}
+	return 0
+}
+
+func (x *TelemetryAck) GetResultInfo() string {
+	if x != nil {
+		return x.ResultInfo
+	}
+	return ""
+}
+
+// Results of the responses that the agent executed with its local rules.
+// Each result is the JSON of the request and its result.
+type ResultBatch struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	ComputerName string   `protobuf:"bytes,1,opt,name=ComputerName,proto3" json:"ComputerName,omitempty"`
+	Results      []string `protobuf:"bytes,2,rep,name=Results,proto3" json:"Results,omitempty"`
+}
+
+func (x *ResultBatch) Reset() {
+	*x = ResultBatch{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_protobuf_agent_message_proto_msgTypes[30]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ResultBatch) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ResultBatch) ProtoMessage() {}
+
+func (x *ResultBatch) ProtoReflect() protoreflect.Message {
+	mi := &file_protobuf_agent_message_proto_msgTypes[30]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ResultBatch.ProtoReflect.Descriptor instead.
+func (*ResultBatch) Descriptor() ([]byte, []int) {
+	return file_protobuf_agent_message_proto_rawDescGZIP(), []int{30}
+}
+
+func (x *ResultBatch) GetComputerName() string {
+	if x != nil {
+		return x.ComputerName
+	}
+	return ""
+}
+
+func (x *ResultBatch) GetResults() []string {
+	if x != nil {
+		return x.Results
 	}
 	return nil
 }
@@ -906,65 +2153,239 @@ var file_protobuf_agent_message_proto_rawDesc = []byte{
 	0x6f, 0x6e, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x41, 0x63, 0x74, 0x69, 0x6f, 0x6e,
 	0x22, 0x28, 0x0a, 0x0e, 0x4e, 0x65, 0x74, 0x77, 0x6f, 0x72, 0x6b, 0x41, 0x64, 0x61, 0x70, 0x74,
 	0x65, 0x72, 0x12, 0x16, 0x0a, 0x06, 0x61, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x01, 0x20, 0x01,
-	0x28, 0x09, 0x52, 0x06, 0x61, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x22, 0x48, 0x0a, 0x0e, 0x52, 0x65,
-	0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x12, 0x1e, 0x0a, 0x0a,
-	0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x49, 0x6e, 0x66, 0x6f, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09,
-	0x52, 0x0a, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x49, 0x6e, 0x66, 0x6f, 0x12, 0x16, 0x0a, 0x06,
-	0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x08, 0x52, 0x06, 0x52, 0x65,
-	0x73, 0x75, 0x6c, 0x74, 0x22, 0x26, 0x0a, 0x08, 0x46, 0x69, 0x6c, 0x65, 0x49, 0x6e, 0x66, 0x6f,
-	0x12, 0x1a, 0x0a, 0x08, 0x46, 0x69, 0x6c, 0x65, 0x50, 0x61, 0x74, 0x68, 0x18, 0x03, 0x20, 0x01,
-	0x28, 0x09, 0x52, 0x08, 0x46, 0x69, 0x6c, 0x65, 0x50, 0x61, 0x74, 0x68, 0x22, 0x28, 0x0a, 0x08,
-	0x46, 0x69, 0x6c, 0x65, 0x44, 0x61, 0x74, 0x61, 0x12, 0x1c, 0x0a, 0x09, 0x46, 0x69, 0x6c, 0x65,
-	0x43, 0x68, 0x75, 0x6e, 0x6b, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x09, 0x46, 0x69, 0x6c,
-	0x65, 0x43, 0x68, 0x75, 0x6e, 0x6b, 0x32, 0xee, 0x05, 0x0a, 0x07, 0x4d, 0x61, 0x6e, 0x61, 0x67,
-	0x65, 0x72, 0x12, 0x3b, 0x0a, 0x11, 0x4d, 0x61, 0x6e, 0x61, 0x67, 0x65, 0x72, 0x45, 0x76, 0x65,
-	0x6e, 0x74, 0x43, 0x6f, 0x64, 0x65, 0x31, 0x12, 0x0f, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x45, 0x76,
-	0x65, 0x6e, 0x74, 0x43, 0x6f, 0x64, 0x65, 0x31, 0x1a, 0x13, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x52,
-	0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x22, 0x00, 0x12,
+	0x28, 0x09, 0x52, 0x06, 0x61, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x22, 0x80, 0x01, 0x0a, 0x0e, 0x52,
+	0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x12, 0x1e, 0x0a,
+	0x0a, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x49, 0x6e, 0x66, 0x6f, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x0a, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x49, 0x6e, 0x66, 0x6f, 0x12, 0x16, 0x0a,
+	0x06, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x08, 0x52, 0x06, 0x52,
+	0x65, 0x73, 0x75, 0x6c, 0x74, 0x12, 0x1e, 0x0a, 0x0a, 0x44, 0x65, 0x6e, 0x79, 0x52, 0x65, 0x61,
+	0x73, 0x6f, 0x6e, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x44, 0x65, 0x6e, 0x79, 0x52,
+	0x65, 0x61, 0x73, 0x6f, 0x6e, 0x12, 0x16, 0x0a, 0x06, 0x55, 0x6e, 0x64, 0x6f, 0x49, 0x64, 0x18,
+	0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x55, 0x6e, 0x64, 0x6f, 0x49, 0x64, 0x22, 0xca, 0x01,
+	0x0a, 0x08, 0x46, 0x69, 0x6c, 0x65, 0x49, 0x6e, 0x66, 0x6f, 0x12, 0x1a, 0x0a, 0x08, 0x46, 0x69,
+	0x6c, 0x65, 0x50, 0x61, 0x74, 0x68, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x46, 0x69,
+	0x6c, 0x65, 0x50, 0x61, 0x74, 0x68, 0x12, 0x16, 0x0a, 0x06, 0x4f, 0x66, 0x66, 0x73, 0x65, 0x74,
+	0x18, 0x04, 0x20, 0x01, 0x28, 0x03, 0x52, 0x06, 0x4f, 0x66, 0x66, 0x73, 0x65, 0x74, 0x12, 0x16,
+	0x0a, 0x06, 0x53, 0x68, 0x61, 0x32, 0x35, 0x36, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06,
+	0x53, 0x68, 0x61, 0x32, 0x35, 0x36, 0x12, 0x18, 0x0a, 0x07, 0x4d, 0x61, 0x78, 0x53, 0x69, 0x7a,
+	0x65, 0x18, 0x06, 0x20, 0x01, 0x28, 0x03, 0x52, 0x07, 0x4d, 0x61, 0x78, 0x53, 0x69, 0x7a, 0x65,
+	0x12, 0x18, 0x0a, 0x07, 0x4d, 0x61, 0x78, 0x52, 0x61, 0x74, 0x65, 0x18, 0x07, 0x20, 0x01, 0x28,
+	0x03, 0x52, 0x07, 0x4d, 0x61, 0x78, 0x52, 0x61, 0x74, 0x65, 0x12, 0x20, 0x0a, 0x0b, 0x43, 0x6f,
+	0x6d, 0x70, 0x72, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x08, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x0b, 0x43, 0x6f, 0x6d, 0x70, 0x72, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x1c, 0x0a, 0x09,
+	0x50, 0x72, 0x6f, 0x63, 0x65, 0x73, 0x73, 0x49, 0x64, 0x18, 0x09, 0x20, 0x01, 0x28, 0x05, 0x52,
+	0x09, 0x50, 0x72, 0x6f, 0x63, 0x65, 0x73, 0x73, 0x49, 0x64, 0x22, 0xb2, 0x02, 0x0a, 0x08, 0x46,
+	0x69, 0x6c, 0x65, 0x4d, 0x65, 0x74, 0x61, 0x12, 0x1a, 0x0a, 0x08, 0x46, 0x69, 0x6c, 0x65, 0x50,
+	0x61, 0x74, 0x68, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x46, 0x69, 0x6c, 0x65, 0x50,
+	0x61, 0x74, 0x68, 0x12, 0x12, 0x0a, 0x04, 0x53, 0x69, 0x7a, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28,
+	0x03, 0x52, 0x04, 0x53, 0x69, 0x7a, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x53, 0x68, 0x61, 0x32, 0x35,
+	0x36, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x53, 0x68, 0x61, 0x32, 0x35, 0x36, 0x12,
+	0x10, 0x0a, 0x03, 0x4d, 0x64, 0x35, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x4d, 0x64,
+	0x35, 0x12, 0x18, 0x0a, 0x07, 0x4d, 0x6f, 0x64, 0x54, 0x69, 0x6d, 0x65, 0x18, 0x05, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x07, 0x4d, 0x6f, 0x64, 0x54, 0x69, 0x6d, 0x65, 0x12, 0x1e, 0x0a, 0x0a, 0x41,
+	0x63, 0x63, 0x65, 0x73, 0x73, 0x54, 0x69, 0x6d, 0x65, 0x18, 0x06, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x0a, 0x41, 0x63, 0x63, 0x65, 0x73, 0x73, 0x54, 0x69, 0x6d, 0x65, 0x12, 0x1e, 0x0a, 0x0a, 0x43,
+	0x72, 0x65, 0x61, 0x74, 0x65, 0x54, 0x69, 0x6d, 0x65, 0x18, 0x07, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x0a, 0x43, 0x72, 0x65, 0x61, 0x74, 0x65, 0x54, 0x69, 0x6d, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x4f,
+	0x66, 0x66, 0x73, 0x65, 0x74, 0x18, 0x08, 0x20, 0x01, 0x28, 0x03, 0x52, 0x06, 0x4f, 0x66, 0x66,
+	0x73, 0x65, 0x74, 0x12, 0x20, 0x0a, 0x0b, 0x43, 0x6f, 0x6d, 0x70, 0x72, 0x65, 0x73, 0x73, 0x69,
+	0x6f, 0x6e, 0x18, 0x09, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x43, 0x6f, 0x6d, 0x70, 0x72, 0x65,
+	0x73, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x1a, 0x0a, 0x08, 0x4d, 0x61, 0x6e, 0x69, 0x66, 0x65, 0x73,
+	0x74, 0x18, 0x0a, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x4d, 0x61, 0x6e, 0x69, 0x66, 0x65, 0x73,
+	0x74, 0x12, 0x1c, 0x0a, 0x09, 0x4f, 0x76, 0x65, 0x72, 0x77, 0x72, 0x69, 0x74, 0x65, 0x18, 0x0b,
+	0x20, 0x01, 0x28, 0x08, 0x52, 0x09, 0x4f, 0x76, 0x65, 0x72, 0x77, 0x72, 0x69, 0x74, 0x65, 0x22,
+	0xb7, 0x01, 0x0a, 0x0b, 0x43, 0x6f, 0x6c, 0x6c, 0x65, 0x63, 0x74, 0x49, 0x6e, 0x66, 0x6f, 0x12,
+	0x14, 0x0a, 0x05, 0x50, 0x61, 0x74, 0x68, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x09, 0x52, 0x05,
+	0x50, 0x61, 0x74, 0x68, 0x73, 0x12, 0x1a, 0x0a, 0x08, 0x4d, 0x61, 0x78, 0x44, 0x65, 0x70, 0x74,
+	0x68, 0x18, 0x02, 0x20, 0x01, 0x28, 0x05, 0x52, 0x08, 0x4d, 0x61, 0x78, 0x44, 0x65, 0x70, 0x74,
+	0x68, 0x12, 0x20, 0x0a, 0x0b, 0x4d, 0x61, 0x78, 0x46, 0x69, 0x6c, 0x65, 0x53, 0x69, 0x7a, 0x65,
+	0x18, 0x03, 0x20, 0x01, 0x28, 0x03, 0x52, 0x0b, 0x4d, 0x61, 0x78, 0x46, 0x69, 0x6c, 0x65, 0x53,
+	0x69, 0x7a, 0x65, 0x12, 0x22, 0x0a, 0x0c, 0x4d, 0x61, 0x78, 0x54, 0x6f, 0x74, 0x61, 0x6c, 0x53,
+	0x69, 0x7a, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x03, 0x52, 0x0c, 0x4d, 0x61, 0x78, 0x54, 0x6f,
+	0x74, 0x61, 0x6c, 0x53, 0x69, 0x7a, 0x65, 0x12, 0x18, 0x0a, 0x07, 0x4d, 0x61, 0x78, 0x52, 0x61,
+	0x74, 0x65, 0x18, 0x05, 0x20, 0x01, 0x28, 0x03, 0x52, 0x07, 0x4d, 0x61, 0x78, 0x52, 0x61, 0x74,
+	0x65, 0x12, 0x16, 0x0a, 0x06, 0x46, 0x6f, 0x72, 0x6d, 0x61, 0x74, 0x18, 0x06, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x06, 0x46, 0x6f, 0x72, 0x6d, 0x61, 0x74, 0x22, 0x4b, 0x0a, 0x08, 0x46, 0x69, 0x6c,
+	0x65, 0x44, 0x61, 0x74, 0x61, 0x12, 0x1c, 0x0a, 0x09, 0x46, 0x69, 0x6c, 0x65, 0x43, 0x68, 0x75,
+	0x6e, 0x6b, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x09, 0x46, 0x69, 0x6c, 0x65, 0x43, 0x68,
+	0x75, 0x6e, 0x6b, 0x12, 0x21, 0x0a, 0x04, 0x4d, 0x65, 0x74, 0x61, 0x18, 0x02, 0x20, 0x01, 0x28,
+	0x0b, 0x32, 0x0d, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x46, 0x69, 0x6c, 0x65, 0x4d, 0x65, 0x74, 0x61,
+	0x52, 0x04, 0x4d, 0x65, 0x74, 0x61, 0x22, 0x2d, 0x0a, 0x0f, 0x51, 0x75, 0x61, 0x72, 0x61, 0x6e,
+	0x74, 0x69, 0x6e, 0x65, 0x51, 0x75, 0x65, 0x72, 0x79, 0x12, 0x1a, 0x0a, 0x08, 0x46, 0x69, 0x6c,
+	0x65, 0x50, 0x61, 0x74, 0x68, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x46, 0x69, 0x6c,
+	0x65, 0x50, 0x61, 0x74, 0x68, 0x22, 0x98, 0x01, 0x0a, 0x0e, 0x51, 0x75, 0x61, 0x72, 0x61, 0x6e,
+	0x74, 0x69, 0x6e, 0x65, 0x49, 0x74, 0x65, 0x6d, 0x12, 0x0e, 0x0a, 0x02, 0x49, 0x64, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x02, 0x49, 0x64, 0x12, 0x22, 0x0a, 0x0c, 0x4f, 0x72, 0x69, 0x67,
+	0x69, 0x6e, 0x61, 0x6c, 0x50, 0x61, 0x74, 0x68, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0c,
+	0x4f, 0x72, 0x69, 0x67, 0x69, 0x6e, 0x61, 0x6c, 0x50, 0x61, 0x74, 0x68, 0x12, 0x16, 0x0a, 0x06,
+	0x53, 0x68, 0x61, 0x32, 0x35, 0x36, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x53, 0x68,
+	0x61, 0x32, 0x35, 0x36, 0x12, 0x12, 0x0a, 0x04, 0x53, 0x69, 0x7a, 0x65, 0x18, 0x04, 0x20, 0x01,
+	0x28, 0x03, 0x52, 0x04, 0x53, 0x69, 0x7a, 0x65, 0x12, 0x26, 0x0a, 0x0e, 0x51, 0x75, 0x61, 0x72,
+	0x61, 0x6e, 0x74, 0x69, 0x6e, 0x65, 0x54, 0x69, 0x6d, 0x65, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x0e, 0x51, 0x75, 0x61, 0x72, 0x61, 0x6e, 0x74, 0x69, 0x6e, 0x65, 0x54, 0x69, 0x6d, 0x65,
+	0x22, 0x3b, 0x0a, 0x0e, 0x51, 0x75, 0x61, 0x72, 0x61, 0x6e, 0x74, 0x69, 0x6e, 0x65, 0x4c, 0x69,
+	0x73, 0x74, 0x12, 0x29, 0x0a, 0x05, 0x49, 0x74, 0x65, 0x6d, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28,
+	0x0b, 0x32, 0x13, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x51, 0x75, 0x61, 0x72, 0x61, 0x6e, 0x74, 0x69,
+	0x6e, 0x65, 0x49, 0x74, 0x65, 0x6d, 0x52, 0x05, 0x49, 0x74, 0x65, 0x6d, 0x73, 0x22, 0x2d, 0x0a,
+	0x0b, 0x54, 0x72, 0x69, 0x61, 0x67, 0x65, 0x51, 0x75, 0x65, 0x72, 0x79, 0x12, 0x1e, 0x0a, 0x0a,
+	0x53, 0x6b, 0x69, 0x70, 0x48, 0x61, 0x73, 0x68, 0x65, 0x73, 0x18, 0x01, 0x20, 0x01, 0x28, 0x08,
+	0x52, 0x0a, 0x53, 0x6b, 0x69, 0x70, 0x48, 0x61, 0x73, 0x68, 0x65, 0x73, 0x22, 0x2c, 0x0a, 0x0e,
+	0x54, 0x72, 0x69, 0x61, 0x67, 0x65, 0x53, 0x6e, 0x61, 0x70, 0x73, 0x68, 0x6f, 0x74, 0x12, 0x1a,
+	0x0a, 0x08, 0x53, 0x6e, 0x61, 0x70, 0x73, 0x68, 0x6f, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x08, 0x53, 0x6e, 0x61, 0x70, 0x73, 0x68, 0x6f, 0x74, 0x22, 0x46, 0x0a, 0x0c, 0x4c, 0x6f,
+	0x63, 0x61, 0x6c, 0x52, 0x75, 0x6c, 0x65, 0x53, 0x65, 0x74, 0x12, 0x18, 0x0a, 0x07, 0x52, 0x75,
+	0x6c, 0x65, 0x53, 0x65, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x07, 0x52, 0x75, 0x6c,
+	0x65, 0x53, 0x65, 0x74, 0x12, 0x1c, 0x0a, 0x09, 0x53, 0x69, 0x67, 0x6e, 0x61, 0x74, 0x75, 0x72,
+	0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x09, 0x53, 0x69, 0x67, 0x6e, 0x61, 0x74, 0x75,
+	0x72, 0x65, 0x22, 0x66, 0x0a, 0x12, 0x41, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x48, 0x69, 0x73, 0x74,
+	0x6f, 0x72, 0x79, 0x51, 0x75, 0x65, 0x72, 0x79, 0x12, 0x1a, 0x0a, 0x08, 0x41, 0x66, 0x74, 0x65,
+	0x72, 0x53, 0x65, 0x71, 0x18, 0x01, 0x20, 0x01, 0x28, 0x03, 0x52, 0x08, 0x41, 0x66, 0x74, 0x65,
+	0x72, 0x53, 0x65, 0x71, 0x12, 0x14, 0x0a, 0x05, 0x4c, 0x69, 0x6d, 0x69, 0x74, 0x18, 0x02, 0x20,
+	0x01, 0x28, 0x05, 0x52, 0x05, 0x4c, 0x69, 0x6d, 0x69, 0x74, 0x12, 0x1e, 0x0a, 0x0a, 0x52, 0x65,
+	0x71, 0x75, 0x65, 0x73, 0x74, 0x49, 0x64, 0x73, 0x18, 0x03, 0x20, 0x03, 0x28, 0x09, 0x52, 0x0a,
+	0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x49, 0x64, 0x73, 0x22, 0x90, 0x02, 0x0a, 0x0c, 0x41,
+	0x63, 0x74, 0x69, 0x6f, 0x6e, 0x52, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x12, 0x10, 0x0a, 0x03, 0x53,
+	0x65, 0x71, 0x18, 0x01, 0x20, 0x01, 0x28, 0x03, 0x52, 0x03, 0x53, 0x65, 0x71, 0x12, 0x1c, 0x0a,
+	0x09, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x49, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x09, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x49, 0x64, 0x12, 0x16, 0x0a, 0x06, 0x53,
+	0x6f, 0x75, 0x72, 0x63, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x53, 0x6f, 0x75,
+	0x72, 0x63, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x4d, 0x65, 0x74, 0x68, 0x6f, 0x64, 0x18, 0x04, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x06, 0x4d, 0x65, 0x74, 0x68, 0x6f, 0x64, 0x12, 0x18, 0x0a, 0x07, 0x52,
+	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x52, 0x65,
+	0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x16, 0x0a, 0x06, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x18,
+	0x06, 0x20, 0x01, 0x28, 0x08, 0x52, 0x06, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x12, 0x1e, 0x0a,
+	0x0a, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x49, 0x6e, 0x66, 0x6f, 0x18, 0x07, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x0a, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x49, 0x6e, 0x66, 0x6f, 0x12, 0x1c, 0x0a,
+	0x09, 0x53, 0x74, 0x61, 0x72, 0x74, 0x54, 0x69, 0x6d, 0x65, 0x18, 0x08, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x09, 0x53, 0x74, 0x61, 0x72, 0x74, 0x54, 0x69, 0x6d, 0x65, 0x12, 0x18, 0x0a, 0x07, 0x45,
+	0x6e, 0x64, 0x54, 0x69, 0x6d, 0x65, 0x18, 0x09, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x45, 0x6e,
+	0x64, 0x54, 0x69, 0x6d, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x55, 0x6e, 0x64, 0x6f, 0x49, 0x64, 0x18,
+	0x0a, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x55, 0x6e, 0x64, 0x6f, 0x49, 0x64, 0x22, 0x3c, 0x0a,
+	0x0d, 0x41, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x48, 0x69, 0x73, 0x74, 0x6f, 0x72, 0x79, 0x12, 0x2b,
+	0x0a, 0x07, 0x52, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32,
+	0x11, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x41, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x52, 0x65, 0x63, 0x6f,
+	0x72, 0x64, 0x52, 0x07, 0x52, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x73, 0x22, 0x58, 0x0a, 0x0c, 0x41,
+	0x67, 0x65, 0x6e, 0x74, 0x50, 0x72, 0x6f, 0x66, 0x69, 0x6c, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x4e,
+	0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x4e, 0x61, 0x6d, 0x65, 0x12,
+	0x16, 0x0a, 0x06, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x06, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x12, 0x1c, 0x0a, 0x09, 0x53, 0x69, 0x67, 0x6e, 0x61,
+	0x74, 0x75, 0x72, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x53, 0x69, 0x67, 0x6e,
+	0x61, 0x74, 0x75, 0x72, 0x65, 0x22, 0x0d, 0x0a, 0x0b, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x51,
+	0x75, 0x65, 0x72, 0x79, 0x22, 0x7d, 0x0a, 0x0f, 0x41, 0x67, 0x65, 0x6e, 0x74, 0x43, 0x6f, 0x6e,
+	0x66, 0x69, 0x67, 0x56, 0x69, 0x65, 0x77, 0x12, 0x1e, 0x0a, 0x0a, 0x43, 0x6f, 0x6e, 0x66, 0x69,
+	0x67, 0x50, 0x61, 0x74, 0x68, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x43, 0x6f, 0x6e,
+	0x66, 0x69, 0x67, 0x50, 0x61, 0x74, 0x68, 0x12, 0x18, 0x0a, 0x07, 0x50, 0x72, 0x6f, 0x66, 0x69,
+	0x6c, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x50, 0x72, 0x6f, 0x66, 0x69, 0x6c,
+	0x65, 0x12, 0x16, 0x0a, 0x06, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x18, 0x03, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x06, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x12, 0x18, 0x0a, 0x07, 0x53, 0x6f, 0x75,
+	0x72, 0x63, 0x65, 0x73, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x53, 0x6f, 0x75, 0x72,
+	0x63, 0x65, 0x73, 0x22, 0xa4, 0x01, 0x0a, 0x0a, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x42, 0x61, 0x74,
+	0x63, 0x68, 0x12, 0x22, 0x0a, 0x0c, 0x43, 0x6f, 0x6d, 0x70, 0x75, 0x74, 0x65, 0x72, 0x4e, 0x61,
+	0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0c, 0x43, 0x6f, 0x6d, 0x70, 0x75, 0x74,
+	0x65, 0x72, 0x4e, 0x61, 0x6d, 0x65, 0x12, 0x20, 0x0a, 0x0b, 0x43, 0x6f, 0x6d, 0x70, 0x72, 0x65,
+	0x73, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x43, 0x6f, 0x6d,
+	0x70, 0x72, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x16, 0x0a, 0x06, 0x45, 0x76, 0x65, 0x6e,
+	0x74, 0x73, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x06, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x73,
+	0x12, 0x14, 0x0a, 0x05, 0x43, 0x6f, 0x75, 0x6e, 0x74, 0x18, 0x04, 0x20, 0x01, 0x28, 0x05, 0x52,
+	0x05, 0x43, 0x6f, 0x75, 0x6e, 0x74, 0x12, 0x22, 0x0a, 0x0c, 0x4c, 0x6f, 0x63, 0x61, 0x6c, 0x48,
+	0x61, 0x6e, 0x64, 0x6c, 0x65, 0x64, 0x18, 0x05, 0x20, 0x03, 0x28, 0x08, 0x52, 0x0c, 0x4c, 0x6f,
+	0x63, 0x61, 0x6c, 0x48, 0x61, 0x6e, 0x64, 0x6c, 0x65, 0x64, 0x22, 0x4a, 0x0a, 0x0c, 0x54, 0x65,
+	0x6c, 0x65, 0x6d, 0x65, 0x74, 0x72, 0x79, 0x41, 0x63, 0x6b, 0x12, 0x1a, 0x0a, 0x08, 0x52, 0x65,
+	0x63, 0x65, 0x69, 0x76, 0x65, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x03, 0x52, 0x08, 0x52, 0x65,
+	0x63, 0x65, 0x69, 0x76, 0x65, 0x64, 0x12, 0x1e, 0x0a, 0x0a, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74,
+	0x49, 0x6e, 0x66, 0x6f, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x52, 0x65, 0x73, 0x75,
+	0x6c, 0x74, 0x49, 0x6e, 0x66, 0x6f, 0x22, 0x4b, 0x0a, 0x0b, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74,
+	0x42, 0x61, 0x74, 0x63, 0x68, 0x12, 0x22, 0x0a, 0x0c, 0x43, 0x6f, 0x6d, 0x70, 0x75, 0x74, 0x65,
+	0x72, 0x4e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0c, 0x43, 0x6f, 0x6d,
+	0x70, 0x75, 0x74, 0x65, 0x72, 0x4e, 0x61, 0x6d, 0x65, 0x12, 0x18, 0x0a, 0x07, 0x52, 0x65, 0x73,
+	0x75, 0x6c, 0x74, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x09, 0x52, 0x07, 0x52, 0x65, 0x73, 0x75,
+	0x6c, 0x74, 0x73, 0x32, 0xcf, 0x09, 0x0a, 0x07, 0x4d, 0x61, 0x6e, 0x61, 0x67, 0x65, 0x72, 0x12,
 	0x3b, 0x0a, 0x11, 0x4d, 0x61, 0x6e, 0x61, 0x67, 0x65, 0x72, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x43,
-	0x6f, 0x64, 0x65, 0x33, 0x12, 0x0f, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x45, 0x76, 0x65, 0x6e, 0x74,
-	0x43, 0x6f, 0x64, 0x65, 0x33, 0x1a, 0x13, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x52, 0x65, 0x73, 0x70,
+	0x6f, 0x64, 0x65, 0x31, 0x12, 0x0f, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x45, 0x76, 0x65, 0x6e, 0x74,
+	0x43, 0x6f, 0x64, 0x65, 0x31, 0x1a, 0x13, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x52, 0x65, 0x73, 0x70,
 	0x6f, 0x6e, 0x73, 0x65, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x22, 0x00, 0x12, 0x3b, 0x0a, 0x11,
 	0x4d, 0x61, 0x6e, 0x61, 0x67, 0x65, 0x72, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x43, 0x6f, 0x64, 0x65,
-	0x37, 0x12, 0x0f, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x43, 0x6f, 0x64,
-	0x65, 0x37, 0x1a, 0x13, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73,
+	0x33, 0x12, 0x0f, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x43, 0x6f, 0x64,
+	0x65, 0x33, 0x1a, 0x13, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73,
 	0x65, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x22, 0x00, 0x12, 0x3b, 0x0a, 0x11, 0x4d, 0x61, 0x6e,
-	0x61, 0x67, 0x65, 0x72, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x43, 0x6f, 0x64, 0x65, 0x38, 0x12, 0x0f,
-	0x2e, 0x72, 0x70, 0x63, 0x2e, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x43, 0x6f, 0x64, 0x65, 0x38, 0x1a,
+	0x61, 0x67, 0x65, 0x72, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x43, 0x6f, 0x64, 0x65, 0x37, 0x12, 0x0f,
+	0x2e, 0x72, 0x70, 0x63, 0x2e, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x43, 0x6f, 0x64, 0x65, 0x37, 0x1a,
 	0x13, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x52, 0x65,
 	0x73, 0x75, 0x6c, 0x74, 0x22, 0x00, 0x12, 0x3b, 0x0a, 0x11, 0x4d, 0x61, 0x6e, 0x61, 0x67, 0x65,
-	0x72, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x43, 0x6f, 0x64, 0x65, 0x39, 0x12, 0x0f, 0x2e, 0x72, 0x70,
-	0x63, 0x2e, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x43, 0x6f, 0x64, 0x65, 0x39, 0x1a, 0x13, 0x2e, 0x72,
+	0x72, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x43, 0x6f, 0x64, 0x65, 0x38, 0x12, 0x0f, 0x2e, 0x72, 0x70,
+	0x63, 0x2e, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x43, 0x6f, 0x64, 0x65, 0x38, 0x1a, 0x13, 0x2e, 0x72,
 	0x70, 0x63, 0x2e, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x52, 0x65, 0x73, 0x75, 0x6c,
-	0x74, 0x22, 0x00, 0x12, 0x3d, 0x0a, 0x12, 0x4d, 0x61, 0x6e, 0x61, 0x67, 0x65, 0x72, 0x45, 0x76,
-	0x65, 0x6e, 0x74, 0x43, 0x6f, 0x64, 0x65, 0x31, 0x30, 0x12, 0x10, 0x2e, 0x72, 0x70, 0x63, 0x2e,
-	0x45, 0x76, 0x65, 0x6e, 0x74, 0x43, 0x6f, 0x64, 0x65, 0x31, 0x30, 0x1a, 0x13, 0x2e, 0x72, 0x70,
-	0x63, 0x2e, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74,
-	0x22, 0x00, 0x12, 0x3d, 0x0a, 0x12, 0x4d, 0x61, 0x6e, 0x61, 0x67, 0x65, 0x72, 0x45, 0x76, 0x65,
-	0x6e, 0x74, 0x43, 0x6f, 0x64, 0x65, 0x31, 0x31, 0x12, 0x10, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x45,
-	0x76, 0x65, 0x6e, 0x74, 0x43, 0x6f, 0x64, 0x65, 0x31, 0x31, 0x1a, 0x13, 0x2e, 0x72, 0x70, 0x63,
-	0x2e, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x22,
-	0x00, 0x12, 0x3d, 0x0a, 0x12, 0x4d, 0x61, 0x6e, 0x61, 0x67, 0x65, 0x72, 0x45, 0x76, 0x65, 0x6e,
-	0x74, 0x43, 0x6f, 0x64, 0x65, 0x31, 0x32, 0x12, 0x10, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x45, 0x76,
-	0x65, 0x6e, 0x74, 0x43, 0x6f, 0x64, 0x65, 0x31, 0x32, 0x1a, 0x13, 0x2e, 0x72, 0x70, 0x63, 0x2e,
+	0x74, 0x22, 0x00, 0x12, 0x3b, 0x0a, 0x11, 0x4d, 0x61, 0x6e, 0x61, 0x67, 0x65, 0x72, 0x45, 0x76,
+	0x65, 0x6e, 0x74, 0x43, 0x6f, 0x64, 0x65, 0x39, 0x12, 0x0f, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x45,
+	0x76, 0x65, 0x6e, 0x74, 0x43, 0x6f, 0x64, 0x65, 0x39, 0x1a, 0x13, 0x2e, 0x72, 0x70, 0x63, 0x2e,
 	0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x22, 0x00,
 	0x12, 0x3d, 0x0a, 0x12, 0x4d, 0x61, 0x6e, 0x61, 0x67, 0x65, 0x72, 0x45, 0x76, 0x65, 0x6e, 0x74,
-	0x43, 0x6f, 0x64, 0x65, 0x31, 0x33, 0x12, 0x10, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x45, 0x76, 0x65,
-	0x6e, 0x74, 0x43, 0x6f, 0x64, 0x65, 0x31, 0x33, 0x1a, 0x13, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x52,
+	0x43, 0x6f, 0x64, 0x65, 0x31, 0x30, 0x12, 0x10, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x45, 0x76, 0x65,
+	0x6e, 0x74, 0x43, 0x6f, 0x64, 0x65, 0x31, 0x30, 0x1a, 0x13, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x52,
 	0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x22, 0x00, 0x12,
 	0x3d, 0x0a, 0x12, 0x4d, 0x61, 0x6e, 0x61, 0x67, 0x65, 0x72, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x43,
-	0x6f, 0x64, 0x65, 0x31, 0x34, 0x12, 0x10, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x45, 0x76, 0x65, 0x6e,
-	0x74, 0x43, 0x6f, 0x64, 0x65, 0x31, 0x34, 0x1a, 0x13, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x52, 0x65,
-	0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x22, 0x00, 0x12, 0x43,
-	0x0a, 0x15, 0x4d, 0x61, 0x6e, 0x61, 0x67, 0x65, 0x72, 0x4e, 0x65, 0x74, 0x77, 0x6f, 0x72, 0x6b,
-	0x41, 0x64, 0x61, 0x70, 0x74, 0x65, 0x72, 0x12, 0x13, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x4e, 0x65,
-	0x74, 0x77, 0x6f, 0x72, 0x6b, 0x41, 0x64, 0x61, 0x70, 0x74, 0x65, 0x72, 0x1a, 0x13, 0x2e, 0x72,
-	0x70, 0x63, 0x2e, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x52, 0x65, 0x73, 0x75, 0x6c,
-	0x74, 0x22, 0x00, 0x12, 0x32, 0x0a, 0x0e, 0x4d, 0x61, 0x6e, 0x61, 0x67, 0x65, 0x72, 0x47, 0x65,
-	0x74, 0x46, 0x69, 0x6c, 0x65, 0x12, 0x0d, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x46, 0x69, 0x6c, 0x65,
-	0x49, 0x6e, 0x66, 0x6f, 0x1a, 0x0d, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x46, 0x69, 0x6c, 0x65, 0x44,
-	0x61, 0x74, 0x61, 0x22, 0x00, 0x30, 0x01, 0x42, 0x0b, 0x5a, 0x09, 0x2e, 0x2f, 0x70, 0x6b, 0x67,
-	0x2f, 0x72, 0x70, 0x63, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x6f, 0x64, 0x65, 0x31, 0x31, 0x12, 0x10, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x45, 0x76, 0x65, 0x6e,
+	0x74, 0x43, 0x6f, 0x64, 0x65, 0x31, 0x31, 0x1a, 0x13, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x52, 0x65,
+	0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x22, 0x00, 0x12, 0x3d,
+	0x0a, 0x12, 0x4d, 0x61, 0x6e, 0x61, 0x67, 0x65, 0x72, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x43, 0x6f,
+	0x64, 0x65, 0x31, 0x32, 0x12, 0x10, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x45, 0x76, 0x65, 0x6e, 0x74,
+	0x43, 0x6f, 0x64, 0x65, 0x31, 0x32, 0x1a, 0x13, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x52, 0x65, 0x73,
+	0x70, 0x6f, 0x6e, 0x73, 0x65, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x22, 0x00, 0x12, 0x3d, 0x0a,
+	0x12, 0x4d, 0x61, 0x6e, 0x61, 0x67, 0x65, 0x72, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x43, 0x6f, 0x64,
+	0x65, 0x31, 0x33, 0x12, 0x10, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x43,
+	0x6f, 0x64, 0x65, 0x31, 0x33, 0x1a, 0x13, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x52, 0x65, 0x73, 0x70,
+	0x6f, 0x6e, 0x73, 0x65, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x22, 0x00, 0x12, 0x3d, 0x0a, 0x12,
+	0x4d, 0x61, 0x6e, 0x61, 0x67, 0x65, 0x72, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x43, 0x6f, 0x64, 0x65,
+	0x31, 0x34, 0x12, 0x10, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x43, 0x6f,
+	0x64, 0x65, 0x31, 0x34, 0x1a, 0x13, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x52, 0x65, 0x73, 0x70, 0x6f,
+	0x6e, 0x73, 0x65, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x22, 0x00, 0x12, 0x43, 0x0a, 0x15, 0x4d,
+	0x61, 0x6e, 0x61, 0x67, 0x65, 0x72, 0x4e, 0x65, 0x74, 0x77, 0x6f, 0x72, 0x6b, 0x41, 0x64, 0x61,
+	0x70, 0x74, 0x65, 0x72, 0x12, 0x13, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x4e, 0x65, 0x74, 0x77, 0x6f,
+	0x72, 0x6b, 0x41, 0x64, 0x61, 0x70, 0x74, 0x65, 0x72, 0x1a, 0x13, 0x2e, 0x72, 0x70, 0x63, 0x2e,
+	0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x22, 0x00,
+	0x12, 0x32, 0x0a, 0x0e, 0x4d, 0x61, 0x6e, 0x61, 0x67, 0x65, 0x72, 0x47, 0x65, 0x74, 0x46, 0x69,
+	0x6c, 0x65, 0x12, 0x0d, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x46, 0x69, 0x6c, 0x65, 0x49, 0x6e, 0x66,
+	0x6f, 0x1a, 0x0d, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x46, 0x69, 0x6c, 0x65, 0x44, 0x61, 0x74, 0x61,
+	0x22, 0x00, 0x30, 0x01, 0x12, 0x44, 0x0a, 0x15, 0x4d, 0x61, 0x6e, 0x61, 0x67, 0x65, 0x72, 0x4c,
+	0x69, 0x73, 0x74, 0x51, 0x75, 0x61, 0x72, 0x61, 0x6e, 0x74, 0x69, 0x6e, 0x65, 0x12, 0x14, 0x2e,
+	0x72, 0x70, 0x63, 0x2e, 0x51, 0x75, 0x61, 0x72, 0x61, 0x6e, 0x74, 0x69, 0x6e, 0x65, 0x51, 0x75,
+	0x65, 0x72, 0x79, 0x1a, 0x13, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x51, 0x75, 0x61, 0x72, 0x61, 0x6e,
+	0x74, 0x69, 0x6e, 0x65, 0x4c, 0x69, 0x73, 0x74, 0x22, 0x00, 0x12, 0x35, 0x0a, 0x0e, 0x4d, 0x61,
+	0x6e, 0x61, 0x67, 0x65, 0x72, 0x43, 0x6f, 0x6c, 0x6c, 0x65, 0x63, 0x74, 0x12, 0x10, 0x2e, 0x72,
+	0x70, 0x63, 0x2e, 0x43, 0x6f, 0x6c, 0x6c, 0x65, 0x63, 0x74, 0x49, 0x6e, 0x66, 0x6f, 0x1a, 0x0d,
+	0x2e, 0x72, 0x70, 0x63, 0x2e, 0x46, 0x69, 0x6c, 0x65, 0x44, 0x61, 0x74, 0x61, 0x22, 0x00, 0x30,
+	0x01, 0x12, 0x38, 0x0a, 0x0e, 0x4d, 0x61, 0x6e, 0x61, 0x67, 0x65, 0x72, 0x50, 0x75, 0x74, 0x46,
+	0x69, 0x6c, 0x65, 0x12, 0x0d, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x46, 0x69, 0x6c, 0x65, 0x44, 0x61,
+	0x74, 0x61, 0x1a, 0x13, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73,
+	0x65, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x22, 0x00, 0x28, 0x01, 0x12, 0x38, 0x0a, 0x0d, 0x4d,
+	0x61, 0x6e, 0x61, 0x67, 0x65, 0x72, 0x54, 0x72, 0x69, 0x61, 0x67, 0x65, 0x12, 0x10, 0x2e, 0x72,
+	0x70, 0x63, 0x2e, 0x54, 0x72, 0x69, 0x61, 0x67, 0x65, 0x51, 0x75, 0x65, 0x72, 0x79, 0x1a, 0x13,
+	0x2e, 0x72, 0x70, 0x63, 0x2e, 0x54, 0x72, 0x69, 0x61, 0x67, 0x65, 0x53, 0x6e, 0x61, 0x70, 0x73,
+	0x68, 0x6f, 0x74, 0x22, 0x00, 0x12, 0x3d, 0x0a, 0x11, 0x4d, 0x61, 0x6e, 0x61, 0x67, 0x65, 0x72,
+	0x4c, 0x6f, 0x63, 0x61, 0x6c, 0x52, 0x75, 0x6c, 0x65, 0x73, 0x12, 0x11, 0x2e, 0x72, 0x70, 0x63,
+	0x2e, 0x4c, 0x6f, 0x63, 0x61, 0x6c, 0x52, 0x75, 0x6c, 0x65, 0x53, 0x65, 0x74, 0x1a, 0x13, 0x2e,
+	0x72, 0x70, 0x63, 0x2e, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x52, 0x65, 0x73, 0x75,
+	0x6c, 0x74, 0x22, 0x00, 0x12, 0x41, 0x0a, 0x10, 0x47, 0x65, 0x74, 0x41, 0x63, 0x74, 0x69, 0x6f,
+	0x6e, 0x48, 0x69, 0x73, 0x74, 0x6f, 0x72, 0x79, 0x12, 0x17, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x41,
+	0x63, 0x74, 0x69, 0x6f, 0x6e, 0x48, 0x69, 0x73, 0x74, 0x6f, 0x72, 0x79, 0x51, 0x75, 0x65, 0x72,
+	0x79, 0x1a, 0x12, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x41, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x48, 0x69,
+	0x73, 0x74, 0x6f, 0x72, 0x79, 0x22, 0x00, 0x12, 0x35, 0x0a, 0x09, 0x53, 0x65, 0x74, 0x43, 0x6f,
+	0x6e, 0x66, 0x69, 0x67, 0x12, 0x11, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x41, 0x67, 0x65, 0x6e, 0x74,
+	0x50, 0x72, 0x6f, 0x66, 0x69, 0x6c, 0x65, 0x1a, 0x13, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x52, 0x65,
+	0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x22, 0x00, 0x12, 0x35,
+	0x0a, 0x09, 0x47, 0x65, 0x74, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x12, 0x10, 0x2e, 0x72, 0x70,
+	0x63, 0x2e, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x51, 0x75, 0x65, 0x72, 0x79, 0x1a, 0x14, 0x2e,
+	0x72, 0x70, 0x63, 0x2e, 0x41, 0x67, 0x65, 0x6e, 0x74, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x56,
+	0x69, 0x65, 0x77, 0x22, 0x00, 0x32, 0x7e, 0x0a, 0x09, 0x54, 0x65, 0x6c, 0x65, 0x6d, 0x65, 0x74,
+	0x72, 0x79, 0x12, 0x39, 0x0a, 0x0f, 0x54, 0x65, 0x6c, 0x65, 0x6d, 0x65, 0x74, 0x72, 0x79, 0x53,
+	0x74, 0x72, 0x65, 0x61, 0x6d, 0x12, 0x0f, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x45, 0x76, 0x65, 0x6e,
+	0x74, 0x42, 0x61, 0x74, 0x63, 0x68, 0x1a, 0x11, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x54, 0x65, 0x6c,
+	0x65, 0x6d, 0x65, 0x74, 0x72, 0x79, 0x41, 0x63, 0x6b, 0x22, 0x00, 0x28, 0x01, 0x12, 0x36, 0x0a,
+	0x0d, 0x55, 0x70, 0x6c, 0x6f, 0x61, 0x64, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x73, 0x12, 0x10,
+	0x2e, 0x72, 0x70, 0x63, 0x2e, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x42, 0x61, 0x74, 0x63, 0x68,
+	0x1a, 0x11, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x54, 0x65, 0x6c, 0x65, 0x6d, 0x65, 0x74, 0x72, 0x79,
+	0x41, 0x63, 0x6b, 0x22, 0x00, 0x42, 0x0b, 0x5a, 0x09, 0x2e, 0x2f, 0x70, 0x6b, 0x67, 0x2f, 0x72,
+	0x70, 0x63, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -979,53 +2400,93 @@ func file_protobuf_agent_message_proto_rawDescGZIP() []byte {
 	return file_protobuf_agent_message_proto_rawDescData
 }
 
-var file_protobuf_agent_message_proto_msgTypes = make([]protoimpl.MessageInfo, 14)
+var file_protobuf_agent_message_proto_msgTypes = make([]protoimpl.MessageInfo, 31)
 var file_protobuf_agent_message_proto_goTypes = []interface{}{
-	(*EventCode1)(nil),     // 0: rpc.EventCode1
-	(*EventCode3)(nil),     // 1: rpc.EventCode3
-	(*EventCode7)(nil),     // 2: rpc.EventCode7
-	(*EventCode8)(nil),     // 3: rpc.EventCode8
-	(*EventCode9)(nil),     // 4: rpc.EventCode9
-	(*EventCode10)(nil),    // 5: rpc.EventCode10
-	(*EventCode11)(nil),    // 6: rpc.EventCode11
-	(*EventCode12)(nil),    // 7: rpc.EventCode12
-	(*EventCode13)(nil),    // 8: rpc.EventCode13
-	(*EventCode14)(nil),    // 9: rpc.EventCode14
-	(*NetworkAdapter)(nil), // 10: rpc.NetworkAdapter
-	(*ResponseResult)(nil), // 11: rpc.ResponseResult
-	(*FileInfo)(nil),       // 12: rpc.FileInfo
-	(*FileData)(nil),       // 13: rpc.FileData
+	(*EventCode1)(nil),         // 0: rpc.EventCode1
+	(*EventCode3)(nil),         // 1: rpc.EventCode3
+	(*EventCode7)(nil),         // 2: rpc.EventCode7
+	(*EventCode8)(nil),         // 3: rpc.EventCode8
+	(*EventCode9)(nil),         // 4: rpc.EventCode9
+	(*EventCode10)(nil),        // 5: rpc.EventCode10
+	(*EventCode11)(nil),        // 6: rpc.EventCode11
+	(*EventCode12)(nil),        // 7: rpc.EventCode12
+	(*EventCode13)(nil),        // 8: rpc.EventCode13
+	(*EventCode14)(nil),        // 9: rpc.EventCode14
+	(*NetworkAdapter)(nil),     // 10: rpc.NetworkAdapter
+	(*ResponseResult)(nil),     // 11: rpc.ResponseResult
+	(*FileInfo)(nil),           // 12: rpc.FileInfo
+	(*FileMeta)(nil),           // 13: rpc.FileMeta
+	(*CollectInfo)(nil),        // 14: rpc.CollectInfo
+	(*FileData)(nil),           // 15: rpc.FileData
+	(*QuarantineQuery)(nil),    // 16: rpc.QuarantineQuery
+	(*QuarantineItem)(nil),     // 17: rpc.QuarantineItem
+	(*QuarantineList)(nil),     // 18: rpc.QuarantineList
+	(*TriageQuery)(nil),        // 19: rpc.TriageQuery
+	(*TriageSnapshot)(nil),     // 20: rpc.TriageSnapshot
+	(*LocalRuleSet)(nil),       // 21: rpc.LocalRuleSet
+	(*ActionHistoryQuery)(nil), // 22: rpc.ActionHistoryQuery
+	(*ActionRecord)(nil),       // 23: rpc.ActionRecord
+	(*ActionHistory)(nil),      // 24: rpc.ActionHistory
+	(*AgentProfile)(nil),       // 25: rpc.AgentProfile
+	(*ConfigQuery)(nil),        // 26: rpc.ConfigQuery
+	(*AgentConfigView)(nil),    // 27: rpc.AgentConfigView
+	(*EventBatch)(nil),         // 28: rpc.EventBatch
+	(*TelemetryAck)(nil),       // 29: rpc.TelemetryAck
+	(*ResultBatch)(nil),        // 30: rpc.ResultBatch
 }
 var file_protobuf_agent_message_proto_depIdxs = []int32{
-	0,  // 0: rpc.Manager.ManagerEventCode1:input_type -> rpc.EventCode1
-	1,  // 1: rpc.Manager.ManagerEventCode3:input_type -> rpc.EventCode3
-	2,  // 2: rpc.Manager.ManagerEventCode7:input_type -> rpc.EventCode7
-	3,  // 3: rpc.Manager.ManagerEventCode8:input_type -> rpc.EventCode8
-	4,  // 4: rpc.Manager.ManagerEventCode9:input_type -> rpc.EventCode9
-	5,  // 5: rpc.Manager.ManagerEventCode10:input_type -> rpc.EventCode10
-	6,  // 6: rpc.Manager.ManagerEventCode11:input_type -> rpc.EventCode11
-	7,  // 7: rpc.Manager.ManagerEventCode12:input_type -> rpc.EventCode12
-	8,  // 8: rpc.Manager.ManagerEventCode13:input_type -> rpc.EventCode13
-	9,  // 9: rpc.Manager.ManagerEventCode14:input_type -> rpc.EventCode14
-	10, // 10: rpc.Manager.ManagerNetworkAdapter:input_type -> rpc.NetworkAdapter
-	12, // 11: rpc.Manager.ManagerGetFile:input_type -> rpc.FileInfo
-	11, // 12: rpc.Manager.ManagerEventCode1:output_type -> rpc.ResponseResult
-	11, // 13: rpc.Manager.ManagerEventCode3:output_type -> rpc.ResponseResult
-	11, // 14: rpc.Manager.ManagerEventCode7:output_type -> rpc.ResponseResult
-	11, // 15: rpc.Manager.ManagerEventCode8:output_type -> rpc.ResponseResult
-	11, // 16: rpc.Manager.ManagerEventCode9:output_type -> rpc.ResponseResult
-	11, // 17: rpc.Manager.ManagerEventCode10:output_type -> rpc.ResponseResult
-	11, // 18: rpc.Manager.ManagerEventCode11:output_type -> rpc.ResponseResult
-	11, // 19: rpc.Manager.ManagerEventCode12:output_type -> rpc.ResponseResult
-	11, // 20: rpc.Manager.ManagerEventCode13:output_type -> rpc.ResponseResult
-	11, // 21: rpc.Manager.ManagerEventCode14:output_type -> rpc.ResponseResult
-	11, // 22: rpc.Manager.ManagerNetworkAdapter:output_type -> rpc.ResponseResult
-	13, // 23: rpc.Manager.ManagerGetFile:output_type -> rpc.FileData
-	12, // [12:24] is the sub-list for method output_type
-	0,  // [0:12] is the sub-list for method input_type
-	0,  // [0:0] is the sub-list for extension type_name
-	0,  // [0:0] is the sub-list for extension extendee
-	0,  // [0:0] is the sub-list for field type_name
+	13, // 0: rpc.FileData.Meta:type_name -> rpc.FileMeta
+	17, // 1: rpc.QuarantineList.Items:type_name -> rpc.QuarantineItem
+	23, // 2: rpc.ActionHistory.Records:type_name -> rpc.ActionRecord
+	0,  // 3: rpc.Manager.ManagerEventCode1:input_type -> rpc.EventCode1
+	1,  // 4: rpc.Manager.ManagerEventCode3:input_type -> rpc.EventCode3
+	2,  // 5: rpc.Manager.ManagerEventCode7:input_type -> rpc.EventCode7
+	3,  // 6: rpc.Manager.ManagerEventCode8:input_type -> rpc.EventCode8
+	4,  // 7: rpc.Manager.ManagerEventCode9:input_type -> rpc.EventCode9
+	5,  // 8: rpc.Manager.ManagerEventCode10:input_type -> rpc.EventCode10
+	6,  // 9: rpc.Manager.ManagerEventCode11:input_type -> rpc.EventCode11
+	7,  // 10: rpc.Manager.ManagerEventCode12:input_type -> rpc.EventCode12
+	8,  // 11: rpc.Manager.ManagerEventCode13:input_type -> rpc.EventCode13
+	9,  // 12: rpc.Manager.ManagerEventCode14:input_type -> rpc.EventCode14
+	10, // 13: rpc.Manager.ManagerNetworkAdapter:input_type -> rpc.NetworkAdapter
+	12, // 14: rpc.Manager.ManagerGetFile:input_type -> rpc.FileInfo
+	16, // 15: rpc.Manager.ManagerListQuarantine:input_type -> rpc.QuarantineQuery
+	14, // 16: rpc.Manager.ManagerCollect:input_type -> rpc.CollectInfo
+	15, // 17: rpc.Manager.ManagerPutFile:input_type -> rpc.FileData
+	19, // 18: rpc.Manager.ManagerTriage:input_type -> rpc.TriageQuery
+	21, // 19: rpc.Manager.ManagerLocalRules:input_type -> rpc.LocalRuleSet
+	22, // 20: rpc.Manager.GetActionHistory:input_type -> rpc.ActionHistoryQuery
+	25, // 21: rpc.Manager.SetConfig:input_type -> rpc.AgentProfile
+	26, // 22: rpc.Manager.GetConfig:input_type -> rpc.ConfigQuery
+	28, // 23: rpc.Telemetry.TelemetryStream:input_type -> rpc.EventBatch
+	30, // 24: rpc.Telemetry.UploadResults:input_type -> rpc.ResultBatch
+	11, // 25: rpc.Manager.ManagerEventCode1:output_type -> rpc.ResponseResult
+	11, // 26: rpc.Manager.ManagerEventCode3:output_type -> rpc.ResponseResult
+	11, // 27: rpc.Manager.ManagerEventCode7:output_type -> rpc.ResponseResult
+	11, // 28: rpc.Manager.ManagerEventCode8:output_type -> rpc.ResponseResult
+	11, // 29: rpc.Manager.ManagerEventCode9:output_type -> rpc.ResponseResult
+	11, // 30: rpc.Manager.ManagerEventCode10:output_type -> rpc.ResponseResult
+	11, // 31: rpc.Manager.ManagerEventCode11:output_type -> rpc.ResponseResult
+	11, // 32: rpc.Manager.ManagerEventCode12:output_type -> rpc.ResponseResult
+	11, // 33: rpc.Manager.ManagerEventCode13:output_type -> rpc.ResponseResult
+	11, // 34: rpc.Manager.ManagerEventCode14:output_type -> rpc.ResponseResult
+	11, // 35: rpc.Manager.ManagerNetworkAdapter:output_type -> rpc.ResponseResult
+	15, // 36: rpc.Manager.ManagerGetFile:output_type -> rpc.FileData
+	18, // 37: rpc.Manager.ManagerListQuarantine:output_type -> rpc.QuarantineList
+	15, // 38: rpc.Manager.ManagerCollect:output_type -> rpc.FileData
+	11, // 39: rpc.Manager.ManagerPutFile:output_type -> rpc.ResponseResult
+	20, // 40: rpc.Manager.ManagerTriage:output_type -> rpc.TriageSnapshot
+	11, // 41: rpc.Manager.ManagerLocalRules:output_type -> rpc.ResponseResult
+	24, // 42: rpc.Manager.GetActionHistory:output_type -> rpc.ActionHistory
+	11, // 43: rpc.Manager.SetConfig:output_type -> rpc.ResponseResult
+	27, // 44: rpc.Manager.GetConfig:output_type -> rpc.AgentConfigView
+	29, // 45: rpc.Telemetry.TelemetryStream:output_type -> rpc.TelemetryAck
+	29, // 46: rpc.Telemetry.UploadResults:output_type -> rpc.TelemetryAck
+	25, // [25:47] is the sub-list for method output_type
+	3,  // [3:25] is the sub-list for method input_type
+	3,  // [3:3] is the sub-list for extension type_name
+	3,  // [3:3] is the sub-list for extension extendee
+	0,  // [0:3] is the sub-list for field type_name
 }
 
 func init() { file_protobuf_agent_message_proto_init() }
@@ -1046,8 +2507,92 @@ func file_protobuf_agent_message_proto_init() {
 				return nil
 			}
 		}
-		file_protobuf_agent_message_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*EventCode3); i {
+		file_protobuf_agent_message_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*EventCode3); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_protobuf_agent_message_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*EventCode7); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_protobuf_agent_message_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*EventCode8); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_protobuf_agent_message_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*EventCode9); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_protobuf_agent_message_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*EventCode10); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_protobuf_agent_message_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*EventCode11); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_protobuf_agent_message_proto_msgTypes[7].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*EventCode12); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_protobuf_agent_message_proto_msgTypes[8].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*EventCode13); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -1058,8 +2603,8 @@ func file_protobuf_agent_message_proto_init() {
 				return nil
 			}
 		}
-		file_protobuf_agent_message_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*EventCode7); i {
+		file_protobuf_agent_message_proto_msgTypes[9].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*EventCode14); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -1070,8 +2615,8 @@ func file_protobuf_agent_message_proto_init() {
 				return nil
 			}
 		}
-		file_protobuf_agent_message_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*EventCode8); i {
+		file_protobuf_agent_message_proto_msgTypes[10].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*NetworkAdapter); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -1082,8 +2627,8 @@ func file_protobuf_agent_message_proto_init() {
 				return nil
 			}
 		}
-		file_protobuf_agent_message_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*EventCode9); i {
+		file_protobuf_agent_message_proto_msgTypes[11].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ResponseResult); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -1094,8 +2639,8 @@ func file_protobuf_agent_message_proto_init() {
 				return nil
 			}
 		}
-		file_protobuf_agent_message_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*EventCode10); i {
+		file_protobuf_agent_message_proto_msgTypes[12].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*FileInfo); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -1106,8 +2651,8 @@ func file_protobuf_agent_message_proto_init() {
 				return nil
 			}
 		}
-		file_protobuf_agent_message_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*EventCode11); i {
+		file_protobuf_agent_message_proto_msgTypes[13].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*FileMeta); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -1118,8 +2663,8 @@ func file_protobuf_agent_message_proto_init() {
 				return nil
 			}
 		}
-		file_protobuf_agent_message_proto_msgTypes[7].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*EventCode12); i {
+		file_protobuf_agent_message_proto_msgTypes[14].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*CollectInfo); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -1130,8 +2675,8 @@ func file_protobuf_agent_message_proto_init() {
 				return nil
 			}
 		}
-		file_protobuf_agent_message_proto_msgTypes[8].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*EventCode13); i {
+		file_protobuf_agent_message_proto_msgTypes[15].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*FileData); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -1142,8 +2687,8 @@ func file_protobuf_agent_message_proto_init() {
 				return nil
 			}
 		}
-		file_protobuf_agent_message_proto_msgTypes[9].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*EventCode14); i {
+		file_protobuf_agent_message_proto_msgTypes[16].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*QuarantineQuery); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -1154,8 +2699,8 @@ func file_protobuf_agent_message_proto_init() {
 				return nil
 			}
 		}
-		file_protobuf_agent_message_proto_msgTypes[10].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*NetworkAdapter); i {
+		file_protobuf_agent_message_proto_msgTypes[17].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*QuarantineItem); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -1166,8 +2711,8 @@ func file_protobuf_agent_message_proto_init() {
 				return nil
 			}
 		}
-		file_protobuf_agent_message_proto_msgTypes[11].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*ResponseResult); i {
+		file_protobuf_agent_message_proto_msgTypes[18].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*QuarantineList); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -1178,8 +2723,8 @@ func file_protobuf_agent_message_proto_init() {
 				return nil
 			}
 		}
-		file_protobuf_agent_message_proto_msgTypes[12].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*FileInfo); i {
+		file_protobuf_agent_message_proto_msgTypes[19].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*TriageQuery); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -1190,8 +2735,128 @@ func file_protobuf_agent_message_proto_init() {
 				return nil
 			}
 		}
-		file_protobuf_agent_message_proto_msgTypes[13].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*FileData); i {
+		file_protobuf_agent_message_proto_msgTypes[20].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*TriageSnapshot); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_protobuf_agent_message_proto_msgTypes[21].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*LocalRuleSet); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_protobuf_agent_message_proto_msgTypes[22].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ActionHistoryQuery); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_protobuf_agent_message_proto_msgTypes[23].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ActionRecord); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_protobuf_agent_message_proto_msgTypes[24].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ActionHistory); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_protobuf_agent_message_proto_msgTypes[25].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*AgentProfile); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_protobuf_agent_message_proto_msgTypes[26].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ConfigQuery); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_protobuf_agent_message_proto_msgTypes[27].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*AgentConfigView); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_protobuf_agent_message_proto_msgTypes[28].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*EventBatch); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_protobuf_agent_message_proto_msgTypes[29].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*TelemetryAck); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_protobuf_agent_message_proto_msgTypes[30].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ResultBatch); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -1209,9 +2874,9 @@ func file_protobuf_agent_message_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_protobuf_agent_message_proto_rawDesc,
 			NumEnums:      0,
-			NumMessages:   14,
+			NumMessages:   31,
 			NumExtensions: 0,
-			NumServices:   1,
+			NumServices:   2,
 		},
 		GoTypes:           file_protobuf_agent_message_proto_goTypes,
 		DependencyIndexes: file_protobuf_agent_message_proto_depIdxs,
@@ -1260,6 +2925,26 @@ type ManagerClient interface {
 	// Obtains the FileDatas available within the given FileInfo.
 	// Results are streamed rather than returned at once
 	ManagerGetFile(ctx context.Context, in *FileInfo, opts ...grpc.CallOption) (Manager_ManagerGetFileClient, error)
+	// Obtains the QuarantineList of quarantined files on agent
+	ManagerListQuarantine(ctx context.Context, in *QuarantineQuery, opts ...grpc.CallOption) (*QuarantineList, error)
+	// Obtains the FileDatas of an archive of the files within the given
+	// CollectInfo. Results are streamed rather than returned at once
+	ManagerCollect(ctx context.Context, in *CollectInfo, opts ...grpc.CallOption) (Manager_ManagerCollectClient, error)
+	// Accepts a stream of FileDatas to write a file on agent, the first
+	// message is the FileMeta of destination, and returns a ResponseResult
+	ManagerPutFile(ctx context.Context, opts ...grpc.CallOption) (Manager_ManagerPutFileClient, error)
+	// Obtains the TriageSnapshot of agent at a given TriageQuery
+	ManagerTriage(ctx context.Context, in *TriageQuery, opts ...grpc.CallOption) (*TriageSnapshot, error)
+	// Replaces the local rules of agent with the given LocalRuleSet
+	ManagerLocalRules(ctx context.Context, in *LocalRuleSet, opts ...grpc.CallOption) (*ResponseResult, error)
+	// Obtains the ActionHistory of the action journal of agent at a given
+	// ActionHistoryQuery
+	GetActionHistory(ctx context.Context, in *ActionHistoryQuery, opts ...grpc.CallOption) (*ActionHistory, error)
+	// Applies the given AgentProfile over the agent config, and returns a
+	// ResponseResult
+	SetConfig(ctx context.Context, in *AgentProfile, opts ...grpc.CallOption) (*ResponseResult, error)
+	// Obtains the AgentConfigView of the effective config of agent
+	GetConfig(ctx context.Context, in *ConfigQuery, opts ...grpc.CallOption) (*AgentConfigView, error)
 }
 
 type managerClient struct {
@@ -1351,54 +3036,174 @@ func (c *managerClient) ManagerEventCode13(ctx context.Context, in *EventCode13,
 	return out, nil
 }
 
-func (c *managerClient) ManagerEventCode14(ctx context.Context, in *EventCode14, opts ...grpc.CallOption) (*ResponseResult, error) {
+func (c *managerClient) ManagerEventCode14(ctx context.Context, in *EventCode14, opts ...grpc.CallOption) (*ResponseResult, error) {
+	out := new(ResponseResult)
+	err := c.cc.Invoke(ctx, "/rpc.Manager/ManagerEventCode14", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *managerClient) ManagerNetworkAdapter(ctx context.Context, in *NetworkAdapter, opts ...grpc.CallOption) (*ResponseResult, error) {
+	out := new(ResponseResult)
+	err := c.cc.Invoke(ctx, "/rpc.Manager/ManagerNetworkAdapter", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *managerClient) ManagerGetFile(ctx context.Context, in *FileInfo, opts ...grpc.CallOption) (Manager_ManagerGetFileClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Manager_serviceDesc.Streams[0], "/rpc.Manager/ManagerGetFile", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &managerManagerGetFileClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Manager_ManagerGetFileClient interface {
+	Recv() (*FileData, error)
+	grpc.ClientStream
+}
+
+type managerManagerGetFileClient struct {
+	grpc.ClientStream
+}
+
+func (x *managerManagerGetFileClient) Recv() (*FileData, error) {
+	m := new(FileData)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *managerClient) ManagerListQuarantine(ctx context.Context, in *QuarantineQuery, opts ...grpc.CallOption) (*QuarantineList, error) {
+	out := new(QuarantineList)
+	err := c.cc.Invoke(ctx, "/rpc.Manager/ManagerListQuarantine", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *managerClient) ManagerCollect(ctx context.Context, in *CollectInfo, opts ...grpc.CallOption) (Manager_ManagerCollectClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Manager_serviceDesc.Streams[1], "/rpc.Manager/ManagerCollect", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &managerManagerCollectClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Manager_ManagerCollectClient interface {
+	Recv() (*FileData, error)
+	grpc.ClientStream
+}
+
+type managerManagerCollectClient struct {
+	grpc.ClientStream
+}
+
+func (x *managerManagerCollectClient) Recv() (*FileData, error) {
+	m := new(FileData)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *managerClient) ManagerPutFile(ctx context.Context, opts ...grpc.CallOption) (Manager_ManagerPutFileClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Manager_serviceDesc.Streams[2], "/rpc.Manager/ManagerPutFile", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &managerManagerPutFileClient{stream}
+	return x, nil
+}
+
+type Manager_ManagerPutFileClient interface {
+	Send(*FileData) error
+	CloseAndRecv() (*ResponseResult, error)
+	grpc.ClientStream
+}
+
+type managerManagerPutFileClient struct {
+	grpc.ClientStream
+}
+
+func (x *managerManagerPutFileClient) Send(m *FileData) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *managerManagerPutFileClient) CloseAndRecv() (*ResponseResult, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(ResponseResult)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *managerClient) ManagerTriage(ctx context.Context, in *TriageQuery, opts ...grpc.CallOption) (*TriageSnapshot, error) {
+	out := new(TriageSnapshot)
+	err := c.cc.Invoke(ctx, "/rpc.Manager/ManagerTriage", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *managerClient) ManagerLocalRules(ctx context.Context, in *LocalRuleSet, opts ...grpc.CallOption) (*ResponseResult, error) {
 	out := new(ResponseResult)
-	err := c.cc.Invoke(ctx, "/rpc.Manager/ManagerEventCode14", in, out, opts...)
+	err := c.cc.Invoke(ctx, "/rpc.Manager/ManagerLocalRules", in, out, opts...)
 	if err != nil {
 		return nil, err
 	}
 	return out, nil
 }
 
-func (c *managerClient) ManagerNetworkAdapter(ctx context.Context, in *NetworkAdapter, opts ...grpc.CallOption) (*ResponseResult, error) {
-	out := new(ResponseResult)
-	err := c.cc.Invoke(ctx, "/rpc.Manager/ManagerNetworkAdapter", in, out, opts...)
+func (c *managerClient) GetActionHistory(ctx context.Context, in *ActionHistoryQuery, opts ...grpc.CallOption) (*ActionHistory, error) {
+	out := new(ActionHistory)
+	err := c.cc.Invoke(ctx, "/rpc.Manager/GetActionHistory", in, out, opts...)
 	if err != nil {
 		return nil, err
 	}
 	return out, nil
 }
 
-func (c *managerClient) ManagerGetFile(ctx context.Context, in *FileInfo, opts ...grpc.CallOption) (Manager_ManagerGetFileClient, error) {
-	stream, err := c.cc.NewStream(ctx, &_Manager_serviceDesc.Streams[0], "/rpc.Manager/ManagerGetFile", opts...)
+func (c *managerClient) SetConfig(ctx context.Context, in *AgentProfile, opts ...grpc.CallOption) (*ResponseResult, error) {
+	out := new(ResponseResult)
+	err := c.cc.Invoke(ctx, "/rpc.Manager/SetConfig", in, out, opts...)
 	if err != nil {
 		return nil, err
 	}
-	x := &managerManagerGetFileClient{stream}
-	if err := x.ClientStream.SendMsg(in); err != nil {
-		return nil, err
-	}
-	if err := x.ClientStream.CloseSend(); err != nil {
-		return nil, err
-	}
-	return x, nil
-}
-
-type Manager_ManagerGetFileClient interface {
-	Recv() (*FileData, error)
-	grpc.ClientStream
-}
-
-type managerManagerGetFileClient struct {
-	grpc.ClientStream
+	return out, nil
 }
 
-func (x *managerManagerGetFileClient) Recv() (*FileData, error) {
-	m := new(FileData)
-	if err := x.ClientStream.RecvMsg(m); err != nil {
+func (c *managerClient) GetConfig(ctx context.Context, in *ConfigQuery, opts ...grpc.CallOption) (*AgentConfigView, error) {
+	out := new(AgentConfigView)
+	err := c.cc.Invoke(ctx, "/rpc.Manager/GetConfig", in, out, opts...)
+	if err != nil {
 		return nil, err
 	}
-	return m, nil
+	return out, nil
 }
 
 // ManagerServer is the server API for Manager service.
@@ -1428,6 +3233,26 @@ type ManagerServer interface {
 	// Obtains the FileDatas available within the given FileInfo.
 	// Results are streamed rather than returned at once
 	ManagerGetFile(*FileInfo, Manager_ManagerGetFileServer) error
+	// Obtains the QuarantineList of quarantined files on agent
+	ManagerListQuarantine(context.Context, *QuarantineQuery) (*QuarantineList, error)
+	// Obtains the FileDatas of an archive of the files within the given
+	// CollectInfo. Results are streamed rather than returned at once
+	ManagerCollect(*CollectInfo, Manager_ManagerCollectServer) error
+	// Accepts a stream of FileDatas to write a file on agent, the first
+	// message is the FileMeta of destination, and returns a ResponseResult
+	ManagerPutFile(Manager_ManagerPutFileServer) error
+	// Obtains the TriageSnapshot of agent at a given TriageQuery
+	ManagerTriage(context.Context, *TriageQuery) (*TriageSnapshot, error)
+	// Replaces the local rules of agent with the given LocalRuleSet
+	ManagerLocalRules(context.Context, *LocalRuleSet) (*ResponseResult, error)
+	// Obtains the ActionHistory of the action journal of agent at a given
+	// ActionHistoryQuery
+	GetActionHistory(context.Context, *ActionHistoryQuery) (*ActionHistory, error)
+	// Applies the given AgentProfile over the agent config, and returns a
+	// ResponseResult
+	SetConfig(context.Context, *AgentProfile) (*ResponseResult, error)
+	// Obtains the AgentConfigView of the effective config of agent
+	GetConfig(context.Context, *ConfigQuery) (*AgentConfigView, error)
 }
 
 // UnimplementedManagerServer can be embedded to have forward compatible implementations.
@@ -1470,6 +3295,30 @@ func (*UnimplementedManagerServer) ManagerNetworkAdapter(context.Context, *Netwo
 func (*UnimplementedManagerServer) ManagerGetFile(*FileInfo, Manager_ManagerGetFileServer) error {
 	return status.Errorf(codes.Unimplemented, "method ManagerGetFile not implemented")
 }
+func (*UnimplementedManagerServer) ManagerListQuarantine(context.Context, *QuarantineQuery) (*QuarantineList, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ManagerListQuarantine not implemented")
+}
+func (*UnimplementedManagerServer) ManagerCollect(*CollectInfo, Manager_ManagerCollectServer) error {
+	return status.Errorf(codes.Unimplemented, "method ManagerCollect not implemented")
+}
+func (*UnimplementedManagerServer) ManagerPutFile(Manager_ManagerPutFileServer) error {
+	return status.Errorf(codes.Unimplemented, "method ManagerPutFile not implemented")
+}
+func (*UnimplementedManagerServer) ManagerTriage(context.Context, *TriageQuery) (*TriageSnapshot, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ManagerTriage not implemented")
+}
+func (*UnimplementedManagerServer) ManagerLocalRules(context.Context, *LocalRuleSet) (*ResponseResult, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ManagerLocalRules not implemented")
+}
+func (*UnimplementedManagerServer) GetActionHistory(context.Context, *ActionHistoryQuery) (*ActionHistory, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetActionHistory not implemented")
+}
+func (*UnimplementedManagerServer) SetConfig(context.Context, *AgentProfile) (*ResponseResult, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetConfig not implemented")
+}
+func (*UnimplementedManagerServer) GetConfig(context.Context, *ConfigQuery) (*AgentConfigView, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetConfig not implemented")
+}
 
 func RegisterManagerServer(s *grpc.Server, srv ManagerServer) {
 	s.RegisterService(&_Manager_serviceDesc, srv)
@@ -1694,6 +3543,161 @@ func (x *managerManagerGetFileServer) Send(m *FileData) error {
 	return x.ServerStream.SendMsg(m)
 }
 
+func _Manager_ManagerListQuarantine_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(QuarantineQuery)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ManagerServer).ManagerListQuarantine(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/rpc.Manager/ManagerListQuarantine",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ManagerServer).ManagerListQuarantine(ctx, req.(*QuarantineQuery))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Manager_ManagerCollect_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(CollectInfo)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ManagerServer).ManagerCollect(m, &managerManagerCollectServer{stream})
+}
+
+type Manager_ManagerCollectServer interface {
+	Send(*FileData) error
+	grpc.ServerStream
+}
+
+type managerManagerCollectServer struct {
+	grpc.ServerStream
+}
+
+func (x *managerManagerCollectServer) Send(m *FileData) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Manager_ManagerPutFile_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ManagerServer).ManagerPutFile(&managerManagerPutFileServer{stream})
+}
+
+type Manager_ManagerPutFileServer interface {
+	SendAndClose(*ResponseResult) error
+	Recv() (*FileData, error)
+	grpc.ServerStream
+}
+
+type managerManagerPutFileServer struct {
+	grpc.ServerStream
+}
+
+func (x *managerManagerPutFileServer) SendAndClose(m *ResponseResult) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *managerManagerPutFileServer) Recv() (*FileData, error) {
+	m := new(FileData)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _Manager_ManagerTriage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TriageQuery)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ManagerServer).ManagerTriage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/rpc.Manager/ManagerTriage",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ManagerServer).ManagerTriage(ctx, req.(*TriageQuery))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Manager_ManagerLocalRules_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LocalRuleSet)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ManagerServer).ManagerLocalRules(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/rpc.Manager/ManagerLocalRules",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ManagerServer).ManagerLocalRules(ctx, req.(*LocalRuleSet))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Manager_GetActionHistory_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ActionHistoryQuery)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ManagerServer).GetActionHistory(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/rpc.Manager/GetActionHistory",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ManagerServer).GetActionHistory(ctx, req.(*ActionHistoryQuery))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Manager_SetConfig_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AgentProfile)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ManagerServer).SetConfig(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/rpc.Manager/SetConfig",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ManagerServer).SetConfig(ctx, req.(*AgentProfile))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Manager_GetConfig_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ConfigQuery)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ManagerServer).GetConfig(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/rpc.Manager/GetConfig",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ManagerServer).GetConfig(ctx, req.(*ConfigQuery))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _Manager_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "rpc.Manager",
 	HandlerType: (*ManagerServer)(nil),
@@ -1742,6 +3746,30 @@ var _Manager_serviceDesc = grpc.ServiceDesc{
 			MethodName: "ManagerNetworkAdapter",
 			Handler:    _Manager_ManagerNetworkAdapter_Handler,
 		},
+		{
+			MethodName: "ManagerListQuarantine",
+			Handler:    _Manager_ManagerListQuarantine_Handler,
+		},
+		{
+			MethodName: "ManagerTriage",
+			Handler:    _Manager_ManagerTriage_Handler,
+		},
+		{
+			MethodName: "ManagerLocalRules",
+			Handler:    _Manager_ManagerLocalRules_Handler,
+		},
+		{
+			MethodName: "GetActionHistory",
+			Handler:    _Manager_GetActionHistory_Handler,
+		},
+		{
+			MethodName: "SetConfig",
+			Handler:    _Manager_SetConfig_Handler,
+		},
+		{
+			MethodName: "GetConfig",
+			Handler:    _Manager_GetConfig_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -1749,6 +3777,167 @@ var _Manager_serviceDesc = grpc.ServiceDesc{
 			Handler:       _Manager_ManagerGetFile_Handler,
 			ServerStreams: true,
 		},
+		{
+			StreamName:    "ManagerCollect",
+			Handler:       _Manager_ManagerCollect_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "ManagerPutFile",
+			Handler:       _Manager_ManagerPutFile_Handler,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "protobuf/agent.message.proto",
+}
+
+// TelemetryClient is the client API for Telemetry service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type TelemetryClient interface {
+	// Accepts a stream of EventBatches of agent, the events are compared
+	// with the rules of server, and returns a TelemetryAck
+	TelemetryStream(ctx context.Context, opts ...grpc.CallOption) (Telemetry_TelemetryStreamClient, error)
+	// Accepts the results of the local responses of agent, and returns a
+	// TelemetryAck
+	UploadResults(ctx context.Context, in *ResultBatch, opts ...grpc.CallOption) (*TelemetryAck, error)
+}
+
+type telemetryClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewTelemetryClient(cc grpc.ClientConnInterface) TelemetryClient {
+	return &telemetryClient{cc}
+}
+
+func (c *telemetryClient) TelemetryStream(ctx context.Context, opts ...grpc.CallOption) (Telemetry_TelemetryStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Telemetry_serviceDesc.Streams[0], "/rpc.Telemetry/TelemetryStream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &telemetryTelemetryStreamClient{stream}
+	return x, nil
+}
+
+type Telemetry_TelemetryStreamClient interface {
+	Send(*EventBatch) error
+	CloseAndRecv() (*TelemetryAck, error)
+	grpc.ClientStream
+}
+
+type telemetryTelemetryStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *telemetryTelemetryStreamClient) Send(m *EventBatch) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *telemetryTelemetryStreamClient) CloseAndRecv() (*TelemetryAck, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(TelemetryAck)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *telemetryClient) UploadResults(ctx context.Context, in *ResultBatch, opts ...grpc.CallOption) (*TelemetryAck, error) {
+	out := new(TelemetryAck)
+	err := c.cc.Invoke(ctx, "/rpc.Telemetry/UploadResults", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// TelemetryServer is the server API for Telemetry service.
+type TelemetryServer interface {
+	// Accepts a stream of EventBatches of agent, the events are compared
+	// with the rules of server, and returns a TelemetryAck
+	TelemetryStream(Telemetry_TelemetryStreamServer) error
+	// Accepts the results of the local responses of agent, and returns a
+	// TelemetryAck
+	UploadResults(context.Context, *ResultBatch) (*TelemetryAck, error)
+}
+
+// UnimplementedTelemetryServer can be embedded to have forward compatible implementations.
+type UnimplementedTelemetryServer struct {
+}
+
+func (*UnimplementedTelemetryServer) TelemetryStream(Telemetry_TelemetryStreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method TelemetryStream not implemented")
+}
+func (*UnimplementedTelemetryServer) UploadResults(context.Context, *ResultBatch) (*TelemetryAck, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UploadResults not implemented")
+}
+
+func RegisterTelemetryServer(s *grpc.Server, srv TelemetryServer) {
+	s.RegisterService(&_Telemetry_serviceDesc, srv)
+}
+
+func _Telemetry_TelemetryStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(TelemetryServer).TelemetryStream(&telemetryTelemetryStreamServer{stream})
+}
+
+type Telemetry_TelemetryStreamServer interface {
+	SendAndClose(*TelemetryAck) error
+	Recv() (*EventBatch, error)
+	grpc.ServerStream
+}
+
+type telemetryTelemetryStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *telemetryTelemetryStreamServer) SendAndClose(m *TelemetryAck) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *telemetryTelemetryStreamServer) Recv() (*EventBatch, error) {
+	m := new(EventBatch)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _Telemetry_UploadResults_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ResultBatch)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TelemetryServer).UploadResults(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/rpc.Telemetry/UploadResults",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TelemetryServer).UploadResults(ctx, req.(*ResultBatch))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _Telemetry_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "rpc.Telemetry",
+	HandlerType: (*TelemetryServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "UploadResults",
+			Handler:    _Telemetry_UploadResults_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "TelemetryStream",
+			Handler:       _Telemetry_TelemetryStream_Handler,
+			ClientStreams: true,
+		},
 	},
 	Metadata: "protobuf/agent.message.proto",
 }
@@ -0,0 +1,196 @@
+/**
+ * File:    admin.go
+ *
+ * Summary of File:
+ *
+ * 	This file contains the code related to the admin socket of the bkedr
+ * 	server. The admin socket is a unix socket that only the local
+ *	administrator can open.
+ * 	Functions:
+ * 	Handling the commands received on the admin socket and replying with
+ *	the result of command.
+ * 	Command line of bkedr to send commands to the admin socket:
+ *	bkedr approvals, bkedr approve <id>, bkedr deny <id>,
+ *	bkedr config push [<computer>], bkedr config show <computer>,
+ *	bkedr respond <computer> [-override-protection] Key=Value...
+ */
+
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// This function listens on the admin socket and handles each connection
+// in a new goroutine.
+func StartAdminSocket() {
+
+	// remove the socket of the previous run
+	os.Remove(adminSocketPath)
+	l, err := net.Listen("unix", adminSocketPath)
+	if err != nil {
+		WriteAppLogError("Error listening admin socket: ", err)
+		return
+	}
+	if err := os.Chmod(adminSocketPath, 0600); err != nil {
+		WriteAppLogError(err)
+	}
+	WriteAppLogInfo("Starting admin socket on " + adminSocketPath)
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			WriteAppLogError(err)
+			return
+		}
+		go HandleAdminConn(conn)
+	}
+}
+
+// This function handles one command of admin socket, then writes the
+// command with its Result and ResultInfo back to the connection.
+func HandleAdminConn(conn net.Conn) {
+
+	defer conn.Close()
+	jsonString, _ := bufio.NewReader(conn).ReadString('\n')
+	command := ConvertInterfaceToString(ConvertJsonToInterface(jsonString))
+
+	var err error
+	if _, ok := command["Action Approval"]; ok {
+		err = HandleApproval(command)
+	} else if _, ok := command["Action Config"]; ok {
+		err = HandleAgentConfig(command)
+	} else if _, ok := command["Action Respond"]; ok {
+		err = HandleAdminResponse(command)
+	} else {
+		err = errors.New("Error: command is not supported on admin socket")
+	}
+	if err != nil {
+		command["Result"] = "Failure"
+		command["ResultInfo"] = err.Error()
+	}
+
+	data, _ := json.Marshal(command)
+	conn.Write(append(data, '\n'))
+}
+
+// This function runs the command line of bkedr and returns the exit code.
+// The command is sent to the admin socket of the running server:
+//   - approvals: list pending approvals
+//   - approve <id> -approver <name> [-reason <reason>]
+//   - deny <id> -approver <name> [-reason <reason>]
+//   - config push [<computer>]: push the config profiles to agents
+//   - config show <computer>: show the effective config of agent
+//   - respond <computer> [-override-protection] Key=Value...: send a
+//     response to agent, the override allows actions on protected processes
+//
+// The token of approver is read from -token or BKEDR_APPROVER_TOKEN.
+func RunCommand(args []string) int {
+
+	command := make(map[string]string)
+	switch args[0] {
+	case "approvals":
+		command["Action Approval"] = "list"
+	case "approve", "deny":
+		flags := flag.NewFlagSet(args[0], flag.ContinueOnError)
+		approver := flags.String("approver", "", "name of approver")
+		token := flags.String("token", os.Getenv("BKEDR_APPROVER_TOKEN"), "token of approver")
+		reason := flags.String("reason", "", "reason of decision")
+		if len(args) < 2 || flags.Parse(args[2:]) != nil {
+			fmt.Println("Usage: bkedr " + args[0] + " <id> -approver <name> [-reason <reason>]")
+			return 2
+		}
+		command["Action Approval"] = args[0]
+		command["Id"] = args[1]
+		command["Approver"] = *approver
+		command["Token"] = *token
+		command["Reason"] = *reason
+	case "config":
+		if len(args) < 2 || (args[1] != "push" && args[1] != "show") || (args[1] == "show" && len(args) < 3) {
+			fmt.Println("Usage: bkedr config push [<computer>] | bkedr config show <computer>")
+			return 2
+		}
+		command["Action Config"] = args[1]
+		if len(args) > 2 {
+			command["ComputerName"] = args[2]
+		}
+	case "respond":
+		flags := flag.NewFlagSet(args[0], flag.ContinueOnError)
+		override := flags.Bool("override-protection", false, "allow actions on protected processes")
+		if len(args) < 3 || flags.Parse(args[2:]) != nil || flags.NArg() == 0 {
+			fmt.Println("Usage: bkedr respond <computer> [-override-protection] Key=Value...")
+			return 2
+		}
+		for _, field := range flags.Args() {
+			parts := strings.SplitN(field, "=", 2)
+			if len(parts) != 2 || parts[0] == "" {
+				fmt.Println("Error: " + field + " is not Key=Value")
+				return 2
+			}
+			command[parts[0]] = parts[1]
+		}
+		command["Action Respond"] = "true"
+		command["ComputerName"] = args[1]
+		if *override {
+			command["OverrideProtection"] = "true"
+		}
+	default:
+		fmt.Println("Usage: bkedr [approvals | approve <id> | deny <id> | config push | config show <computer> | respond <computer>]")
+		return 2
+	}
+
+	reply, err := SendAdminCommand(command)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return 1
+	}
+	fmt.Println(reply["ResultInfo"])
+	if reply["DenyReason"] != "" {
+		fmt.Println("DenyReason:", reply["DenyReason"])
+	}
+	if reply["Approvals"] != "" {
+		fmt.Println(reply["Approvals"])
+	}
+	if reply["Config"] != "" {
+		fmt.Println("ConfigPath:", reply["ConfigPath"])
+		fmt.Println("Profile:", reply["Profile"])
+		fmt.Println("Sources:", reply["Sources"])
+		fmt.Println(reply["Config"])
+	}
+	if reply["Result"] != "Success" {
+		return 1
+	}
+	return 0
+}
+
+// This function sends command to the admin socket and returns the reply
+func SendAdminCommand(command map[string]string) (map[string]string, error) {
+
+	conn, err := net.Dial("unix", adminSocketPath)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	data, err := json.Marshal(command)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.Write(append(data, '\n')); err != nil {
+		return nil, err
+	}
+
+	reply := make(map[string]string)
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err != nil {
+		return nil, err
+	}
+	return reply, json.Unmarshal(line, &reply)
+}
@@ -0,0 +1,309 @@
+/**
+ * File:    approval.go
+ *
+ * Summary of File:
+ *
+ * 	This file contains the code related to the human approval of the
+ * 	responses of bkedr server. A rule with RequiresApproval "true" does not
+ *	run its action automatically.
+ * 	Functions:
+ * 	Parking the response as a pending approval and notifying approvers.
+ * 	Approving or denying a pending approval by an authorized approver from
+ *	the splunk server or the admin socket (bkedr approve/deny command).
+ * 	Expiring pending approvals after ApprovalTTL.
+ * 	Every approval, denial and expiration is written to result log with the
+ *	approver.
+ */
+
+package server
+
+import (
+	"bkedr/pkg/rpc"
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// Response waits for an approver
+	APPROVAL_PENDING = "pending"
+	// Response is approved and executed
+	APPROVAL_APPROVED = "approved"
+	// Response is denied by an approver
+	APPROVAL_DENIED = "denied"
+	// Response is not approved before its TTL
+	APPROVAL_EXPIRED = "expired"
+)
+
+// ApproverConfig struct is used to decode json of an approver. TokenSha256
+// is the SHA-256 of the token that the approver sends with a decision.
+type ApproverConfig struct {
+	Name        string `json:"Name"`
+	TokenSha256 string `json:"TokenSha256"`
+}
+
+var (
+	// Approvals of all responses that require approval
+	approvals = make([]map[string]string, 0)
+	// Mutex protects approvals and approvals file
+	approvalMutex sync.Mutex
+)
+
+// This function parks the response objRequest until it is approved. The
+// pending approval is saved, written to result log and sent to the notify
+// url of approvers.
+func ParkApproval(objRequest map[string]string) error {
+
+	// the request is stored to execute it after the approval
+	request, err := json.Marshal(objRequest)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	approval := map[string]string{
+		"Id":           NewId(),
+		"ComputerName": objRequest["ComputerName"],
+		"Action":       objRequest["Action"],
+		"Message":      objRequest["Message"],
+		"Request":      string(request),
+		"CreatedTime":  now.Format("2006-01-02 15:04:05.000"),
+		"ExpireTime":   now.Add(approvalTTL).Format("2006-01-02 15:04:05.000"),
+		"Status":       APPROVAL_PENDING,
+	}
+
+	approvalMutex.Lock()
+	approvals = append(approvals, approval)
+	err = WriteMapString(approvalsPath, approval)
+	approvalMutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// pending result is indexed by splunk, so approvers can be alerted
+	objRequest["ApprovalId"] = approval["Id"]
+	objRequest["ApprovalStatus"] = APPROVAL_PENDING
+	WriteResultStatus(objRequest, "Pending", "Pending approval "+approval["Id"]+
+		" until "+approval["ExpireTime"])
+	WriteAppLogInfo("Success parks " + approval["Action"] + " on " +
+		approval["ComputerName"] + " for approval " + approval["Id"])
+
+	if approvalNotifyUrl != "" {
+		go NotifyApprovers(approval)
+	}
+	return nil
+}
+
+// This function posts the JSON of approval to the notify url of approvers
+func NotifyApprovers(approval map[string]string) {
+
+	data, err := json.Marshal(approval)
+	if err != nil {
+		WriteAppLogError(err)
+		return
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	response, err := client.Post(approvalNotifyUrl, "application/json", bytes.NewReader(data))
+	if err != nil {
+		WriteAppLogError("Error notifies approvers of approval "+approval["Id"]+": ", err)
+		return
+	}
+	response.Body.Close()
+	if response.StatusCode >= 300 {
+		WriteAppLogError("Error notifies approvers of approval "+approval["Id"]+": ",
+			response.Status)
+	}
+}
+
+// This function checks that token belongs to the approver name
+func IsAuthorizedApprover(name string, token string) bool {
+
+	if name == "" || token == "" {
+		return false
+	}
+	hash := sha256.Sum256([]byte(token))
+	tokenSha256 := []byte(hex.EncodeToString(hash[:]))
+	for _, approver := range approvers {
+		if approver.Name == name &&
+			subtle.ConstantTimeCompare(tokenSha256, []byte(approver.TokenSha256)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// This function handles the approval command sent by the administrator and
+// writes the result to result log file. "Action Approval" is one of:
+//   - list: set Approvals of command to the pending approvals
+//   - approve: execute the response of approval Id
+//   - deny: drop the response of approval Id
+//
+// Approve and deny require Approver and Token of an approver of config
+// file, Reason is optional.
+func HandleApproval(command map[string]string) error {
+
+	// token is not written to result log
+	action := command["Action Approval"]
+	token := command["Token"]
+	delete(command, "Token")
+
+	switch action {
+	case "list":
+		approvalMutex.Lock()
+		pending := make([]map[string]string, 0)
+		for _, approval := range approvals {
+			if approval["Status"] == APPROVAL_PENDING {
+				pending = append(pending, approval)
+			}
+		}
+		data, err := json.Marshal(pending)
+		approvalMutex.Unlock()
+		if err != nil {
+			return err
+		}
+		command["Approvals"] = string(data)
+		HandleResult(&rpc.ResponseResult{
+			ResultInfo: "List pending approvals",
+			Result:     true,
+		}, command)
+		return nil
+	case "approve", "deny":
+	default:
+		return errors.New("Error: Action Approval " + action + " is not supported")
+	}
+
+	return DecideApproval(command, action, token)
+}
+
+// This function approves or denies the pending approval Id of command if
+// token belongs to Approver of command. An approved response is executed on
+// the agent with the approver.
+func DecideApproval(command map[string]string, action string, token string) error {
+
+	responseResult := &rpc.ResponseResult{}
+	defer func() { HandleResult(responseResult, command) }()
+
+	approver := command["Approver"]
+	if !IsAuthorizedApprover(approver, token) {
+		responseResult.ResultInfo = "Error: " + approver + " is not an authorized approver"
+		WriteAppLogError("Unauthorized " + action + " of approval " + command["Id"] +
+			" by " + approver)
+		return nil
+	}
+
+	status := APPROVAL_DENIED
+	if action == "approve" {
+		status = APPROVAL_APPROVED
+	}
+	approval, err := SetApprovalStatus(command["Id"], status, map[string]string{
+		"Approver":     approver,
+		"Reason":       command["Reason"],
+		"DecisionTime": FormatCurrentDateMilisecond(),
+	})
+	if err != nil {
+		responseResult.ResultInfo = "Error: " + err.Error()
+		return nil
+	}
+	command["ApprovalStatus"] = status
+	responseResult.Result = true
+	responseResult.ResultInfo = "Approval " + approval["Id"] + " is " + status + " by " + approver
+	if status == APPROVAL_APPROVED {
+		go ExecuteApproval(approval, approver)
+	}
+	return nil
+}
+
+// This function changes the status of pending approval id and adds fields,
+// then saves the approvals. It returns the approval.
+func SetApprovalStatus(id string, status string, fields map[string]string) (map[string]string, error) {
+
+	approvalMutex.Lock()
+	defer approvalMutex.Unlock()
+
+	for _, approval := range approvals {
+		if approval["Id"] != id {
+			continue
+		}
+		if approval["Status"] != APPROVAL_PENDING {
+			return nil, errors.New("approval " + id + " is already " + approval["Status"])
+		}
+		if expireTime, err := ParseDateMilisecond(approval["ExpireTime"]); err == nil &&
+			time.Now().After(expireTime) {
+			return nil, errors.New("approval " + id + " expired at " + approval["ExpireTime"])
+		}
+		approval["Status"] = status
+		for key, value := range fields {
+			approval[key] = value
+		}
+		return approval, WriteSliceMapString(approvalsPath, approvals)
+	}
+	return nil, errors.New("approval " + id + " is not found")
+}
+
+// This function executes the response of approved approval. The result
+// record contains the approval id and the approver.
+func ExecuteApproval(approval map[string]string, approver string) {
+
+	objRequest := make(map[string]string)
+	if err := json.Unmarshal([]byte(approval["Request"]), &objRequest); err != nil {
+		WriteAppLogError("Error executes approval "+approval["Id"]+": ", err)
+		return
+	}
+	objRequest["ApprovalId"] = approval["Id"]
+	objRequest["Approver"] = approver
+
+	clientConn, ok := GetClientConn(approval["ComputerName"])
+	if !ok {
+		WriteNotConnected(objRequest)
+		return
+	}
+	// approvals are parked for the responses of rules, which are limited
+	HandleRespone(clientConn, objRequest, ResponseOptions{Limited: true, Approved: true})
+}
+
+// This function checks the approvals every 30 seconds and expires the
+// pending approvals that are not approved before their TTL.
+func WatchApprovals() {
+	for range time.Tick(30 * time.Second) {
+		ExpireApprovals(time.Now())
+	}
+}
+
+// This function expires the pending approvals whose ExpireTime is before
+// now and writes them to result log.
+func ExpireApprovals(now time.Time) {
+
+	approvalMutex.Lock()
+	expired := make([]map[string]string, 0)
+	for _, approval := range approvals {
+		expireTime, err := ParseDateMilisecond(approval["ExpireTime"])
+		if approval["Status"] == APPROVAL_PENDING && err == nil && now.After(expireTime) {
+			approval["Status"] = APPROVAL_EXPIRED
+			expired = append(expired, approval)
+		}
+	}
+	if len(expired) > 0 {
+		if err := WriteSliceMapString(approvalsPath, approvals); err != nil {
+			WriteAppLogError(err)
+		}
+	}
+	approvalMutex.Unlock()
+
+	for _, approval := range expired {
+		objRequest := make(map[string]string)
+		json.Unmarshal([]byte(approval["Request"]), &objRequest)
+		objRequest["ApprovalId"] = approval["Id"]
+		objRequest["ApprovalStatus"] = APPROVAL_EXPIRED
+		HandleResult(&rpc.ResponseResult{
+			ResultInfo: "Error: Approval " + approval["Id"] + " expired at " +
+				approval["ExpireTime"],
+			Result: false,
+		}, objRequest)
+	}
+}
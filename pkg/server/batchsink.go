@@ -0,0 +1,376 @@
+/**
+ * File:    batchsink.go
+ *
+ * Summary of File:
+ *
+ * 	This file contains the code of the batch sink, that is used by the
+ * 	result sinks that send the results over the network (HEC, syslog,
+ *	webhook, Elasticsearch).
+ * 	Functions:
+ * 	Batching the results, a batch is sent when it has BatchSize results or
+ *	every FlushInterval.
+ * 	Retrying a batch with exponential backoff when the server of sink is
+ *	unreachable or busy.
+ * 	Spooling the batches that are not sent to disk, and sending the spool
+ *	again when the server of sink is reachable.
+ * 	Moving the events that the server of sink rejects to a dead letter
+ *	file, so they do not block the spool.
+ */
+
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// BatchSender is the protocol of a batch sink. Encode returns the event of
+// a result in one line, Send sends the events of a batch and returns
+// whether the error can be retried.
+type BatchSender interface {
+	Encode(result map[string]string) ([]byte, error)
+	Send(batch [][]byte) (bool, error)
+}
+
+// BatchSink struct sends the results with its sender. Results are encoded
+// when they are written and sent in background by Run.
+type BatchSink struct {
+	config        SinkConfig
+	sender        BatchSender
+	flushInterval time.Duration
+	retryBackoff  time.Duration
+	events        chan []byte
+	flushes       chan chan error
+	// Mutex protects spool file
+	spoolMutex sync.Mutex
+}
+
+// This function creates the batch sink of config and sender, and sets the
+// defaults: BatchSize 100, FlushInterval 5s, MaxRetries 3, RetryBackoff 1s,
+// SpoolPath spool/<Name>.spool next to result log file and DeadLetterPath
+// <SpoolPath>.dead.
+func NewBatchSink(config SinkConfig, sender BatchSender) *BatchSink {
+
+	if config.Name == "" {
+		config.Name = config.Type
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 100
+	}
+	if config.MaxRetries < 0 {
+		config.MaxRetries = 0
+	} else if config.MaxRetries == 0 {
+		config.MaxRetries = 3
+	}
+	if config.SpoolPath == "" {
+		config.SpoolPath = filepath.Join(filepath.Dir(resultLogPath), "spool", config.Name+".spool")
+	}
+	if config.DeadLetterPath == "" {
+		config.DeadLetterPath = config.SpoolPath + ".dead"
+	}
+	flushInterval, err := time.ParseDuration(config.FlushInterval)
+	if err != nil || flushInterval <= 0 {
+		flushInterval = 5 * time.Second
+	}
+	retryBackoff, err := time.ParseDuration(config.RetryBackoff)
+	if err != nil || retryBackoff <= 0 {
+		retryBackoff = time.Second
+	}
+
+	return &BatchSink{
+		config:        config,
+		sender:        sender,
+		flushInterval: flushInterval,
+		retryBackoff:  retryBackoff,
+		events:        make(chan []byte, config.BatchSize*10),
+		flushes:       make(chan chan error),
+	}
+}
+
+// This function returns the name of sink
+func (sink *BatchSink) Name() string {
+	return sink.config.Name
+}
+
+// This function starts sending the results in background
+func (sink *BatchSink) Start() {
+	go sink.Run()
+}
+
+// This function encodes the result if it matches the filter of sink and
+// queues it. If the queue is full, because the server of sink is
+// unreachable for a long time, the event is spooled to disk.
+func (sink *BatchSink) WriteResult(result map[string]string) error {
+
+	if !MatchSinkFilter(sink.config, result) {
+		return nil
+	}
+	event, err := sink.sender.Encode(result)
+	if err != nil {
+		return err
+	}
+	select {
+	case sink.events <- event:
+		return nil
+	default:
+		return sink.Spool([][]byte{event})
+	}
+}
+
+// This function sends the queued results now and waits for the result of
+// sending. It is used after Start.
+func (sink *BatchSink) Flush() error {
+	done := make(chan error)
+	sink.flushes <- done
+	return <-done
+}
+
+// This function collects the events in a batch and sends the batch when it
+// is full, every FlushInterval and on Flush. The spool is sent again after
+// a batch is sent.
+func (sink *BatchSink) Run() {
+
+	ticker := time.NewTicker(sink.flushInterval)
+	defer ticker.Stop()
+	batch := make([][]byte, 0, sink.config.BatchSize)
+
+	for {
+		var done chan error
+		select {
+		case event := <-sink.events:
+			batch = append(batch, event)
+			if len(batch) < sink.config.BatchSize {
+				continue
+			}
+		case <-ticker.C:
+		case done = <-sink.flushes:
+		}
+
+		// all queued events are sent with the flush, in full batches
+		var err error
+		for done != nil && len(sink.events) > 0 {
+			if batch = append(batch, <-sink.events); len(batch) == sink.config.BatchSize {
+				if batchErr := sink.SendBatch(batch); batchErr != nil && err == nil {
+					err = batchErr
+				}
+				batch = make([][]byte, 0, sink.config.BatchSize)
+			}
+		}
+		if batchErr := sink.SendBatch(batch); batchErr != nil && err == nil {
+			err = batchErr
+		}
+		if err != nil {
+			WriteAppLogError("Error sends results to sink "+sink.Name()+": ", err)
+		}
+		batch = make([][]byte, 0, sink.config.BatchSize)
+		if done != nil {
+			done <- err
+		}
+	}
+}
+
+// This function sends batch and then the spool. The events of batch that
+// are not sent are spooled, and the spool is not sent.
+func (sink *BatchSink) SendBatch(batch [][]byte) error {
+
+	var err error
+	if len(batch) > 0 {
+		var unsent [][]byte
+		if unsent, err = sink.Deliver(batch); len(unsent) > 0 {
+			if spoolErr := sink.Spool(unsent); spoolErr != nil {
+				WriteAppLogError(spoolErr)
+			}
+			return err
+		}
+	}
+	if spoolErr := sink.SendSpool(); spoolErr != nil {
+		return spoolErr
+	}
+	return err
+}
+
+// This function sends batch and returns the events that are not sent
+// because the server of sink is unreachable. If the server rejects the
+// batch (ex: 400), the events are sent again one by one, so only the
+// rejected events are moved to the dead letter file.
+func (sink *BatchSink) Deliver(batch [][]byte) ([][]byte, error) {
+
+	retry, err := sink.Send(batch)
+	if err == nil {
+		return nil, nil
+	}
+	if retry {
+		return batch, err
+	}
+	if len(batch) == 1 {
+		sink.DeadLetter(batch, err)
+		return nil, err
+	}
+
+	for index, event := range batch {
+		retry, eventErr := sink.Send([][]byte{event})
+		if eventErr == nil {
+			continue
+		}
+		if retry {
+			return batch[index:], eventErr
+		}
+		sink.DeadLetter([][]byte{event}, eventErr)
+	}
+	return nil, err
+}
+
+// This function sends the events of batch with the sender. A network error
+// or a busy server is retried MaxRetries times, the wait between attempts
+// starts at RetryBackoff and doubles until 30 seconds. It returns whether
+// the last error can be retried.
+func (sink *BatchSink) Send(batch [][]byte) (bool, error) {
+
+	backoff := sink.retryBackoff
+	var retry bool
+	var err error
+	for attempt := 0; attempt <= sink.config.MaxRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			if backoff *= 2; backoff > 30*time.Second {
+				backoff = 30 * time.Second
+			}
+		}
+
+		retry, err = sink.sender.Send(batch)
+		if err == nil || !retry {
+			return retry, err
+		}
+	}
+	return retry, err
+}
+
+// This function appends the events that the server of sink rejected to the
+// dead letter file and writes the error to app log. They are not sent
+// again.
+func (sink *BatchSink) DeadLetter(events [][]byte, err error) {
+
+	sink.spoolMutex.Lock()
+	defer sink.spoolMutex.Unlock()
+
+	WriteAppLogError("Error: sink "+sink.Name()+" rejects "+strconv.Itoa(len(events))+
+		" results, they are moved to "+sink.config.DeadLetterPath+": ", err)
+	if err := AppendEvents(sink.config.DeadLetterPath, events); err != nil {
+		WriteAppLogError("Error writes dead letter file of sink "+sink.Name()+": ", err)
+	}
+}
+
+// This function appends the events to file, one event per line
+func AppendEvents(filePath string, events [][]byte) error {
+
+	if err := os.MkdirAll(filepath.Dir(filePath), 0700); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(append(bytes.Join(events, []byte("\n")), '\n'))
+	return err
+}
+
+// This function replaces the content of file with the events, one event
+// per line. The file is written aside and renamed, so it is never partial.
+func WriteEvents(filePath string, events [][]byte) error {
+
+	tempPath := filePath + ".tmp"
+	data := append(bytes.Join(events, []byte("\n")), '\n')
+	if err := ioutil.WriteFile(tempPath, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tempPath, filePath)
+}
+
+// This function appends the events of batch to the spool file, one event
+// per line. The events are dropped if the spool is larger than MaxSpoolSize.
+func (sink *BatchSink) Spool(batch [][]byte) error {
+
+	sink.spoolMutex.Lock()
+	defer sink.spoolMutex.Unlock()
+
+	if sink.config.MaxSpoolSize > 0 {
+		size := int64(len(batch))
+		for _, event := range batch {
+			size += int64(len(event))
+		}
+		if info, err := os.Stat(sink.config.SpoolPath); err == nil &&
+			info.Size()+size > sink.config.MaxSpoolSize {
+			return errors.New("spool of sink " + sink.Name() + " is full, " +
+				strconv.Itoa(len(batch)) + " results are dropped")
+		}
+	}
+	return AppendEvents(sink.config.SpoolPath, batch)
+}
+
+// This function sends the spooled events in batches. The spool file is
+// moved aside while it is sent, the events that are not sent stay in the
+// replay file and are sent first the next time.
+func (sink *BatchSink) SendSpool() error {
+
+	replayPath := sink.config.SpoolPath + ".replay"
+	sink.spoolMutex.Lock()
+	// a replay file is left if the server stopped while sending it
+	if _, err := os.Stat(replayPath); os.IsNotExist(err) {
+		if err := os.Rename(sink.config.SpoolPath, replayPath); err != nil {
+			sink.spoolMutex.Unlock()
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+	}
+	sink.spoolMutex.Unlock()
+
+	file, err := os.Open(replayPath)
+	if err != nil {
+		return err
+	}
+	events := make([][]byte, 0)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if line := bytes.TrimSpace(scanner.Bytes()); len(line) > 0 {
+			events = append(events, append([]byte(nil), line...))
+		}
+	}
+	file.Close()
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	for start := 0; start < len(events); start += sink.config.BatchSize {
+		end := start + sink.config.BatchSize
+		if end > len(events) {
+			end = len(events)
+		}
+		unsent, err := sink.Deliver(events[start:end])
+		if len(unsent) == 0 {
+			continue
+		}
+		remaining := make([][]byte, 0, len(unsent)+len(events)-end)
+		remaining = append(append(remaining, unsent...), events[end:]...)
+		if writeErr := WriteEvents(replayPath, remaining); writeErr != nil {
+			WriteAppLogError("Error keeps "+strconv.Itoa(len(remaining))+
+				" spooled results of sink "+sink.Name()+": ", writeErr)
+		}
+		return err
+	}
+	if len(events) > 0 {
+		WriteAppLogInfo("Success sends " + strconv.Itoa(len(events)) +
+			" spooled results to sink " + sink.Name())
+	}
+	return os.Remove(replayPath)
+}
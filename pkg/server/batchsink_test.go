@@ -0,0 +1,294 @@
+/**
+ * File:    batchsink_test.go
+ *
+ * Summary of File:
+ *
+ * 	This file contains the tests of the batch sink with the HEC sender and
+ *	a local HTTP server that stands in for Splunk HEC.
+ * 	Functions:
+ * 	Testing the batching, the retry of a busy server, the spool and its
+ *	replay, and the dead letter file of rejected events.
+ */
+
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// hecStandIn struct is a local HEC server. Status returns the status of
+// each request from the events of request, the received events of
+// successful requests are kept.
+type hecStandIn struct {
+	mutex    sync.Mutex
+	server   *httptest.Server
+	requests int
+	batches  [][]map[string]interface{}
+	status   func(events []map[string]interface{}) int
+}
+
+// This function starts the local HEC server
+func newHecStandIn(t *testing.T) *hecStandIn {
+
+	hec := &hecStandIn{status: func([]map[string]interface{}) int { return http.StatusOK }}
+	hec.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != HEC_EVENT_PATH || r.Header.Get("Authorization") != "Splunk test-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		events := make([]map[string]interface{}, 0)
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			event := make(map[string]interface{})
+			if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			events = append(events, event)
+		}
+
+		hec.mutex.Lock()
+		defer hec.mutex.Unlock()
+		hec.requests++
+		status := hec.status(events)
+		if status == http.StatusOK {
+			hec.batches = append(hec.batches, events)
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(`{"text":"` + http.StatusText(status) + `"}`))
+	}))
+	t.Cleanup(hec.server.Close)
+	return hec
+}
+
+// This function sets the function that returns the status of requests
+func (hec *hecStandIn) setStatus(status func(events []map[string]interface{}) int) {
+	hec.mutex.Lock()
+	defer hec.mutex.Unlock()
+	hec.status = status
+}
+
+// This function returns the ids of received events in order
+func (hec *hecStandIn) receivedIds() []string {
+	hec.mutex.Lock()
+	defer hec.mutex.Unlock()
+	ids := make([]string, 0)
+	for _, batch := range hec.batches {
+		for _, event := range batch {
+			result := event["event"].(map[string]interface{})
+			ids = append(ids, result["Id"].(string))
+		}
+	}
+	return ids
+}
+
+// This function creates the HEC sink of the local HEC server
+func newTestHecSink(t *testing.T, hec *hecStandIn, batchSize int, maxRetries int) *BatchSink {
+	dir := t.TempDir()
+	sink, err := NewHecSink(SinkConfig{
+		Type:          "hec",
+		Name:          "test",
+		Url:           hec.server.URL,
+		Token:         "test-token",
+		BatchSize:     batchSize,
+		FlushInterval: "1h",
+		MaxRetries:    maxRetries,
+		RetryBackoff:  "1ms",
+		SpoolPath:     filepath.Join(dir, "test.spool"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sink
+}
+
+// This function returns the encoded events of results with ids
+func encodeResults(t *testing.T, sink *BatchSink, ids ...string) [][]byte {
+	events := make([][]byte, 0, len(ids))
+	for _, id := range ids {
+		event, err := sink.sender.Encode(map[string]string{"Id": id, "ComputerName": "host1",
+			"Result": "Success"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+// This function returns the number of lines of file, 0 if it does not exist
+func countLines(t *testing.T, filePath string) int {
+	data, err := ioutil.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		return 0
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bytes.Count(data, []byte("\n"))
+}
+
+func TestBatchSinkBatching(t *testing.T) {
+
+	hec := newHecStandIn(t)
+	sink := newTestHecSink(t, hec, 3, 0)
+	sink.Start()
+	for i := 1; i <= 7; i++ {
+		if err := sink.WriteResult(map[string]string{"Id": strconv.Itoa(i), "ComputerName": "host1"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sink.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	sizes := make([]int, 0)
+	for _, batch := range hec.batches {
+		sizes = append(sizes, len(batch))
+		for _, event := range batch {
+			if event["host"] != "host1" || event["sourcetype"] != "bkedr:result" {
+				t.Fatalf("event %v has wrong host or sourcetype", event)
+			}
+		}
+	}
+	if len(sizes) != 3 || sizes[0] != 3 || sizes[1] != 3 || sizes[2] != 1 {
+		t.Fatalf("batches have sizes %v, want [3 3 1]", sizes)
+	}
+	if ids := strings.Join(hec.receivedIds(), ","); ids != "1,2,3,4,5,6,7" {
+		t.Fatalf("received %s", ids)
+	}
+}
+
+func TestBatchSinkRetry(t *testing.T) {
+
+	hec := newHecStandIn(t)
+	failures := 2
+	hec.setStatus(func([]map[string]interface{}) int {
+		if failures > 0 {
+			failures--
+			return http.StatusServiceUnavailable
+		}
+		return http.StatusOK
+	})
+	sink := newTestHecSink(t, hec, 10, 3)
+
+	if err := sink.SendBatch(encodeResults(t, sink, "a", "b")); err != nil {
+		t.Fatal(err)
+	}
+	if hec.requests != 3 {
+		t.Fatalf("server gets %d requests, want 3", hec.requests)
+	}
+	if ids := strings.Join(hec.receivedIds(), ","); ids != "a,b" {
+		t.Fatalf("received %s", ids)
+	}
+	if lines := countLines(t, sink.config.SpoolPath); lines != 0 {
+		t.Fatalf("spool has %d events", lines)
+	}
+}
+
+func TestBatchSinkSpoolReplay(t *testing.T) {
+
+	hec := newHecStandIn(t)
+	hec.setStatus(func([]map[string]interface{}) int { return http.StatusServiceUnavailable })
+	sink := newTestHecSink(t, hec, 2, 1)
+	replayPath := sink.config.SpoolPath + ".replay"
+
+	// the server is busy, the batches are spooled
+	if err := sink.SendBatch(encodeResults(t, sink, "1", "2", "3")); err == nil {
+		t.Fatal("batch is sent to a busy server")
+	}
+	if err := sink.SendBatch(encodeResults(t, sink, "4")); err == nil {
+		t.Fatal("batch is sent to a busy server")
+	}
+	if lines := countLines(t, sink.config.SpoolPath); lines != 4 {
+		t.Fatalf("spool has %d events, want 4", lines)
+	}
+
+	// the replay fails, the events stay in the replay file
+	if err := sink.SendSpool(); err == nil {
+		t.Fatal("spool is sent to a busy server")
+	}
+	if lines := countLines(t, replayPath); lines != 4 {
+		t.Fatalf("replay file has %d events, want 4", lines)
+	}
+
+	// the server is back, the first batch is accepted and the second is
+	// refused once, the rest stays in the replay file
+	accepted := 0
+	hec.setStatus(func([]map[string]interface{}) int {
+		if accepted++; accepted == 2 {
+			return http.StatusServiceUnavailable
+		}
+		return http.StatusOK
+	})
+	sink.config.MaxRetries = 0
+	if err := sink.SendSpool(); err == nil {
+		t.Fatal("refused batch is not reported")
+	}
+	if lines := countLines(t, replayPath); lines != 2 {
+		t.Fatalf("replay file has %d events, want 2", lines)
+	}
+
+	hec.setStatus(func([]map[string]interface{}) int { return http.StatusOK })
+	if err := sink.SendBatch(nil); err != nil {
+		t.Fatal(err)
+	}
+	if ids := strings.Join(hec.receivedIds(), ","); ids != "1,2,3,4" {
+		t.Fatalf("received %s, want 1,2,3,4", ids)
+	}
+	for _, path := range []string{sink.config.SpoolPath, replayPath} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Fatalf("%s is not removed: %v", path, err)
+		}
+	}
+}
+
+func TestBatchSinkDeadLetter(t *testing.T) {
+
+	hec := newHecStandIn(t)
+	hec.setStatus(func(events []map[string]interface{}) int {
+		for _, event := range events {
+			if event["event"].(map[string]interface{})["Id"] == "bad" {
+				return http.StatusBadRequest
+			}
+		}
+		return http.StatusOK
+	})
+	sink := newTestHecSink(t, hec, 10, 3)
+
+	if err := sink.SendBatch(encodeResults(t, sink, "1", "bad", "2")); err == nil {
+		t.Fatal("rejected event is not reported")
+	}
+	if ids := strings.Join(hec.receivedIds(), ","); ids != "1,2" {
+		t.Fatalf("received %s, want 1,2", ids)
+	}
+	if lines := countLines(t, sink.config.DeadLetterPath); lines != 1 {
+		t.Fatalf("dead letter file has %d events, want 1", lines)
+	}
+	if lines := countLines(t, sink.config.SpoolPath); lines != 0 {
+		t.Fatalf("spool has %d events, the rejected event blocks it", lines)
+	}
+
+	// a rejected event in the spool does not block the next events
+	if err := sink.Spool(encodeResults(t, sink, "bad", "3")); err != nil {
+		t.Fatal(err)
+	}
+	sink.SendSpool()
+	if ids := strings.Join(hec.receivedIds(), ","); ids != "1,2,3" {
+		t.Fatalf("received %s, want 1,2,3", ids)
+	}
+	if lines := countLines(t, sink.config.DeadLetterPath); lines != 2 {
+		t.Fatalf("dead letter file has %d events, want 2", lines)
+	}
+}
@@ -0,0 +1,328 @@
+/**
+ * File:    containment.go
+ *
+ * Summary of File:
+ *
+ * 	This file contains the code related to the containment actions of the
+ * 	bkedr server.
+ * 	Functions:
+ * 	Recording every reversible action (block ip/port, disable adapter,
+ * 	isolate, suspend, quarantine, registry delete, ...) with its inverse
+ * 	action.
+ * 	Undoing containments by id, rule, host and time, from the splunk server.
+ * 	Undoing containments automatically when their TTL expires.
+ */
+
+package server
+
+import (
+	"bkedr/pkg/rpc"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// Containment is in place on the agent
+	CONTAINMENT_ACTIVE = "active"
+	// Containment is undone by the administrator
+	CONTAINMENT_UNDONE = "undone"
+	// Containment is undone because its TTL expired
+	CONTAINMENT_EXPIRED = "expired"
+	// Inverse action of containment is being sent to the agent
+	CONTAINMENT_UNDOING = "undoing"
+)
+
+var (
+	// Containment actions are recorded from all responses
+	containments = make([]map[string]string, 0)
+	// Mutex protects containments and containments file
+	containmentMutex sync.Mutex
+)
+
+// This function returns the action that undoes the action of objRequest.
+// It returns an empty string if the action cannot be undone.
+func InverseAction(objRequest map[string]string) string {
+	switch objRequest["Action"] {
+	case "block_src_ip":
+		return "unblock_src_ip"
+	case "block_dst_ip":
+		return "unblock_dst_ip"
+	case "block_src_port":
+		return "unblock_src_port"
+	case "block_dst_port":
+		return "unblock_dst_port"
+	case "disable":
+		return "enable"
+	case "isolate":
+		return "unisolate"
+	case "suspend":
+		return "resume"
+	case "quarantine":
+		return "restore"
+	case "delete":
+		// deleted registry keys and values are backed up by agent
+		switch objRequest["EventCode"] {
+		case "12", "13", "14":
+			return "restore"
+		}
+		return ""
+	default:
+		return ""
+	}
+}
+
+// This function returns the key of request that the agent restores by its
+// UndoId (quarantined file or deleted registry key or value)
+func ContainmentTargetKey(objRequest map[string]string) string {
+	switch objRequest["EventCode"] {
+	case "7":
+		return "ImageLoaded"
+	case "12", "13":
+		return "TargetObject"
+	case "14":
+		return "NewName"
+	default:
+		return "TargetFilename"
+	}
+}
+
+// This function returns the key of the process that the process actions
+// (ex: kill, suspend) of request act on. The request of EventCode 8 has
+// the source process of the remote thread.
+func ProcessTargetKey(objRequest map[string]string) string {
+	if objRequest["EventCode"] == "8" {
+		return "SourceProcessId"
+	}
+	return "ProcessId"
+}
+
+// This function returns the object that is contained by the action
+func ContainmentTarget(objRequest map[string]string) string {
+	switch objRequest["Action"] {
+	case "block_src_ip":
+		return objRequest["SourceIp"]
+	case "block_dst_ip":
+		return objRequest["DestinationIp"]
+	case "block_src_port":
+		return objRequest["SourcePort"]
+	case "block_dst_port":
+		return objRequest["DestinationPort"]
+	case "disable":
+		return "Network Adapter"
+	case "isolate":
+		return "Host"
+	case "quarantine", "delete":
+		return objRequest[ContainmentTargetKey(objRequest)]
+	default:
+		return objRequest[ProcessTargetKey(objRequest)]
+	}
+}
+
+// This function records a successful action that can be undone.
+// The containment expires after TTL if the rule sets it.
+func RecordContainment(objRequest map[string]string) error {
+
+	inverseAction := InverseAction(objRequest)
+	if inverseAction == "" {
+		return nil
+	}
+
+	// the request is stored to send the inverse action later
+	request, err := json.Marshal(objRequest)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	containment := map[string]string{
+		"Id":            NewId(),
+		"ComputerName":  objRequest["ComputerName"],
+		"Action":        objRequest["Action"],
+		"InverseAction": inverseAction,
+		"Target":        ContainmentTarget(objRequest),
+		"Message":       objRequest["Message"],
+		"Request":       string(request),
+		"CreatedTime":   now.Format("2006-01-02 15:04:05.000"),
+		"Status":        CONTAINMENT_ACTIVE,
+	}
+
+	// If TTL is set, save the time that containment expires. The action
+	// already ran, so a containment with invalid TTL is still recorded and
+	// can be undone by the administrator.
+	if objRequest["TTL"] != "" {
+		if ttl, err := ParseTTL(objRequest["TTL"]); err != nil {
+			WriteAppLogError("Error records TTL of containment "+containment["Id"]+": ", err)
+		} else {
+			containment["ExpireTime"] = now.Add(ttl).Format("2006-01-02 15:04:05.000")
+		}
+	}
+
+	containmentMutex.Lock()
+	defer containmentMutex.Unlock()
+
+	containments = append(containments, containment)
+	if err := WriteMapString(containmentsPath, containment); err != nil {
+		return err
+	}
+	WriteAppLogInfo("Success records containment " + containment["Id"] + " " +
+		containment["Action"] + " " + containment["Target"] + " on " +
+		containment["ComputerName"])
+	return nil
+}
+
+// This function returns the duration of TTL of rule. TTL must be a
+// positive duration (ex: 30m, 24h).
+func ParseTTL(value string) (time.Duration, error) {
+	ttl, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, errors.New("Error: TTL " + value + " is not a duration")
+	}
+	if ttl <= 0 {
+		return 0, errors.New("Error: TTL " + value + " is not positive")
+	}
+	return ttl, nil
+}
+
+// This function handles the containment command sent by the administrator.
+// In case "Action Containment" equal "undo", we undo all active containments
+// that match the fields of the command:
+//   - Id: id of containment
+//   - Message: message of rule that did the containment
+//   - ComputerName: agent that the containment is done
+//   - Since: duration, containments are done in the last duration (ex: 1h)
+func HandleContainment(command map[string]string) error {
+
+	switch command["Action Containment"] {
+	case "undo":
+		var since time.Time
+		if command["Since"] != "" {
+			duration, err := time.ParseDuration(command["Since"])
+			if err != nil {
+				return err
+			}
+			since = time.Now().Add(-duration)
+		}
+
+		// check fields of the command with fields of containment
+		count := UndoContainments(CONTAINMENT_UNDONE, func(containment map[string]string) bool {
+			for _, key := range []string{"Id", "Message", "ComputerName"} {
+				if command[key] != "" && command[key] != containment[key] {
+					return false
+				}
+			}
+			createdTime, err := ParseDateMilisecond(containment["CreatedTime"])
+			return err == nil && !createdTime.Before(since)
+		})
+		WriteAppLogInfo("Success undoes ", count, " containments")
+		return nil
+	default:
+		return errors.New("Error: Action Containment " +
+			command["Action Containment"] + " is not supported")
+	}
+}
+
+// This function undoes all active containments that match function and
+// changes their status. Function returns the number of undone containments.
+func UndoContainments(status string, match func(map[string]string) bool) int {
+
+	// matched containments are marked undoing under the lock, so another
+	// undo does not pick them, and copied so the lock is not held while
+	// requesting agent
+	containmentMutex.Lock()
+	matched := make([]map[string]string, 0)
+	for _, containment := range containments {
+		if containment["Status"] == CONTAINMENT_ACTIVE && match(containment) {
+			containment["Status"] = CONTAINMENT_UNDOING
+			matched = append(matched, CopyMapString(containment))
+		}
+	}
+	containmentMutex.Unlock()
+
+	count := 0
+	for _, containment := range matched {
+		err := UndoContainment(containment)
+		newStatus := status
+		if err != nil {
+			WriteAppLogError("Error undoes containment "+containment["Id"]+": ", err)
+			// the containment is still in place, it can be undone again
+			newStatus = CONTAINMENT_ACTIVE
+		} else {
+			count++
+		}
+		if err := SetContainmentStatus(containment["Id"], newStatus); err != nil {
+			WriteAppLogError(err)
+		}
+	}
+	return count
+}
+
+// This function sends the inverse action of containment to agent and writes
+// the result to result log file. Containment is a copy that is not shared.
+func UndoContainment(containment map[string]string) error {
+
+	objRequest := make(map[string]string)
+	if err := json.Unmarshal([]byte(containment["Request"]), &objRequest); err != nil {
+		return err
+	}
+	objRequest["Action"] = containment["InverseAction"]
+	objRequest["ContainmentId"] = containment["Id"]
+	delete(objRequest, "TTL")
+	// the inverse action is another RPC, with its own RequestId
+	delete(objRequest, "RequestId")
+
+	// the quarantine item or registry backup is restored by its id, so
+	// another copy of the same path is not restored
+	if objRequest["UndoId"] != "" {
+		objRequest[ContainmentTargetKey(objRequest)] = objRequest["UndoId"]
+	}
+
+	// GRPC Connection has a key in the Map equal to the ComputerName
+	var responseResult *rpc.ResponseResult
+	if clientConn, ok := GetClientConn(containment["ComputerName"]); ok {
+		responseResult = ExecuteRequest(clientConn, objRequest)
+	} else {
+		responseResult = &rpc.ResponseResult{
+			ResultInfo: "Error: Agent " + containment["ComputerName"] + " is not connected",
+			Result:     false,
+		}
+	}
+	HandleResult(responseResult, objRequest)
+	if !responseResult.GetResult() {
+		return errors.New(responseResult.GetResultInfo())
+	}
+	return nil
+}
+
+// This function saves the new status of containment id. A containment that
+// is not active anymore has the time it was undone.
+func SetContainmentStatus(id string, status string) error {
+
+	containmentMutex.Lock()
+	defer containmentMutex.Unlock()
+
+	for _, containment := range containments {
+		if containment["Id"] != id {
+			continue
+		}
+		containment["Status"] = status
+		if status != CONTAINMENT_ACTIVE {
+			containment["UndoTime"] = FormatCurrentDateMilisecond()
+		}
+		return WriteSliceMapString(containmentsPath, containments)
+	}
+	return errors.New("Error: containment " + id + " is not found")
+}
+
+// This function checks the containments every 30 seconds and undoes
+// containments that have expired.
+func WatchContainments() {
+	for range time.Tick(30 * time.Second) {
+		now := time.Now()
+		UndoContainments(CONTAINMENT_EXPIRED, func(containment map[string]string) bool {
+			expireTime, err := ParseDateMilisecond(containment["ExpireTime"])
+			return err == nil && now.After(expireTime)
+		})
+	}
+}
@@ -0,0 +1,365 @@
+/**
+ * File:    decoder.go
+ *
+ * Summary of File:
+ *
+ * 	This file contains the input decoders of the bkedr server. The rules
+ * 	use the flat fields extracted by Splunk (EventCode, ComputerName and
+ *	the fields of Sysmon event data). The decoders normalize the logs of
+ *	other formats into these fields.
+ * 	Functions:
+ * 	Decoding raw Sysmon XML, Winlogbeat/ECS JSON and the JSON of
+ *	Get-WinEvent | ConvertTo-Json.
+ * 	Mapping the fields of each format to the fields of rules, with tables
+ *	of field mappings that can be changed in server config.
+ */
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// LogDecoder struct is an input format of logs. Match checks that a log is
+// of the format, object is the decoded JSON of log or nil if the log is not
+// a JSON object. Flatten returns the fields of log by their path. Fields
+// whose path starts with Passthrough keep the name after Passthrough,
+// other fields are only kept if they are in Mappings.
+type LogDecoder struct {
+	Name        string
+	Passthrough string
+	Mappings    []FieldMapping
+	Match       func(data []byte, object map[string]interface{}) bool
+	Flatten     func(data []byte, object map[string]interface{}) (map[string]string, error)
+}
+
+// FieldMapping struct maps the field Source of a format to the field Target
+// of rules. An empty Target removes the field.
+type FieldMapping struct {
+	Source string `json:"Source"`
+	Target string `json:"Target"`
+}
+
+// FieldMappingConfig struct is used to decode json of a field mapping of
+// server config. Decoder is the name of decoder.
+type FieldMappingConfig struct {
+	Decoder string `json:"Decoder"`
+	Source  string `json:"Source"`
+	Target  string `json:"Target"`
+}
+
+// Decoders of input formats. A log that matches no decoder is already in
+// the fields of rules.
+var logDecoders = []*LogDecoder{
+	{
+		Name:        "sysmon-xml",
+		Passthrough: "EventData.",
+		Mappings: []FieldMapping{
+			{"System.EventID", "EventCode"},
+			{"System.Computer", "ComputerName"},
+			{"System.EventRecordID", "RecordNumber"},
+			{"System.Channel", "LogName"},
+			{"System.Provider.Name", "SourceName"},
+			{"System.TimeCreated.SystemTime", "TimeCreated"},
+		},
+		Match:   MatchSysmonXml,
+		Flatten: FlattenSysmonXml,
+	},
+	{
+		Name:        "winlogbeat",
+		Passthrough: "winlog.event_data.",
+		Mappings: []FieldMapping{
+			{"winlog.event_id", "EventCode"},
+			{"event.code", "EventCode"},
+			{"winlog.computer_name", "ComputerName"},
+			{"host.hostname", "ComputerName"},
+			{"host.name", "ComputerName"},
+			{"winlog.record_id", "RecordNumber"},
+			{"winlog.channel", "LogName"},
+			{"winlog.provider_name", "SourceName"},
+			{"@timestamp", "TimeCreated"},
+			// ECS fields, when the event data is not forwarded
+			{"process.pid", "ProcessId"},
+			{"process.executable", "Image"},
+			{"process.command_line", "CommandLine"},
+			{"process.parent.pid", "ParentProcessId"},
+			{"process.parent.executable", "ParentImage"},
+			{"process.parent.command_line", "ParentCommandLine"},
+			{"file.path", "TargetFilename"},
+			{"dll.path", "ImageLoaded"},
+			{"registry.path", "TargetObject"},
+			{"source.ip", "SourceIp"},
+			{"source.port", "SourcePort"},
+			{"destination.ip", "DestinationIp"},
+			{"destination.port", "DestinationPort"},
+			{"destination.domain", "DestinationHostname"},
+			{"dns.question.name", "QueryName"},
+		},
+		Match:   MatchWinlogbeat,
+		Flatten: FlattenJson,
+	},
+	{
+		Name:        "winevent-json",
+		Passthrough: "Message.",
+		Mappings: []FieldMapping{
+			{"Id", "EventCode"},
+			{"MachineName", "ComputerName"},
+			{"RecordId", "RecordNumber"},
+			{"LogName", "LogName"},
+			{"ProviderName", "SourceName"},
+			{"TimeCreated", "TimeCreated"},
+		},
+		Match:   MatchWinEventJson,
+		Flatten: FlattenWinEventJson,
+	},
+}
+
+// This function adds the field mappings of server config to the decoders.
+// They are used before the default mappings of decoder.
+func LoadFieldMappings(configs []FieldMappingConfig) {
+
+	for _, decoder := range logDecoders {
+		mappings := make([]FieldMapping, 0, len(configs)+len(decoder.Mappings))
+		for _, config := range configs {
+			if config.Decoder == decoder.Name && config.Source != "" {
+				mappings = append(mappings, FieldMapping{config.Source, config.Target})
+			}
+		}
+		decoder.Mappings = append(mappings, decoder.Mappings...)
+	}
+	for _, config := range configs {
+		if FindLogDecoder(config.Decoder) == nil {
+			WriteAppLogError("Error loads field mapping: decoder " + config.Decoder +
+				" is not found")
+		}
+	}
+}
+
+// This function returns the decoder named name, or nil
+func FindLogDecoder(name string) *LogDecoder {
+	for _, decoder := range logDecoders {
+		if decoder.Name == name {
+			return decoder
+		}
+	}
+	return nil
+}
+
+// This function returns the log in the fields of rules, as JSON. A log that
+// matches no decoder or that cannot be decoded is returned unchanged.
+func NormalizeLog(jsonString string) string {
+
+	fields, decoder, err := DecodeLog([]byte(jsonString))
+	if decoder == nil {
+		return jsonString
+	}
+	if err != nil {
+		WriteAppLogError("Error decodes log of "+decoder.Name+": ", err)
+		return jsonString
+	}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		WriteAppLogError(err)
+		return jsonString
+	}
+	return string(data)
+}
+
+// This function decodes the log with the first decoder that matches it and
+// maps its fields. It returns the decoder, nil if no decoder matches. The
+// decoder is added to the fields in LogFormat.
+func DecodeLog(data []byte) (map[string]string, *LogDecoder, error) {
+
+	data = bytes.TrimSpace(data)
+	var object map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	// numbers are kept as they are written, ex: large process ids
+	decoder.UseNumber()
+	if decoder.Decode(&object) != nil {
+		object = nil
+	}
+
+	for _, logDecoder := range logDecoders {
+		if !logDecoder.Match(data, object) {
+			continue
+		}
+		flat, err := logDecoder.Flatten(data, object)
+		if err != nil {
+			return nil, logDecoder, err
+		}
+		fields := MapFields(flat, logDecoder)
+		fields["LogFormat"] = logDecoder.Name
+		return fields, logDecoder, nil
+	}
+	return nil, nil, nil
+}
+
+// This function maps the flat fields of a log to the fields of rules. The
+// fields of Passthrough are kept first, then the first mapping of each
+// target that has a value is used.
+func MapFields(flat map[string]string, decoder *LogDecoder) map[string]string {
+
+	mapped := make(map[string]bool)
+	for _, mapping := range decoder.Mappings {
+		mapped[mapping.Source] = true
+	}
+
+	fields := make(map[string]string)
+	for path, value := range flat {
+		if decoder.Passthrough != "" && strings.HasPrefix(path, decoder.Passthrough) &&
+			!mapped[path] {
+			fields[strings.TrimPrefix(path, decoder.Passthrough)] = value
+		}
+	}
+	for _, mapping := range decoder.Mappings {
+		value, ok := flat[mapping.Source]
+		if !ok || value == "" || mapping.Target == "" {
+			continue
+		}
+		if _, ok := fields[mapping.Target]; !ok {
+			fields[mapping.Target] = value
+		}
+	}
+
+	// commands of the administrator are flat JSON, a decoded log is never
+	// a command
+	for _, key := range adminCommandKeys {
+		delete(fields, key)
+	}
+	return fields
+}
+
+// This function returns the fields of a JSON object by their path, the keys
+// of nested objects and the indexes of arrays are separated by ".".
+func FlattenJson(data []byte, object map[string]interface{}) (map[string]string, error) {
+	flat := make(map[string]string)
+	FlattenValue("", object, flat)
+	return flat, nil
+}
+
+// This function adds value to flat with path, nested values are added with
+// their path.
+func FlattenValue(path string, value interface{}, flat map[string]string) {
+
+	prefix := path
+	if prefix != "" {
+		prefix += "."
+	}
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		for key, item := range typed {
+			FlattenValue(prefix+key, item, flat)
+		}
+	case []interface{}:
+		for index, item := range typed {
+			FlattenValue(prefix+strconv.Itoa(index), item, flat)
+		}
+	case nil:
+	default:
+		flat[path] = fmt.Sprintf("%v", typed)
+	}
+}
+
+// This function checks that the log is a Windows event in XML
+func MatchSysmonXml(data []byte, object map[string]interface{}) bool {
+	return object == nil && bytes.HasPrefix(data, []byte("<"))
+}
+
+// XmlEvent struct is used to decode the XML of a Windows event
+type XmlEvent struct {
+	System struct {
+		Provider struct {
+			Name string `xml:"Name,attr"`
+		} `xml:"Provider"`
+		EventID       string `xml:"EventID"`
+		EventRecordID string `xml:"EventRecordID"`
+		Channel       string `xml:"Channel"`
+		Computer      string `xml:"Computer"`
+		TimeCreated   struct {
+			SystemTime string `xml:"SystemTime,attr"`
+		} `xml:"TimeCreated"`
+	} `xml:"System"`
+	EventData struct {
+		Data []struct {
+			Name  string `xml:"Name,attr"`
+			Value string `xml:",chardata"`
+		} `xml:"Data"`
+	} `xml:"EventData"`
+}
+
+// This function returns the fields of the XML of a Windows event. The data
+// of event are EventData.<Name>.
+func FlattenSysmonXml(data []byte, object map[string]interface{}) (map[string]string, error) {
+
+	event := XmlEvent{}
+	if err := xml.Unmarshal(data, &event); err != nil {
+		return nil, err
+	}
+	flat := map[string]string{
+		"System.Provider.Name":          event.System.Provider.Name,
+		"System.EventID":                strings.TrimSpace(event.System.EventID),
+		"System.EventRecordID":          strings.TrimSpace(event.System.EventRecordID),
+		"System.Channel":                event.System.Channel,
+		"System.Computer":               event.System.Computer,
+		"System.TimeCreated.SystemTime": event.System.TimeCreated.SystemTime,
+	}
+	for _, item := range event.EventData.Data {
+		if item.Name != "" {
+			flat["EventData."+item.Name] = item.Value
+		}
+	}
+	return flat, nil
+}
+
+// This function checks that the log is a Winlogbeat or ECS event
+func MatchWinlogbeat(data []byte, object map[string]interface{}) bool {
+
+	if object == nil {
+		return false
+	}
+	if _, ok := object["winlog"].(map[string]interface{}); ok {
+		return true
+	}
+	_, ok := object["ecs"]
+	return ok
+}
+
+// This function checks that the log is an event of Get-WinEvent converted
+// to JSON.
+func MatchWinEventJson(data []byte, object map[string]interface{}) bool {
+
+	if object == nil {
+		return false
+	}
+	for _, key := range []string{"Id", "ProviderName", "Message"} {
+		if _, ok := object[key]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// This function returns the fields of an event of Get-WinEvent. The data of
+// event are only in its message, a line per field (ex: Image: C:\a.exe),
+// they are Message.<Name>. ProcessId of the event is the process that
+// wrote the event, not the process of Sysmon event, it is not mapped.
+func FlattenWinEventJson(data []byte, object map[string]interface{}) (map[string]string, error) {
+
+	flat, _ := FlattenJson(data, object)
+	message, _ := object["Message"].(string)
+	lines := strings.Split(strings.ReplaceAll(message, "\r\n", "\n"), "\n")
+	// the first line is the title of event (ex: Process Create:)
+	for _, line := range lines[1:] {
+		index := strings.Index(line, ": ")
+		if index <= 0 || strings.ContainsAny(line[:index], " \t") {
+			continue
+		}
+		flat["Message."+line[:index]] = strings.TrimSpace(line[index+2:])
+	}
+	return flat, nil
+}
@@ -0,0 +1,147 @@
+/**
+ * File:    decoder_test.go
+ *
+ * Summary of File:
+ *
+ * 	This file contains the tests of the input decoders with a sample log
+ *	of each format in testdata/decoder.
+ * 	Functions:
+ * 	Testing that each sample is decoded by the decoder of its format and
+ *	that its fields are mapped to the fields of rules.
+ */
+
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// This function tests DecodeLog and NormalizeLog with a sample of each
+// format. Format is empty for a log that is already in the fields of rules.
+func TestDecodeLogFormats(t *testing.T) {
+
+	tests := []struct {
+		fixture string
+		format  string
+		fields  map[string]string
+		absent  []string
+	}{
+		{
+			fixture: "sysmon.xml",
+			format:  "sysmon-xml",
+			fields: map[string]string{
+				"EventCode":       "1",
+				"ComputerName":    "WS01.corp.local",
+				"RecordNumber":    "48213",
+				"LogName":         "Microsoft-Windows-Sysmon/Operational",
+				"SourceName":      "Microsoft-Windows-Sysmon",
+				"TimeCreated":     "2021-08-02T09:12:44.5120000Z",
+				"ProcessId":       "4312",
+				"Image":           `C:\Windows\System32\cmd.exe`,
+				"CommandLine":     "cmd.exe /c whoami",
+				"ParentProcessId": "2208",
+			},
+		},
+		{
+			fixture: "winlogbeat.json",
+			format:  "winlogbeat",
+			fields: map[string]string{
+				"EventCode":       "3",
+				"ComputerName":    "WS01.corp.local",
+				"RecordNumber":    "48214",
+				"LogName":         "Microsoft-Windows-Sysmon/Operational",
+				"SourceName":      "Microsoft-Windows-Sysmon",
+				"TimeCreated":     "2021-08-02T09:12:44.511Z",
+				"ProcessId":       "4312",
+				"DestinationIp":   "10.1.2.3",
+				"DestinationPort": "443",
+			},
+			absent: []string{"agent.type", "ecs.version"},
+		},
+		{
+			fixture: "ecs.json",
+			format:  "winlogbeat",
+			fields: map[string]string{
+				"EventCode":       "1",
+				"ComputerName":    "WS01.corp.local",
+				"ProcessId":       "4312",
+				"Image":           `C:\Windows\System32\cmd.exe`,
+				"CommandLine":     "cmd.exe /c whoami",
+				"ParentProcessId": "2208",
+				"ParentImage":     `C:\Windows\explorer.exe`,
+			},
+		},
+		{
+			fixture: "winevent.json",
+			format:  "winevent-json",
+			fields: map[string]string{
+				"EventCode":    "1",
+				"ComputerName": "WS01.corp.local",
+				"RecordNumber": "48213",
+				"LogName":      "Microsoft-Windows-Sysmon/Operational",
+				"SourceName":   "Microsoft-Windows-Sysmon",
+				// ProcessId of the message, not the process that wrote the event
+				"ProcessId":   "4312",
+				"Image":       `C:\Windows\System32\cmd.exe`,
+				"CommandLine": "cmd.exe /c whoami",
+				"ParentImage": `C:\Windows\explorer.exe`,
+				"RuleName":    "-",
+			},
+			absent: []string{"Message", "Id"},
+		},
+		{
+			fixture: "splunk.json",
+			format:  "",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.fixture, func(t *testing.T) {
+			data, err := ioutil.ReadFile(filepath.Join("testdata", "decoder", test.fixture))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			fields, decoder, err := DecodeLog(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.format == "" {
+				if decoder != nil {
+					t.Fatalf("log is decoded by %s", decoder.Name)
+				}
+				if normalized := NormalizeLog(string(data)); normalized != string(data) {
+					t.Fatalf("log is changed: %s", normalized)
+				}
+				return
+			}
+			if decoder == nil || decoder.Name != test.format {
+				t.Fatalf("decoder is %v, want %s", decoder, test.format)
+			}
+			if fields["LogFormat"] != test.format {
+				t.Errorf("LogFormat is %q, want %q", fields["LogFormat"], test.format)
+			}
+			for key, value := range test.fields {
+				if fields[key] != value {
+					t.Errorf("%s is %q, want %q", key, fields[key], value)
+				}
+			}
+			for _, key := range test.absent {
+				if _, ok := fields[key]; ok {
+					t.Errorf("%s is kept: %q", key, fields[key])
+				}
+			}
+
+			normalized := make(map[string]string)
+			if err := json.Unmarshal([]byte(NormalizeLog(string(data))), &normalized); err != nil {
+				t.Fatal(err)
+			}
+			if normalized["EventCode"] != test.fields["EventCode"] {
+				t.Errorf("normalized EventCode is %q", normalized["EventCode"])
+			}
+		})
+	}
+}
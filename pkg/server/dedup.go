@@ -0,0 +1,139 @@
+/**
+ * File:    dedup.go
+ *
+ * Summary of File:
+ *
+ * 	This file contains the code related to the deduplication of the
+ * 	responses of rules. Splunk can send the same event or alert many times.
+ * 	Functions:
+ * 	Computing the dedup key of response: rule, host, action and target.
+ * 	Suppressing the responses that repeat within DedupWindow after the
+ *	first response.
+ * 	Writing the number of suppressed repeats with the DedupId of the first
+ *	response when the window ends.
+ */
+
+package server
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DedupEntry struct contains the first response of a dedup key and the
+// number of repeats suppressed until ExpireTime
+type DedupEntry struct {
+	Id         string
+	Request    map[string]string
+	ExpireTime time.Time
+	Suppressed int
+}
+
+var (
+	// First responses of dedup keys in the window
+	dedupEntries = make(map[string]*DedupEntry)
+	// Mutex protects dedupEntries
+	dedupMutex sync.Mutex
+)
+
+// This function returns the dedup key of response: rule, host, action and
+// the entity that is the target of action.
+func DedupKey(objRequest map[string]string) string {
+	return strings.Join([]string{objRequest["Message"], objRequest["ComputerName"],
+		objRequest["Action"], DedupTarget(objRequest)}, "|")
+}
+
+// This function returns the entity that is the target of action
+func DedupTarget(objRequest map[string]string) string {
+	switch objRequest["Action"] {
+	case "getfile":
+		switch objRequest["EventCode"] {
+		case "7":
+			return objRequest["ImageLoaded"]
+		case "11":
+			return objRequest["TargetFilename"]
+		}
+		return objRequest["Image"]
+	case "collect":
+		return objRequest["CollectPaths"]
+	case "triage":
+		return "Host"
+	default:
+		return ContainmentTarget(objRequest)
+	}
+}
+
+// This function checks that the response is a repeat of a response within
+// DedupWindow. A repeat is counted on the first response. A first response
+// gets DedupId, that is also written with the count of repeats.
+func IsDuplicateResponse(objRequest map[string]string, now time.Time) bool {
+
+	if dedupWindow <= 0 {
+		return false
+	}
+	key := DedupKey(objRequest)
+
+	dedupMutex.Lock()
+	entry, ok := dedupEntries[key]
+	if ok && now.Before(entry.ExpireTime) {
+		entry.Suppressed++
+		dedupMutex.Unlock()
+		return true
+	}
+
+	objRequest["DedupId"] = NewId()
+	dedupEntries[key] = &DedupEntry{
+		Id:         objRequest["DedupId"],
+		Request:    CopyMapString(objRequest),
+		ExpireTime: now.Add(dedupWindow),
+	}
+	dedupMutex.Unlock()
+
+	// the window of previous first response ended before the sweep
+	if ok {
+		WriteSuppressed(entry)
+	}
+	return false
+}
+
+// This function checks the dedup entries every 30 seconds and writes the
+// suppressed repeats of ended windows.
+func WatchDedup() {
+	for range time.Tick(30 * time.Second) {
+		FlushDedup(time.Now())
+	}
+}
+
+// This function removes the entries whose window ended before now and
+// writes their suppressed repeats.
+func FlushDedup(now time.Time) {
+
+	dedupMutex.Lock()
+	ended := make([]*DedupEntry, 0)
+	for key, entry := range dedupEntries {
+		if !now.Before(entry.ExpireTime) {
+			ended = append(ended, entry)
+			delete(dedupEntries, key)
+		}
+	}
+	dedupMutex.Unlock()
+
+	for _, entry := range ended {
+		WriteSuppressed(entry)
+	}
+}
+
+// This function writes the number of repeats suppressed in the window of
+// entry to result log, with the DedupId of the first response.
+func WriteSuppressed(entry *DedupEntry) {
+
+	if entry.Suppressed == 0 {
+		return
+	}
+	objRequest := CopyMapString(entry.Request)
+	objRequest["SuppressedCount"] = strconv.Itoa(entry.Suppressed)
+	WriteResultStatus(objRequest, "Suppressed", strconv.Itoa(entry.Suppressed)+
+		" repeats of response "+entry.Id+" are suppressed in "+dedupWindow.String())
+}
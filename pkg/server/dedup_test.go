@@ -0,0 +1,80 @@
+/**
+ * File:    dedup_test.go
+ *
+ * Summary of File:
+ *
+ * 	This file contains the tests of the deduplication of responses.
+ * 	Functions:
+ * 	Testing that the responses of a rule to distinct targets on one host
+ *	have distinct dedup keys, and that a repeat of a target is suppressed.
+ */
+
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+// This function tests the responses of one rule on one host to two
+// distinct targets of each kind of event: both are executed, the repeat of
+// the first target is suppressed.
+func TestDedupDistinctTargets(t *testing.T) {
+
+	oldWindow := dedupWindow
+	dedupWindow = time.Minute
+	t.Cleanup(func() {
+		dedupWindow = oldWindow
+		dedupMutex.Lock()
+		dedupEntries = make(map[string]*DedupEntry)
+		dedupMutex.Unlock()
+	})
+
+	tests := []struct {
+		name      string
+		request   map[string]string
+		targetKey string
+		targets   [2]string
+	}{
+		{"delete EventCode 11", map[string]string{"EventCode": "11", "Action": "delete"},
+			"TargetFilename", [2]string{`C:\Users\Public\a.exe`, `C:\Users\Public\b.exe`}},
+		{"delete EventCode 7", map[string]string{"EventCode": "7", "Action": "delete"},
+			"ImageLoaded", [2]string{`C:\Temp\a.dll`, `C:\Temp\b.dll`}},
+		{"delete EventCode 13", map[string]string{"EventCode": "13", "Action": "delete"},
+			"TargetObject", [2]string{`HKLM\Software\Run\a`, `HKLM\Software\Run\b`}},
+		{"delete EventCode 14", map[string]string{"EventCode": "14", "Action": "delete"},
+			"NewName", [2]string{`HKLM\Software\Run\c`, `HKLM\Software\Run\d`}},
+		{"kill EventCode 8", map[string]string{"EventCode": "8", "Action": "kill"},
+			"SourceProcessId", [2]string{"4312", "4313"}},
+		{"suspend EventCode 8", map[string]string{"EventCode": "8", "Action": "suspend"},
+			"SourceProcessId", [2]string{"4312", "4313"}},
+		{"kill EventCode 1", map[string]string{"EventCode": "1", "Action": "kill"},
+			"ProcessId", [2]string{"4312", "4313"}},
+	}
+
+	now := time.Now()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			requests := make([]map[string]string, 0, 3)
+			for _, target := range []string{test.targets[0], test.targets[1], test.targets[0]} {
+				request := CopyMapString(test.request)
+				request["Message"] = "rule " + test.name
+				request["ComputerName"] = "WS01"
+				request[test.targetKey] = target
+				requests = append(requests, request)
+			}
+			if DedupTarget(requests[0]) != test.targets[0] {
+				t.Fatalf("target is %q, want %q", DedupTarget(requests[0]), test.targets[0])
+			}
+			if IsDuplicateResponse(requests[0], now) {
+				t.Fatal("first target is suppressed")
+			}
+			if IsDuplicateResponse(requests[1], now) {
+				t.Fatal("second target is suppressed as a repeat of the first target")
+			}
+			if !IsDuplicateResponse(requests[2], now) {
+				t.Fatal("repeat of first target is not suppressed")
+			}
+		})
+	}
+}
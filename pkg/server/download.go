@@ -0,0 +1,432 @@
+/**
+ * File:    download.go
+ *
+ * Summary of File:
+ *
+ * 	This file contains the code related to the files downloaded from agent.
+ * 	Functions:
+ * 	Receiving the file stream, the first message contains the metadata of
+ *	file (size, hashes, timestamps, offset and compression).
+ * 	Verifying the hashes of file after transfer.
+ * 	Writing a JSON sidecar manifest next to each file. Partial downloads
+ *	are kept with .partial suffix, corrupt downloads are deleted.
+ * 	Resuming partial downloads from the last received byte and retrying
+ *	broken transfers.
+ * 	Limiting the size, the rate and choosing the compression of transfer,
+ *	per agent.
+ * 	Receiving archives of collected paths and globs the same way.
+ */
+
+package server
+
+import (
+	"bkedr/pkg/rpc"
+	"compress/gzip"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Status of downloaded file
+const (
+	// Hashes of file are equal to the hashes sent by agent
+	FILE_VERIFIED = "verified"
+	// Agent does not send metadata, file can not be verified
+	FILE_UNVERIFIED = "unverified"
+	// Stream is broken, file is not complete
+	FILE_PARTIAL = "partial"
+	// Hashes of file are different from the hashes sent by agent
+	FILE_CORRUPT = "corrupt"
+)
+
+// FileManifest struct is used to encode json of sidecar manifest file
+type FileManifest struct {
+	ComputerName   string          `json:"ComputerName"`
+	SourcePath     string          `json:"SourcePath"`
+	SavedPath      string          `json:"SavedPath"`
+	Size           int64           `json:"Size"`
+	Sha256         string          `json:"Sha256"`
+	Md5            string          `json:"Md5"`
+	ModTime        string          `json:"ModTime"`
+	AccessTime     string          `json:"AccessTime"`
+	CreateTime     string          `json:"CreateTime"`
+	Compression    string          `json:"Compression"`
+	Contents       json.RawMessage `json:"Contents,omitempty"`
+	ReceivedSize   int64           `json:"ReceivedSize"`
+	ReceivedSha256 string          `json:"ReceivedSha256"`
+	ReceivedMd5    string          `json:"ReceivedMd5"`
+	Attempts       int             `json:"Attempts"`
+	Status         string          `json:"Status"`
+	Error          string          `json:"Error,omitempty"`
+	StartTime      string          `json:"StartTime"`
+	EndTime        string          `json:"EndTime"`
+}
+
+// FileDataReceiver is the client stream of ManagerGetFile and ManagerCollect
+type FileDataReceiver interface {
+	Recv() (*rpc.FileData, error)
+}
+
+// streamReader reads the file chunks of stream as an io.Reader
+type streamReader struct {
+	stream FileDataReceiver
+	buff   []byte
+}
+
+// Read copies the bytes of current chunk to p, and receives the next chunk
+// when the current chunk is read. It returns io.EOF when the stream is done.
+func (r *streamReader) Read(p []byte) (int, error) {
+	for len(r.buff) == 0 {
+		chunkData, err := r.stream.Recv()
+		if err != nil {
+			return 0, err
+		}
+		r.buff = chunkData.GetFileChunk()
+	}
+	n := copy(p, r.buff)
+	r.buff = r.buff[n:]
+	return n, nil
+}
+
+// This function returns the FileInfo with the download limits of agent.
+// Limits in agents config file override the limits in server config file.
+func NewFileInfo(computerName string, filePath string) *rpc.FileInfo {
+
+	fileInfo := &rpc.FileInfo{
+		FilePath:    filePath,
+		MaxSize:     maxFileSize,
+		MaxRate:     maxTransferRate,
+		Compression: compression,
+	}
+
+	for _, agent := range sliceAgentConfig {
+		if agent["ComputerName"] != computerName {
+			continue
+		}
+		if value, err := strconv.ParseInt(agent["MaxFileSize"], 10, 64); err == nil {
+			fileInfo.MaxSize = value
+		}
+		if value, err := strconv.ParseInt(agent["MaxTransferRate"], 10, 64); err == nil {
+			fileInfo.MaxRate = value
+		}
+		if value, ok := agent["Compression"]; ok {
+			fileInfo.Compression = value
+		}
+		break
+	}
+	return fileInfo
+}
+
+// This function downloads the file of fileInfo to manifest.SavedPath. If
+// the transfer is broken, it is retried from the last received byte up to
+// downloadRetries times.
+func DownloadFile(ctx context.Context, client rpc.ManagerClient, fileInfo *rpc.FileInfo,
+	manifest *FileManifest) error {
+
+	return ReceiveWithRetries(manifest, func() (FileDataReceiver, error) {
+
+		// resume from the partial file if the file is not changed on agent
+		fileInfo.Offset = 0
+		fileInfo.Sha256 = manifest.Sha256
+		if info, err := os.Stat(manifest.SavedPath + ".partial"); err == nil {
+			fileInfo.Offset = info.Size()
+		}
+		return client.ManagerGetFile(ctx, fileInfo)
+	})
+}
+
+// This function calls request to open a file stream and receives the file
+// to manifest.SavedPath. If the transfer is broken, it is retried up to
+// downloadRetries times.
+func ReceiveWithRetries(manifest *FileManifest,
+	request func() (FileDataReceiver, error)) error {
+
+	var err error
+	for attempt := 0; attempt <= downloadRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(attempt) * 2 * time.Second)
+		}
+		manifest.Attempts++
+
+		stream, errStream := request()
+		if errStream != nil {
+			err = errStream
+			continue
+		}
+		if err = ReceiveFile(stream, manifest); err == nil {
+			return nil
+		}
+		WriteAppLogError("Error downloads file "+manifest.SourcePath+" from "+
+			manifest.ComputerName+", attempt ", manifest.Attempts, ": ", err)
+	}
+	return err
+}
+
+// This function receives the file stream and writes data to SavedPath of
+// manifest. Data is written to SavedPath.partial until the hashes are
+// verified, then renamed to SavedPath. The manifest is written to
+// SavedPath.json in all cases.
+func ReceiveFile(stream FileDataReceiver, manifest *FileManifest) error {
+
+	manifest.StartTime = FormatCurrentDateMilisecond()
+	manifest.Error = ""
+	partialPath := manifest.SavedPath + ".partial"
+
+	f, err := os.OpenFile(partialPath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// The first message contains the metadata, old agent sends only chunks
+	reader := &streamReader{stream: stream}
+	chunkData, err := stream.Recv()
+	if err != nil && err != io.EOF {
+		return FinishFileManifest(manifest, FILE_PARTIAL, err)
+	}
+	var offset int64
+	if chunkData.GetMeta() != nil {
+		SetFileMeta(manifest, chunkData.GetMeta())
+		offset = chunkData.GetMeta().GetOffset()
+	}
+	reader.buff = chunkData.GetFileChunk()
+
+	// Hash the bytes before offset, that are received in previous download,
+	// and drop the bytes after offset
+	sha256Hash := sha256.New()
+	md5Hash := md5.New()
+	if err := LoadPartialFile(f, offset, sha256Hash, md5Hash); err != nil {
+		return FinishFileManifest(manifest, FILE_PARTIAL, err)
+	}
+
+	var content io.Reader = reader
+	switch manifest.Compression {
+	case "":
+	case "gzip":
+		gzipReader, err := gzip.NewReader(reader)
+		if err != nil {
+			return FinishFileManifest(manifest, FILE_PARTIAL, err)
+		}
+		content = gzipReader
+	default:
+		return FinishFileManifest(manifest, FILE_PARTIAL,
+			errors.New("compression "+manifest.Compression+" is not supported"))
+	}
+
+	// Bytes that are received before the stream is broken stay in the
+	// partial file, so the next download resumes from them
+	received, err := io.Copy(io.MultiWriter(f, sha256Hash, md5Hash), content)
+	manifest.ReceivedSize = offset + received
+	if err != nil {
+		return FinishFileManifest(manifest, FILE_PARTIAL, err)
+	}
+	if err := f.Close(); err != nil {
+		return FinishFileManifest(manifest, FILE_PARTIAL, err)
+	}
+
+	manifest.ReceivedSha256 = hex.EncodeToString(sha256Hash.Sum(nil))
+	manifest.ReceivedMd5 = hex.EncodeToString(md5Hash.Sum(nil))
+
+	// compare the received file with the metadata sent by agent
+	status := FILE_VERIFIED
+	err = nil
+	if manifest.Sha256 == "" {
+		status = FILE_UNVERIFIED
+	} else if manifest.ReceivedSize != manifest.Size {
+		status = FILE_CORRUPT
+		err = fmt.Errorf("size %d is different from %d", manifest.ReceivedSize, manifest.Size)
+	} else if manifest.ReceivedSha256 != manifest.Sha256 || manifest.ReceivedMd5 != manifest.Md5 {
+		status = FILE_CORRUPT
+		err = errors.New("hash " + manifest.ReceivedSha256 + " is different from " +
+			manifest.Sha256)
+	}
+
+	// corrupt file is deleted, only the manifest is kept
+	if status == FILE_CORRUPT {
+		os.Remove(partialPath)
+		return FinishFileManifest(manifest, status, err)
+	}
+
+	if err := os.Rename(partialPath, manifest.SavedPath); err != nil {
+		return FinishFileManifest(manifest, FILE_PARTIAL, err)
+	}
+	return FinishFileManifest(manifest, status, nil)
+}
+
+// This function returns the CollectInfo of request with the limits of
+// agent. MaxDepth, MaxFileSize and MaxTotalSize of request are optional.
+func NewCollectInfo(objRequest map[string]string) (*rpc.CollectInfo, error) {
+
+	fileInfo := NewFileInfo(objRequest["ComputerName"], "")
+	collectInfo := &rpc.CollectInfo{
+		MaxFileSize:  fileInfo.GetMaxSize(),
+		MaxTotalSize: fileInfo.GetMaxSize(),
+		MaxRate:      fileInfo.GetMaxRate(),
+		Format:       objRequest["Format"],
+	}
+
+	for _, path := range strings.Split(objRequest["CollectPaths"], ";") {
+		if path = strings.TrimSpace(path); path != "" {
+			collectInfo.Paths = append(collectInfo.Paths, path)
+		}
+	}
+	if len(collectInfo.Paths) == 0 {
+		return nil, errors.New("CollectPaths is empty")
+	}
+
+	if objRequest["MaxDepth"] != "" {
+		maxDepth, err := strconv.Atoi(objRequest["MaxDepth"])
+		if err != nil {
+			return nil, err
+		}
+		collectInfo.MaxDepth = int32(maxDepth)
+	}
+	for key, value := range map[string]*int64{
+		"MaxFileSize":  &collectInfo.MaxFileSize,
+		"MaxTotalSize": &collectInfo.MaxTotalSize,
+	} {
+		if objRequest[key] == "" {
+			continue
+		}
+		limit, err := strconv.ParseInt(objRequest[key], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		*value = limit
+	}
+	return collectInfo, nil
+}
+
+// This function adds the result of download to request and adds the file
+// to evidence store with the request that triggers it.
+func RecordDownload(manifest *FileManifest, objRequest map[string]string) {
+
+	objRequest["SavedPath"] = manifest.SavedPath
+	objRequest["Sha256"] = manifest.ReceivedSha256
+	objRequest["Md5"] = manifest.ReceivedMd5
+
+	if _, err := AddEvidence(manifest, objRequest); err != nil {
+		WriteAppLogError("Error adds evidence "+manifest.SavedPath+": ", err)
+	} else {
+		objRequest["EvidenceId"] = manifest.ReceivedSha256
+	}
+}
+
+// This function truncates the partial file to offset, writes the bytes
+// before offset to hashes and moves to the end of file.
+func LoadPartialFile(f *os.File, offset int64, hashes ...hash.Hash) error {
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if offset > info.Size() {
+		return fmt.Errorf("offset %d is larger than partial file %d", offset, info.Size())
+	}
+	if err := f.Truncate(offset); err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	writers := make([]io.Writer, len(hashes))
+	for i, h := range hashes {
+		writers[i] = h
+	}
+	_, err = io.CopyN(io.MultiWriter(writers...), f, offset)
+	return err
+}
+
+// This function copies the metadata sent by agent to manifest
+func SetFileMeta(manifest *FileManifest, fileMeta *rpc.FileMeta) {
+	manifest.Size = fileMeta.GetSize()
+	manifest.Sha256 = fileMeta.GetSha256()
+	manifest.Md5 = fileMeta.GetMd5()
+	manifest.ModTime = fileMeta.GetModTime()
+	manifest.AccessTime = fileMeta.GetAccessTime()
+	manifest.CreateTime = fileMeta.GetCreateTime()
+	manifest.Compression = fileMeta.GetCompression()
+
+	// archive of collected files contains the list of files, memory dump
+	// contains the list of memory regions
+	if json.Valid([]byte(fileMeta.GetManifest())) {
+		manifest.Contents = json.RawMessage(fileMeta.GetManifest())
+	}
+}
+
+// This function sets status and error of manifest, writes the manifest
+// to file and returns the error.
+func FinishFileManifest(manifest *FileManifest, status string, err error) error {
+
+	manifest.Status = status
+	manifest.EndTime = FormatCurrentDateMilisecond()
+	if err != nil {
+		manifest.Error = err.Error()
+	}
+
+	if errWrite := WriteFileManifest(manifest); errWrite != nil {
+		WriteAppLogError(errWrite)
+	}
+	return err
+}
+
+// This function returns the manifest of the latest partial download of
+// sourcePath from agent computerName. It returns nil if there is no partial
+// download in dirPath.
+func FindPartialDownload(dirPath string, computerName string, sourcePath string) *FileManifest {
+
+	manifestPaths, err := filepath.Glob(filepath.Join(dirPath, "*.json"))
+	if err != nil {
+		return nil
+	}
+
+	var partial *FileManifest
+	for _, manifestPath := range manifestPaths {
+		byteValue, err := ioutil.ReadFile(manifestPath)
+		if err != nil {
+			continue
+		}
+		manifest := &FileManifest{}
+		if err := json.Unmarshal(byteValue, manifest); err != nil {
+			continue
+		}
+		if manifest.Status != FILE_PARTIAL || manifest.ComputerName != computerName ||
+			manifest.SourcePath != sourcePath {
+			continue
+		}
+		if _, err := os.Stat(manifest.SavedPath + ".partial"); err != nil {
+			continue
+		}
+		if partial == nil || manifest.StartTime > partial.StartTime {
+			partial = manifest
+		}
+	}
+	return partial
+}
+
+// This function returns the path of manifest file of the downloaded file
+func FileManifestPath(manifest *FileManifest) string {
+	return manifest.SavedPath + ".json"
+}
+
+// This function writes the manifest next to the downloaded file
+func WriteFileManifest(manifest *FileManifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(FileManifestPath(manifest), data, 0644)
+}
@@ -0,0 +1,146 @@
+/**
+ * File:    elastic.go
+ *
+ * Summary of File:
+ *
+ * 	This file contains the code of the Elasticsearch result sink. The
+ * 	results are indexed with the bulk API.
+ * 	Functions:
+ * 	Encoding a result as a document with @timestamp.
+ * 	Posting a batch of documents to the bulk API. The id of a document is
+ *	the SHA-256 of the document, so a batch that is sent again does not
+ *	duplicate documents.
+ */
+
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Path of bulk API of Elasticsearch
+const ELASTIC_BULK_PATH = "/_bulk"
+
+// ElasticSender struct indexes the documents of results in Elasticsearch
+type ElasticSender struct {
+	config   SinkConfig
+	client   *http.Client
+	endpoint string
+}
+
+// ElasticBulkResponse struct is used to decode the response of bulk API
+type ElasticBulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int             `json:"status"`
+		Error  json.RawMessage `json:"error"`
+	} `json:"items"`
+}
+
+// This function creates the Elasticsearch sink of config. Url is the
+// address of Elasticsearch, user and password of Url are used for basic
+// authentication, Token is sent as an API key if it is set. Index is bkedr
+// by default.
+func NewElasticSink(config SinkConfig) (*BatchSink, error) {
+
+	if config.Url == "" {
+		return nil, errors.New("Url of elasticsearch sink is required")
+	}
+	endpoint, err := url.Parse(config.Url)
+	if err != nil {
+		return nil, err
+	}
+	endpoint.Path = strings.TrimSuffix(endpoint.Path, "/") + ELASTIC_BULK_PATH
+	client, err := NewSinkHttpClient(config)
+	if err != nil {
+		return nil, err
+	}
+	if config.Index == "" {
+		config.Index = "bkedr"
+	}
+	return NewBatchSink(config, &ElasticSender{
+		config:   config,
+		client:   client,
+		endpoint: endpoint.String(),
+	}), nil
+}
+
+// This function returns the document of result. @timestamp is the time of
+// result.
+func (sender *ElasticSender) Encode(result map[string]string) ([]byte, error) {
+
+	document := make(map[string]string, len(result)+1)
+	for key, value := range result {
+		document[key] = value
+	}
+	document["@timestamp"] = ResultEventTime(result).Format("2006-01-02T15:04:05.000Z07:00")
+	return json.Marshal(document)
+}
+
+// This function indexes the documents of batch with the bulk API. A network
+// error, a busy or a server error, or a document rejected because
+// Elasticsearch is busy can be retried.
+func (sender *ElasticSender) Send(batch [][]byte) (bool, error) {
+
+	var body bytes.Buffer
+	for _, document := range batch {
+		hash := sha256.Sum256(document)
+		action, _ := json.Marshal(map[string]map[string]string{
+			"index": {"_index": sender.config.Index, "_id": hex.EncodeToString(hash[:])},
+		})
+		body.Write(action)
+		body.WriteByte('\n')
+		body.Write(document)
+		body.WriteByte('\n')
+	}
+
+	request, err := http.NewRequest(http.MethodPost, sender.endpoint, &body)
+	if err != nil {
+		return false, err
+	}
+	request.Header.Set("Content-Type", "application/x-ndjson")
+	if sender.config.Token != "" {
+		request.Header.Set("Authorization", "ApiKey "+sender.config.Token)
+	}
+
+	response, err := sender.client.Do(request)
+	if err != nil {
+		return true, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		text, _ := ioutil.ReadAll(io.LimitReader(response.Body, 1024))
+		return CheckHttpResponse(response, text)
+	}
+
+	// the bulk API returns 200 even if some documents are rejected
+	bulkResponse := ElasticBulkResponse{}
+	if err := json.NewDecoder(response.Body).Decode(&bulkResponse); err != nil {
+		return true, err
+	}
+	if !bulkResponse.Errors {
+		return false, nil
+	}
+	retry := false
+	var itemError json.RawMessage
+	for _, item := range bulkResponse.Items {
+		for _, result := range item {
+			if result.Status == http.StatusTooManyRequests {
+				retry = true
+			}
+			if itemError == nil && result.Error != nil {
+				itemError = result.Error
+			}
+		}
+	}
+	return retry, errors.New("elasticsearch rejects documents: " + string(itemError))
+}
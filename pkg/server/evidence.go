@@ -0,0 +1,448 @@
+/**
+ * File:    evidence.go
+ *
+ * Summary of File:
+ *
+ * 	This file contains the code related to the evidence store of the
+ * 	bkedr server.
+ * 	Functions:
+ * 	Storing downloaded files by SHA-256, identical files from different
+ *	agents are stored once.
+ * 	Recording the sources of each evidence: agent, original path,
+ *	triggering rule and event, collector and timestamps.
+ * 	Appending every collection, access and export of an evidence to its
+ *	custody log. Each entry contains the hash of the previous entry, so
+ *	a modified or removed entry is detected.
+ * 	Handling evidence commands (show, verify, export) sent by the
+ *	administrator.
+ */
+
+package server
+
+import (
+	"bkedr/pkg/rpc"
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Collector of evidence when the request does not set one
+const DEFAULT_COLLECTOR = "bkedr server"
+
+// Actions of custody log
+const (
+	CUSTODY_COLLECT = "collect"
+	CUSTODY_ACCESS  = "access"
+	CUSTODY_VERIFY  = "verify"
+	CUSTODY_EXPORT  = "export"
+)
+
+// Mutex protects the files of evidence store
+var evidenceMutex sync.Mutex
+
+// EvidenceSource struct is used to encode json of a source of evidence
+type EvidenceSource struct {
+	ComputerName  string `json:"ComputerName"`
+	OriginalPath  string `json:"OriginalPath"`
+	Rule          string `json:"Rule"`
+	EventCode     string `json:"EventCode"`
+	Event         string `json:"Event"`
+	Collector     string `json:"Collector"`
+	CollectedTime string `json:"CollectedTime"`
+	ModTime       string `json:"ModTime"`
+	AccessTime    string `json:"AccessTime"`
+	CreateTime    string `json:"CreateTime"`
+	DownloadPath  string `json:"DownloadPath"`
+}
+
+// EvidenceRecord struct is used to encode json of evidence record file
+type EvidenceRecord struct {
+	Sha256    string           `json:"Sha256"`
+	Md5       string           `json:"Md5"`
+	Size      int64            `json:"Size"`
+	FirstSeen string           `json:"FirstSeen"`
+	Sources   []EvidenceSource `json:"Sources"`
+}
+
+// CustodyEntry struct is used to encode json of a line of custody log
+type CustodyEntry struct {
+	Time     string `json:"Time"`
+	Sha256   string `json:"Sha256"`
+	Action   string `json:"Action"`
+	Actor    string `json:"Actor"`
+	Detail   string `json:"Detail"`
+	PrevHash string `json:"PrevHash"`
+	Hash     string `json:"Hash"`
+}
+
+// This function returns path of the object file, the record file and the
+// custody log of evidence
+func EvidencePaths(sha string) (string, string, string) {
+	return filepath.Join(evidenceDirPath, "objects", sha[:2], sha),
+		filepath.Join(evidenceDirPath, "records", sha+".json"),
+		filepath.Join(evidenceDirPath, "custody", sha+".log")
+}
+
+// This function adds the downloaded file of manifest to evidence store.
+// If the file is already stored, only the new source is added to record.
+func AddEvidence(manifest *FileManifest, objRequest map[string]string) (*EvidenceRecord, error) {
+
+	sha := manifest.ReceivedSha256
+	if len(sha) != sha256.Size*2 {
+		return nil, errors.New("sha256 of " + manifest.SavedPath + " is invalid")
+	}
+
+	evidenceMutex.Lock()
+	defer evidenceMutex.Unlock()
+
+	objectPath, recordPath, _ := EvidencePaths(sha)
+	for _, dirPath := range []string{filepath.Dir(objectPath), filepath.Dir(recordPath),
+		filepath.Join(evidenceDirPath, "custody")} {
+		if err := os.MkdirAll(dirPath, 0700); err != nil {
+			return nil, err
+		}
+	}
+
+	// the object is written once, identical files are deduplicated
+	if _, err := os.Stat(objectPath); os.IsNotExist(err) {
+		if err := StoreEvidenceObject(manifest.SavedPath, objectPath, sha); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	record, err := ReadEvidenceRecord(sha)
+	if os.IsNotExist(err) {
+		record = &EvidenceRecord{
+			Sha256:    sha,
+			Md5:       manifest.ReceivedMd5,
+			Size:      manifest.ReceivedSize,
+			FirstSeen: FormatCurrentDateMilisecond(),
+			Sources:   make([]EvidenceSource, 0),
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	// the triggering event is kept as the request sent to agent
+	event, err := json.Marshal(objRequest)
+	if err != nil {
+		return nil, err
+	}
+	collector := objRequest["Collector"]
+	if collector == "" {
+		collector = DEFAULT_COLLECTOR
+	}
+	source := EvidenceSource{
+		ComputerName:  manifest.ComputerName,
+		OriginalPath:  manifest.SourcePath,
+		Rule:          objRequest["Message"],
+		EventCode:     objRequest["EventCode"],
+		Event:         string(event),
+		Collector:     collector,
+		CollectedTime: manifest.EndTime,
+		ModTime:       manifest.ModTime,
+		AccessTime:    manifest.AccessTime,
+		CreateTime:    manifest.CreateTime,
+		DownloadPath:  manifest.SavedPath,
+	}
+	record.Sources = append(record.Sources, source)
+
+	if err := WriteEvidenceRecord(record); err != nil {
+		return nil, err
+	}
+	if err := AppendCustody(sha, CUSTODY_COLLECT, collector,
+		source.ComputerName+":"+source.OriginalPath); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// This function copies the downloaded file to object path. The content is
+// hashed while copying, so the stored object is the verified content.
+func StoreEvidenceObject(srcPath string, objectPath string, sha string) error {
+
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmpPath := objectPath + ".tmp"
+	dst, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(dst, hash), src)
+	if errClose := dst.Close(); err == nil {
+		err = errClose
+	}
+	if err == nil && hex.EncodeToString(hash.Sum(nil)) != sha {
+		err = errors.New("hash of " + srcPath + " is different from " + sha)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	// object is read only, it is never modified after stored
+	if err := os.Chmod(tmpPath, 0400); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, objectPath)
+}
+
+// This function reads the evidence record of sha
+func ReadEvidenceRecord(sha string) (*EvidenceRecord, error) {
+
+	_, recordPath, _ := EvidencePaths(sha)
+	byteValue, err := ioutil.ReadFile(recordPath)
+	if err != nil {
+		return nil, err
+	}
+	record := &EvidenceRecord{}
+	if err := json.Unmarshal(byteValue, record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// This function writes the evidence record to record file
+func WriteEvidenceRecord(record *EvidenceRecord) error {
+
+	_, recordPath, _ := EvidencePaths(record.Sha256)
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(recordPath, data, 0600)
+}
+
+// This function appends an entry to the custody log of evidence. The hash
+// of entry is computed from the hash of previous entry and the fields of
+// entry.
+func AppendCustody(sha string, action string, actor string, detail string) error {
+
+	entries, err := ReadCustody(sha)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	entry := &CustodyEntry{
+		Time:   FormatCurrentDateMilisecond(),
+		Sha256: sha,
+		Action: action,
+		Actor:  actor,
+		Detail: detail,
+	}
+	if len(entries) > 0 {
+		entry.PrevHash = entries[len(entries)-1].Hash
+	}
+	entry.Hash = CustodyHash(entry)
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	// custody log is only opened to append
+	_, _, custodyPath := EvidencePaths(sha)
+	file, err := os.OpenFile(custodyPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(data, 10)); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// This function reads all entries of the custody log of evidence
+func ReadCustody(sha string) ([]*CustodyEntry, error) {
+
+	_, _, custodyPath := EvidencePaths(sha)
+	file, err := os.Open(custodyPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	entries := make([]*CustodyEntry, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		entry := &CustodyEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), entry); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// This function returns the hash of custody entry
+func CustodyHash(entry *CustodyEntry) string {
+	hash := sha256.Sum256([]byte(strings.Join([]string{entry.PrevHash, entry.Time,
+		entry.Sha256, entry.Action, entry.Actor, entry.Detail}, "\n")))
+	return hex.EncodeToString(hash[:])
+}
+
+// This function checks the content of evidence object with its SHA-256 and
+// checks the hash chain of its custody log.
+func VerifyEvidence(sha string) error {
+
+	objectPath, _, _ := EvidencePaths(sha)
+	file, err := os.Open(objectPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return err
+	}
+	if hex.EncodeToString(hash.Sum(nil)) != sha {
+		return errors.New("content of evidence " + sha + " is modified")
+	}
+
+	entries, err := ReadCustody(sha)
+	if err != nil {
+		return err
+	}
+	prevHash := ""
+	for index, entry := range entries {
+		if entry.PrevHash != prevHash || entry.Hash != CustodyHash(entry) {
+			return errors.New("custody log of evidence " + sha + " is modified at entry " +
+				entry.Time + ", line " + strconv.Itoa(index+1))
+		}
+		prevHash = entry.Hash
+	}
+	return nil
+}
+
+// This function copies the evidence object, its record and its custody log
+// to exportDir. The export is appended to custody log before the custody log
+// is copied.
+func ExportEvidence(sha string, exportDir string, actor string) (string, error) {
+
+	if err := VerifyEvidence(sha); err != nil {
+		return "", err
+	}
+	if err := AppendCustody(sha, CUSTODY_EXPORT, actor, exportDir); err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(exportDir, 0700); err != nil {
+		return "", err
+	}
+
+	objectPath, recordPath, custodyPath := EvidencePaths(sha)
+	exportPath := filepath.Join(exportDir, sha)
+	for src, dst := range map[string]string{
+		objectPath:  exportPath + ".bin",
+		recordPath:  exportPath + ".json",
+		custodyPath: exportPath + ".custody.log",
+	} {
+		if err := CopyFile(src, dst); err != nil {
+			return "", err
+		}
+	}
+	return exportPath + ".bin", nil
+}
+
+// This function copies srcPath to dstPath
+func CopyFile(srcPath string, dstPath string) error {
+
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(dstPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+// This function handles the evidence command sent by the administrator and
+// writes the result to result log file. "Action Evidence" is one of:
+//   - show: set EvidenceRecord of command to the record of Sha256
+//   - verify: check the content and the custody log of Sha256
+//   - export: copy the evidence Sha256 to ExportDir
+//
+// Actor of command is recorded in the custody log.
+func HandleEvidence(command map[string]string) error {
+
+	sha := strings.ToLower(command["Sha256"])
+	if len(sha) != sha256.Size*2 {
+		return errors.New("Error: Sha256 " + command["Sha256"] + " is invalid")
+	}
+	actor := command["Actor"]
+	if actor == "" {
+		actor = "administrator"
+	}
+
+	evidenceMutex.Lock()
+	defer evidenceMutex.Unlock()
+
+	if _, err := ReadEvidenceRecord(sha); err != nil {
+		return errors.New("Error: evidence " + sha + " is not found: " + err.Error())
+	}
+
+	var err error
+	responseResult := &rpc.ResponseResult{}
+	switch command["Action Evidence"] {
+	case "show":
+		var record *EvidenceRecord
+		var data []byte
+		if record, err = ReadEvidenceRecord(sha); err == nil {
+			if data, err = json.Marshal(record); err == nil {
+				command["EvidenceRecord"] = string(data)
+				err = AppendCustody(sha, CUSTODY_ACCESS, actor, "show")
+			}
+		}
+		responseResult.ResultInfo = "Show evidence " + sha
+	case "verify":
+		if err = VerifyEvidence(sha); err == nil {
+			err = AppendCustody(sha, CUSTODY_VERIFY, actor, "verified")
+		}
+		responseResult.ResultInfo = "Evidence " + sha + " is verified"
+	case "export":
+		var exportPath string
+		if command["ExportDir"] == "" {
+			err = errors.New("ExportDir is empty")
+		} else if exportPath, err = ExportEvidence(sha, command["ExportDir"], actor); err == nil {
+			command["ExportPath"] = exportPath
+		}
+		responseResult.ResultInfo = "Export evidence " + sha + " to " + command["ExportDir"]
+	default:
+		return errors.New("Error: Action Evidence " +
+			command["Action Evidence"] + " is not supported")
+	}
+
+	if err != nil {
+		responseResult.ResultInfo = "Error: " + err.Error()
+	} else {
+		responseResult.Result = true
+	}
+	HandleResult(responseResult, command)
+	return nil
+}
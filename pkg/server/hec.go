@@ -0,0 +1,112 @@
+/**
+ * File:    hec.go
+ *
+ * Summary of File:
+ *
+ * 	This file contains the code of the Splunk HTTP Event Collector (HEC)
+ * 	result sink. The results are sent to Splunk without a Universal
+ *	Forwarder on the bkedr server.
+ * 	Functions:
+ * 	Encoding a result as a HEC event with the time of result and the agent
+ *	as host.
+ * 	Posting a batch of events to the HEC endpoint with the HEC token.
+ */
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// Path of HEC endpoint of JSON events
+const HEC_EVENT_PATH = "/services/collector/event"
+
+// HecSender struct posts the events of results to Splunk HEC
+type HecSender struct {
+	config   SinkConfig
+	client   *http.Client
+	endpoint string
+}
+
+// This function creates the HEC sink of config. Source is bkedr and
+// Sourcetype is bkedr:result by default.
+func NewHecSink(config SinkConfig) (*BatchSink, error) {
+
+	if config.Url == "" || config.Token == "" {
+		return nil, errors.New("Url and Token of HEC sink are required")
+	}
+	endpoint, err := url.Parse(config.Url)
+	if err != nil {
+		return nil, err
+	}
+	// Url can be the address of HEC without the path of endpoint
+	if endpoint.Path == "" || endpoint.Path == "/" {
+		endpoint.Path = HEC_EVENT_PATH
+	}
+	client, err := NewSinkHttpClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Source == "" {
+		config.Source = "bkedr"
+	}
+	if config.Sourcetype == "" {
+		config.Sourcetype = "bkedr:result"
+	}
+	return NewBatchSink(config, &HecSender{
+		config:   config,
+		client:   client,
+		endpoint: endpoint.String(),
+	}), nil
+}
+
+// This function returns the HEC event of result. The time of event is the
+// ResultTime of result and the host is the agent of result.
+func (sender *HecSender) Encode(result map[string]string) ([]byte, error) {
+
+	host := result["ComputerName"]
+	if host == "" {
+		host, _ = os.Hostname()
+	}
+	event := map[string]interface{}{
+		"time":       float64(ResultEventTime(result).UnixNano()/int64(time.Millisecond)) / 1000,
+		"host":       host,
+		"source":     sender.config.Source,
+		"sourcetype": sender.config.Sourcetype,
+		"event":      result,
+	}
+	if sender.config.Index != "" {
+		event["index"] = sender.config.Index
+	}
+	return json.Marshal(event)
+}
+
+// This function posts the events of batch to HEC. A network error, a busy
+// or a server error can be retried.
+func (sender *HecSender) Send(batch [][]byte) (bool, error) {
+
+	request, err := http.NewRequest(http.MethodPost, sender.endpoint,
+		bytes.NewReader(bytes.Join(batch, []byte("\n"))))
+	if err != nil {
+		return false, err
+	}
+	request.Header.Set("Authorization", "Splunk "+sender.config.Token)
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := sender.client.Do(request)
+	if err != nil {
+		return true, err
+	}
+	defer response.Body.Close()
+	text, _ := ioutil.ReadAll(io.LimitReader(response.Body, 1024))
+	return CheckHttpResponse(response, text)
+}
@@ -0,0 +1,331 @@
+/**
+ * File:    ingest.go
+ *
+ * Summary of File:
+ *
+ * 	This file contains the code of the HTTP ingestion endpoint of the bkedr
+ * 	server. Many sources (Splunk search heads, Logstash, SOAR) can send
+ *	their events, each source has its own token.
+ * 	Functions:
+ * 	Authenticating the source of request with its token.
+ * 	Decoding the events of Splunk HEC (/services/collector/event and
+ *	/services/collector/raw), of Splunk webhook alert action and of a
+ *	JSON array or object (/ingest). Events of other formats (Sysmon XML,
+ *	Winlogbeat, Get-WinEvent) are normalized by the input decoders.
+ * 	Handling each event like a log of the splunk raw socket, the event
+ *	gets the name of its source in IngestSource.
+ */
+
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Max size of the body of an ingestion request, 10 MB
+const MAX_INGEST_BODY_SIZE = 10 << 20
+
+// Regex matches each Windows event of a XML body
+var reXmlEvent = regexp.MustCompile(`(?s)<Event[ >].*?</Event>`)
+
+// IngestSourceConfig struct is used to decode json of an ingestion source.
+// TokenSha256 is the SHA-256 of the token of source. A source can send
+// commands of the administrator only if AllowCommands is true.
+type IngestSourceConfig struct {
+	Name          string `json:"Name"`
+	TokenSha256   string `json:"TokenSha256"`
+	AllowCommands bool   `json:"AllowCommands"`
+}
+
+// This function starts the HTTP ingestion endpoint on ingestAddress, with
+// TLS if the certificate of endpoint is set.
+func StartIngestServer() {
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/services/collector", HandleIngestHec)
+	mux.HandleFunc("/services/collector/event", HandleIngestHec)
+	mux.HandleFunc("/services/collector/event/1.0", HandleIngestHec)
+	mux.HandleFunc("/services/collector/raw", HandleIngestRaw)
+	mux.HandleFunc("/services/collector/raw/1.0", HandleIngestRaw)
+	mux.HandleFunc("/ingest", HandleIngestJson)
+
+	server := &http.Server{Addr: ingestAddress, Handler: mux}
+	WriteAppLogInfo("Starting HTTP ingestion on " + ingestAddress)
+	var err error
+	if ingestCertFile != "" {
+		err = server.ListenAndServeTLS(ingestCertFile, ingestKeyFile)
+	} else {
+		err = server.ListenAndServe()
+	}
+	WriteAppLogError("Error listening HTTP ingestion: ", err)
+}
+
+// This function returns the source of the token of request. The token is
+// sent in header Authorization (Splunk <token> or Bearer <token>) or in
+// query token, because the Splunk webhook alert action cannot set headers.
+func AuthenticateIngestSource(request *http.Request) (*IngestSourceConfig, bool) {
+
+	token := request.URL.Query().Get("token")
+	authorization := request.Header.Get("Authorization")
+	for _, scheme := range []string{"Splunk ", "Bearer "} {
+		if strings.HasPrefix(authorization, scheme) {
+			token = strings.TrimSpace(authorization[len(scheme):])
+		}
+	}
+	if token == "" {
+		return nil, false
+	}
+
+	hash := sha256.Sum256([]byte(token))
+	tokenSha256 := []byte(hex.EncodeToString(hash[:]))
+	for index := range ingestSources {
+		source := &ingestSources[index]
+		if subtle.ConstantTimeCompare(tokenSha256, []byte(source.TokenSha256)) == 1 {
+			return source, true
+		}
+	}
+	return nil, false
+}
+
+// This function handles a request of Splunk HEC event endpoint. The body is
+// a sequence of HEC events, the fields of event are the log.
+func HandleIngestHec(writer http.ResponseWriter, request *http.Request) {
+	HandleIngest(writer, request, DecodeHecEvents)
+}
+
+// This function handles a request of Splunk HEC raw endpoint. The body is
+// a log per line, like the splunk raw socket.
+func HandleIngestRaw(writer http.ResponseWriter, request *http.Request) {
+	HandleIngest(writer, request, DecodeRawEvents)
+}
+
+// This function handles a request of the generic endpoint. The body is a
+// Splunk webhook alert action, a JSON array of logs or a JSON log.
+func HandleIngestJson(writer http.ResponseWriter, request *http.Request) {
+	HandleIngest(writer, request, DecodeJsonEvents)
+}
+
+// This function authenticates the source of request, decodes the events of
+// body with decode, then handles the events in background. The reply is a
+// HEC reply, so the senders of HEC accept it.
+func HandleIngest(writer http.ResponseWriter, request *http.Request,
+	decode func(body io.Reader) ([]map[string]interface{}, error)) {
+
+	if request.Method != http.MethodPost {
+		WriteIngestReply(writer, http.StatusMethodNotAllowed, "Method not allowed", 10)
+		return
+	}
+	source, ok := AuthenticateIngestSource(request)
+	if !ok {
+		WriteAppLogError("Unauthorized ingestion request from " + request.RemoteAddr)
+		WriteIngestReply(writer, http.StatusUnauthorized, "Invalid token", 4)
+		return
+	}
+
+	events, err := decode(http.MaxBytesReader(writer, request.Body, MAX_INGEST_BODY_SIZE))
+	if err != nil {
+		WriteAppLogError("Error decodes ingestion request of "+source.Name+": ", err)
+		WriteIngestReply(writer, http.StatusBadRequest, "Invalid data format", 6)
+		return
+	}
+
+	jsonStrings := make([]string, 0, len(events))
+	for _, event := range events {
+		data, err := json.Marshal(event)
+		if err != nil {
+			WriteIngestReply(writer, http.StatusBadRequest, "Invalid data format", 6)
+			return
+		}
+		jsonString, ok := NormalizeSourceEvent(string(data), source.Name, nil,
+			source.AllowCommands)
+		if !ok {
+			WriteAppLogError("Source " + source.Name + " is not allowed to send commands")
+			WriteIngestReply(writer, http.StatusForbidden, "Commands are not allowed", 3)
+			return
+		}
+		jsonStrings = append(jsonStrings, jsonString)
+	}
+
+	// responses can take long, the events are acknowledged when received
+	go func() {
+		for _, jsonString := range jsonStrings {
+			HandleLog(jsonString)
+		}
+	}()
+	WriteIngestReply(writer, http.StatusOK, "Success", 0)
+}
+
+// This function normalizes an event of source and sets IngestSource to the
+// name of source and the fields of overrides. Events of other formats are
+// normalized before, so these fields are kept. It returns false if the
+// event is a command and the source cannot send commands.
+func NormalizeSourceEvent(jsonString string, sourceName string,
+	overrides map[string]string, allowCommands bool) (string, bool) {
+
+	event := ConvertJsonToInterface(NormalizeLog(jsonString))
+	if !allowCommands && IsAdminCommand(event) {
+		return "", false
+	}
+	event["IngestSource"] = sourceName
+	for key, value := range overrides {
+		event[key] = value
+	}
+	data, _ := json.Marshal(event)
+	return string(data), true
+}
+
+// This function writes a reply with the text and code of Splunk HEC
+func WriteIngestReply(writer http.ResponseWriter, status int, text string, code int) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	json.NewEncoder(writer).Encode(map[string]interface{}{"text": text, "code": code})
+}
+
+// This function decodes a sequence of HEC events. The log is the field
+// event, it is a JSON object or a string of JSON object.
+func DecodeHecEvents(body io.Reader) ([]map[string]interface{}, error) {
+
+	events := make([]map[string]interface{}, 0)
+	decoder := json.NewDecoder(body)
+	for {
+		hecEvent := struct {
+			Event json.RawMessage `json:"event"`
+		}{}
+		if err := decoder.Decode(&hecEvent); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		event, err := DecodeJsonObject(hecEvent.Event)
+		if err != nil {
+			// the event of HEC can be the text of a JSON object or of a
+			// XML event
+			var text string
+			if json.Unmarshal(hecEvent.Event, &text) != nil {
+				return nil, err
+			}
+			if event, err = DecodeTextEvent([]byte(text)); err != nil {
+				return nil, err
+			}
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// This function decodes a JSON log per line
+func DecodeRawEvents(body io.Reader) ([]map[string]interface{}, error) {
+
+	events := make([]map[string]interface{}, 0)
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), MAX_INGEST_BODY_SIZE)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		event, err := DecodeTextEvent(line)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, scanner.Err()
+}
+
+// This function decodes a Splunk webhook alert action, the log is its field
+// result, or a JSON array of logs, or a JSON log, or XML events.
+func DecodeJsonEvents(body io.Reader) ([]map[string]interface{}, error) {
+
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimSpace(data)
+
+	if bytes.HasPrefix(data, []byte("<")) {
+		events := make([]map[string]interface{}, 0)
+		for _, xmlEvent := range reXmlEvent.FindAll(data, -1) {
+			event, err := DecodeTextEvent(xmlEvent)
+			if err != nil {
+				return nil, err
+			}
+			events = append(events, event)
+		}
+		if len(events) == 0 {
+			return nil, errors.New("body has no XML event")
+		}
+		return events, nil
+	}
+
+	if bytes.HasPrefix(data, []byte("[")) {
+		events := make([]map[string]interface{}, 0)
+		if err := json.Unmarshal(data, &events); err != nil {
+			return nil, err
+		}
+		for _, event := range events {
+			if event == nil {
+				return nil, errors.New("event is not a JSON object")
+			}
+		}
+		return events, nil
+	}
+
+	event, err := DecodeJsonObject(data)
+	if err != nil {
+		return nil, err
+	}
+	// Splunk webhook alert action has the fields of the first result in
+	// result, and the name of search in search_name
+	if result, ok := event["result"].(map[string]interface{}); ok {
+		if _, ok := event["search_name"]; ok {
+			return []map[string]interface{}{result}, nil
+		}
+	}
+	return []map[string]interface{}{event}, nil
+}
+
+// This function decodes a JSON object or a XML event. A XML event is
+// decoded into the fields of rules.
+func DecodeTextEvent(data []byte) (map[string]interface{}, error) {
+
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("<")) {
+		return DecodeJsonObject(data)
+	}
+	fields, decoder, err := DecodeLog(data)
+	if err != nil {
+		return nil, err
+	}
+	if decoder == nil {
+		return nil, errors.New("event is not a XML event")
+	}
+	event := make(map[string]interface{}, len(fields))
+	for key, value := range fields {
+		event[key] = value
+	}
+	return event, nil
+}
+
+// This function decodes a JSON object
+func DecodeJsonObject(data []byte) (map[string]interface{}, error) {
+	event := make(map[string]interface{})
+	if err := json.Unmarshal(data, &event); err != nil {
+		return nil, err
+	}
+	if event == nil {
+		return nil, errors.New("event is not a JSON object")
+	}
+	return event, nil
+}
@@ -0,0 +1,242 @@
+/**
+ * File:    localrules.go
+ *
+ * Summary of File:
+ *
+ * 	This file contains the code related to the local rules of agents. When
+ * 	the bkedr server or Splunk is unreachable, the agent compares its
+ *	events with a signed copy of the local rules and responds itself.
+ * 	Functions:
+ * 	Selecting the rules that agents can execute locally, the server is the
+ *	source of truth of local rules.
+ * 	Signing the local rules with the Ed25519 key of server and pushing them
+ *	to agents when they connect and when the rules change.
+ * 	Signing the claims of the requests that agents only accept from the
+ *	server (ex: override of protected processes, config profiles).
+ * 	Receiving the results of local responses that agents upload when the
+ *	server is reachable again.
+ */
+
+package server
+
+import (
+	"bkedr/pkg/detection"
+	"bkedr/pkg/rpc"
+	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Actions that agents can execute without the server. Actions that
+// download files, run playbooks or wait for approval need the server.
+var localActions = []string{"kill", "killtree", "suspend", "delete", "quarantine",
+	"block_src_ip", "block_dst_ip", "block_src_port", "block_dst_port", "isolate"}
+
+// Private key that signs the local rules, nil is disabled
+var localRulesKey ed25519.PrivateKey
+
+// LocalRuleSet struct is the JSON of rule set that is signed. Version is
+// the time of signature, agents reject a rule set older than theirs.
+type LocalRuleSet struct {
+	Version int64                    `json:"Version"`
+	Rules   []map[string]interface{} `json:"Rules"`
+}
+
+// This function loads the Ed25519 private key of PEM file (PKCS #8), ex:
+// openssl genpkey -algorithm ed25519 -out localrules.key
+func LoadLocalRulesKey(keyPath string) (ed25519.PrivateKey, error) {
+
+	data, err := ioutil.ReadFile(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("key " + keyPath + " is not PEM")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New("key " + keyPath + " is not Ed25519")
+	}
+	return privateKey, nil
+}
+
+// This function returns the JSON of claims signed by the key of local rules:
+// the claims and the signature, in base64 and separated by ".".
+func SignClaims(claims interface{}) (string, error) {
+
+	if localRulesKey == nil {
+		return "", errors.New("LocalRulesKeyPath is not set")
+	}
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signature := ed25519.Sign(localRulesKey, data)
+	return base64.RawURLEncoding.EncodeToString(data) + "." +
+		base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// This function checks that the rule is local: "Local" is true, every
+// action of rule is a local action and the rule does not require approval.
+func IsLocalRule(rule map[string]interface{}) bool {
+
+	if fmt.Sprintf("%v", rule["Local"]) != "true" {
+		return false
+	}
+	if fmt.Sprintf("%v", rule["RequiresApproval"]) == "true" {
+		return false
+	}
+	if _, ok := rule["Data"].(map[string]interface{}); !ok {
+		return false
+	}
+	for _, action := range strings.Split(fmt.Sprintf("%v", rule["Action"]), ",") {
+		if !CheckStringInSlice(strings.TrimSpace(action), localActions) {
+			return false
+		}
+	}
+	return true
+}
+
+// This function filters the log with the rules that are not local. The
+// agent executes the responses of the local rules to the events that it
+// handles while the server is unreachable.
+func FilterRemoteRulesLog(log map[string]string) []map[string]string {
+
+	remoteRules := make([]map[string]interface{}, 0, len(rules))
+	for _, rule := range rules {
+		if !IsLocalRule(rule) {
+			remoteRules = append(remoteRules, rule)
+		}
+	}
+	return detection.FilterRules(remoteRules, log)
+}
+
+// This function returns the local rules signed by the key of server
+func SignLocalRules() (*rpc.LocalRuleSet, error) {
+
+	if localRulesKey == nil {
+		return nil, errors.New("LocalRulesKeyPath is not set")
+	}
+	ruleSet := LocalRuleSet{
+		Version: time.Now().UnixNano(),
+		Rules:   make([]map[string]interface{}, 0),
+	}
+	for _, rule := range rules {
+		if IsLocalRule(rule) {
+			ruleSet.Rules = append(ruleSet.Rules, rule)
+		}
+	}
+	data, err := json.Marshal(ruleSet)
+	if err != nil {
+		return nil, err
+	}
+	return &rpc.LocalRuleSet{
+		RuleSet:   data,
+		Signature: ed25519.Sign(localRulesKey, data),
+	}, nil
+}
+
+// This function pushes the local rules to the agent of conn. The result
+// is written to app log.
+func PushLocalRules(computerName string, conn *grpc.ClientConn) {
+
+	ruleSet, err := SignLocalRules()
+	if err != nil {
+		WriteAppLogError("Error signs local rules: ", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	client := rpc.NewManagerClient(conn)
+	responseResult, err := client.ManagerLocalRules(ctx, ruleSet)
+	if err != nil {
+		WriteAppLogError("Error pushes local rules to "+computerName+": ", err)
+		return
+	}
+	if !responseResult.GetResult() {
+		WriteAppLogError("Error pushes local rules to " + computerName + ": " +
+			responseResult.GetResultInfo())
+		return
+	}
+	WriteAppLogInfo("Success pushes local rules to " + computerName)
+}
+
+// This function pushes the local rules to all agents, in background
+func PushLocalRulesAll() {
+
+	if localRulesKey == nil {
+		return
+	}
+	for computerName, conn := range ClientConns() {
+		go PushLocalRules(computerName, conn)
+	}
+}
+
+// UploadResults function implementation of gRPC Service.
+// This function writes the results of the local responses of an agent to
+// result log. LocalResponse is "true" in these results. The agent is
+// authenticated with its token like the telemetry stream, a batch of
+// another ComputerName is rejected and a result of another ComputerName is
+// dropped. The responses are counted by the dedup of server, and the
+// successful containments are recorded so they can be undone.
+func (*TelemetryService) UploadResults(ctx context.Context,
+	batch *rpc.ResultBatch) (*rpc.TelemetryAck, error) {
+
+	computerName, err := AuthenticateAgent(ctx)
+	if err != nil {
+		WriteAppLogError("Error authenticates local results: ", err)
+		return nil, err
+	}
+	if batch.GetComputerName() != computerName {
+		WriteAppLogError("Agent " + computerName + " uploads local results of " +
+			batch.GetComputerName())
+		return nil, status.Error(codes.PermissionDenied,
+			"batch of "+batch.GetComputerName()+" is not allowed for "+computerName)
+	}
+
+	var received int64
+	for _, result := range batch.GetResults() {
+		objRequest := ConvertInterfaceToString(ConvertJsonToInterface(result))
+		if objRequest["ComputerName"] != computerName {
+			WriteAppLogError("Agent " + computerName + " uploads a local result of " +
+				objRequest["ComputerName"] + ", it is dropped")
+			continue
+		}
+		objRequest["LocalResponse"] = "true"
+
+		IsDuplicateResponse(objRequest, time.Now())
+		if objRequest["Result"] == "Success" {
+			if err := RecordContainment(objRequest); err != nil {
+				WriteAppLogError(err)
+			}
+		}
+		WriteResultLog(objRequest)
+		received++
+	}
+	WriteAppLogInfo("Success receives " + strconv.FormatInt(received, 10) +
+		" local results of " + computerName)
+
+	return &rpc.TelemetryAck{
+		Received:   received,
+		ResultInfo: "Received " + strconv.FormatInt(received, 10) + " results",
+	}, nil
+}
@@ -0,0 +1,165 @@
+/**
+ * File:    override.go
+ *
+ * Summary of File:
+ *
+ * 	This file contains the code related to the override of the protected
+ *	processes of agents. The agent never kills, kills the tree of or
+ *	suspends its built-in protected processes (csrss, wininit, lsass,
+ *	services, smss, systemd, init), itself and its parents, unless the
+ *	request overrides the protection.
+ * 	Functions:
+ * 	Handling the command "Action Respond" of admin socket, which sends a
+ *	response to an agent. Only the administrator of admin socket can set
+ *	OverrideProtection, the rules and the logs of Splunk cannot.
+ * 	Signing the override of the requests that the administrator authorized
+ *	with the Ed25519 key of local rules, and sending it in the metadata of
+ *	request. The agent verifies it with the public key of the server.
+ */
+
+package server
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// Metadata of request that overrides the protected processes of agent
+	PROTECTION_OVERRIDE_METADATA = "bkedr-override-protection"
+	// Time that a signed override is valid, it allows for the clock of
+	// agent being a few minutes late
+	PROTECTION_OVERRIDE_VALIDITY = 5 * time.Minute
+)
+
+// OverrideClaims struct is the JSON of override that is signed. The agent
+// only overrides the protection for the RPC RequestId, its action on the
+// process ProcessId, until ExpireTime (Unix time).
+type OverrideClaims struct {
+	RequestId  string `json:"RequestId"`
+	Action     string `json:"Action"`
+	ProcessId  string `json:"ProcessId"`
+	ExpireTime int64  `json:"ExpireTime"`
+}
+
+var (
+	// OverrideIds of the requests whose override is authorized by the
+	// administrator, a field of log cannot add a request here
+	protectionOverrides = make(map[string]bool)
+	// Mutex protects protectionOverrides
+	protectionOverridesMutex sync.Mutex
+)
+
+// This function handles the command "Action Respond" of admin socket. The
+// other keys of command are the request (ex: Action, EventCode, ProcessId).
+// If OverrideProtection is "true", the agent executes the action even if
+// the target is a protected process.
+func HandleAdminResponse(command map[string]string) error {
+
+	computerName := command["ComputerName"]
+	conn, connected := GetClientConn(computerName)
+	if !connected {
+		return errors.New("Error: agent " + computerName + " is not connected")
+	}
+	if command["Action"] == "playbook" || strings.Contains(command["Action"], ",") {
+		return errors.New("Error: Action Respond runs one action, not a chain or a playbook")
+	}
+
+	if command["OverrideProtection"] == "true" && localRulesKey == nil {
+		return errors.New("Error: OverrideProtection is signed with the key of " +
+			"LocalRulesKeyPath, it is not set")
+	}
+
+	objRequest := CopyMapString(command)
+	delete(objRequest, "Action Respond")
+	delete(objRequest, "RequiresApproval")
+	delete(objRequest, "OverrideId")
+	if objRequest["OverrideProtection"] == "true" {
+		// the RPC gets its RequestId when it is sent, the override is
+		// authorized by an id that only this request has
+		objRequest["OverrideId"] = NewId()
+		AuthorizeOverride(objRequest["OverrideId"])
+		defer RevokeOverride(objRequest["OverrideId"])
+	} else {
+		delete(objRequest, "OverrideProtection")
+	}
+
+	responseResult := ExecuteRequest(conn, objRequest)
+	if objRequest["OverrideId"] != "" {
+		WriteAppLogInfo("Administrator overrides protected processes for request " +
+			objRequest["RequestId"] + " on " + computerName)
+		delete(objRequest, "OverrideId")
+	}
+	if responseResult.GetResult() {
+		if err := RecordContainment(objRequest); err != nil {
+			WriteAppLogError(err)
+		}
+	}
+	HandleResult(responseResult, objRequest)
+
+	command["RequestId"] = objRequest["RequestId"]
+	command["Result"] = objRequest["Result"]
+	command["ResultInfo"] = objRequest["ResultInfo"]
+	if objRequest["DenyReason"] != "" {
+		command["DenyReason"] = objRequest["DenyReason"]
+	}
+	return nil
+}
+
+// This function authorizes the override of protected processes for the
+// request with OverrideId overrideId
+func AuthorizeOverride(overrideId string) {
+	protectionOverridesMutex.Lock()
+	defer protectionOverridesMutex.Unlock()
+	protectionOverrides[overrideId] = true
+}
+
+// This function removes the override overrideId
+func RevokeOverride(overrideId string) {
+	protectionOverridesMutex.Lock()
+	defer protectionOverridesMutex.Unlock()
+	delete(protectionOverrides, overrideId)
+}
+
+// This function checks that the override overrideId is authorized by the
+// administrator
+func CheckOverride(overrideId string) bool {
+	if overrideId == "" {
+		return false
+	}
+	protectionOverridesMutex.Lock()
+	defer protectionOverridesMutex.Unlock()
+	return protectionOverrides[overrideId]
+}
+
+// This function appends the signed override to the metadata of ctx if the
+// administrator authorized the override OverrideId of request. RequestId
+// of request is already set.
+func OverrideContext(ctx context.Context, objRequest map[string]string) context.Context {
+	if !CheckOverride(objRequest["OverrideId"]) {
+		return ctx
+	}
+	override, err := SignOverride(objRequest)
+	if err != nil {
+		WriteAppLogError("Error signs override of request "+objRequest["RequestId"]+": ", err)
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, PROTECTION_OVERRIDE_METADATA, override)
+}
+
+// This function returns the override of request signed by the key of local
+// rules, see SignClaims
+func SignOverride(objRequest map[string]string) (string, error) {
+
+	return SignClaims(OverrideClaims{
+		RequestId:  objRequest["RequestId"],
+		Action:     objRequest["Action"],
+		ProcessId:  objRequest[ProcessTargetKey(objRequest)],
+		ExpireTime: time.Now().Add(PROTECTION_OVERRIDE_VALIDITY).Unix(),
+	})
+}
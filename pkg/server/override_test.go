@@ -0,0 +1,166 @@
+/**
+ * File:    override_test.go
+ *
+ * Summary of File:
+ *
+ * 	This file contains the tests of the override of protected processes
+ *	between the server and the policy of the agent. The test process is the
+ *	"agent", a protected process, and the stand-in agent never acts on it.
+ * 	Functions:
+ * 	Testing that the override signed by the server is verified by the agent
+ *	for the process of each EventCode, and that a request without override
+ *	is denied.
+ */
+
+package server
+
+import (
+	"bkedr/pkg/agent"
+	"bkedr/pkg/rpc"
+	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"google.golang.org/grpc"
+)
+
+// managerStandIn struct is an agent that checks the override of the kill
+// requests like KillProcess, without killing
+type managerStandIn struct {
+	rpc.UnimplementedManagerServer
+}
+
+// This function returns the result of kill of pid32 with the override of
+// ctx
+func (*managerStandIn) kill(ctx context.Context, action string, pid string) *rpc.ResponseResult {
+	if err := agent.ProtectionOverride(ctx).Verify(action, agent.ConvertStringToInt32(pid)); err != nil {
+		return &rpc.ResponseResult{ResultInfo: err.Error(), Result: false}
+	}
+	return &rpc.ResponseResult{ResultInfo: "Success kills ProcessId " + pid, Result: true}
+}
+
+// ManagerEventCode1 checks the override of kill
+func (m *managerStandIn) ManagerEventCode1(ctx context.Context, in *rpc.EventCode1) (*rpc.ResponseResult, error) {
+	return m.kill(ctx, in.GetAction(), in.GetProcessId()), nil
+}
+
+// ManagerEventCode3 checks the override of kill
+func (m *managerStandIn) ManagerEventCode3(ctx context.Context, in *rpc.EventCode3) (*rpc.ResponseResult, error) {
+	return m.kill(ctx, in.GetAction(), in.GetProcessId()), nil
+}
+
+// ManagerEventCode7 checks the override of kill
+func (m *managerStandIn) ManagerEventCode7(ctx context.Context, in *rpc.EventCode7) (*rpc.ResponseResult, error) {
+	return m.kill(ctx, in.GetAction(), in.GetProcessId()), nil
+}
+
+// ManagerEventCode8 checks the override of kill
+func (m *managerStandIn) ManagerEventCode8(ctx context.Context, in *rpc.EventCode8) (*rpc.ResponseResult, error) {
+	return m.kill(ctx, in.GetAction(), in.GetSourceProcessId()), nil
+}
+
+// ManagerEventCode9 checks the override of kill
+func (m *managerStandIn) ManagerEventCode9(ctx context.Context, in *rpc.EventCode9) (*rpc.ResponseResult, error) {
+	return m.kill(ctx, in.GetAction(), in.GetProcessId()), nil
+}
+
+// ManagerEventCode10 checks the override of kill
+func (m *managerStandIn) ManagerEventCode10(ctx context.Context, in *rpc.EventCode10) (*rpc.ResponseResult, error) {
+	return m.kill(ctx, in.GetAction(), in.GetProcessId()), nil
+}
+
+// This function writes a new Ed25519 key pair in PEM files, loads the
+// private key as the key of local rules and the public key in the agent
+// config. It returns the connection to a stand-in agent with the policy
+// interceptor of agent.
+func newOverrideStandIn(t *testing.T) *grpc.ClientConn {
+
+	dir := t.TempDir()
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateData, _ := x509.MarshalPKCS8PrivateKey(privateKey)
+	publicData, _ := x509.MarshalPKIXPublicKey(publicKey)
+	privatePath := filepath.Join(dir, "localrules.key")
+	publicPath := filepath.Join(dir, "localrules.pub")
+	ioutil.WriteFile(privatePath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateData}), 0600)
+	ioutil.WriteFile(publicPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicData}), 0600)
+
+	oldKey := localRulesKey
+	if localRulesKey, err = LoadLocalRulesKey(privatePath); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { localRulesKey = oldKey })
+
+	configPath := filepath.Join(dir, "windowsagent.conf")
+	config := `{"AgentConfig": [{"LocalRulesPublicKeyPath": ` + strconv.Quote(publicPath) + `}]}`
+	if err := ioutil.WriteFile(configPath, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := agent.LoadConfig(configPath, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := agent.LoadLocalRules(); err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	grpcServer := grpc.NewServer(grpc.UnaryInterceptor(agent.PolicyUnaryInterceptor(func(err error) {
+		t.Error(err)
+	})))
+	rpc.RegisterManagerServer(grpcServer, &managerStandIn{})
+	go grpcServer.Serve(listener)
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.Dial(listener.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// This function tests that the agent verifies the override that the server
+// signs for the process of each EventCode, and denies the request without
+// override
+func TestSignOverrideEventCodes(t *testing.T) {
+
+	conn := newOverrideStandIn(t)
+	pid := strconv.Itoa(os.Getpid())
+	for _, eventCode := range []string{"1", "3", "7", "8", "9", "10"} {
+		for _, override := range []bool{false, true} {
+			objRequest := map[string]string{
+				"EventCode":    eventCode,
+				"Action":       "kill",
+				"ComputerName": "WS01",
+			}
+			objRequest[ProcessTargetKey(objRequest)] = pid
+			if override {
+				objRequest["OverrideId"] = NewId()
+				AuthorizeOverride(objRequest["OverrideId"])
+			}
+
+			responseResult := SendRequest(conn, objRequest)
+			RevokeOverride(objRequest["OverrideId"])
+			if override && !responseResult.GetResult() {
+				t.Errorf("EventCode %s: signed override is rejected: %s", eventCode,
+					responseResult.GetResultInfo())
+			}
+			if !override && responseResult.GetDenyReason() != agent.DENY_PROTECTED_PROCESS {
+				t.Errorf("EventCode %s: kill of protected process is not denied: %s", eventCode,
+					responseResult.GetResultInfo())
+			}
+		}
+	}
+}
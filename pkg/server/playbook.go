@@ -0,0 +1,260 @@
+/**
+ * File:    playbook.go
+ *
+ * Summary of File:
+ *
+ * 	This file contains the code related to the response playbooks of the
+ * 	bkedr server. A rule with Action "playbook" runs the steps of the
+ *	playbook named by its key Playbook, in order.
+ * 	Functions:
+ * 	Loading playbooks from the playbook file, one playbook per line.
+ * 	Running the steps of playbook with conditions on the outcome of
+ *	previous steps, continue-on-error and a timeout for each step.
+ * 	Logging the outcome of each step and of the whole execution with the
+ *	same execution id.
+ */
+
+package server
+
+import (
+	"bkedr/pkg/rpc"
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+const (
+	// Step is executed and the agent returns success
+	STEP_SUCCESS = "success"
+	// Step is executed and returns failure, or it times out
+	STEP_FAILURE = "failure"
+	// Step is not executed, its condition is not met or the playbook stopped
+	STEP_SKIPPED = "skipped"
+)
+
+// Playbook struct is used to decode json of a playbook
+type Playbook struct {
+	Name  string         `json:"Name"`
+	Steps []PlaybookStep `json:"Steps"`
+}
+
+// PlaybookStep struct is used to decode json of a step of playbook.
+// Name is used by the conditions of next steps, default is Action.
+// If is a list of step names separated by ",", the step is executed only if
+// these steps succeeded, or failed for the names starting with "!".
+// A failed step stops the playbook unless ContinueOnError is true.
+// Timeout is a duration (ex: 30s), the request is canceled after it.
+// Params are added to the request, a value $Key$ is the value of Key in
+// the log that triggered the playbook.
+type PlaybookStep struct {
+	Name            string            `json:"Name"`
+	Action          string            `json:"Action"`
+	If              string            `json:"If"`
+	ContinueOnError bool              `json:"ContinueOnError"`
+	Timeout         string            `json:"Timeout"`
+	Params          map[string]string `json:"Params"`
+}
+
+// Playbooks are loaded from the playbook file
+var playbooks = make([]*Playbook, 0)
+
+// This function reads the playbooks of file, one JSON playbook per line.
+// An invalid playbook is written to app log and ignored.
+func LoadPlaybooks(filePath string) []*Playbook {
+
+	loaded := make([]*Playbook, 0)
+	file, err := os.Open(filePath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			WriteAppLogError("Error loads playbooks: ", err)
+		}
+		return loaded
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		playbook := &Playbook{}
+		if err := json.Unmarshal([]byte(line), playbook); err != nil {
+			WriteAppLogError("Error loads playbook "+line+": ", err)
+			continue
+		}
+		if err := ValidatePlaybook(playbook); err != nil {
+			WriteAppLogError("Error loads playbook "+playbook.Name+": ", err)
+			continue
+		}
+		loaded = append(loaded, playbook)
+	}
+	return loaded
+}
+
+// This function checks the steps of playbook and sets the default name of
+// steps. A condition can only use the steps before it.
+func ValidatePlaybook(playbook *Playbook) error {
+
+	if playbook.Name == "" || len(playbook.Steps) == 0 {
+		return errors.New("playbook has no name or no step")
+	}
+
+	names := make(map[string]bool)
+	for index := range playbook.Steps {
+		step := &playbook.Steps[index]
+		if step.Action == "" || step.Action == "playbook" || strings.Contains(step.Action, ",") {
+			return errors.New("action " + step.Action + " of step " +
+				strconv.Itoa(index+1) + " is invalid")
+		}
+		if step.Name == "" {
+			step.Name = step.Action
+		}
+		if step.Timeout != "" {
+			if _, err := time.ParseDuration(step.Timeout); err != nil {
+				return err
+			}
+		}
+		for _, name := range SplitCondition(step.If) {
+			if !names[strings.TrimPrefix(name, "!")] {
+				return errors.New("condition " + name + " of step " + step.Name +
+					" is not a previous step")
+			}
+		}
+		names[step.Name] = true
+	}
+	return nil
+}
+
+// This function returns the playbook named name, or nil
+func FindPlaybook(name string) *Playbook {
+	for _, playbook := range playbooks {
+		if playbook.Name == name {
+			return playbook
+		}
+	}
+	return nil
+}
+
+// This function returns the step names of condition
+func SplitCondition(condition string) []string {
+	names := make([]string, 0)
+	for _, name := range strings.Split(condition, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// This function checks the condition with the outcomes of previous steps
+func CheckCondition(condition string, outcomes map[string]string) bool {
+	for _, name := range SplitCondition(condition) {
+		if strings.HasPrefix(name, "!") {
+			if outcomes[name[1:]] != STEP_FAILURE {
+				return false
+			}
+		} else if outcomes[name] != STEP_SUCCESS {
+			return false
+		}
+	}
+	return true
+}
+
+// This function returns the request of step. It is a copy of objRequest
+// with the action, timeout and params of step.
+func NewStepRequest(objRequest map[string]string, step PlaybookStep) map[string]string {
+
+	request := CopyMapString(objRequest)
+	request["Action"] = step.Action
+	if step.Timeout != "" {
+		request["Timeout"] = step.Timeout
+	}
+	for key, value := range step.Params {
+		if strings.HasPrefix(value, "$") && strings.HasSuffix(value, "$") && len(value) > 2 {
+			value = objRequest[strings.Trim(value, "$")]
+		}
+		request[key] = value
+	}
+	return request
+}
+
+// This function runs the playbook of objRequest on the agent of clientConn.
+// The result of each step and the result of execution are written to
+// result log with the same PlaybookExecutionId. If options is Limited, a
+// step that is a duplicate or over a rate limit is skipped.
+func RunPlaybook(clientConn *grpc.ClientConn, objRequest map[string]string,
+	options ResponseOptions) {
+
+	objRequest["PlaybookExecutionId"] = NewId()
+	playbook := FindPlaybook(objRequest["Playbook"])
+	if playbook == nil {
+		HandleResult(&rpc.ResponseResult{
+			ResultInfo: "Error: Playbook " + objRequest["Playbook"] + " is not found",
+			Result:     false,
+		}, objRequest)
+		return
+	}
+
+	result := true
+	stopped := false
+	outcomes := make(map[string]string)
+	summary := make([]string, 0, len(playbook.Steps))
+
+	for index, step := range playbook.Steps {
+		request := NewStepRequest(objRequest, step)
+		request["PlaybookStep"] = strconv.Itoa(index + 1)
+		request["PlaybookStepName"] = step.Name
+
+		skipReason := ""
+		if stopped {
+			skipReason = "Skipped: a previous step failed"
+		} else if !CheckCondition(step.If, outcomes) {
+			skipReason = "Skipped: condition " + step.If + " is not met"
+		} else if options.Limited {
+			// the step is checked like a response of rule, so a playbook
+			// does not bypass dedup and rate limits
+			if IsDuplicateResponse(request, time.Now()) {
+				skipReason = "Skipped: duplicate response"
+			} else if allowed, reason := AllowResponse(request, time.Now()); !allowed {
+				skipReason = "Skipped: " + reason
+			}
+		}
+
+		if skipReason != "" {
+			outcomes[step.Name] = STEP_SKIPPED
+			summary = append(summary, step.Name+" "+STEP_SKIPPED)
+			request["PlaybookStepStatus"] = STEP_SKIPPED
+			WriteResultStatus(request, "Skipped", skipReason)
+			continue
+		}
+
+		responseResult := ExecuteRequest(clientConn, request)
+		status := STEP_FAILURE
+		if responseResult.GetResult() {
+			status = STEP_SUCCESS
+			if err := RecordContainment(request); err != nil {
+				WriteAppLogError(err)
+			}
+		} else if !step.ContinueOnError {
+			stopped = true
+			result = false
+		}
+
+		outcomes[step.Name] = status
+		summary = append(summary, step.Name+" "+status)
+		request["PlaybookStepStatus"] = status
+		HandleResult(responseResult, request)
+	}
+
+	HandleResult(&rpc.ResponseResult{
+		ResultInfo: "Playbook " + playbook.Name + ": " + strings.Join(summary, ", "),
+		Result:     result,
+	}, objRequest)
+}
@@ -0,0 +1,255 @@
+/**
+ * File:    profiles.go
+ *
+ * Summary of File:
+ *
+ * 	This file contains the code related to the config profiles of agents.
+ * 	A profile sets fields of agent config (server address, adapter name,
+ *	allowed actions, log level...) for all agents, for the agents of groups
+ *	or for named agents, so the config is not edited on every endpoint.
+ * 	Functions:
+ * 	Loading profiles from the profile file, one profile per line.
+ * 	Merging the profiles of an agent and pushing them to the agent when it
+ *	connects and with the command bkedr config push. The agent saves and
+ *	applies them without restart.
+ * 	Reading the effective config of an agent with bkedr config show.
+ */
+
+package server
+
+import (
+	"bkedr/pkg/rpc"
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// Time that the signature of a pushed profile is valid
+const PROFILE_SIGNATURE_VALIDITY = 5 * time.Minute
+
+// AgentProfile struct is used to decode json of a config profile. The
+// profile applies to the agents whose ComputerName is in Agents, to the
+// agents whose Group is in Groups, or to all agents if both are empty.
+// Config is the fields of agent config that the profile sets.
+type AgentProfile struct {
+	Name   string                 `json:"Name"`
+	Agents []string               `json:"Agents"`
+	Groups []string               `json:"Groups"`
+	Config map[string]interface{} `json:"Config"`
+}
+
+// ProfileClaims struct is the JSON of pushed profile that is signed. The
+// agent ComputerName only applies the profile for the RPC RequestId, until
+// ExpireTime (Unix time).
+type ProfileClaims struct {
+	RequestId    string `json:"RequestId"`
+	ComputerName string `json:"ComputerName"`
+	Name         string `json:"Name"`
+	Config       string `json:"Config"`
+	ExpireTime   int64  `json:"ExpireTime"`
+}
+
+var (
+	// Profiles are loaded from the profile file
+	agentProfiles = make([]*AgentProfile, 0)
+	// Mutex protects agentProfiles
+	agentProfilesMutex sync.Mutex
+)
+
+// This function reads the profiles of file, one JSON profile per line. An
+// invalid profile is written to app log and ignored.
+func LoadAgentProfiles(filePath string) []*AgentProfile {
+
+	loaded := make([]*AgentProfile, 0)
+	file, err := os.Open(filePath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			WriteAppLogError("Error loads agent profiles: ", err)
+		}
+		return loaded
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		profile := &AgentProfile{}
+		if err := json.Unmarshal([]byte(line), profile); err != nil {
+			WriteAppLogError("Error loads agent profile "+line+": ", err)
+			continue
+		}
+		if profile.Name == "" || len(profile.Config) == 0 {
+			WriteAppLogError("Error loads agent profile " + line + ": profile has no name or no config")
+			continue
+		}
+		loaded = append(loaded, profile)
+	}
+	return loaded
+}
+
+// This function returns the names and the merged config of the profiles of
+// agent. The profiles of all agents are applied first, then the profiles
+// of group, then the profiles of agent, each in the order of file.
+func ProfileForAgent(computerName string, group string) (string, map[string]interface{}) {
+
+	agentProfilesMutex.Lock()
+	defer agentProfilesMutex.Unlock()
+
+	names := make([]string, 0)
+	config := make(map[string]interface{})
+	levels := []func(profile *AgentProfile) bool{
+		func(profile *AgentProfile) bool {
+			return len(profile.Agents) == 0 && len(profile.Groups) == 0
+		},
+		func(profile *AgentProfile) bool {
+			return group != "" && CheckStringInSlice(group, profile.Groups)
+		},
+		func(profile *AgentProfile) bool {
+			return CheckStringInSlice(computerName, profile.Agents)
+		},
+	}
+	for _, match := range levels {
+		for _, profile := range agentProfiles {
+			if !match(profile) {
+				continue
+			}
+			names = append(names, profile.Name)
+			for field, value := range profile.Config {
+				config[field] = value
+			}
+		}
+	}
+	return strings.Join(names, ","), config
+}
+
+// This function returns the Group of agent in agent config file
+func AgentGroup(computerName string) string {
+	for _, agent := range sliceAgentConfig {
+		if agent["ComputerName"] == computerName {
+			return agent["Group"]
+		}
+	}
+	return ""
+}
+
+// This function pushes the merged profiles of agent. An agent without
+// profile gets an empty profile, which removes its previous profile. The
+// profile is signed with the key of local rules, agents reject a profile
+// that is not signed.
+func PushAgentProfile(computerName string, conn *grpc.ClientConn) error {
+
+	name, config := ProfileForAgent(computerName, AgentGroup(computerName))
+	data, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	requestId := NewId()
+	signature, err := SignClaims(ProfileClaims{
+		RequestId:    requestId,
+		ComputerName: computerName,
+		Name:         name,
+		Config:       string(data),
+		ExpireTime:   time.Now().Add(PROFILE_SIGNATURE_VALIDITY).Unix(),
+	})
+	if err != nil {
+		return errors.New("config profile cannot be signed: " + err.Error())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	ctx = metadata.AppendToOutgoingContext(ctx, REQUEST_ID_METADATA, requestId)
+	client := rpc.NewManagerClient(conn)
+	responseResult, err := client.SetConfig(ctx, &rpc.AgentProfile{
+		Name:      name,
+		Config:    string(data),
+		Signature: signature,
+	})
+	if err != nil {
+		return err
+	}
+	if !responseResult.GetResult() {
+		return errors.New(responseResult.GetResultInfo())
+	}
+	WriteAppLogInfo("Success pushes config profile " + name + " to " + computerName)
+	return nil
+}
+
+// This function pushes the profiles to all agents that are connected
+func PushAgentProfileAll() {
+	for computerName, conn := range ClientConns() {
+		if err := PushAgentProfile(computerName, conn); err != nil {
+			WriteAppLogError("Error pushes config profile to "+computerName+": ", err)
+		}
+	}
+}
+
+// This function handles the command "Action Config" of admin socket:
+//   - push: load the profile file again and push the profiles to agent
+//     ComputerName, or to all agents if ComputerName is empty
+//   - show: read the effective config of agent ComputerName
+func HandleAgentConfig(command map[string]string) error {
+
+	computerName := command["ComputerName"]
+	switch command["Action Config"] {
+	case "push":
+		loaded := LoadAgentProfiles(agentProfilesPath)
+		agentProfilesMutex.Lock()
+		agentProfiles = loaded
+		agentProfilesMutex.Unlock()
+		if computerName == "" {
+			PushAgentProfileAll()
+			HandleResult(&rpc.ResponseResult{
+				ResultInfo: "Success pushes config profiles to all agents",
+				Result:     true,
+			}, command)
+			return nil
+		}
+	case "show":
+	default:
+		return errors.New("Error: Action Config " + command["Action Config"] + " is not supported")
+	}
+
+	conn, connected := GetClientConn(computerName)
+	if !connected {
+		return errors.New("Error: agent " + computerName + " is not connected")
+	}
+
+	responseResult := &rpc.ResponseResult{}
+	if command["Action Config"] == "push" {
+		if err := PushAgentProfile(computerName, conn); err != nil {
+			responseResult.ResultInfo = "Error pushes config profile to " + computerName + ": " + err.Error()
+		} else {
+			responseResult.ResultInfo = "Success pushes config profile to " + computerName
+			responseResult.Result = true
+		}
+		HandleResult(responseResult, command)
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	view, err := rpc.NewManagerClient(conn).GetConfig(ctx, &rpc.ConfigQuery{})
+	if err != nil {
+		responseResult.ResultInfo = "Error reads config of " + computerName + ": " + err.Error()
+	} else {
+		command["ConfigPath"] = view.GetConfigPath()
+		command["Profile"] = view.GetProfile()
+		command["Config"] = view.GetConfig()
+		command["Sources"] = view.GetSources()
+		responseResult.ResultInfo = "Success reads config of " + computerName
+		responseResult.Result = true
+	}
+	HandleResult(responseResult, command)
+	return nil
+}
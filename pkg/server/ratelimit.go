@@ -0,0 +1,194 @@
+/**
+ * File:    ratelimit.go
+ *
+ * Summary of File:
+ *
+ * 	This file contains the code related to the rate limits of the
+ * 	automatic responses of bkedr server.
+ * 	Functions:
+ * 	Limiting the responses of rules per host, per rule and globally, for
+ *	all actions or for some actions (ex: at most 10 kills per host per
+ *	minute). A response over a limit is not executed.
+ * 	Circuit breaker: a rule that fires more than MaxFires times in Window
+ *	becomes alert-only for Cooldown, its logs are still written to result
+ *	log but no action is executed.
+ */
+
+package server
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Limit counts the responses of each host
+	RATE_LIMIT_HOST = "host"
+	// Limit counts the responses of each rule
+	RATE_LIMIT_RULE = "rule"
+	// Limit counts all responses
+	RATE_LIMIT_GLOBAL = "global"
+)
+
+// RateLimitConfig struct is used to decode json of a rate limit. Actions is
+// a list of actions separated by ",", empty is all actions. At most Max
+// responses are executed in Window (ex: 1m) for each key of Scope.
+type RateLimitConfig struct {
+	Scope   string `json:"Scope"`
+	Actions string `json:"Actions"`
+	Max     int    `json:"Max"`
+	Window  string `json:"Window"`
+}
+
+// CircuitBreakerConfig struct is used to decode json of circuit breaker.
+// A rule that fires more than MaxFires times in Window is alert-only for
+// Cooldown. MaxFires 0 disables the circuit breaker.
+type CircuitBreakerConfig struct {
+	MaxFires int    `json:"MaxFires"`
+	Window   string `json:"Window"`
+	Cooldown string `json:"Cooldown"`
+}
+
+var (
+	// Times of the responses and of the fires of rules, by counter key
+	rateEvents = make(map[string][]time.Time)
+	// Rules that are alert-only until the time
+	openCircuits = make(map[string]time.Time)
+	// Mutex protects rateEvents and openCircuits
+	rateMutex sync.Mutex
+)
+
+// This function checks the circuit breaker of the rule and the rate limits
+// of the response objRequest. If the response is allowed, it is counted.
+// Otherwise, it returns the reason that the response is not executed.
+func AllowResponse(objRequest map[string]string, now time.Time) (bool, string) {
+
+	rateMutex.Lock()
+	defer rateMutex.Unlock()
+
+	rule := objRequest["Message"]
+	if reason := CheckCircuitBreaker(rule, now); reason != "" {
+		return false, reason
+	}
+
+	// check all limits before counting, so a denied response is not counted
+	keys := make([]string, 0, len(rateLimits))
+	for index, limit := range rateLimits {
+		if !MatchRateLimitActions(limit.Actions, objRequest["Action"]) {
+			continue
+		}
+		window, err := time.ParseDuration(limit.Window)
+		if err != nil || limit.Max <= 0 {
+			continue
+		}
+
+		var scopeKey string
+		switch limit.Scope {
+		case RATE_LIMIT_HOST:
+			scopeKey = objRequest["ComputerName"]
+		case RATE_LIMIT_RULE:
+			scopeKey = rule
+		case RATE_LIMIT_GLOBAL:
+		default:
+			continue
+		}
+		key := "limit:" + strconv.Itoa(index) + ":" + scopeKey
+		if CountEvents(key, window, now) >= limit.Max {
+			return false, "Rate limited: " + limit.Scope + " limit of " +
+				strconv.Itoa(limit.Max) + " responses of " +
+				RateLimitActionsName(limit.Actions) + " in " + limit.Window + " is reached"
+		}
+		keys = append(keys, key)
+	}
+
+	for _, key := range keys {
+		rateEvents[key] = append(rateEvents[key], now)
+	}
+	return true, ""
+}
+
+// This function counts the fire of rule and opens the circuit of rule if
+// it fires more than MaxFires times in Window. It returns the reason if
+// the rule is alert-only.
+func CheckCircuitBreaker(rule string, now time.Time) string {
+
+	if circuitBreaker.MaxFires <= 0 {
+		return ""
+	}
+	if until, ok := openCircuits[rule]; ok {
+		if now.Before(until) {
+			return "Alert only: circuit breaker of rule is open until " +
+				until.Format("2006-01-02 15:04:05.000")
+		}
+		delete(openCircuits, rule)
+		WriteAppLogInfo("Circuit breaker of rule " + rule + " is closed")
+	}
+
+	window, err := time.ParseDuration(circuitBreaker.Window)
+	if err != nil {
+		window = time.Minute
+	}
+	key := "fire:" + rule
+	rateEvents[key] = append(rateEvents[key], now)
+	fires := CountEvents(key, window, now)
+	if fires <= circuitBreaker.MaxFires {
+		return ""
+	}
+
+	cooldown, err := time.ParseDuration(circuitBreaker.Cooldown)
+	if err != nil {
+		cooldown = time.Hour
+	}
+	openCircuits[rule] = now.Add(cooldown)
+	delete(rateEvents, key)
+	reason := "Alert only: rule fired " + strconv.Itoa(fires) + " times in " +
+		window.String() + ", more than " + strconv.Itoa(circuitBreaker.MaxFires) +
+		", circuit breaker is open until " +
+		openCircuits[rule].Format("2006-01-02 15:04:05.000")
+	WriteAppLogError("Circuit breaker of rule " + rule + " opens. " + reason)
+	return reason
+}
+
+// This function removes the events of key that are older than window and
+// returns the number of remaining events.
+func CountEvents(key string, window time.Duration, now time.Time) int {
+
+	events := rateEvents[key]
+	index := 0
+	for index < len(events) && !events[index].After(now.Add(-window)) {
+		index++
+	}
+	if index == len(events) {
+		delete(rateEvents, key)
+		return 0
+	}
+	rateEvents[key] = events[index:]
+	return len(events) - index
+}
+
+// This function checks that the action of response is one of actions of
+// limit. A chain of actions matches if one of its actions matches.
+func MatchRateLimitActions(actions string, action string) bool {
+
+	if strings.TrimSpace(actions) == "" {
+		return true
+	}
+	for _, limitAction := range strings.Split(actions, ",") {
+		for _, responseAction := range strings.Split(action, ",") {
+			if strings.TrimSpace(limitAction) == strings.TrimSpace(responseAction) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// This function returns the name of actions of limit for the result log
+func RateLimitActionsName(actions string) string {
+	if strings.TrimSpace(actions) == "" {
+		return "all actions"
+	}
+	return actions
+}
@@ -0,0 +1,173 @@
+/**
+ * File:    reconcile.go
+ *
+ * Summary of File:
+ *
+ * 	This file contains the code related to the reconciliation of requests
+ * 	with the action journal of agents. If the connection to an agent breaks
+ *	during a request, the agent may have executed the action but its result
+ *	is lost.
+ * 	Functions:
+ * 	Recording the requests whose RPC failed as unconfirmed.
+ * 	Reading the action journal of agent when it connects and every minute,
+ *	and writing the real result of unconfirmed requests to result log.
+ */
+
+package server
+
+import (
+	"bkedr/pkg/rpc"
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+const (
+	// Metadata of request that contains RequestId, the agent journals it
+	REQUEST_ID_METADATA = "bkedr-request-id"
+	// A request that the journal of agent does not contain after this
+	// duration was not executed by the agent
+	UNCONFIRMED_GRACE = 5 * time.Minute
+)
+
+var (
+	// Requests whose RPC failed, until they are reconciled
+	unconfirmed = make([]map[string]string, 0)
+	// Mutex protects unconfirmed and unconfirmed file
+	unconfirmedMutex sync.Mutex
+)
+
+// This function records the request as unconfirmed
+func RecordUnconfirmed(objRequest map[string]string) error {
+
+	if objRequest["RequestId"] == "" {
+		return nil
+	}
+	request, err := json.Marshal(objRequest)
+	if err != nil {
+		return err
+	}
+
+	unconfirmedMutex.Lock()
+	defer unconfirmedMutex.Unlock()
+	unconfirmed = append(unconfirmed, map[string]string{
+		"RequestId":    objRequest["RequestId"],
+		"ComputerName": objRequest["ComputerName"],
+		"Request":      string(request),
+		"CreatedTime":  FormatCurrentDateMilisecond(),
+	})
+	return WriteSliceMapString(unconfirmedPath, unconfirmed)
+}
+
+// This function reconciles the unconfirmed requests every minute, with the
+// agents that are connected.
+func WatchUnconfirmed() {
+	for range time.Tick(time.Minute) {
+		ReconcileAll(time.Now())
+	}
+}
+
+// This function reconciles the unconfirmed requests of all agents. An
+// agent that is still unreachable is tried again later.
+func ReconcileAll(now time.Time) {
+
+	unconfirmedMutex.Lock()
+	computerNames := make(map[string]bool)
+	for _, request := range unconfirmed {
+		computerNames[request["ComputerName"]] = true
+	}
+	unconfirmedMutex.Unlock()
+
+	for computerName := range computerNames {
+		conn, connected := GetClientConn(computerName)
+		if !connected {
+			continue
+		}
+		if err := ReconcileActions(computerName, conn, now); err != nil {
+			WriteAppLogError("Error reconciles actions of "+computerName+": ", err)
+		}
+	}
+}
+
+// This function reads the records of the unconfirmed requests of agent in
+// its action journal. The result of a record is written to result log with
+// Reconciled "true". A request without record after UNCONFIRMED_GRACE was
+// not executed, its failure is already in result log.
+func ReconcileActions(computerName string, conn *grpc.ClientConn, now time.Time) error {
+
+	unconfirmedMutex.Lock()
+	requestIds := make([]string, 0)
+	for _, request := range unconfirmed {
+		if request["ComputerName"] == computerName {
+			requestIds = append(requestIds, request["RequestId"])
+		}
+	}
+	unconfirmedMutex.Unlock()
+	if len(requestIds) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	client := rpc.NewManagerClient(conn)
+	history, err := client.GetActionHistory(ctx, &rpc.ActionHistoryQuery{
+		RequestIds: requestIds,
+	})
+	if err != nil {
+		return err
+	}
+	// the last record of a request is its outcome
+	records := make(map[string]*rpc.ActionRecord)
+	for _, record := range history.GetRecords() {
+		records[record.GetRequestId()] = record
+	}
+
+	unconfirmedMutex.Lock()
+	reconciled := make([]map[string]string, 0)
+	remaining := make([]map[string]string, 0, len(unconfirmed))
+	for _, request := range unconfirmed {
+		if request["ComputerName"] != computerName {
+			remaining = append(remaining, request)
+			continue
+		}
+		if _, ok := records[request["RequestId"]]; ok {
+			reconciled = append(reconciled, request)
+			continue
+		}
+		createdTime, err := ParseDateMilisecond(request["CreatedTime"])
+		if err == nil && now.Sub(createdTime) < UNCONFIRMED_GRACE {
+			remaining = append(remaining, request)
+			continue
+		}
+		WriteAppLogInfo("Request " + request["RequestId"] + " was not executed by agent " +
+			computerName)
+	}
+	unconfirmed = remaining
+	err = WriteSliceMapString(unconfirmedPath, unconfirmed)
+	unconfirmedMutex.Unlock()
+
+	for _, request := range reconciled {
+		record := records[request["RequestId"]]
+		objRequest := ConvertInterfaceToString(ConvertJsonToInterface(request["Request"]))
+		objRequest["Reconciled"] = "true"
+		objRequest["ActionTime"] = record.GetEndTime()
+		if record.GetUndoId() != "" {
+			objRequest["UndoId"] = record.GetUndoId()
+		}
+
+		// the containment was not recorded because the RPC failed
+		if record.GetResult() {
+			if err := RecordContainment(objRequest); err != nil {
+				WriteAppLogError(err)
+			}
+		}
+		HandleResult(&rpc.ResponseResult{
+			ResultInfo: record.GetResultInfo(),
+			Result:     record.GetResult(),
+		}, objRequest)
+	}
+	return err
+}
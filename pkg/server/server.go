@@ -14,20 +14,27 @@
 package server
 
 import (
+	"bkedr/pkg/detection"
 	"bkedr/pkg/rpc"
 	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"net"
 	"os"
-	"regexp"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 const CONFIG_PATH = "./configs/server.conf"
@@ -40,20 +47,71 @@ var (
 	resultLogPath string
 	// File saves rules that be used to automatically respond
 	ruleFilePath string
+	// File saves playbooks, ordered steps that rules can run
+	playbookFilePath string
 	// File save app log message
 	appLogPath string
 	// File save agent info to create grpc connection
 	agentsConfPath string
+	// File saves containment actions that can be undone
+	containmentsPath string
+	// File saves responses that wait for approval
+	approvalsPath string
+	// Pending approval expires after this duration
+	approvalTTL time.Duration
+	// Approvers can approve or deny the pending responses
+	approvers []ApproverConfig
+	// URL that the pending approvals are posted to
+	approvalNotifyUrl string
+	// Unix socket of the bkedr command line
+	adminSocketPath string
+	// Directory of evidence store
+	evidenceDirPath string
+	// Directory of files that can be pushed to agents
+	pushDirPath string
 	// Host of splunk server
 	splunkHost string
+	// Address of HTTP ingestion endpoint, empty is disabled
+	ingestAddress string
+	// Certificate and key of HTTP ingestion endpoint, empty is plain HTTP
+	ingestCertFile string
+	ingestKeyFile  string
+	// Sources that can send events to HTTP ingestion endpoint
+	ingestSources []IngestSourceConfig
 	// Host for bkedr Server
 	serverHost string
 	// Port for bkedr Server
 	serverPort string
+	// Port of telemetry service of agents, empty is disabled
+	telemetryPort string
+	// Tokens of agents that can send events to telemetry service
+	agentTokens []AgentTokenConfig
+	// Max size of downloaded file in bytes, 0 is unlimited
+	maxFileSize int64
+	// Max rate of file transfer in bytes per second, 0 is unlimited
+	maxTransferRate int64
+	// Compression of file transfer, empty or gzip
+	compression string
+	// Number of times a broken download is retried
+	downloadRetries int
+	// Limits of the responses of rules per host, per rule and globally
+	rateLimits []RateLimitConfig
+	// Rules that fire too often become alert-only
+	circuitBreaker CircuitBreakerConfig
+	// Repeats of a response are suppressed within this duration
+	dedupWindow time.Duration
+	// Private key file that signs the local rules of agents
+	localRulesKeyPath string
+	// File saves the requests whose RPC failed, until they are reconciled
+	unconfirmedPath string
+	// File saves the config profiles of agents
+	agentProfilesPath string
 	// Rules are used to automatically respond
 	rules []map[string]interface{}
 	// map computerName with agent Connection
-	mapClientConns   = make(map[string]*grpc.ClientConn)
+	mapClientConns = make(map[string]*grpc.ClientConn)
+	// RWMutex protects mapClientConns
+	clientConnsMutex sync.RWMutex
 	sliceAgentConfig = make([]map[string]string, 0)
 )
 
@@ -64,32 +122,128 @@ type ServerConfig struct {
 
 // ServerConfigObj struct is used to decode json of ServerConfig object
 type ServerConfigObj struct {
-	ParentDirPath  string `json:"ParentDirPath"`
-	ResultLogPath  string `json:"ResultLogPath"`
-	RuleFilePath   string `json:"RuleFilePath"`
-	AppLogPath     string `json:"AppLogPath"`
-	AgentsConfPath string `json:"AgentsConfPath"`
-	SplunkHost     string `json:"SplunkHost"`
-	ServerHost     string `json:"ServerHost"`
-	ServerPort     string `json:"ServerPort"`
+	ParentDirPath     string               `json:"ParentDirPath"`
+	ResultLogPath     string               `json:"ResultLogPath"`
+	RuleFilePath      string               `json:"RuleFilePath"`
+	PlaybookFilePath  string               `json:"PlaybookFilePath"`
+	AppLogPath        string               `json:"AppLogPath"`
+	AgentsConfPath    string               `json:"AgentsConfPath"`
+	ContainmentsPath  string               `json:"ContainmentsPath"`
+	ApprovalsPath     string               `json:"ApprovalsPath"`
+	ApprovalTTL       string               `json:"ApprovalTTL"`
+	Approvers         []ApproverConfig     `json:"Approvers"`
+	ApprovalNotifyUrl string               `json:"ApprovalNotifyUrl"`
+	AdminSocketPath   string               `json:"AdminSocketPath"`
+	EvidenceDirPath   string               `json:"EvidenceDirPath"`
+	PushDirPath       string               `json:"PushDirPath"`
+	SplunkHost        string               `json:"SplunkHost"`
+	IngestAddress     string               `json:"IngestAddress"`
+	IngestCertFile    string               `json:"IngestCertFile"`
+	IngestKeyFile     string               `json:"IngestKeyFile"`
+	IngestSources     []IngestSourceConfig `json:"IngestSources"`
+	FieldMappings     []FieldMappingConfig `json:"FieldMappings"`
+	ServerHost        string               `json:"ServerHost"`
+	ServerPort        string               `json:"ServerPort"`
+	TelemetryPort     string               `json:"TelemetryPort"`
+	AgentTokens       []AgentTokenConfig   `json:"AgentTokens"`
+	MaxFileSize       int64                `json:"MaxFileSize"`
+	MaxTransferRate   int64                `json:"MaxTransferRate"`
+	Compression       string               `json:"Compression"`
+	DownloadRetries   int                  `json:"DownloadRetries"`
+	RateLimits        []RateLimitConfig    `json:"RateLimits"`
+	CircuitBreaker    CircuitBreakerConfig `json:"CircuitBreaker"`
+	DedupWindow       string               `json:"DedupWindow"`
+	ResultSinks       []SinkConfig         `json:"ResultSinks"`
+	LocalRulesKeyPath string               `json:"LocalRulesKeyPath"`
+	UnconfirmedPath   string               `json:"UnconfirmedPath"`
+	AgentProfilesPath string               `json:"AgentProfilesPath"`
 }
 
-func init() {
+// This function loads the server config, the rules, playbooks, profiles
+// and result sinks, and creates the connections to agents. It is called by
+// main before the server starts or a command is sent to the server.
+func LoadServerConfig() {
 
 	// Get all values of variables from config file
 	serverConfig := GetServerConfig()
 	parentDirPath = serverConfig.ServerConfig[0].ParentDirPath
 	resultLogPath = serverConfig.ServerConfig[0].ResultLogPath
 	ruleFilePath = serverConfig.ServerConfig[0].RuleFilePath
+	playbookFilePath = serverConfig.ServerConfig[0].PlaybookFilePath
 	appLogPath = serverConfig.ServerConfig[0].AppLogPath
 	agentsConfPath = serverConfig.ServerConfig[0].AgentsConfPath
+	containmentsPath = serverConfig.ServerConfig[0].ContainmentsPath
+	approvalsPath = serverConfig.ServerConfig[0].ApprovalsPath
+	approvers = serverConfig.ServerConfig[0].Approvers
+	approvalNotifyUrl = serverConfig.ServerConfig[0].ApprovalNotifyUrl
+	adminSocketPath = serverConfig.ServerConfig[0].AdminSocketPath
+	evidenceDirPath = serverConfig.ServerConfig[0].EvidenceDirPath
+	pushDirPath = serverConfig.ServerConfig[0].PushDirPath
 	splunkHost = serverConfig.ServerConfig[0].SplunkHost
+	ingestAddress = serverConfig.ServerConfig[0].IngestAddress
+	ingestCertFile = serverConfig.ServerConfig[0].IngestCertFile
+	ingestKeyFile = serverConfig.ServerConfig[0].IngestKeyFile
+	ingestSources = serverConfig.ServerConfig[0].IngestSources
 	serverHost = serverConfig.ServerConfig[0].ServerHost
 	serverPort = serverConfig.ServerConfig[0].ServerPort
+	telemetryPort = serverConfig.ServerConfig[0].TelemetryPort
+	agentTokens = serverConfig.ServerConfig[0].AgentTokens
+	maxFileSize = serverConfig.ServerConfig[0].MaxFileSize
+	maxTransferRate = serverConfig.ServerConfig[0].MaxTransferRate
+	compression = serverConfig.ServerConfig[0].Compression
+	downloadRetries = serverConfig.ServerConfig[0].DownloadRetries
+	rateLimits = serverConfig.ServerConfig[0].RateLimits
+	circuitBreaker = serverConfig.ServerConfig[0].CircuitBreaker
+	localRulesKeyPath = serverConfig.ServerConfig[0].LocalRulesKeyPath
+	unconfirmedPath = serverConfig.ServerConfig[0].UnconfirmedPath
+	agentProfilesPath = serverConfig.ServerConfig[0].AgentProfilesPath
 	sliceAgentConfig = ReadSliceMapString(agentsConfPath)
+	containments = ReadSliceMapString(containmentsPath)
 
-	// Get all rules from rule file
-	rules = ReadSliceMapInterface(ruleFilePath)
+	// an undo that did not finish before the server stopped is sent again
+	for _, containment := range containments {
+		if containment["Status"] == CONTAINMENT_UNDOING {
+			containment["Status"] = CONTAINMENT_ACTIVE
+		}
+	}
+
+	// Default evidence store is next to the downloaded files
+	if evidenceDirPath == "" {
+		evidenceDirPath = filepath.Join(filepath.Dir(parentDirPath), "evidence")
+	}
+	if pushDirPath == "" {
+		pushDirPath = filepath.Join(filepath.Dir(parentDirPath), "push")
+	}
+	if approvalsPath == "" {
+		approvalsPath = filepath.Join(filepath.Dir(containmentsPath), "approvals.conf")
+	}
+	if unconfirmedPath == "" {
+		unconfirmedPath = filepath.Join(filepath.Dir(containmentsPath), "unconfirmed.conf")
+	}
+	if adminSocketPath == "" {
+		adminSocketPath = filepath.Join(filepath.Dir(containmentsPath), "bkedr.sock")
+	}
+	// Dedup is disabled if DedupWindow is not set
+	if window, err := time.ParseDuration(serverConfig.ServerConfig[0].DedupWindow); err == nil {
+		dedupWindow = window
+	}
+	// Default TTL of pending approvals is 1 hour
+	approvalTTL = time.Hour
+	if ttl, err := time.ParseDuration(serverConfig.ServerConfig[0].ApprovalTTL); err == nil {
+		approvalTTL = ttl
+	}
+	if playbookFilePath == "" {
+		playbookFilePath = filepath.Join(filepath.Dir(ruleFilePath), "playbooks.txt")
+	}
+	if agentProfilesPath == "" {
+		agentProfilesPath = filepath.Join(filepath.Dir(ruleFilePath), "profiles.txt")
+	}
+
+	approvals = ReadSliceMapString(approvalsPath)
+	unconfirmed = ReadSliceMapString(unconfirmedPath)
+
+	// Get all rules from rule file, invalid rules are logged and ignored
+	rules = LoadRules(ruleFilePath)
 
 	// Log as JSON instead of the default ASCII formatter.
 	log.SetFormatter(&log.JSONFormatter{})
@@ -103,6 +257,30 @@ func init() {
 	log.SetOutput(f)             // SetOutput sets the standard logger output
 	log.SetLevel(log.DebugLevel) // Only log the debud severity or above.
 
+	// Get all playbooks from playbook file, invalid playbooks are logged
+	playbooks = LoadPlaybooks(playbookFilePath)
+
+	// Get all config profiles of agents, invalid profiles are logged
+	agentProfiles = LoadAgentProfiles(agentProfilesPath)
+
+	// Field mappings of config are used before the defaults of decoders
+	LoadFieldMappings(serverConfig.ServerConfig[0].FieldMappings)
+
+	// Results are written to result log file and result sinks, invalid
+	// sinks are logged
+	resultSinks = append([]ResultSink{&FileSink{config: SinkConfig{
+		Type: "file",
+		Name: "ResultLogPath",
+		Path: resultLogPath,
+	}}}, LoadResultSinks(serverConfig.ServerConfig[0].ResultSinks)...)
+
+	// Local rules are pushed to agents if the signing key is set
+	if localRulesKeyPath != "" {
+		if localRulesKey, err = LoadLocalRulesKey(localRulesKeyPath); err != nil {
+			WriteAppLogError("Error loads local rules key: ", err)
+		}
+	}
+
 	// Create all GRPC dial connection from agent config file
 	CreateGrpcDial()
 }
@@ -160,6 +338,33 @@ func WriteAppLogError(args ...interface{}) {
 	}).Error(args...)
 }
 
+// This function returns the grpc client connection of agent
+func GetClientConn(computerName string) (*grpc.ClientConn, bool) {
+	clientConnsMutex.RLock()
+	defer clientConnsMutex.RUnlock()
+	conn, ok := mapClientConns[computerName]
+	return conn, ok
+}
+
+// This function saves the grpc client connection of agent
+func SetClientConn(computerName string, conn *grpc.ClientConn) {
+	clientConnsMutex.Lock()
+	mapClientConns[computerName] = conn
+	clientConnsMutex.Unlock()
+}
+
+// This function returns a copy of the grpc client connections of agents,
+// so callers can range over it without holding the lock
+func ClientConns() map[string]*grpc.ClientConn {
+	clientConnsMutex.RLock()
+	defer clientConnsMutex.RUnlock()
+	conns := make(map[string]*grpc.ClientConn, len(mapClientConns))
+	for computerName, conn := range mapClientConns {
+		conns[computerName] = conn
+	}
+	return conns
+}
+
 // Create all GRPC dial connection from sliceAgentConfig
 func CreateGrpcDial() {
 
@@ -174,7 +379,7 @@ func CreateGrpcDial() {
 			WriteAppLogError(err)
 		} else {
 			// save grpc client connection to mapClientConns
-			mapClientConns[computerName] = agentConn
+			SetClientConn(computerName, agentConn)
 			WriteAppLogInfo("Success creates dial client connection to " + agentAddress)
 		}
 	}
@@ -200,6 +405,28 @@ func StartServer() {
 	}
 	defer l.Close()
 
+	// Undo containment actions when their TTL expires
+	go WatchContainments()
+	// Expire pending approvals and accept commands of bkedr command line
+	go WatchApprovals()
+	// Write the repeats of responses that are suppressed
+	go WatchDedup()
+	// Reconcile the requests whose RPC failed with the journal of agents
+	go WatchUnconfirmed()
+	// Send results to result sinks in background
+	StartResultSinks()
+	go StartAdminSocket()
+	// Receive events of many sources over HTTP
+	if ingestAddress != "" {
+		go StartIngestServer()
+	}
+	// Receive events that agents collect
+	if telemetryPort != "" {
+		go StartTelemetryServer()
+	}
+	// Agents of agent config file get the current local rules
+	PushLocalRulesAll()
+
 	// Loop is used to listen for incoming connection.
 	for {
 		// Accept waits for and returns the next connection to the listener
@@ -245,6 +472,7 @@ func HandleWindowsConn(conn net.Conn) {
 	computerName := agentConfig["ComputerName"]
 	agentHost := agentConfig["AgentHost"]
 	agentPort := agentConfig["AgentPort"]
+	group := agentConfig["Group"]
 	agentAddress := agentHost + ":" + agentPort
 
 	agentExist := false // variable check agent is exist
@@ -253,10 +481,11 @@ func HandleWindowsConn(conn net.Conn) {
 	for index, agent := range sliceAgentConfig {
 		if agent["ComputerName"] == computerName {
 
-			// If ComputerName already exists, but host or port is change, update old config
-			if agent["AgentHost"] != agentHost || agent["AgentPort"] != agentPort {
+			// If ComputerName already exists, but host, port or group is change, update old config
+			if agent["AgentHost"] != agentHost || agent["AgentPort"] != agentPort || agent["Group"] != group {
 				sliceAgentConfig[index]["AgentHost"] = agentHost
 				sliceAgentConfig[index]["AgentPort"] = agentPort
+				sliceAgentConfig[index]["Group"] = group
 				if err := WriteSliceMapString(agentsConfPath, sliceAgentConfig); err != nil {
 					WriteAppLogError(err)
 				} else {
@@ -284,8 +513,25 @@ func HandleWindowsConn(conn net.Conn) {
 		WriteAppLogError(err)
 	} else {
 		// save grpc client connection to mapClientConns
-		mapClientConns[computerName] = agentConn
+		SetClientConn(computerName, agentConn)
 		WriteAppLogInfo("Success creates dial client connection to " + agentAddress)
+
+		// the agent gets its config profile and the local rules when it
+		// connects
+		go func() {
+			if err := PushAgentProfile(computerName, agentConn); err != nil {
+				WriteAppLogError("Error pushes config profile to "+computerName+": ", err)
+			}
+		}()
+		if localRulesKey != nil {
+			go PushLocalRules(computerName, agentConn)
+		}
+		// the requests whose RPC failed are reconciled when it connects
+		go func() {
+			if err := ReconcileActions(computerName, agentConn, time.Now()); err != nil {
+				WriteAppLogError("Error reconciles actions of "+computerName+": ", err)
+			}
+		}()
 	}
 
 	conn.Close()
@@ -305,45 +551,161 @@ func HandleSplunkConn(conn net.Conn) {
 			break
 		}
 
-		// convert string json to map interface
-		logMapInterface := ConvertJsonToInterface(jsonString)
-
-		// if the key "Rule Action" exists, this log is sent to update rules.
-		if _, ok := logMapInterface["Action Rule"]; ok {
-			if err := HandleRule(jsonString); err != nil {
-				WriteAppLogError(err)
-			}
+		// a command of the administrator ends the connection
+		if HandleLog(jsonString) {
 			break
 		}
+	}
+}
 
-		// convert string json to map string
-		logMapString := ConvertInterfaceToString(logMapInterface)
-		computerName := logMapString["ComputerName"]
-		connRequest := mapClientConns[computerName]
+// This function handles a log received from splunk server or from the HTTP
+// ingestion endpoint. A log is a command of the administrator or an event
+// that is compared with the rules. It returns true if the log is a command
+// of the administrator.
+func HandleLog(jsonString string) bool {
+	return HandleEventLog(jsonString, false)
+}
 
-		// if the key "action" exists, this log is sent by the administrator.
-		if _, ok := logMapString["Action"]; ok {
+// This function handles a log like HandleLog. localHandled is true for an
+// event of telemetry that the agent already compared with its local rules,
+// the responses of local rules are not executed again for it.
+func HandleEventLog(jsonString string, localHandled bool) bool {
 
-			// GRPC Connection has a key in the Map equal to the
-			// ComputerName of the received message
-			connRequest := mapClientConns[computerName]
-			HandleRespone(connRequest, logMapString)
-			break
-			//If not, compare the rule
-		} else {
+	// logs of other formats are normalized into the fields of rules
+	jsonString = NormalizeLog(jsonString)
 
-			//the slice log after filtering rules
-			objRequests := FilterRulesLog(logMapString)
+	// convert string json to map interface
+	logMapInterface := ConvertJsonToInterface(jsonString)
 
-			// check length of the slice log, if it not empty, call response
-			// function for each log
-			if len(objRequests) != 0 {
-				for _, objRequest := range objRequests {
-					HandleRespone(connRequest, objRequest)
-				}
-			}
+	// if the key "Rule Action" exists, this log is sent to update rules.
+	if _, ok := logMapInterface["Action Rule"]; ok {
+		if err := HandleRule(jsonString); err != nil {
+			WriteAppLogError(err)
+		}
+		return true
+	}
+
+	// convert string json to map string
+	logMapString := ConvertInterfaceToString(logMapInterface)
+
+	// if the key "Action Containment" exists, this log is sent to undo
+	// containment actions.
+	if _, ok := logMapString["Action Containment"]; ok {
+		if err := HandleContainment(logMapString); err != nil {
+			WriteAppLogError(err)
+		}
+		return true
+	}
+
+	// if the key "Action Approval" exists, this log is sent to list,
+	// approve or deny the responses that wait for approval.
+	if _, ok := logMapString["Action Approval"]; ok {
+		if err := HandleApproval(logMapString); err != nil {
+			WriteAppLogError(err)
 		}
+		return true
 	}
+
+	// if the key "Action Evidence" exists, this log is sent to show,
+	// verify or export an evidence.
+	if _, ok := logMapString["Action Evidence"]; ok {
+		if err := HandleEvidence(logMapString); err != nil {
+			WriteAppLogError(err)
+		}
+		return true
+	}
+
+	// GRPC Connection has a key in the Map equal to the
+	// ComputerName of the received message
+	computerName := logMapString["ComputerName"]
+	connRequest, connected := GetClientConn(computerName)
+
+	// if the key "action" exists, this log is sent by the administrator.
+	if _, ok := logMapString["Action"]; ok {
+		if !connected {
+			WriteNotConnected(logMapString)
+			return true
+		}
+		HandleRespone(connRequest, logMapString, ResponseOptions{})
+		return true
+	}
+
+	// If not, compare the rule. The keys that only the server and the rules
+	// set are removed first, so an event can not skip the approval, forge
+	// ids or choose the parameters of response (ex: CollectPaths).
+	StripEventKeys(logMapString)
+	objRequests := FilterRulesLog(logMapString)
+	if localHandled {
+		objRequests = FilterRemoteRulesLog(logMapString)
+	}
+
+	// call response function for each log
+	for _, objRequest := range objRequests {
+
+		// a repeat of the same response is counted on the first
+		// response and is not executed
+		if IsDuplicateResponse(objRequest, time.Now()) {
+			continue
+		}
+
+		// a response over a rate limit or of a rule with open
+		// circuit breaker is only written to result log
+		if allowed, reason := AllowResponse(objRequest, time.Now()); !allowed {
+			WriteResultStatus(objRequest, "Skipped", reason)
+			continue
+		}
+		if !connected {
+			WriteNotConnected(objRequest)
+			continue
+		}
+		HandleRespone(connRequest, objRequest, ResponseOptions{Limited: true})
+	}
+	return false
+}
+
+// This function writes the failure of a response whose agent is not
+// connected to result log.
+func WriteNotConnected(objRequest map[string]string) {
+	HandleResult(&rpc.ResponseResult{
+		ResultInfo: "Error: Agent " + objRequest["ComputerName"] + " is not connected",
+		Result:     false,
+	}, objRequest)
+}
+
+// Keys of request that only the server sets
+var internalKeys = []string{"ApprovalId", "Approver", "RequestId", "ContainmentId",
+	"PlaybookExecutionId", "PlaybookStep", "PlaybookStepName", "DedupId", "UndoId",
+	"LocalResponse", "ActionChain", "ActionStep", "OverrideProtection", "OverrideId"}
+
+// Keys of request that set the parameters of response. Rules set them, the
+// administrator sets them in its commands, events never set them.
+var responseKeys = []string{"TTL", "Timeout", "CollectPaths", "MaxDepth", "MaxFileSize",
+	"MaxTotalSize", "Format", "Playbook", "RequiresApproval", "Severity", "SourcePath",
+	"DestinationPath", "Overwrite", "SkipHashes", "Collector"}
+
+// This function removes the keys that only the server and the rules set
+// from the event
+func StripEventKeys(log map[string]string) {
+	for _, key := range internalKeys {
+		delete(log, key)
+	}
+	for _, key := range responseKeys {
+		delete(log, key)
+	}
+}
+
+// Keys of the commands of the administrator
+var adminCommandKeys = []string{"Action Rule", "Action Containment", "Action Approval",
+	"Action Evidence", "Action"}
+
+// This function checks that the log is a command of the administrator
+func IsAdminCommand(logMap map[string]interface{}) bool {
+	for _, key := range adminCommandKeys {
+		if _, ok := logMap[key]; ok {
+			return true
+		}
+	}
+	return false
 }
 
 // This function handle rules base on "Rule Action".
@@ -392,193 +754,244 @@ func HandleRule(ruleString string) error {
 	case "add":
 
 		// add a new rule in the rules file and slice rule
-
+		if err := ValidateRule(ruleInterface); err != nil {
+			return err
+		}
 		rules = append(rules, ruleInterface)
 		if err := WriteMapInterface(ruleFilePath, ruleInterface); err != nil {
 			return err
 		}
 	}
 	WriteAppLogInfo("Success " + ruleAction + " rule")
+
+	// agents get the local rules after every change of rules
+	PushLocalRulesAll()
 	return nil
 }
 
-// This function handle response for each of "Action" or "EventCode"
-// In case "Action" equal "get file" or "disable", we have only one function
-// that send request to agent. Other case, we send request base on EventCode.
-// After receiving ResponseResult, write it to result log file.
-func HandleRespone(clientConn *grpc.ClientConn, objRequest map[string]string) {
-
-	// send request base on "Action" value
-	if objRequest["Action"] == "getfile" { // download file from agent
-		resultFile := RequestGetFile(objRequest, clientConn)
-		HandleResult(resultFile, objRequest)
-
-		// disable network adapter
-	} else if objRequest["Action"] == "disable" || objRequest["Action"] == "enable" {
-		resultNetAdapt := RequestNetworkAdapter(objRequest, clientConn)
-		HandleResult(resultNetAdapt, objRequest)
-
-	} else {
-
-		// send request base on "EventCode" value, then call the HandleResult
-		// function to handle the result
-		switch objRequest["EventCode"] {
-		case "1":
-			resultEvent1 := RequestEventCode1(objRequest, clientConn)
-			HandleResult(resultEvent1, objRequest)
-		case "3":
-			resultEvent3 := RequestEventCode3(objRequest, clientConn)
-			HandleResult(resultEvent3, objRequest)
-		case "7":
-			resultEvent7 := RequestEventCode7(objRequest, clientConn)
-			HandleResult(resultEvent7, objRequest)
-		case "8":
-			resultEvent8 := RequestEventCode8(objRequest, clientConn)
-			HandleResult(resultEvent8, objRequest)
-		case "9":
-			resultEvent9 := RequestEventCode9(objRequest, clientConn)
-			HandleResult(resultEvent9, objRequest)
-		case "10":
-			resultEvent10 := RequestEventCode10(objRequest, clientConn)
-			HandleResult(resultEvent10, objRequest)
-		case "11":
-			resultEvent11 := RequestEventCode11(objRequest, clientConn)
-			HandleResult(resultEvent11, objRequest)
-		case "12":
-			resultEvent12 := RequestEventCode12(objRequest, clientConn)
-			HandleResult(resultEvent12, objRequest)
-		case "13":
-			resultEvent13 := RequestEventCode13(objRequest, clientConn)
-			HandleResult(resultEvent13, objRequest)
-		case "14":
-			resultEvent14 := RequestEventCode14(objRequest, clientConn)
-			HandleResult(resultEvent14, objRequest)
-		default:
-			resultDefault := &rpc.ResponseResult{
-				ResultInfo: "Error: Not support for EventCode" + objRequest["EventCode"],
-				Result:     false,
-			}
-			HandleResult(resultDefault, objRequest)
+// This function reads the rules of rule file. An invalid rule is written to
+// app log and ignored.
+func LoadRules(filePath string) []map[string]interface{} {
+	loaded := make([]map[string]interface{}, 0)
+	for _, rule := range ReadSliceMapInterface(filePath) {
+		if err := ValidateRule(rule); err != nil {
+			WriteAppLogError("Error loads rule ", rule["Message"], ": ", err)
+			continue
 		}
+		loaded = append(loaded, rule)
 	}
+	return loaded
 }
 
-// This function is used to filter the log with the slice of available rules.
-// Function returns a slice of objectRequest that matched rules.
-func FilterRulesLog(log map[string]string) []map[string]string {
-
-	// The pointer of slice is used to add objectRequest when rule capture log
-	objRequests := make([]map[string]string, 0)
-
-	// The for loop is used to retrieve all the rules, then adds an Object
-	// to the slice if the rule matches a log.
-	for _, rule := range rules {
+// This function checks the fields of rule that are used after its action
+// ran, so an invalid field does not fail a containment that is in place.
+func ValidateRule(rule map[string]interface{}) error {
+	if _, ok := rule["Data"].(map[string]interface{}); !ok {
+		return errors.New("Error: rule has no Data")
+	}
+	if value, ok := rule["TTL"]; ok {
+		if _, err := ParseTTL(fmt.Sprintf("%v", value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-		// slice of fields used to match fields in log.
-		ruleRegex := ConvertInterfaceToString(rule["Data"].(map[string]interface{}))
+// ResponseOptions struct is set by the server for a response, never by the
+// fields of log. Limited is set for the responses of rules, the steps of
+// their playbooks are checked by dedup and rate limits like the rules.
+// Approved is set when an approver approved the response.
+type ResponseOptions struct {
+	Limited  bool
+	Approved bool
+}
 
-		// If the event code is not equal, it means that the log is not
-		// related to this rule, continue.
-		if log["EventCode"] != ruleRegex["EventCode"] {
-			continue
+// This function handle response for each of "Action" or "EventCode".
+// After receiving ResponseResult, records the containment if the action
+// can be undone and writes the result to result log file.
+// "Action" can be a chain of actions separated by "," (ex: "dumpmem,kill"),
+// the actions are executed in order and each action has its own result.
+// The chain stops at the first failed action, the next actions are written
+// to result log as skipped.
+// "Action" equal "playbook" runs the steps of playbook "Playbook".
+func HandleRespone(clientConn *grpc.ClientConn, objRequest map[string]string,
+	options ResponseOptions) {
+
+	// response of rule that requires approval is executed after an
+	// approver approves it
+	if objRequest["RequiresApproval"] == "true" && !options.Approved {
+		if err := ParkApproval(objRequest); err != nil {
+			WriteAppLogError(err)
 		}
+		return
+	}
 
-		// check all fields of the rule with fields of log. If the result is true,
-		// we add 1 Object to the Slice
-		if CheckRule(log, ruleRegex) {
-			log["Type"] = fmt.Sprintf("%v", rule["Type"])
-			log["Message"] = fmt.Sprintf("%v", rule["Message"])
-			log["Action"] = fmt.Sprintf("%v", rule["Action"])
-			objRequests = append(objRequests, log)
+	if objRequest["Action"] == "playbook" {
+		RunPlaybook(clientConn, objRequest, options)
+		return
+	}
+
+	if actions := strings.Split(objRequest["Action"], ","); len(actions) > 1 {
+		failedStep := 0
+		for index, action := range actions {
+			step := CopyMapString(objRequest)
+			step["Action"] = strings.TrimSpace(action)
+			step["ActionChain"] = objRequest["Action"]
+			step["ActionStep"] = strconv.Itoa(index + 1)
+			if failedStep != 0 {
+				WriteResultStatus(step, "Skipped", "Error: step "+
+					strconv.Itoa(failedStep)+" of action chain failed")
+				continue
+			}
+			if !HandleAction(clientConn, step) {
+				failedStep = index + 1
+			}
 		}
+		return
 	}
-	return objRequests
+	HandleAction(clientConn, objRequest)
 }
 
-// This function is used to check all fields of the rule with fields of log.
-// Each value of fields of rule is regex. We use regex to catch the fields of log.
-func CheckRule(log map[string]string, ruleRegex map[string]string) bool {
+// This function sends one action to agent, records the containment if the
+// action can be undone and writes the result to result log file. It
+// returns the result of action.
+func HandleAction(clientConn *grpc.ClientConn, objRequest map[string]string) bool {
 
-	// regex match the string begin and end by $ character. This is how we
-	// mark the content between the two $ as the key of a log.
-	// We use this method when we want to check in the log if the value whose
-	// key is the key of the regex with the value whose key is the content
-	// between two $ characters are equal.
-	reSimilar := regexp.MustCompile(`(?m)^\$[a-zA-Z]+\$$`)
+	responseResult := ExecuteRequest(clientConn, objRequest)
 
-	// regex matches strings that start with two $ characters and end with
-	// one $ character. This is how we highlight the content between the $
-	// characters as the key of a log.
-	// We use this method when we want to check in the log if the value whose
-	// key is the key of the regex with the value whose key is the content
-	// between the $ characters are different.
-	reDifferent := regexp.MustCompile(`(?m)^\$\$[a-zA-Z]+\$$`)
+	// keep track of reversible actions so that they can be undone later
+	if responseResult.GetResult() {
+		if err := RecordContainment(objRequest); err != nil {
+			WriteAppLogError(err)
+		}
+	}
+	HandleResult(responseResult, objRequest)
+	return responseResult.GetResult()
+}
 
-	// loop for all key of map ruleRegex
-	for key := range ruleRegex {
+// This function sends the request to agent and returns the ResponseResult.
+// UndoId of the result (quarantine id or registry backup id) is kept in
+// objRequest, the inverse action of containment takes it.
+func ExecuteRequest(clientConn *grpc.ClientConn, objRequest map[string]string) *rpc.ResponseResult {
+	responseResult := SendRequest(clientConn, objRequest)
+	if responseResult.GetUndoId() != "" {
+		objRequest["UndoId"] = responseResult.GetUndoId()
+	}
+	return responseResult
+}
 
-		// check if reSimilar is matched in value of ruleRegex
-		if reSimilar.FindString(ruleRegex[key]) != "" {
+// This function sends the request to agent and returns the ResponseResult.
+// In case "Action" equal "get file" or "disable", we have only one function
+// that send request to agent. Other case, we send request base on EventCode.
+func SendRequest(clientConn *grpc.ClientConn, objRequest map[string]string) *rpc.ResponseResult {
 
-			// content between the two $ characters as the key of a log
-			keyLogSimilar := strings.Replace(ruleRegex[key], "$", "", -1)
+	// send request base on "Action" value
+	switch objRequest["Action"] {
+	case "getfile": // download file from agent
+		return RequestGetFile(objRequest, clientConn)
+	case "disable", "enable": // disable, enable network adapter
+		return RequestNetworkAdapter(objRequest, clientConn)
+	case "isolate", "unisolate": // isolate host, remove isolation
+		return RequestNetworkAdapter(objRequest, clientConn)
+	case "listquarantine": // list quarantined files of agent
+		return RequestListQuarantine(objRequest, clientConn)
+	case "collect": // download an archive of paths and globs from agent
+		return RequestCollect(objRequest, clientConn)
+	case "putfile": // upload a file of push directory to agent
+		return RequestPutFile(objRequest, clientConn)
+	case "triage": // snapshot processes, connections, users, services, autoruns
+		return RequestTriage(objRequest, clientConn)
+	case "dumpmem": // download a memory dump of ProcessId from agent
+		return RequestDumpMemory(objRequest, clientConn)
+	}
 
-			// check if two values of log[key] and log[keyLogSimilar] are equal.
-			// If not equal, log is not catched by ruleRegex, return false.
-			// Otherwise, continue checking to another ruleRegex.
-			if log[key] != log[keyLogSimilar] {
-				return false
-			} else {
-				continue
-			}
+	// send request base on "EventCode" value
+	switch objRequest["EventCode"] {
+	case "1":
+		return RequestEventCode1(objRequest, clientConn)
+	case "3":
+		return RequestEventCode3(objRequest, clientConn)
+	case "7":
+		return RequestEventCode7(objRequest, clientConn)
+	case "8":
+		return RequestEventCode8(objRequest, clientConn)
+	case "9":
+		return RequestEventCode9(objRequest, clientConn)
+	case "10":
+		return RequestEventCode10(objRequest, clientConn)
+	case "11":
+		return RequestEventCode11(objRequest, clientConn)
+	case "12":
+		return RequestEventCode12(objRequest, clientConn)
+	case "13":
+		return RequestEventCode13(objRequest, clientConn)
+	case "14":
+		return RequestEventCode14(objRequest, clientConn)
+	default:
+		return &rpc.ResponseResult{
+			ResultInfo: "Error: Not support for EventCode" + objRequest["EventCode"],
+			Result:     false,
 		}
+	}
+}
 
-		// check if reDifferent is matched in value of ruleRegex
-		if reDifferent.FindString((ruleRegex[key])) != "" {
-
-			// content between the $ characters as the key of a log
-			keyLogDifferent := strings.Replace(ruleRegex[key], "$", "", -1)
-
-			// check if two values of log[key] and log[keyLogDifferent]
-			// are different. If equal, log is not captured by ruleRegex, return
-			// false. Otherwise, continue checking to another ruleRegex.
-			if log[key] == log[keyLogDifferent] {
-				return false
-			} else {
-				continue
-			}
-		}
+// This function returns the context of request to agent. If Timeout of
+// request is a duration (ex: 30s), the request is canceled after it.
+// Each RPC gets a new RequestId, sent in the metadata, the agent journals
+// it. A RequestId that is already in the request (ex: of an event, or of
+// the action that a containment undoes) is replaced, so the reconciliation
+// never matches the journal record of another RPC. The override of
+// protected processes is sent if the administrator authorized it.
+func RequestContext(objRequest map[string]string) (context.Context, context.CancelFunc) {
+	objRequest["RequestId"] = NewId()
+	ctx := metadata.AppendToOutgoingContext(context.Background(),
+		REQUEST_ID_METADATA, objRequest["RequestId"])
+	ctx = OverrideContext(ctx, objRequest)
+	if timeout, err := time.ParseDuration(objRequest["Timeout"]); err == nil && timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
+}
 
-		// if reSimilar and reDifferent is not matched value of ruleRegex,
-		// We check if ruleRegex[key] captures log[key]. If not matched,
-		// log is not captured by ruleRegex, return false.
-		re := regexp.MustCompile(ruleRegex[key])
-		if re.FindString(log[key]) == "" {
-			return false
+// This function returns the failure of a request whose RPC fails. The
+// agent may have executed the action before the connection broke, so the
+// request is reconciled with the action journal of agent later, unless
+// the agent refused the action.
+func RequestError(objRequest map[string]string, err error) *rpc.ResponseResult {
+	if status.Code(err) != codes.PermissionDenied {
+		if err := RecordUnconfirmed(objRequest); err != nil {
+			WriteAppLogError(err)
 		}
 	}
+	return &rpc.ResponseResult{
+		ResultInfo: "Error occurs: " + err.Error(),
+		Result:     false,
+	}
+}
 
-	// return true if all ruleRegex match log.
-	return true
+// This function is used to filter the log with the slice of available rules.
+// Function returns a slice of objectRequest that matched rules.
+func FilterRulesLog(log map[string]string) []map[string]string {
+	return detection.FilterRules(rules, log)
 }
 
 // This function sends the request through function client.ManagerEventCode1()
 // to AgentGRPC Server side and obtains the ResponseResult at a given EventCode1
 func RequestEventCode1(objRequest map[string]string, conn *grpc.ClientConn) *rpc.ResponseResult {
 
+	ctx, cancel := RequestContext(objRequest)
+	defer cancel()
+
 	event1 := &rpc.EventCode1{
 		ProcessId: objRequest["ProcessId"],
 		Action:    objRequest["Action"],
 	}
 	client := rpc.NewManagerClient(conn)
-	event1Result, err := client.ManagerEventCode1(context.Background(), event1)
+	event1Result, err := client.ManagerEventCode1(ctx, event1)
 
 	// If error occurs, ResultInfo is error message and request is failure
 	if err != nil {
-		return &rpc.ResponseResult{
-			ResultInfo: "Error occurs: " + err.Error(),
-			Result:     false,
-		}
+		return RequestError(objRequest, err)
 	}
 	return event1Result
 }
@@ -587,6 +1000,9 @@ func RequestEventCode1(objRequest map[string]string, conn *grpc.ClientConn) *rpc
 // to AgentGRPC Server side and obtains the ResponseResult at a given EventCode3
 func RequestEventCode3(objRequest map[string]string, conn *grpc.ClientConn) *rpc.ResponseResult {
 
+	ctx, cancel := RequestContext(objRequest)
+	defer cancel()
+
 	event3 := &rpc.EventCode3{
 		ProcessId:       objRequest["ProcessId"],
 		SourceIp:        objRequest["SourceIp"],
@@ -596,14 +1012,11 @@ func RequestEventCode3(objRequest map[string]string, conn *grpc.ClientConn) *rpc
 		Action:          objRequest["Action"],
 	}
 	client := rpc.NewManagerClient(conn)
-	event3Result, err := client.ManagerEventCode3(context.Background(), event3)
+	event3Result, err := client.ManagerEventCode3(ctx, event3)
 
 	// If error occurs, ResultInfo is error message and request is failure
 	if err != nil {
-		return &rpc.ResponseResult{
-			ResultInfo: "Error occurs: " + err.Error(),
-			Result:     false,
-		}
+		return RequestError(objRequest, err)
 	}
 	return event3Result
 }
@@ -612,20 +1025,20 @@ func RequestEventCode3(objRequest map[string]string, conn *grpc.ClientConn) *rpc
 // to AgentGRPC Server side and obtains the ResponseResult at a given EventCode7
 func RequestEventCode7(objRequest map[string]string, conn *grpc.ClientConn) *rpc.ResponseResult {
 
+	ctx, cancel := RequestContext(objRequest)
+	defer cancel()
+
 	event7 := &rpc.EventCode7{
 		ProcessId:   objRequest["ProcessId"],
 		ImageLoaded: objRequest["ImageLoaded"],
 		Action:      objRequest["Action"],
 	}
 	client := rpc.NewManagerClient(conn)
-	event7Result, err := client.ManagerEventCode7(context.Background(), event7)
+	event7Result, err := client.ManagerEventCode7(ctx, event7)
 
 	// If error occurs, ResultInfo is error message and request is failure
 	if err != nil {
-		return &rpc.ResponseResult{
-			ResultInfo: "Error occurs: " + err.Error(),
-			Result:     false,
-		}
+		return RequestError(objRequest, err)
 	}
 	return event7Result
 }
@@ -634,19 +1047,19 @@ func RequestEventCode7(objRequest map[string]string, conn *grpc.ClientConn) *rpc
 // to AgentGRPC Server side and obtains the ResponseResult at a given EventCode8
 func RequestEventCode8(objRequest map[string]string, conn *grpc.ClientConn) *rpc.ResponseResult {
 
+	ctx, cancel := RequestContext(objRequest)
+	defer cancel()
+
 	event8 := &rpc.EventCode8{
 		SourceProcessId: objRequest["SourceProcessId"],
 		Action:          objRequest["Action"],
 	}
 	client := rpc.NewManagerClient(conn)
-	event8Result, err := client.ManagerEventCode8(context.Background(), event8)
+	event8Result, err := client.ManagerEventCode8(ctx, event8)
 
 	// If error occurs, ResultInfo is error message and request is failure
 	if err != nil {
-		return &rpc.ResponseResult{
-			ResultInfo: "Error occurs: " + err.Error(),
-			Result:     false,
-		}
+		return RequestError(objRequest, err)
 	}
 	return event8Result
 }
@@ -655,19 +1068,19 @@ func RequestEventCode8(objRequest map[string]string, conn *grpc.ClientConn) *rpc
 // to AgentGRPC Server side and obtains the ResponseResult at a given EventCode9
 func RequestEventCode9(objRequest map[string]string, conn *grpc.ClientConn) *rpc.ResponseResult {
 
+	ctx, cancel := RequestContext(objRequest)
+	defer cancel()
+
 	event9 := &rpc.EventCode9{
 		ProcessId: objRequest["ProcessId"],
 		Action:    objRequest["Action"],
 	}
 	client := rpc.NewManagerClient(conn)
-	event9Result, err := client.ManagerEventCode9(context.Background(), event9)
+	event9Result, err := client.ManagerEventCode9(ctx, event9)
 
 	// If error occurs, ResultInfo is error message and request is failure
 	if err != nil {
-		return &rpc.ResponseResult{
-			ResultInfo: "Error occurs: " + err.Error(),
-			Result:     false,
-		}
+		return RequestError(objRequest, err)
 	}
 	return event9Result
 }
@@ -676,19 +1089,19 @@ func RequestEventCode9(objRequest map[string]string, conn *grpc.ClientConn) *rpc
 // to AgentGRPC Server side and obtains the ResponseResult at a given EventCode10
 func RequestEventCode10(objRequest map[string]string, conn *grpc.ClientConn) *rpc.ResponseResult {
 
+	ctx, cancel := RequestContext(objRequest)
+	defer cancel()
+
 	event10 := &rpc.EventCode10{
 		ProcessId: objRequest["ProcessId"],
 		Action:    objRequest["Action"],
 	}
 	client := rpc.NewManagerClient(conn)
-	event10Result, err := client.ManagerEventCode10(context.Background(), event10)
+	event10Result, err := client.ManagerEventCode10(ctx, event10)
 
 	// If error occurs, ResultInfo is error message and request is failure
 	if err != nil {
-		return &rpc.ResponseResult{
-			ResultInfo: "Error occurs: " + err.Error(),
-			Result:     false,
-		}
+		return RequestError(objRequest, err)
 	}
 	return event10Result
 }
@@ -697,19 +1110,19 @@ func RequestEventCode10(objRequest map[string]string, conn *grpc.ClientConn) *rp
 // to AgentGRPC Server side and obtains the ResponseResult at a given EventCode11
 func RequestEventCode11(objRequest map[string]string, conn *grpc.ClientConn) *rpc.ResponseResult {
 
+	ctx, cancel := RequestContext(objRequest)
+	defer cancel()
+
 	event11 := &rpc.EventCode11{
 		TargetFilename: objRequest["TargetFilename"],
 		Action:         objRequest["Action"],
 	}
 	client := rpc.NewManagerClient(conn)
-	event11Result, err := client.ManagerEventCode11(context.Background(), event11)
+	event11Result, err := client.ManagerEventCode11(ctx, event11)
 
 	// If error occurs, ResultInfo is error message and request is failure
 	if err != nil {
-		return &rpc.ResponseResult{
-			ResultInfo: "Error occurs: " + err.Error(),
-			Result:     false,
-		}
+		return RequestError(objRequest, err)
 	}
 	return event11Result
 }
@@ -718,19 +1131,19 @@ func RequestEventCode11(objRequest map[string]string, conn *grpc.ClientConn) *rp
 // to AgentGRPC Server side and obtains the ResponseResult at a given EventCode12
 func RequestEventCode12(objRequest map[string]string, conn *grpc.ClientConn) *rpc.ResponseResult {
 
+	ctx, cancel := RequestContext(objRequest)
+	defer cancel()
+
 	event12 := &rpc.EventCode12{
 		TargetObject: objRequest["TargetObject"],
 		Action:       objRequest["Action"],
 	}
 	client := rpc.NewManagerClient(conn)
-	event12Result, err := client.ManagerEventCode12(context.Background(), event12)
+	event12Result, err := client.ManagerEventCode12(ctx, event12)
 
 	// If error occurs, ResultInfo is error message and request is failure
 	if err != nil {
-		return &rpc.ResponseResult{
-			ResultInfo: "Error occurs: " + err.Error(),
-			Result:     false,
-		}
+		return RequestError(objRequest, err)
 	}
 	return event12Result
 }
@@ -739,19 +1152,19 @@ func RequestEventCode12(objRequest map[string]string, conn *grpc.ClientConn) *rp
 // to AgentGRPC Server side and obtains the ResponseResult at a given EventCode13
 func RequestEventCode13(objRequest map[string]string, conn *grpc.ClientConn) *rpc.ResponseResult {
 
+	ctx, cancel := RequestContext(objRequest)
+	defer cancel()
+
 	event13 := &rpc.EventCode13{
 		TargetObject: objRequest["TargetObject"],
 		Action:       objRequest["Action"],
 	}
 	client := rpc.NewManagerClient(conn)
-	event13Result, err := client.ManagerEventCode13(context.Background(), event13)
+	event13Result, err := client.ManagerEventCode13(ctx, event13)
 
 	// If error occurs, ResultInfo is error message and request is failure
 	if err != nil {
-		return &rpc.ResponseResult{
-			ResultInfo: "Error occurs: " + err.Error(),
-			Result:     false,
-		}
+		return RequestError(objRequest, err)
 	}
 	return event13Result
 }
@@ -760,6 +1173,9 @@ func RequestEventCode13(objRequest map[string]string, conn *grpc.ClientConn) *rp
 // to AgentGRPC Server side and obtains the ResponseResult at a given EventCode14
 func RequestEventCode14(objRequest map[string]string, conn *grpc.ClientConn) *rpc.ResponseResult {
 
+	ctx, cancel := RequestContext(objRequest)
+	defer cancel()
+
 	event14 := &rpc.EventCode14{
 		EventType:    objRequest["EventType"],
 		TargetObject: objRequest["TargetObject"],
@@ -767,14 +1183,11 @@ func RequestEventCode14(objRequest map[string]string, conn *grpc.ClientConn) *rp
 		Action:       objRequest["Action"],
 	}
 	client := rpc.NewManagerClient(conn)
-	event14Result, err := client.ManagerEventCode14(context.Background(), event14)
+	event14Result, err := client.ManagerEventCode14(ctx, event14)
 
 	// If error occurs, ResultInfo is error message and request is failure
 	if err != nil {
-		return &rpc.ResponseResult{
-			ResultInfo: "Error occurs: " + err.Error(),
-			Result:     false,
-		}
+		return RequestError(objRequest, err)
 	}
 	return event14Result
 }
@@ -783,11 +1196,35 @@ func RequestEventCode14(objRequest map[string]string, conn *grpc.ClientConn) *rp
 // to AgentGRPC Server side and obtains the ResponseResult at a given NetworkAdapter
 func RequestNetworkAdapter(objRequest map[string]string, conn *grpc.ClientConn) *rpc.ResponseResult {
 
+	ctx, cancel := RequestContext(objRequest)
+	defer cancel()
+
 	netAdapter := &rpc.NetworkAdapter{
 		Action: objRequest["Action"],
 	}
 	client := rpc.NewManagerClient(conn)
-	netAdapterResult, err := client.ManagerNetworkAdapter(context.Background(), netAdapter)
+	netAdapterResult, err := client.ManagerNetworkAdapter(ctx, netAdapter)
+
+	// If error occurs, ResultInfo is error message and request is failure
+	if err != nil {
+		return RequestError(objRequest, err)
+	}
+	return netAdapterResult
+}
+
+// This function sends the request through function client.ManagerListQuarantine()
+// to AgentGRPC Server side and obtains the QuarantineList of agent. The
+// quarantined files are added to objRequest as json string.
+func RequestListQuarantine(objRequest map[string]string, conn *grpc.ClientConn) *rpc.ResponseResult {
+
+	ctx, cancel := RequestContext(objRequest)
+	defer cancel()
+
+	query := &rpc.QuarantineQuery{
+		FilePath: objRequest["FilePath"],
+	}
+	client := rpc.NewManagerClient(conn)
+	quarantineList, err := client.ManagerListQuarantine(ctx, query)
 
 	// If error occurs, ResultInfo is error message and request is failure
 	if err != nil {
@@ -796,7 +1233,21 @@ func RequestNetworkAdapter(objRequest map[string]string, conn *grpc.ClientConn)
 			Result:     false,
 		}
 	}
-	return netAdapterResult
+
+	items, err := json.Marshal(quarantineList.GetItems())
+	if err != nil {
+		return &rpc.ResponseResult{
+			ResultInfo: "Error: " + err.Error(),
+			Result:     false,
+		}
+	}
+	objRequest["QuarantineItems"] = string(items)
+
+	return &rpc.ResponseResult{
+		ResultInfo: fmt.Sprintf("List %d quarantined files of %s",
+			len(quarantineList.GetItems()), objRequest["ComputerName"]),
+		Result: true,
+	}
 }
 
 // This function sends the request through function client.ManagerGetFile()
@@ -804,6 +1255,9 @@ func RequestNetworkAdapter(objRequest map[string]string, conn *grpc.ClientConn)
 // given FileInfo. Results are streamed rather than returned at once.
 func RequestGetFile(objRequest map[string]string, grpcClient *grpc.ClientConn) *rpc.ResponseResult {
 
+	ctx, cancel := RequestContext(objRequest)
+	defer cancel()
+
 	var filePath string
 	eventCode := objRequest["EventCode"]
 
@@ -821,14 +1275,73 @@ func RequestGetFile(objRequest map[string]string, grpcClient *grpc.ClientConn) *
 			Result:     false,
 		}
 	}
-	fileInfo := &rpc.FileInfo{
-		FilePath: filePath,
-	}
 	client := rpc.NewManagerClient(grpcClient)
+	fileInfo := NewFileInfo(objRequest["ComputerName"], filePath)
+
+	// Get name of file
+	fileName := SplitName(filePath)
+
+	// Check directory to save file. If directory is not exist, create dir
+	dirPath, err := CreateDir(parentDirPath, objRequest["ComputerName"])
+	if err != nil {
+		return &rpc.ResponseResult{
+			ResultInfo: "Error: " + err.Error(),
+			Result:     false,
+		}
+	}
+
+	// File path to write data from client stream. Data is verified with
+	// the metadata sent by agent and a manifest is written next to file.
+	// If a previous download of file is broken, resume it.
+	manifest := FindPartialDownload(dirPath, objRequest["ComputerName"], filePath)
+	if manifest == nil {
+		manifest = &FileManifest{
+			ComputerName: objRequest["ComputerName"],
+			SourcePath:   filePath,
+			SavedPath:    dirPath + "/" + FormatCurrentDate() + fileName,
+		}
+	}
 
 	// call the function ManagerGetFile() on AgentGRPC Server side and receive
 	// a client stream object. Results are streamed rather than returned at once
-	stream, err := client.ManagerGetFile(context.Background(), fileInfo)
+	if err := DownloadFile(ctx, client, fileInfo, manifest); err != nil {
+		responseResult := RequestError(objRequest, err)
+		responseResult.ResultInfo = "Error: Download file " + fileName + " " +
+			manifest.Status + ": " + err.Error()
+		return responseResult
+	}
+	RecordDownload(manifest, objRequest)
+
+	return &rpc.ResponseResult{
+		ResultInfo: "Download file " + fileName + " successfully, " + manifest.Status +
+			" sha256 " + manifest.ReceivedSha256,
+		Result: true,
+	}
+}
+
+// This function sends the request through function client.ManagerGetFile()
+// with the ProcessId to AgentGRPC Server side and obtains the FileDatas of
+// a memory dump of the process. The dump is requested before the process is
+// killed, so a rule can chain "dumpmem,kill".
+func RequestDumpMemory(objRequest map[string]string, grpcClient *grpc.ClientConn) *rpc.ResponseResult {
+
+	ctx, cancel := RequestContext(objRequest)
+	defer cancel()
+
+	pid, err := strconv.ParseInt(objRequest["ProcessId"], 10, 32)
+	if err != nil || pid <= 0 {
+		return &rpc.ResponseResult{
+			ResultInfo: "Error: ProcessId " + objRequest["ProcessId"] +
+				" is invalid for action dumpmem",
+			Result: false,
+		}
+	}
+	client := rpc.NewManagerClient(grpcClient)
+	fileInfo := NewFileInfo(objRequest["ComputerName"], "")
+	fileInfo.ProcessId = int32(pid)
+
+	// Check directory to save dump. If directory is not exist, create dir
+	dirPath, err := CreateDir(parentDirPath, objRequest["ComputerName"])
 	if err != nil {
 		return &rpc.ResponseResult{
 			ResultInfo: "Error: " + err.Error(),
@@ -836,8 +1349,49 @@ func RequestGetFile(objRequest map[string]string, grpcClient *grpc.ClientConn) *
 		}
 	}
 
-	// Get name of file
-	fileName := SplitName(filePath)
+	// Memory changes between attempts, so a broken dump is not resumed,
+	// the agent always sends a new dump from offset 0
+	manifest := &FileManifest{
+		ComputerName: objRequest["ComputerName"],
+		SourcePath:   "pid:" + objRequest["ProcessId"],
+		SavedPath:    dirPath + "/" + FormatCurrentDate() + "pid" + objRequest["ProcessId"] + ".dmp",
+	}
+	err = ReceiveWithRetries(manifest, func() (FileDataReceiver, error) {
+		return client.ManagerGetFile(ctx, fileInfo)
+	})
+	if err != nil {
+		return &rpc.ResponseResult{
+			ResultInfo: "Error: Dump memory of ProcessId " + objRequest["ProcessId"] + " " +
+				manifest.Status + ": " + err.Error(),
+			Result: false,
+		}
+	}
+	RecordDownload(manifest, objRequest)
+
+	return &rpc.ResponseResult{
+		ResultInfo: "Dump memory of ProcessId " + objRequest["ProcessId"] + " successfully, " +
+			manifest.Status + " sha256 " + manifest.ReceivedSha256,
+		Result: true,
+	}
+}
+
+// This function sends the request through function client.ManagerCollect()
+// to AgentGRPC Server side and obtains the FileDatas of an archive of the
+// files within CollectPaths. CollectPaths is a list of paths and globs
+// separated by ";", environment variables like %TEMP% are expanded by agent.
+func RequestCollect(objRequest map[string]string, grpcClient *grpc.ClientConn) *rpc.ResponseResult {
+
+	ctx, cancel := RequestContext(objRequest)
+	defer cancel()
+
+	collectInfo, err := NewCollectInfo(objRequest)
+	if err != nil {
+		return &rpc.ResponseResult{
+			ResultInfo: "Error: " + err.Error(),
+			Result:     false,
+		}
+	}
+	client := rpc.NewManagerClient(grpcClient)
 
 	// Check directory to save file. If directory is not exist, create dir
 	dirPath, err := CreateDir(parentDirPath, objRequest["ComputerName"])
@@ -848,43 +1402,158 @@ func RequestGetFile(objRequest map[string]string, grpcClient *grpc.ClientConn) *
 		}
 	}
 
-	// File path to write data from client stream.
-	fileSave := dirPath + "/" + FormatCurrentDate() + fileName
-	f, err := os.Create(fileSave)
+	// Archive is saved like a downloaded file, the manifest of archive
+	// contains the list of collected files
+	fileName := "collect.zip"
+	if collectInfo.Format == "tar" {
+		fileName = "collect.tar.gz"
+	}
+	manifest := &FileManifest{
+		ComputerName: objRequest["ComputerName"],
+		SourcePath:   objRequest["CollectPaths"],
+		SavedPath:    dirPath + "/" + FormatCurrentDate() + fileName,
+	}
+
+	// call the function ManagerCollect() on AgentGRPC Server side and receive
+	// a client stream object. Results are streamed rather than returned at once
+	err = ReceiveWithRetries(manifest, func() (FileDataReceiver, error) {
+		return client.ManagerCollect(ctx, collectInfo)
+	})
+	if err != nil {
+		responseResult := RequestError(objRequest, err)
+		responseResult.ResultInfo = "Error: Collect " + objRequest["CollectPaths"] + " " +
+			manifest.Status + ": " + err.Error()
+		return responseResult
+	}
+	RecordDownload(manifest, objRequest)
+
+	return &rpc.ResponseResult{
+		ResultInfo: "Collect " + objRequest["CollectPaths"] + " successfully, " +
+			manifest.Status + " sha256 " + manifest.ReceivedSha256,
+		Result: true,
+	}
+}
+
+// This function sends the file SourcePath of push directory through
+// function client.ManagerPutFile() to AgentGRPC Server side. The agent
+// writes the file to DestinationPath if this path is allowed, and replaces
+// an existing file only if Overwrite is "true".
+func RequestPutFile(objRequest map[string]string, grpcClient *grpc.ClientConn) *rpc.ResponseResult {
+
+	ctx, cancel := RequestContext(objRequest)
+	defer cancel()
+
+	// Source path can not leave the push directory
+	sourcePath := filepath.Join(pushDirPath, filepath.Clean("/"+objRequest["SourcePath"]))
+	destinationPath := objRequest["DestinationPath"]
+	if objRequest["SourcePath"] == "" || destinationPath == "" {
+		return &rpc.ResponseResult{
+			ResultInfo: "Error: SourcePath and DestinationPath are required for action putfile",
+			Result:     false,
+		}
+	}
+
+	fileMeta, err := GetFileMeta(sourcePath)
 	if err != nil {
 		return &rpc.ResponseResult{
 			ResultInfo: "Error: " + err.Error(),
 			Result:     false,
 		}
 	}
-	defer f.Close()
+	fileMeta.FilePath = destinationPath
+	fileMeta.Overwrite = objRequest["Overwrite"] == "true"
+	objRequest["Sha256"] = fileMeta.Sha256
 
-	// this loop receives and writes message into filesave util the stream is done.
-	// It returns io.EOF when the stream completes successfully. On any other
-	// error, the stream is aborted and the error contains the RPC status.
-	for {
-		chunkData, err := stream.Recv()
-		if err == io.EOF { // the stream is done, break
-			break
+	client := rpc.NewManagerClient(grpcClient)
+
+	// call the function ManagerPutFile() on AgentGRPC Server side and send
+	// the metadata, then the content of file. Result is returned at once
+	// when the stream is closed. If the stream breaks, the agent may have
+	// written the file, the request is reconciled with its journal.
+	stream, err := client.ManagerPutFile(ctx)
+	if err != nil {
+		return RequestError(objRequest, err)
+	}
+	if err := SendFile(stream, fileMeta, sourcePath); err != nil {
+		return RequestError(objRequest, err)
+	}
+
+	responseResult, err := stream.CloseAndRecv()
+	if err != nil {
+		return RequestError(objRequest, err)
+	}
+	return responseResult
+}
+
+// This function sends the request through function client.ManagerTriage()
+// to AgentGRPC Server side and obtains a JSON snapshot of the host. The
+// snapshot is saved in the directory of agent and recorded as evidence, its
+// path is written with the result record. Hashes of process images are
+// skipped if SkipHashes is "true".
+func RequestTriage(objRequest map[string]string, grpcClient *grpc.ClientConn) *rpc.ResponseResult {
+
+	ctx, cancel := RequestContext(objRequest)
+	defer cancel()
+
+	client := rpc.NewManagerClient(grpcClient)
+
+	// Check directory to save snapshot. If directory is not exist, create dir
+	dirPath, err := CreateDir(parentDirPath, objRequest["ComputerName"])
+	if err != nil {
+		return &rpc.ResponseResult{
+			ResultInfo: "Error: " + err.Error(),
+			Result:     false,
 		}
-		if err != nil { // return error
-			return &rpc.ResponseResult{
-				ResultInfo: "Error: " + err.Error(),
-				Result:     false,
-			}
+	}
+
+	startTime := FormatCurrentDateMilisecond()
+	snapshot, err := client.ManagerTriage(ctx, &rpc.TriageQuery{
+		SkipHashes: objRequest["SkipHashes"] == "true",
+	})
+	if err != nil {
+		responseResult := RequestError(objRequest, err)
+		responseResult.ResultInfo = "Error: Triage " + objRequest["ComputerName"] + ": " +
+			err.Error()
+		return responseResult
+	}
+
+	savedPath := dirPath + "/" + FormatCurrentDate() + "triage.json"
+	if err := ioutil.WriteFile(savedPath, []byte(snapshot.GetSnapshot()), 0644); err != nil {
+		return &rpc.ResponseResult{
+			ResultInfo: "Error: " + err.Error(),
+			Result:     false,
 		}
-		_, err = f.Write(chunkData.FileChunk)
-		if err != nil {
-			return &rpc.ResponseResult{
-				ResultInfo: "Error: " + err.Error(),
-				Result:     false,
-			}
+	}
+	fileMeta, err := GetFileMeta(savedPath)
+	if err != nil {
+		return &rpc.ResponseResult{
+			ResultInfo: "Error: " + err.Error(),
+			Result:     false,
 		}
 	}
 
+	manifest := &FileManifest{
+		ComputerName:   objRequest["ComputerName"],
+		SourcePath:     "triage",
+		SavedPath:      savedPath,
+		Size:           fileMeta.Size,
+		Sha256:         fileMeta.Sha256,
+		Md5:            fileMeta.Md5,
+		ReceivedSize:   fileMeta.Size,
+		ReceivedSha256: fileMeta.Sha256,
+		ReceivedMd5:    fileMeta.Md5,
+		Attempts:       1,
+		Status:         FILE_VERIFIED,
+		StartTime:      startTime,
+		EndTime:        FormatCurrentDateMilisecond(),
+	}
+	objRequest["TriagePath"] = savedPath
+	RecordDownload(manifest, objRequest)
+
 	return &rpc.ResponseResult{
-		ResultInfo: "Download file " + fileName + " successfully",
-		Result:     true,
+		ResultInfo: "Triage " + objRequest["ComputerName"] + " successfully, saved " +
+			savedPath + " sha256 " + fileMeta.Sha256,
+		Result: true,
 	}
 }
 
@@ -892,6 +1561,9 @@ func RequestGetFile(objRequest map[string]string, grpcClient *grpc.ClientConn) *
 func HandleResult(responseResult *rpc.ResponseResult, objRequest map[string]string) {
 
 	objRequest["ResultInfo"] = responseResult.GetResultInfo()
+	if responseResult.GetDenyReason() != "" {
+		objRequest["DenyReason"] = responseResult.GetDenyReason()
+	}
 
 	// if result vaule is true, set log result is success,
 	// otherwise set log result is failure
@@ -902,9 +1574,16 @@ func HandleResult(responseResult *rpc.ResponseResult, objRequest map[string]stri
 	}
 	objRequest["ResultTime"] = FormatCurrentDateMilisecond()
 
-	// write result log to log file
-	err := WriteMapString(resultLogPath, objRequest)
-	if err != nil {
-		WriteAppLogError(err)
-	}
+	// write result log to log file and result sinks
+	WriteResultLog(objRequest)
+}
+
+// This function writes the result of a response that is not executed
+// (ex: Pending, Skipped) to result log file
+func WriteResultStatus(objRequest map[string]string, result string, resultInfo string) {
+
+	objRequest["ResultInfo"] = resultInfo
+	objRequest["Result"] = result
+	objRequest["ResultTime"] = FormatCurrentDateMilisecond()
+	WriteResultLog(objRequest)
 }
@@ -0,0 +1,55 @@
+/**
+ * File:    server_test.go
+ *
+ * Summary of File:
+ *
+ * 	This file contains the tests of the server.
+ * 	Functions:
+ * 	Testing that the connections of agents are saved and read by many
+ *	goroutines at once, run with -race.
+ */
+
+package server
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"google.golang.org/grpc"
+)
+
+// This function tests that the connections of agents are saved while other
+// goroutines read them and range over them, like HandleWindowsConn does
+// while the rules are pushed to all agents.
+func TestClientConnsConcurrent(t *testing.T) {
+	defer func(saved map[string]*grpc.ClientConn) {
+		mapClientConns = saved
+	}(mapClientConns)
+	mapClientConns = make(map[string]*grpc.ClientConn)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		computerName := "DESKTOP-" + strconv.Itoa(i)
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			SetClientConn(computerName, &grpc.ClientConn{})
+		}()
+		go func() {
+			defer wg.Done()
+			GetClientConn(computerName)
+			for range ClientConns() {
+			}
+		}()
+	}
+	wg.Wait()
+
+	conns := ClientConns()
+	if len(conns) != 8 {
+		t.Fatalf("got %d connections, want 8", len(conns))
+	}
+	if _, ok := GetClientConn("DESKTOP-3"); !ok {
+		t.Fatalf("connection of DESKTOP-3 is not saved")
+	}
+}
@@ -0,0 +1,269 @@
+/**
+ * File:    sink.go
+ *
+ * Summary of File:
+ *
+ * 	This file contains the code related to the result sinks of the bkedr
+ * 	server. A result sink is an output of the results of responses, the
+ *	result log file is the first result sink.
+ * 	Functions:
+ * 	Creating the result sinks of server config.
+ * 	Filtering the results of each sink by Result and by severity.
+ * 	Writing each result to all result sinks.
+ * 	File sink: appending the results to a file, one JSON per line.
+ */
+
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ResultSink is an output of the results of responses. WriteResult must
+// not block the response, a sink sends its results in background after
+// Start is called.
+type ResultSink interface {
+	Name() string
+	Start()
+	WriteResult(result map[string]string) error
+	Flush() error
+}
+
+// SinkConfig struct is used to decode json of a result sink. Type is the
+// kind of sink (file, hec, syslog, webhook, elasticsearch), the other
+// fields are used by some kinds of sink. Results is a list of Result values
+// separated by "," (ex: Failure), empty is all results. MinSeverity is the
+// lowest severity of results sent to the sink, empty is all severities.
+type SinkConfig struct {
+	Type               string `json:"Type"`
+	Name               string `json:"Name"`
+	Results            string `json:"Results"`
+	MinSeverity        string `json:"MinSeverity"`
+	Path               string `json:"Path"`
+	Url                string `json:"Url"`
+	Token              string `json:"Token"`
+	Index              string `json:"Index"`
+	Source             string `json:"Source"`
+	Sourcetype         string `json:"Sourcetype"`
+	Facility           int    `json:"Facility"`
+	Template           string `json:"Template"`
+	ContentType        string `json:"ContentType"`
+	BatchSize          int    `json:"BatchSize"`
+	FlushInterval      string `json:"FlushInterval"`
+	MaxRetries         int    `json:"MaxRetries"`
+	RetryBackoff       string `json:"RetryBackoff"`
+	SpoolPath          string `json:"SpoolPath"`
+	MaxSpoolSize       int64  `json:"MaxSpoolSize"`
+	DeadLetterPath     string `json:"DeadLetterPath"`
+	CaFile             string `json:"CaFile"`
+	InsecureSkipVerify bool   `json:"InsecureSkipVerify"`
+}
+
+// Severities of results, from the lowest
+var severityLevels = []string{"info", "low", "medium", "high", "critical"}
+
+// Result sinks of server config
+var resultSinks = make([]ResultSink, 0)
+
+// This function creates the result sinks of configs. An invalid sink is
+// written to app log and ignored.
+func LoadResultSinks(configs []SinkConfig) []ResultSink {
+
+	sinks := make([]ResultSink, 0, len(configs))
+	for _, config := range configs {
+		sink, err := NewResultSink(config)
+		if err != nil {
+			WriteAppLogError("Error loads result sink "+config.Name+": ", err)
+			continue
+		}
+		sinks = append(sinks, sink)
+	}
+	return sinks
+}
+
+// This function creates the result sink of config by its Type
+func NewResultSink(config SinkConfig) (ResultSink, error) {
+	if config.MinSeverity != "" && SeverityLevel(config.MinSeverity) < 0 {
+		return nil, errors.New("MinSeverity " + config.MinSeverity + " is not a severity")
+	}
+	switch config.Type {
+	case "file":
+		return NewFileSink(config)
+	case "hec":
+		return NewHecSink(config)
+	case "syslog":
+		return NewSyslogSink(config)
+	case "webhook":
+		return NewWebhookSink(config)
+	case "elasticsearch":
+		return NewElasticSink(config)
+	default:
+		return nil, errors.New("type " + config.Type + " of result sink is not supported")
+	}
+}
+
+// This function starts sending the results of all result sinks
+func StartResultSinks() {
+	for _, sink := range resultSinks {
+		sink.Start()
+		WriteAppLogInfo("Starting result sink " + sink.Name())
+	}
+}
+
+// This function writes the result of response to all result sinks
+func WriteResultLog(objRequest map[string]string) {
+	for _, sink := range resultSinks {
+		if err := sink.WriteResult(objRequest); err != nil {
+			WriteAppLogError("Error writes result to sink "+sink.Name()+": ", err)
+		}
+	}
+}
+
+// This function returns the TLS config of sink. CaFile is the certificate
+// authority of the sink server, the system pool is used if it is empty.
+func SinkTlsConfig(config SinkConfig) (*tls.Config, error) {
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: config.InsecureSkipVerify}
+	if config.CaFile == "" {
+		return tlsConfig, nil
+	}
+	caData, err := ioutil.ReadFile(config.CaFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caData) {
+		return nil, errors.New("no certificate in " + config.CaFile)
+	}
+	tlsConfig.RootCAs = pool
+	return tlsConfig, nil
+}
+
+// This function returns the HTTP client of sink
+func NewSinkHttpClient(config SinkConfig) (*http.Client, error) {
+
+	tlsConfig, err := SinkTlsConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}, nil
+}
+
+// This function checks the HTTP response of a sink server, text is the
+// beginning of its body. It returns whether the error can be retried: a
+// busy or a server error.
+func CheckHttpResponse(response *http.Response, text []byte) (bool, error) {
+
+	if response.StatusCode >= 200 && response.StatusCode < 300 {
+		return false, nil
+	}
+	err := errors.New(response.Request.URL.Host + " returns " + response.Status + ": " +
+		strings.TrimSpace(string(text)))
+	retry := response.StatusCode == http.StatusTooManyRequests ||
+		response.StatusCode >= http.StatusInternalServerError
+	return retry, err
+}
+
+// This function returns the time of result, it is ResultTime or now
+func ResultEventTime(result map[string]string) time.Time {
+	if resultTime, err := ParseDateMilisecond(result["ResultTime"]); err == nil {
+		return resultTime
+	}
+	return time.Now()
+}
+
+// This function returns the index of severity in severityLevels, or -1
+func SeverityLevel(severity string) int {
+	for index, level := range severityLevels {
+		if strings.EqualFold(level, severity) {
+			return index
+		}
+	}
+	return -1
+}
+
+// This function returns the severity of result. It is the Severity of rule,
+// otherwise a failure is high and other results are info.
+func ResultSeverity(result map[string]string) string {
+	if level := SeverityLevel(result["Severity"]); level >= 0 {
+		return severityLevels[level]
+	}
+	if result["Result"] == "Failure" {
+		return "high"
+	}
+	return "info"
+}
+
+// This function checks that the result matches Results and MinSeverity of
+// the sink.
+func MatchSinkFilter(config SinkConfig, result map[string]string) bool {
+
+	if strings.TrimSpace(config.Results) != "" {
+		match := false
+		for _, value := range strings.Split(config.Results, ",") {
+			if strings.EqualFold(strings.TrimSpace(value), result["Result"]) {
+				match = true
+				break
+			}
+		}
+		if !match {
+			return false
+		}
+	}
+	if config.MinSeverity != "" &&
+		SeverityLevel(ResultSeverity(result)) < SeverityLevel(config.MinSeverity) {
+		return false
+	}
+	return true
+}
+
+// FileSink struct appends the results to a file, one JSON per line. The
+// result log file is a file sink.
+type FileSink struct {
+	config SinkConfig
+}
+
+// This function creates the file sink of config
+func NewFileSink(config SinkConfig) (*FileSink, error) {
+
+	if config.Path == "" {
+		return nil, errors.New("Path of file sink is required")
+	}
+	if config.Name == "" {
+		config.Name = config.Path
+	}
+	return &FileSink{config: config}, nil
+}
+
+// This function returns the name of sink
+func (sink *FileSink) Name() string {
+	return sink.config.Name
+}
+
+// This function does nothing, the results are written when they are
+// received.
+func (sink *FileSink) Start() {
+}
+
+// This function appends the result to the file if it matches the filter
+// of sink.
+func (sink *FileSink) WriteResult(result map[string]string) error {
+	if !MatchSinkFilter(sink.config, result) {
+		return nil
+	}
+	return WriteMapString(sink.config.Path, result)
+}
+
+// This function does nothing, the results are not buffered
+func (sink *FileSink) Flush() error {
+	return nil
+}
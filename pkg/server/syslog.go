@@ -0,0 +1,160 @@
+/**
+ * File:    syslog.go
+ *
+ * Summary of File:
+ *
+ * 	This file contains the code of the syslog result sink. The results are
+ * 	sent as RFC 5424 messages over UDP, TCP or TLS.
+ * 	Functions:
+ * 	Formatting a result as a RFC 5424 message, the message is the JSON of
+ *	result and the severity of message is the severity of result.
+ * 	Sending the messages of a batch, with octet counting framing (RFC 6587)
+ *	over TCP and TLS. The connection is opened again after an error.
+ */
+
+package server
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Default facility of syslog messages, local0
+const SYSLOG_FACILITY_LOCAL0 = 16
+
+// Syslog severity of each severity of result
+var syslogSeverities = map[string]int{
+	"info":     6,
+	"low":      5,
+	"medium":   4,
+	"high":     3,
+	"critical": 2,
+}
+
+// SyslogSender struct sends the messages of results to a syslog server.
+// Network is udp, tcp or tls.
+type SyslogSender struct {
+	config    SinkConfig
+	network   string
+	address   string
+	tlsConfig *tls.Config
+	hostname  string
+	conn      net.Conn
+}
+
+// This function creates the syslog sink of config. Url is
+// udp://host:port, tcp://host:port or tls://host:port. Facility is local0
+// (16) by default. Messages are sent every FlushInterval, 1s by default.
+func NewSyslogSink(config SinkConfig) (*BatchSink, error) {
+
+	address, err := url.Parse(config.Url)
+	if err != nil {
+		return nil, err
+	}
+	switch address.Scheme {
+	case "udp", "tcp", "tls":
+	default:
+		return nil, errors.New("Url of syslog sink must be udp://, tcp:// or tls://host:port")
+	}
+	if address.Port() == "" {
+		return nil, errors.New("Url of syslog sink has no port")
+	}
+	if config.Facility <= 0 || config.Facility > 23 {
+		config.Facility = SYSLOG_FACILITY_LOCAL0
+	}
+	if config.FlushInterval == "" {
+		config.FlushInterval = "1s"
+	}
+
+	sender := &SyslogSender{
+		config:  config,
+		network: address.Scheme,
+		address: address.Host,
+	}
+	if sender.network == "tls" {
+		if sender.tlsConfig, err = SinkTlsConfig(config); err != nil {
+			return nil, err
+		}
+		sender.tlsConfig.ServerName = address.Hostname()
+	}
+	if sender.hostname, err = os.Hostname(); err != nil {
+		sender.hostname = "bkedrServer"
+	}
+	return NewBatchSink(config, sender), nil
+}
+
+// This function returns the RFC 5424 message of result. MSGID is the
+// action of result and the message is the JSON of result.
+func (sender *SyslogSender) Encode(result map[string]string) ([]byte, error) {
+
+	message, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+	priority := sender.config.Facility*8 + syslogSeverities[ResultSeverity(result)]
+	header := "<" + strconv.Itoa(priority) + ">1 " +
+		ResultEventTime(result).Format("2006-01-02T15:04:05.000Z07:00") + " " +
+		SyslogField(sender.hostname, 255) + " bkedr " + strconv.Itoa(os.Getpid()) + " " +
+		SyslogField(result["Action"], 32) + " - "
+	return append([]byte(header), message...), nil
+}
+
+// This function sends the messages of batch, one datagram per message over
+// UDP and one frame per message over TCP and TLS. A network error can be
+// retried, the connection is opened again.
+func (sender *SyslogSender) Send(batch [][]byte) (bool, error) {
+
+	if sender.conn == nil {
+		dialer := &net.Dialer{Timeout: 10 * time.Second}
+		var err error
+		if sender.network == "tls" {
+			sender.conn, err = tls.DialWithDialer(dialer, "tcp", sender.address, sender.tlsConfig)
+		} else {
+			sender.conn, err = dialer.Dial(sender.network, sender.address)
+		}
+		if err != nil {
+			sender.conn = nil
+			return true, err
+		}
+	}
+
+	sender.conn.SetWriteDeadline(time.Now().Add(30 * time.Second))
+	for _, message := range batch {
+		frame := message
+		if sender.network != "udp" {
+			frame = append([]byte(strconv.Itoa(len(message))+" "), message...)
+		}
+		if _, err := sender.conn.Write(frame); err != nil {
+			sender.conn.Close()
+			sender.conn = nil
+			return true, err
+		}
+	}
+	return false, nil
+}
+
+// This function returns value as a header field of RFC 5424: printable
+// ASCII without space, at most max characters, "-" if it is empty.
+func SyslogField(value string, max int) string {
+
+	field := strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' {
+			return '_'
+		}
+		return r
+	}, value)
+	if len(field) > max {
+		field = field[:max]
+	}
+	if field == "" {
+		return "-"
+	}
+	return field
+}
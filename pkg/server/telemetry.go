@@ -0,0 +1,193 @@
+/**
+ * File:    telemetry.go
+ *
+ * Summary of File:
+ *
+ * 	This file contains the code of the telemetry service of the bkedr
+ * 	server. Agents collect Sysmon events and stream them to the server,
+ *	without Splunk in between.
+ * 	Functions:
+ * 	Starting the gRPC server of the telemetry service on TelemetryPort.
+ * 	Authenticating agents with their tokens of AgentTokens.
+ * 	Receiving the batches of events of agent, decompressing them and
+ *	handling each event like a log of splunk server.
+ */
+
+package server
+
+import (
+	"bkedr/pkg/rpc"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// Max size of the events of a batch after decompression, 64 MB
+	MAX_EVENT_BATCH_SIZE = 64 << 20
+	// Metadata of telemetry that contains the token of agent
+	AGENT_TOKEN_METADATA = "bkedr-agent-token"
+)
+
+// AgentTokenConfig struct is the token of an agent for the telemetry
+// service. TokenSha256 is the SHA-256 of the token, the agent that has the
+// token is ComputerName.
+type AgentTokenConfig struct {
+	ComputerName string `json:"ComputerName"`
+	TokenSha256  string `json:"TokenSha256"`
+}
+
+// TelemetryService is the implementation of Telemetry gRPC service
+type TelemetryService struct {
+	rpc.UnimplementedTelemetryServer
+}
+
+// This function starts the gRPC server of telemetry service on
+// serverHost:telemetryPort.
+func StartTelemetryServer() {
+
+	telemetryAddress := serverHost + ":" + telemetryPort
+	if len(agentTokens) == 0 {
+		WriteAppLogError("Telemetry has no AgentTokens, agents cannot send events")
+	}
+	l, err := net.Listen("tcp", telemetryAddress)
+	if err != nil {
+		WriteAppLogError("Error listening telemetry: ", err)
+		return
+	}
+	grpcServer := grpc.NewServer()
+	rpc.RegisterTelemetryServer(grpcServer, &TelemetryService{})
+	WriteAppLogInfo("Starting telemetry on " + telemetryAddress)
+	if err := grpcServer.Serve(l); err != nil {
+		WriteAppLogError("Error serving telemetry: ", err)
+	}
+}
+
+// This function returns the ComputerName of the agent whose token is in
+// the metadata of ctx. An agent sends events and results only with its own
+// ComputerName, the ComputerName of a batch is not trusted.
+func AuthenticateAgent(ctx context.Context) (string, error) {
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	tokens := md.Get(AGENT_TOKEN_METADATA)
+	if len(tokens) == 0 || tokens[0] == "" {
+		return "", status.Error(codes.Unauthenticated, "agent token is missing")
+	}
+
+	hash := sha256.Sum256([]byte(tokens[0]))
+	tokenSha256 := []byte(hex.EncodeToString(hash[:]))
+	for _, agentToken := range agentTokens {
+		if agentToken.ComputerName == "" {
+			continue
+		}
+		if subtle.ConstantTimeCompare(tokenSha256, []byte(agentToken.TokenSha256)) == 1 {
+			return agentToken.ComputerName, nil
+		}
+	}
+	return "", status.Error(codes.Unauthenticated, "agent token is not valid")
+}
+
+// TelemetryStream function implementation of gRPC Service.
+// This function receives the batches of events of an agent until the agent
+// closes the stream. The agent is authenticated with its token, a batch of
+// another ComputerName ends the stream. Each event gets the ComputerName of
+// agent and is compared with the rules, the responses of local rules are
+// not executed for the events that the agent handled locally. Agents cannot
+// send commands of administrator.
+func (*TelemetryService) TelemetryStream(stream rpc.Telemetry_TelemetryStreamServer) error {
+
+	computerName, err := AuthenticateAgent(stream.Context())
+	if err != nil {
+		WriteAppLogError("Error authenticates telemetry: ", err)
+		return err
+	}
+
+	var received int64
+	for {
+		batch, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(&rpc.TelemetryAck{
+				Received:   received,
+				ResultInfo: "Received " + strconv.FormatInt(received, 10) + " events",
+			})
+		}
+		if err != nil {
+			WriteAppLogError("Error receives telemetry of "+computerName+": ", err)
+			return err
+		}
+
+		if batch.GetComputerName() != computerName {
+			WriteAppLogError("Agent " + computerName + " sends telemetry of " +
+				batch.GetComputerName())
+			return status.Error(codes.PermissionDenied,
+				"batch of "+batch.GetComputerName()+" is not allowed for "+computerName)
+		}
+		events, err := DecodeEventBatch(batch)
+		if err != nil {
+			WriteAppLogError("Error decodes telemetry of "+computerName+": ", err)
+			return err
+		}
+		overrides := map[string]string{"ComputerName": computerName}
+		localHandled := batch.GetLocalHandled()
+		for index, event := range events {
+			jsonString, ok := NormalizeSourceEvent(event, "telemetry", overrides, false)
+			if !ok {
+				WriteAppLogError("Agent " + computerName + " is not allowed to send commands")
+				continue
+			}
+			HandleEventLog(jsonString, index < len(localHandled) && localHandled[index])
+		}
+		received += int64(len(events))
+	}
+}
+
+// This function returns the raw events of batch. Events of batch is the
+// JSON array of events, compressed with gzip or not compressed.
+func DecodeEventBatch(batch *rpc.EventBatch) ([]string, error) {
+
+	if batch.GetComputerName() == "" {
+		return nil, errors.New("batch has no ComputerName")
+	}
+
+	data := batch.GetEvents()
+	switch batch.GetCompression() {
+	case "":
+	case "gzip":
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		// a batch larger than the limit is an error, not truncated
+		data, err = ioutil.ReadAll(io.LimitReader(reader, MAX_EVENT_BATCH_SIZE+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(data) > MAX_EVENT_BATCH_SIZE {
+			return nil, errors.New("batch is larger than " +
+				strconv.Itoa(MAX_EVENT_BATCH_SIZE) + " bytes")
+		}
+	default:
+		return nil, errors.New("compression " + batch.GetCompression() + " is not supported")
+	}
+
+	events := make([]string, 0, batch.GetCount())
+	if err := json.Unmarshal(data, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
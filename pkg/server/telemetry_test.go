@@ -0,0 +1,162 @@
+/**
+ * File:    telemetry_test.go
+ *
+ * Summary of File:
+ *
+ * 	This file contains the tests of the authentication of agents by the
+ *	telemetry service.
+ * 	Functions:
+ * 	Testing that a stream or an upload without a valid token is rejected,
+ *	and that an agent cannot send the events or the local results of
+ *	another ComputerName.
+ * 	Testing that the events that the agent handled locally are compared
+ *	only with the rules that are not local.
+ */
+
+package server
+
+import (
+	"bkedr/pkg/agent"
+	"bkedr/pkg/rpc"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"reflect"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// This function starts the telemetry service with the token of agent
+// computerName, and returns the client connection to it
+func newTelemetryService(t *testing.T, computerName string, token string) *grpc.ClientConn {
+
+	hash := sha256.Sum256([]byte(token))
+	oldTokens := agentTokens
+	agentTokens = []AgentTokenConfig{{ComputerName: computerName, TokenSha256: hex.EncodeToString(hash[:])}}
+	t.Cleanup(func() { agentTokens = oldTokens })
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	grpcServer := grpc.NewServer()
+	rpc.RegisterTelemetryServer(grpcServer, &TelemetryService{})
+	go grpcServer.Serve(listener)
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.Dial(listener.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// This function tests that the telemetry stream accepts only the batches
+// of the agent of token
+func TestTelemetryStreamAuthentication(t *testing.T) {
+
+	conn := newTelemetryService(t, "DESKTOP-1", "token-1")
+	cases := []struct {
+		name         string
+		token        string
+		computerName string
+		code         codes.Code
+	}{
+		{"no token", "", "DESKTOP-1", codes.Unauthenticated},
+		{"wrong token", "token-2", "DESKTOP-1", codes.Unauthenticated},
+		{"other agent", "token-1", "DESKTOP-2", codes.PermissionDenied},
+		{"own agent", "token-1", "DESKTOP-1", codes.OK},
+	}
+	for _, c := range cases {
+		ctx := context.Background()
+		if c.token != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, AGENT_TOKEN_METADATA, c.token)
+		}
+		stream, err := rpc.NewTelemetryClient(conn).TelemetryStream(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		batch, err := agent.EncodeEventBatch(c.computerName, &agent.TelemetryBatch{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the server may end the stream before the batch is sent
+		stream.Send(batch)
+		_, err = stream.CloseAndRecv()
+		if status.Code(err) != c.code {
+			t.Errorf("%s: got %v, want %v", c.name, err, c.code)
+		}
+	}
+}
+
+// This function tests that the upload of local results accepts only the
+// results of the agent of token
+func TestUploadResultsAuthentication(t *testing.T) {
+
+	conn := newTelemetryService(t, "DESKTOP-1", "token-1")
+	results := []string{
+		`{"ComputerName":"DESKTOP-1","Action":"kill","ProcessId":"100","Result":"Failed"}`,
+		`{"ComputerName":"DESKTOP-2","Action":"kill","ProcessId":"200","Result":"Failed"}`,
+	}
+	cases := []struct {
+		name         string
+		token        string
+		computerName string
+		code         codes.Code
+		received     int64
+	}{
+		{"no token", "", "DESKTOP-1", codes.Unauthenticated, 0},
+		{"other agent", "token-1", "DESKTOP-2", codes.PermissionDenied, 0},
+		{"own agent", "token-1", "DESKTOP-1", codes.OK, 1},
+	}
+	for _, c := range cases {
+		ctx := context.Background()
+		if c.token != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, AGENT_TOKEN_METADATA, c.token)
+		}
+		ack, err := rpc.NewTelemetryClient(conn).UploadResults(ctx, &rpc.ResultBatch{
+			ComputerName: c.computerName,
+			Results:      results,
+		})
+		if status.Code(err) != c.code {
+			t.Errorf("%s: got %v, want %v", c.name, err, c.code)
+			continue
+		}
+		if ack.GetReceived() != c.received {
+			t.Errorf("%s: got %d results, want %d", c.name, ack.GetReceived(), c.received)
+		}
+	}
+}
+
+// This function tests that an event handled locally by the agent matches
+// only the rules that are not local
+func TestFilterRemoteRulesLog(t *testing.T) {
+
+	oldRules := rules
+	t.Cleanup(func() { rules = oldRules })
+	data := map[string]interface{}{"EventCode": "1", "Image": ".*cmd.exe"}
+	rules = []map[string]interface{}{
+		{"Type": "process", "Message": "local kill", "Action": "kill", "Local": true, "Data": data},
+		{"Type": "process", "Message": "remote getfile", "Action": "getfile", "Data": data},
+		{"Type": "process", "Message": "kill", "Action": "kill", "Data": data},
+	}
+	log := map[string]string{"EventCode": "1", "Image": `C:\Windows\System32\cmd.exe`, "ProcessId": "4312"}
+
+	if objRequests := FilterRulesLog(log); len(objRequests) != 3 {
+		t.Fatalf("event matches %d rules, want 3", len(objRequests))
+	}
+	objRequests := FilterRemoteRulesLog(log)
+	messages := make([]string, 0)
+	for _, objRequest := range objRequests {
+		messages = append(messages, objRequest["Message"])
+	}
+	if want := []string{"remote getfile", "kill"}; !reflect.DeepEqual(messages, want) {
+		t.Errorf("handled event matches %v, want %v", messages, want)
+	}
+}
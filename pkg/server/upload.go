@@ -0,0 +1,97 @@
+/**
+ * File:    upload.go
+ *
+ * Summary of File:
+ *
+ * 	This file contains the code related to the files pushed to agent.
+ * 	Functions:
+ * 	Computing metadata of file: size and hashes, that is sent to the agent
+ *	before the content of file, so the agent can verify the file.
+ * 	Sending the file to agent in chunks.
+ */
+
+package server
+
+import (
+	"bkedr/pkg/rpc"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"time"
+)
+
+// 64KiB, max length of chunk
+const FILE_CHUNK_SIZE = 64 * 1024
+
+// This function reads the file and returns its metadata with size,
+// SHA-256, MD5 and modification time.
+func GetFileMeta(filePath string) (*rpc.FileMeta, error) {
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	// compute both hashes in one read
+	sha256Hash := sha256.New()
+	md5Hash := md5.New()
+	size, err := io.Copy(io.MultiWriter(sha256Hash, md5Hash), file)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rpc.FileMeta{
+		FilePath: filePath,
+		Size:     size,
+		Sha256:   hex.EncodeToString(sha256Hash.Sum(nil)),
+		Md5:      hex.EncodeToString(md5Hash.Sum(nil)),
+		ModTime:  info.ModTime().Format(time.RFC3339Nano),
+	}, nil
+}
+
+// This function sends the metadata, then the content of file filePath in
+// chunks of FILE_CHUNK_SIZE bytes. If the agent rejects the file and closes
+// the stream, sending stops and the result of agent is returned by
+// CloseAndRecv.
+func SendFile(stream rpc.Manager_ManagerPutFileClient, fileMeta *rpc.FileMeta,
+	filePath string) error {
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// Send metadata of file before the content of file
+	if err := stream.Send(&rpc.FileData{Meta: fileMeta}); err != nil {
+		if err == io.EOF {
+			return nil
+		}
+		return err
+	}
+
+	buff := make([]byte, FILE_CHUNK_SIZE)
+	for {
+		bytesRead, err := file.Read(buff)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(&rpc.FileData{FileChunk: buff[:bytesRead]}); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
@@ -12,6 +12,8 @@
 package server
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -24,6 +26,11 @@ func FormatCurrentDateMilisecond() string {
 	return time.Now().Format("2006-01-02 15:04:05.000")
 }
 
+// The function parses the time formatted in milliseconds
+func ParseDateMilisecond(date string) (time.Time, error) {
+	return time.ParseInLocation("2006-01-02 15:04:05.000", date, time.Local)
+}
+
 // The function returns the formatted time used for the file name
 func FormatCurrentDate() string {
 	return time.Now().Format("20060102_150405_")
@@ -75,6 +82,25 @@ func SplitName(targetObject string) string {
 	return name
 }
 
+// The function returns a copy of map string
+func CopyMapString(mapString map[string]string) map[string]string {
+	copied := make(map[string]string, len(mapString))
+	for key, value := range mapString {
+		copied[key] = value
+	}
+	return copied
+}
+
+// The function checks that the slice contains the string
+func CheckStringInSlice(value string, slice []string) bool {
+	for _, item := range slice {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
 // This function create directory for each windows agent
 func CreateDir(parrentDirPath string, dirName string) (string, error) {
 
@@ -90,3 +116,10 @@ func CreateDir(parrentDirPath string, dirName string) (string, error) {
 	}
 	return dirPath, nil
 }
+
+// This function returns a random identifier in hex format
+func NewId() string {
+	bytes := make([]byte, 8)
+	rand.Read(bytes)
+	return hex.EncodeToString(bytes)
+}
@@ -0,0 +1,116 @@
+/**
+ * File:    webhook.go
+ *
+ * Summary of File:
+ *
+ * 	This file contains the code of the webhook result sink. Each result is
+ * 	posted to an HTTP endpoint (ex: chat, ticketing or SOAR).
+ * 	Functions:
+ * 	Rendering the body of request from the Template of sink with the
+ *	fields of result, the body is the JSON of result by default.
+ * 	Posting the body of each result to the Url of sink.
+ */
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"text/template"
+)
+
+// WebhookSender struct posts the results to the Url of sink
+type WebhookSender struct {
+	config   SinkConfig
+	client   *http.Client
+	template *template.Template
+}
+
+// This function creates the webhook sink of config. Template is a Go
+// template of the body, the fields of result are its data (ex:
+// {{.ComputerName}}) and the function json encodes a value as JSON.
+// ContentType is application/json by default. Token is sent as a bearer
+// token if it is set.
+func NewWebhookSink(config SinkConfig) (*BatchSink, error) {
+
+	if config.Url == "" {
+		return nil, errors.New("Url of webhook sink is required")
+	}
+	client, err := NewSinkHttpClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	sender := &WebhookSender{config: config, client: client}
+	if config.Template != "" {
+		sender.template, err = template.New(config.Name).Funcs(template.FuncMap{
+			"json": func(value interface{}) (string, error) {
+				data, err := json.Marshal(value)
+				return string(data), err
+			},
+		}).Option("missingkey=zero").Parse(config.Template)
+		if err != nil {
+			return nil, err
+		}
+		// a template that cannot be rendered is rejected with the config
+		if err := sender.template.Execute(ioutil.Discard, map[string]string{}); err != nil {
+			return nil, err
+		}
+	}
+	if sender.config.ContentType == "" {
+		sender.config.ContentType = "application/json"
+	}
+	// each result is one request
+	config.BatchSize = 1
+	return NewBatchSink(config, sender), nil
+}
+
+// This function returns the JSON of result, the body is rendered when the
+// result is sent.
+func (sender *WebhookSender) Encode(result map[string]string) ([]byte, error) {
+	return json.Marshal(result)
+}
+
+// This function posts the body of each result of batch. A network error, a
+// busy or a server error can be retried.
+func (sender *WebhookSender) Send(batch [][]byte) (bool, error) {
+
+	for _, event := range batch {
+		body := event
+		if sender.template != nil {
+			result := make(map[string]string)
+			if err := json.Unmarshal(event, &result); err != nil {
+				return false, err
+			}
+			var buffer bytes.Buffer
+			if err := sender.template.Execute(&buffer, result); err != nil {
+				return false, err
+			}
+			body = buffer.Bytes()
+		}
+
+		request, err := http.NewRequest(http.MethodPost, sender.config.Url, bytes.NewReader(body))
+		if err != nil {
+			return false, err
+		}
+		request.Header.Set("Content-Type", sender.config.ContentType)
+		if sender.config.Token != "" {
+			request.Header.Set("Authorization", "Bearer "+sender.config.Token)
+		}
+
+		response, err := sender.client.Do(request)
+		if err != nil {
+			return true, err
+		}
+		text, _ := ioutil.ReadAll(io.LimitReader(response.Body, 1024))
+		response.Body.Close()
+		if retry, err := CheckHttpResponse(response, text); err != nil {
+			return retry, err
+		}
+	}
+	return false, nil
+}